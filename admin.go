@@ -1,10 +1,15 @@
 package llmock
 
 import (
+	"cmp"
 	"encoding/json"
-	"math/rand/v2"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -17,6 +22,9 @@ type requestEntry struct {
 	UserMessage string    `json:"user_message"`
 	MatchedRule string    `json:"matched_rule,omitempty"`
 	Response    string    `json:"response"`
+
+	// Metadata is the request's "metadata" object, if it had one.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // adminState holds the mutable state for the admin API: the live rule list,
@@ -27,10 +35,17 @@ type adminState struct {
 	initialRules []Rule
 	requestLog   []requestEntry
 	markov       *MarkovResponder
-	callCounts   map[int]int // rule index → number of tool call invocations
+	callCounts   map[int]int      // rule index → number of tool call invocations
+	hitCounts    map[int]int      // rule index → number of requests it answered
+	usage        *usageState      // per-key usage, cleared by fullReset
+	assistants   *assistantsState // Assistants API state, cleared by fullReset
+
+	caseInsensitive bool   // WithCaseInsensitive, applied to rules added at runtime
+	seed            *int64 // WithSeed, for previewing shuffle-mode rules
 }
 
 func newAdminState(initial []Rule, markov *MarkovResponder) *adminState {
+	initial = sortRules(initial)
 	cp := make([]Rule, len(initial))
 	copy(cp, initial)
 	return &adminState{
@@ -38,6 +53,7 @@ func newAdminState(initial []Rule, markov *MarkovResponder) *adminState {
 		initialRules: initial,
 		markov:       markov,
 		callCounts:   make(map[int]int),
+		hitCounts:    make(map[int]int),
 	}
 }
 
@@ -51,40 +67,86 @@ func (a *adminState) snapshot() []Rule {
 }
 
 // matchRules tries each rule in order; returns the response and pattern on
-// match, or empty response and string if nothing matched.
-func (a *adminState) matchRules(input string) (Response, string) {
+// match, and whether any rule matched. A matching rule may answer with no
+// text, such as one that only sets a finish reason or media.
+func (a *adminState) matchRules(ctx RespondContext) (Response, string, bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	for i, rule := range a.rules {
-		matches := rule.Pattern.FindStringSubmatch(input)
-		if matches == nil {
-			continue
-		}
-		matchedPattern := rule.Pattern.String()
-		// If this rule specifies a tool call, return a tool call response.
-		if rule.ToolCall != nil {
-			if rule.MaxCalls != nil {
-				count := a.callCounts[i]
-				if count >= *rule.MaxCalls {
-					// Exhausted: fall through to text responses if available.
-					if len(rule.Responses) > 0 {
-						template := rule.Responses[rand.IntN(len(rule.Responses))]
-						text := expandTemplate(template, matches, input, a.markov)
-						return Response{Text: text}, matchedPattern
-					}
-					continue
-				}
-				a.callCounts[i]++
-			}
-			tc := resolveToolCall(*rule.ToolCall, matches, input)
-			return Response{ToolCalls: []ToolCall{tc}}, matchedPattern
-		}
-		template := rule.Responses[rand.IntN(len(rule.Responses))]
-		text := expandTemplate(template, matches, input, a.markov)
-		return Response{Text: text}, matchedPattern
+	resp, idx := findRuleResponse(a.rules, a.callCounts, ctx, a.markov)
+	if idx < 0 {
+		return Response{}, "", false
+	}
+	a.hitCounts[idx]++
+	return resp, a.rules[idx].Pattern.String(), true
+}
+
+// ruleStat is one rule's entry in GET /_mock/rules/stats.
+type ruleStat struct {
+	Index   int    `json:"index"`
+	Pattern string `json:"pattern"`
+	Hits    int    `json:"hits"`
+}
+
+// ruleStats returns how many requests each current rule has answered
+// since the rules or counts were last reset.
+func (a *adminState) ruleStats() []ruleStat {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stats := make([]ruleStat, len(a.rules))
+	for i, r := range a.rules {
+		stats[i] = ruleStat{Index: i, Pattern: r.Pattern.String(), Hits: a.hitCounts[i]}
+	}
+	return stats
+}
+
+// resetRuleStats zeroes the hit counts without touching the rules or their
+// MaxCalls counters.
+func (a *adminState) resetRuleStats() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hitCounts = make(map[int]int)
+}
+
+// matchResult is the JSON body returned by POST /_mock/match.
+type matchResult struct {
+	Matched   bool             `json:"matched"`
+	Index     int              `json:"index"`
+	Pattern   string           `json:"pattern,omitempty"`
+	Groups    []string         `json:"groups,omitempty"`
+	Response  string           `json:"response,omitempty"`
+	ToolCalls []ToolCallConfig `json:"tool_calls,omitempty"`
+}
+
+// explain reports which rule would answer ctx and what it would return,
+// without advancing the MaxCalls counters, shuffle orders, or the Markov
+// RNG.
+func (a *adminState) explain(ctx RespondContext) matchResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	counts := make(map[int]int, len(a.callCounts))
+	for k, v := range a.callCounts {
+		counts[k] = v
+	}
+	ctx.seed = a.seed
+	ctx.dryRun = true
+	resp, idx := findRuleResponse(a.rules, counts, ctx, a.markov.preview())
+	if idx < 0 {
+		return matchResult{Index: -1}
 	}
-	return Response{}, ""
+	rule := a.rules[idx]
+	result := matchResult{
+		Matched:  true,
+		Index:    idx,
+		Pattern:  rule.Pattern.String(),
+		Groups:   rule.Pattern.FindStringSubmatch(extractInput(ctx.Messages))[1:],
+		Response: resp.Text,
+	}
+	for _, tc := range resp.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ToolCallConfig{Name: tc.Name, Arguments: tc.Arguments})
+	}
+	return result
 }
 
 // logRequest appends an entry to the request log, keeping the last 100.
@@ -105,9 +167,12 @@ func (a *adminState) resetRules() {
 	copy(cp, a.initialRules)
 	a.rules = cp
 	a.callCounts = make(map[int]int)
+	a.hitCounts = make(map[int]int)
+	resetShuffles(cp)
 }
 
-// fullReset restores rules and clears the request log.
+// fullReset restores rules and clears the request log, usage, and
+// Assistants API state.
 func (a *adminState) fullReset() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -116,34 +181,46 @@ func (a *adminState) fullReset() {
 	a.rules = cp
 	a.requestLog = nil
 	a.callCounts = make(map[int]int)
+	a.hitCounts = make(map[int]int)
+	resetShuffles(cp)
+	if a.usage != nil {
+		a.usage.reset()
+	}
+	if a.assistants != nil {
+		a.assistants.reset()
+	}
+}
+
+// replaceRules swaps in a new rule list and makes it the baseline that
+// resets restore to.
+func (a *adminState) replaceRules(rules []Rule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.caseInsensitive {
+		rules = ignoreCase(rules)
+	}
+	rules = sortRules(rules)
+	cp := make([]Rule, len(rules))
+	copy(cp, rules)
+	a.rules = cp
+	a.initialRules = rules
+	a.callCounts = make(map[int]int)
+	a.hitCounts = make(map[int]int)
 }
 
-// addRules inserts rules at the given priority position.
-// priority 0 = prepend (default), -1 = append, positive int = insert at index.
-func (a *adminState) addRules(rules []Rule, priority int) {
+// addRules inserts rules by priority. Added rules go ahead of existing
+// rules of equal priority, so with the default priority of 0 they take
+// precedence over the startup rules.
+func (a *adminState) addRules(rules []Rule) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if a.caseInsensitive {
+		rules = ignoreCase(rules)
+	}
 	// Reset call counts since rule indices will change.
 	a.callCounts = make(map[int]int)
-	switch {
-	case priority == 0:
-		a.rules = append(rules, a.rules...)
-	case priority == -1:
-		a.rules = append(a.rules, rules...)
-	default:
-		idx := priority
-		if idx > len(a.rules) {
-			idx = len(a.rules)
-		}
-		if idx < 0 {
-			idx = 0
-		}
-		result := make([]Rule, 0, len(a.rules)+len(rules))
-		result = append(result, a.rules[:idx]...)
-		result = append(result, rules...)
-		result = append(result, a.rules[idx:]...)
-		a.rules = result
-	}
+	a.hitCounts = make(map[int]int)
+	a.rules = sortRules(append(slices.Clone(rules), a.rules...))
 }
 
 // getRequests returns a copy of the request log.
@@ -172,7 +249,18 @@ func (a *adminState) getRulesJSON() []ruleJSON {
 			Pattern:   r.Pattern.String(),
 			Responses: r.Responses,
 			MaxCalls:  r.MaxCalls,
+			Priority:  r.Priority,
 		}
+		if r.Model != nil {
+			out[i].Model = r.Model.String()
+		}
+		if r.User != nil {
+			out[i].User = r.User.String()
+		}
+		out[i].FinishReason = r.FinishReason
+		out[i].Blocks = r.Blocks
+		out[i].Preamble = r.Preamble
+		out[i].Mode = r.Mode
 	}
 	return out
 }
@@ -182,6 +270,14 @@ type ruleJSON struct {
 	Pattern   string   `json:"pattern"`
 	Responses []string `json:"responses"`
 	MaxCalls  *int     `json:"max_calls,omitempty"`
+	Model     string   `json:"model,omitempty"`
+	User      string   `json:"user,omitempty"`
+	Priority  int      `json:"priority,omitempty"`
+
+	FinishReason string   `json:"finish_reason,omitempty"`
+	Blocks       []string `json:"blocks,omitempty"`
+	Preamble     string   `json:"preamble,omitempty"`
+	Mode         string   `json:"mode,omitempty"`
 }
 
 // addRulesRequest is the JSON body for POST /_mock/rules.
@@ -193,6 +289,8 @@ type addRuleEntry struct {
 	Pattern   string   `json:"pattern"`
 	Responses []string `json:"responses"`
 	Priority  *int     `json:"priority,omitempty"`
+	Model     string   `json:"model,omitempty"`
+	User      string   `json:"user,omitempty"`
 }
 
 // adminResponder is a Responder that uses the adminState for rule matching
@@ -200,24 +298,41 @@ type addRuleEntry struct {
 type adminResponder struct {
 	state    *adminState
 	fallback Responder
+	initial  Responder // the configured responder, kept for /_mock/config
 
 	mu              sync.Mutex
 	lastMatchedRule string
 }
 
 func (ar *adminResponder) Respond(messages []InternalMessage) (Response, error) {
-	input := extractInput(messages)
+	return ar.RespondWithContext(RespondContext{Messages: messages})
+}
+
+func (ar *adminResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	input := extractInput(ctx.Messages)
 	if input == "" {
 		return Response{}, errNoMessages
 	}
-	resp, matched := ar.state.matchRules(input)
+	resp, matched, ok := ar.state.matchRules(ctx)
 	ar.mu.Lock()
 	ar.lastMatchedRule = matched
+	fallback := ar.fallback
 	ar.mu.Unlock()
-	if resp.Text != "" || resp.IsToolCall() {
+	if ok {
 		return resp, nil
 	}
-	return ar.fallback.Respond(messages)
+	return respondWith(fallback, ctx)
+}
+
+// dropRuleFallback replaces a RuleResponder fallback with the server's
+// no-match responder. Used after the admin rules are swapped out, since the
+// original RuleResponder still holds the old rules.
+func (ar *adminResponder) dropRuleFallback(noMatch Responder) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if _, ok := ar.fallback.(*RuleResponder); ok {
+		ar.fallback = noMatch
+	}
 }
 
 func (ar *adminResponder) getLastMatchedRule() string {
@@ -229,11 +344,49 @@ func (ar *adminResponder) getLastMatchedRule() string {
 // registerFaultRoutes adds the /_mock/faults endpoints to the mux.
 func registerFaultRoutes(mux *http.ServeMux, fs *faultState) {
 	mux.HandleFunc("GET /_mock/faults", func(w http.ResponseWriter, r *http.Request) {
-		faults := fs.getFaults()
+		faults := fs.entries()
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"faults": faults})
 	})
 
+	mux.HandleFunc("PATCH /_mock/faults/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid fault id: "+r.PathValue("id"))
+			return
+		}
+		patch, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reading body: "+err.Error())
+			return
+		}
+		f, err := fs.update(id, patch)
+		if errors.Is(err, errFaultNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no active fault with id %d", id))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(faultEntry{ID: id, Fault: f})
+	})
+
+	mux.HandleFunc("DELETE /_mock/faults/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid fault id: "+r.PathValue("id"))
+			return
+		}
+		if !fs.remove(id) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no active fault with id %d", id))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
 	mux.HandleFunc("POST /_mock/faults", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Faults []Fault `json:"faults"`
@@ -249,6 +402,10 @@ func registerFaultRoutes(mux *http.ServeMux, fs *faultState) {
 			writeError(w, http.StatusBadRequest, "faults array is required and must not be empty")
 			return
 		}
+		if err := validateFaults(req.Faults); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
 		fs.addFaults(req.Faults)
 		w.Header().Set("Content-Type", "application/json")
@@ -283,7 +440,6 @@ func registerAdminRoutes(mux *http.ServeMux, state *adminState) {
 		}
 
 		compiled := make([]Rule, 0, len(req.Rules))
-		priority := 0 // default: prepend
 		for i, entry := range req.Rules {
 			re, err := regexp.Compile(entry.Pattern)
 			if err != nil {
@@ -294,13 +450,34 @@ func registerAdminRoutes(mux *http.ServeMux, state *adminState) {
 				writeError(w, http.StatusBadRequest, "rule must have at least one response")
 				return
 			}
-			compiled = append(compiled, Rule{Pattern: re, Responses: entry.Responses})
+			for _, resp := range entry.Responses {
+				if err := validateTemplate(resp); err != nil {
+					writeError(w, http.StatusBadRequest, "invalid response template: "+err.Error())
+					return
+				}
+			}
+			rule := Rule{Pattern: re, Responses: entry.Responses}
+			if entry.Model != "" {
+				rule.Model, err = regexp.Compile(entry.Model)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "invalid model regex: "+err.Error())
+					return
+				}
+			}
+			if entry.User != "" {
+				rule.User, err = regexp.Compile(entry.User)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "invalid user regex: "+err.Error())
+					return
+				}
+			}
 			if entry.Priority != nil {
-				priority = *entry.Priority
+				rule.Priority = *entry.Priority
 			}
+			compiled = append(compiled, rule)
 		}
 
-		state.addRules(compiled, priority)
+		state.addRules(compiled)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -312,6 +489,46 @@ func registerAdminRoutes(mux *http.ServeMux, state *adminState) {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 
+	mux.HandleFunc("GET /_mock/rules/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"rules": state.ruleStats()})
+	})
+
+	mux.HandleFunc("DELETE /_mock/rules/stats", func(w http.ResponseWriter, r *http.Request) {
+		state.resetRuleStats()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("POST /_mock/match", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input    string `json:"input"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+			Model string `json:"model"`
+			User  string `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		ctx := RespondContext{Model: req.Model, User: req.User, Session: r.Header.Get(sessionHeader)}
+		for _, m := range req.Messages {
+			ctx.Messages = append(ctx.Messages, InternalMessage{Role: m.Role, Content: m.Content})
+		}
+		if req.Input != "" {
+			ctx.Messages = append(ctx.Messages, InternalMessage{Role: "user", Content: req.Input})
+		}
+		if extractInput(ctx.Messages) == "" {
+			writeError(w, http.StatusBadRequest, "input or messages is required")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.explain(ctx))
+	})
+
 	mux.HandleFunc("POST /_mock/reset", func(w http.ResponseWriter, r *http.Request) {
 		state.fullReset()
 		w.Header().Set("Content-Type", "application/json")
@@ -330,3 +547,97 @@ func registerAdminRoutes(mux *http.ServeMux, state *adminState) {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 }
+
+// effectiveConfig is the JSON body of GET /_mock/config.
+type effectiveConfig struct {
+	Responder      string          `json:"responder"`
+	Rules          ruleSummaryJSON `json:"rules"`
+	Faults         []Fault         `json:"faults"`
+	FaultSelection string          `json:"fault_selection"`
+	TokenDelayMS   int64           `json:"token_delay_ms"`
+	Seed           *int64          `json:"seed"`
+	Randomized     bool            `json:"randomized"`
+	Corpus         string          `json:"corpus"`
+	NoMatch        string          `json:"no_match"`
+	Strict         bool            `json:"strict"`
+	Verbose        bool            `json:"verbose"`
+	MCPTools       []string        `json:"mcp_tools,omitempty"`
+	Endpoints      map[string]bool `json:"endpoints"`
+	Warnings       []string        `json:"warnings,omitempty"` // see RuleWarnings
+}
+
+type ruleSummaryJSON struct {
+	Count    int      `json:"count"`
+	Patterns []string `json:"patterns"`
+}
+
+// handleMockConfig serves GET /_mock/config: the settings the server is
+// actually running with, after config files, includes, and options.
+func (s *Server) handleMockConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := effectiveConfig{
+		Responder:      "rules",
+		Faults:         s.faults.getFaults(),
+		FaultSelection: FaultSelectionFirst,
+		TokenDelayMS:   s.getTokenDelay().Milliseconds(),
+		Seed:           s.seed,
+		Randomized:     s.seed == nil,
+		Corpus:         s.markov.corpusSource(),
+		NoMatch:        cmp.Or(s.noMatch.Mode, NoMatchMarkov),
+		Strict:         s.strictMatching,
+		Verbose:        s.verbose.Load(),
+		Endpoints: map[string]bool{
+			"rerank":     s.rerankEnabled,
+			"realtime":   s.realtimeEnabled,
+			"assistants": s.assistantsEnabled,
+			"mcp":        s.mcpEnabled,
+		},
+	}
+	if s.faultSelection != "" {
+		cfg.FaultSelection = s.faultSelection
+	}
+	if ar, ok := s.responder.(*adminResponder); ok {
+		if _, ok := ar.initial.(*RuleResponder); !ok {
+			cfg.Responder = fmt.Sprintf("%T", ar.initial)
+		}
+	}
+	for _, rule := range s.admin.getRulesJSON() {
+		cfg.Rules.Patterns = append(cfg.Rules.Patterns, rule.Pattern)
+	}
+	cfg.Rules.Count = len(cfg.Rules.Patterns)
+	cfg.Warnings = RuleWarnings(s.admin.snapshot())
+	if s.mcp != nil {
+		for _, t := range s.mcp.getTools() {
+			cfg.MCPTools = append(cfg.MCPTools, t.Name)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// verboseJSON is the body of GET and POST /_mock/verbose.
+type verboseJSON struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// handleGetVerbose serves GET /_mock/verbose: whether request logging is on.
+func (s *Server) handleGetVerbose(w http.ResponseWriter, r *http.Request) {
+	enabled := s.verbose.Load()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verboseJSON{Enabled: &enabled})
+}
+
+// handleSetVerbose serves POST /_mock/verbose, turning request logging on or
+// off without restarting the server.
+func (s *Server) handleSetVerbose(w http.ResponseWriter, r *http.Request) {
+	var req verboseJSON
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	s.verbose.Store(*req.Enabled)
+	s.handleGetVerbose(w, r)
+}
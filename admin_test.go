@@ -1,9 +1,14 @@
 package llmock_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -82,6 +87,49 @@ func TestAdmin_InjectRule_AppendPriority(t *testing.T) {
 	}
 }
 
+func TestAdmin_InjectRule_MidPriority(t *testing.T) {
+	ts := newAdminServer(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`deploy`), Responses: []string{"high"}, Priority: 10},
+		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"catchall"}},
+	)
+	defer ts.Close()
+
+	// Priority 5 sits between the priority-10 rule and the catchall.
+	body := `{"rules":[{"pattern":".*","responses":["mid"], "priority":5}]}`
+	resp, err := http.Post(ts.URL+"/_mock/rules", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := chatRequest(t, ts, "deploy it").Choices[0].Message.Content; got != "high" {
+		t.Errorf("expected higher-priority rule to win, got %q", got)
+	}
+	if got := chatRequest(t, ts, "anything").Choices[0].Message.Content; got != "mid" {
+		t.Errorf("expected mid-priority rule ahead of catchall, got %q", got)
+	}
+
+	rulesResp, err := http.Get(ts.URL + "/_mock/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rulesResp.Body.Close()
+	var list struct {
+		Rules []struct {
+			Responses []string `json:"responses"`
+			Priority  int      `json:"priority"`
+		} `json:"rules"`
+	}
+	json.NewDecoder(rulesResp.Body).Decode(&list)
+	var order []string
+	for _, r := range list.Rules {
+		order = append(order, r.Responses[0])
+	}
+	if strings.Join(order, ",") != "high,mid,catchall" {
+		t.Errorf("expected rules ordered high,mid,catchall, got %v", order)
+	}
+}
+
 func TestAdmin_GetRules(t *testing.T) {
 	ts := newAdminServer(t,
 		llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}},
@@ -256,6 +304,110 @@ func TestAdmin_RequestLog(t *testing.T) {
 	}
 }
 
+func TestAdmin_Match(t *testing.T) {
+	ts := newAdminServer(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi there"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`my name is (\w+)`), Responses: []string{"Nice to meet you, $1!"}},
+	)
+	defer ts.Close()
+
+	match := func(body string) map[string]any {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/_mock/match", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var result map[string]any
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	result := match(`{"input": "my name is Alice"}`)
+	if result["matched"] != true || result["index"] != float64(1) {
+		t.Errorf("expected rule 1 to match, got %v", result)
+	}
+	if result["pattern"] != `my name is (\w+)` {
+		t.Errorf("unexpected pattern %v", result["pattern"])
+	}
+	if groups, _ := result["groups"].([]any); len(groups) != 1 || groups[0] != "Alice" {
+		t.Errorf("expected groups [Alice], got %v", result["groups"])
+	}
+	if result["response"] != "Nice to meet you, Alice!" {
+		t.Errorf("expected expanded response, got %v", result["response"])
+	}
+
+	result = match(`{"messages": [{"role": "user", "content": "goodbye"}]}`)
+	if result["matched"] != false {
+		t.Errorf("expected no match, got %v", result)
+	}
+
+	// Dry runs are not logged.
+	resp, err := http.Get(ts.URL + "/_mock/requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var log struct {
+		Requests []any `json:"requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&log)
+	if len(log.Requests) != 0 {
+		t.Errorf("expected empty request log, got %d entries", len(log.Requests))
+	}
+}
+
+func TestAdmin_MatchLeavesShuffleOrder(t *testing.T) {
+	s := llmock.New(
+		llmock.WithSeed(3),
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^pick$`), Responses: []string{"one", "two", "three"}, Mode: llmock.ModeShuffle}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	preview := func() string {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/_mock/match", "application/json", strings.NewReader(`{"input": "pick"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Response string `json:"response"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result.Response
+	}
+
+	want := preview()
+	if again := preview(); again != want {
+		t.Fatalf("expected repeated previews to agree, got %q then %q", want, again)
+	}
+	if got := chatRequest(t, ts, "pick").Choices[0].Message.Content; got != want {
+		t.Errorf("expected the request to get the previewed %q, got %q", want, got)
+	}
+	next := preview()
+	if next == want {
+		t.Errorf("expected the preview to move on after a request, still got %q", next)
+	}
+	if got := chatRequest(t, ts, "pick").Choices[0].Message.Content; got != next {
+		t.Errorf("expected the request to get the previewed %q, got %q", next, got)
+	}
+
+	// A reset starts every session's order again.
+	resp, err := http.Post(ts.URL+"/_mock/reset", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := chatRequest(t, ts, "pick").Choices[0].Message.Content; got != want {
+		t.Errorf("expected %q after reset, got %q", want, got)
+	}
+}
+
 func TestAdmin_DeleteRequests(t *testing.T) {
 	ts := newAdminServer(t,
 		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"response"}},
@@ -466,3 +618,254 @@ func TestAdmin_ConcurrentAccess(t *testing.T) {
 	}
 	// If we get here without data races or panics, the test passes.
 }
+
+func TestSetRules_SwapsRulesAndResetBaseline(t *testing.T) {
+	s := llmock.New(llmock.WithRules(
+		llmock.Rule{Pattern: regexp.MustCompile(`^old$`), Responses: []string{"old rule"}},
+	))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	err := s.SetRules([]llmock.Rule{
+		{Pattern: regexp.MustCompile(`^new$`), Responses: []string{"new rule"}},
+	})
+	if err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+
+	if got := chatRequest(t, ts, "new").Choices[0].Message.Content; got != "new rule" {
+		t.Errorf("expected 'new rule', got %q", got)
+	}
+	// The old rule must not fire via the original responder.
+	if got := chatRequest(t, ts, "old").Choices[0].Message.Content; got == "old rule" {
+		t.Error("expected old rule to be gone after SetRules")
+	}
+
+	// Reset restores the swapped-in rules, not the startup rules.
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/_mock/rules", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := chatRequest(t, ts, "new").Choices[0].Message.Content; got != "new rule" {
+		t.Errorf("expected 'new rule' after reset, got %q", got)
+	}
+}
+
+func TestSetRules_AdminDisabled(t *testing.T) {
+	s := llmock.New(llmock.WithAdminAPI(false))
+	if err := s.SetRules(nil); err == nil {
+		t.Error("expected error when admin API is disabled")
+	}
+}
+
+func TestAdmin_Config(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(corpus, []byte("the quick brown fox jumps over the lazy dog"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := llmock.ParseConfig([]byte(`
+defaults:
+  seed: 3
+  token_delay_ms: 25
+corpus_file: `+corpus+`
+rules:
+  - pattern: "^hello$"
+    responses: ["hi"]
+  - pattern: "bye"
+    responses: ["see you"]
+faults:
+  - type: error
+    status: 503
+    probability: 0.1
+`), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := cfg.ToOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(llmock.New(opts...).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/_mock/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Responder string `json:"responder"`
+		Rules     struct {
+			Count    int      `json:"count"`
+			Patterns []string `json:"patterns"`
+		} `json:"rules"`
+		Faults       []llmock.Fault `json:"faults"`
+		TokenDelayMS int            `json:"token_delay_ms"`
+		Seed         *int64         `json:"seed"`
+		Corpus       string         `json:"corpus"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Rules.Count != 2 || got.Rules.Patterns[0] != "^hello$" {
+		t.Errorf("expected the 2 configured rules, got %+v", got.Rules)
+	}
+	if got.Corpus != "file:"+corpus {
+		t.Errorf("expected corpus %q, got %q", "file:"+corpus, got.Corpus)
+	}
+	if got.Responder != "rules" || len(got.Faults) != 1 || got.TokenDelayMS != 25 || got.Seed == nil || *got.Seed != 3 {
+		t.Errorf("unexpected effective config %+v", got)
+	}
+}
+
+func TestAdmin_ToggleVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	s := llmock.New(llmock.WithLogger(log.New(&buf, "", 0)))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	getVerbose := func() bool {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/_mock/verbose")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Enabled
+	}
+
+	if getVerbose() {
+		t.Fatal("expected verbose to start disabled")
+	}
+	resp, err := http.Post(ts.URL+"/_mock/verbose", "application/json", strings.NewReader(`{"enabled":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if !getVerbose() {
+		t.Fatal("expected verbose to be enabled")
+	}
+
+	buf.Reset()
+	chatRequest(t, ts, "hello there")
+	if !strings.Contains(buf.String(), `user="hello there"`) {
+		t.Errorf("expected request to be logged, got: %q", buf.String())
+	}
+
+	resp, err = http.Post(ts.URL+"/_mock/verbose", "application/json", strings.NewReader(`{"enabled":false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if getVerbose() {
+		t.Fatal("expected verbose to be disabled")
+	}
+	buf.Reset()
+	chatRequest(t, ts, "hello again")
+	if buf.Len() != 0 {
+		t.Errorf("expected no log output once disabled, got: %q", buf.String())
+	}
+}
+
+func TestAdmin_RequestLogMetadata(t *testing.T) {
+	ts := newAdminServer(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi there"}},
+	)
+	defer ts.Close()
+
+	var out map[string]any
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","metadata":{"trace_id":"t-1"},"messages":[{"role":"user","content":"hello"}]}`, &out)
+	postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":100,"metadata":{"user_id":"u-42"},"messages":[{"role":"user","content":"hello"}]}`, &out)
+	chatRequest(t, ts, "hello")
+
+	resp, err := http.Get(ts.URL + "/_mock/requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Requests []struct {
+			Metadata map[string]any `json:"metadata"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Requests) != 3 {
+		t.Fatalf("expected 3 request log entries, got %d", len(result.Requests))
+	}
+	if got := result.Requests[0].Metadata["trace_id"]; got != "t-1" {
+		t.Errorf("OpenAI metadata trace_id = %v, want t-1", got)
+	}
+	if got := result.Requests[1].Metadata["user_id"]; got != "u-42" {
+		t.Errorf("Anthropic metadata user_id = %v, want u-42", got)
+	}
+	if result.Requests[2].Metadata != nil {
+		t.Errorf("expected no metadata without one in the request, got %v", result.Requests[2].Metadata)
+	}
+}
+
+func TestAdmin_RuleStats(t *testing.T) {
+	ts := newAdminServer(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi there"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`weather`), Responses: []string{"sunny"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"fallback"}},
+	)
+	defer ts.Close()
+
+	chatRequest(t, ts, "hello")
+	chatRequest(t, ts, "hello")
+	chatRequest(t, ts, "what's the weather?")
+
+	stats := func() map[string]int {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/_mock/rules/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Rules []struct {
+				Pattern string `json:"pattern"`
+				Hits    int    `json:"hits"`
+			} `json:"rules"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		hits := make(map[string]int)
+		for _, r := range result.Rules {
+			hits[r.Pattern] = r.Hits
+		}
+		return hits
+	}
+
+	want := map[string]int{"^hello$": 2, "weather": 1, ".*": 0}
+	if got := stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %v, want %v", got, want)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/_mock/rules/stats", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want = map[string]int{"^hello$": 0, "weather": 0, ".*": 0}
+	if got := stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stats after reset = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,502 @@
+package llmock
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithAssistants enables a minimal in-memory OpenAI Assistants API:
+// assistants, threads, messages, and runs. Runs complete synchronously with
+// a reply from the responder. Tools, file search, attachments, streaming,
+// and run steps are not supported.
+func WithAssistants() Option {
+	return func(s *Server) {
+		s.assistantsEnabled = true
+	}
+}
+
+// Assistant represents an OpenAI assistant.
+type Assistant struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	CreatedAt    int64             `json:"created_at"`
+	Name         *string           `json:"name"`
+	Description  *string           `json:"description"`
+	Model        string            `json:"model"`
+	Instructions *string           `json:"instructions"`
+	Tools        []any             `json:"tools"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+// Thread represents an Assistants API thread.
+type Thread struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"`
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// ThreadMessage represents a message in a thread.
+type ThreadMessage struct {
+	ID          string                 `json:"id"`
+	Object      string                 `json:"object"`
+	CreatedAt   int64                  `json:"created_at"`
+	ThreadID    string                 `json:"thread_id"`
+	Role        string                 `json:"role"`
+	Content     []ThreadMessageContent `json:"content"`
+	AssistantID *string                `json:"assistant_id"`
+	RunID       *string                `json:"run_id"`
+	Attachments []any                  `json:"attachments"`
+	Metadata    map[string]string      `json:"metadata"`
+}
+
+// ThreadMessageContent is a text content part of a thread message.
+type ThreadMessageContent struct {
+	Type string `json:"type"`
+	Text struct {
+		Value       string `json:"value"`
+		Annotations []any  `json:"annotations"`
+	} `json:"text"`
+}
+
+// Run represents an Assistants API run.
+type Run struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	CreatedAt    int64             `json:"created_at"`
+	ThreadID     string            `json:"thread_id"`
+	AssistantID  string            `json:"assistant_id"`
+	Status       string            `json:"status"`
+	StartedAt    *int64            `json:"started_at"`
+	CompletedAt  *int64            `json:"completed_at"`
+	FailedAt     *int64            `json:"failed_at"`
+	LastError    *RunError         `json:"last_error"`
+	Model        string            `json:"model"`
+	Instructions string            `json:"instructions"`
+	Tools        []any             `json:"tools"`
+	Usage        *Usage            `json:"usage"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+// RunError describes why a run failed.
+type RunError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// assistantMessageRequest is the body of POST /v1/threads/{id}/messages,
+// and an entry of a new thread's messages.
+type assistantMessageRequest struct {
+	Role     string            `json:"role"`
+	Content  json.RawMessage   `json:"content"` // string or array of text parts
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// assistantsState holds the assistants, threads, and runs.
+type assistantsState struct {
+	mu         sync.Mutex
+	assistants map[string]*Assistant
+	threads    map[string]*Thread
+	messages   map[string][]ThreadMessage // thread ID → messages, oldest first
+	runs       map[string]*Run
+}
+
+func newAssistantsState() *assistantsState {
+	a := &assistantsState{}
+	a.reset()
+	return a
+}
+
+func (a *assistantsState) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.assistants = make(map[string]*Assistant)
+	a.threads = make(map[string]*Thread)
+	a.messages = make(map[string][]ThreadMessage)
+	a.runs = make(map[string]*Run)
+}
+
+// assistantContentText extracts the text of message content given as a
+// string or as an array of text parts.
+func assistantContentText(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("content must be a string or an array of text parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type != "text" {
+			return "", errors.New("only text content is supported, got " + p.Type)
+		}
+		texts = append(texts, p.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// newThreadMessage builds a text message for a thread.
+func (s *Server) newThreadMessage(threadID, role, text string) ThreadMessage {
+	var c ThreadMessageContent
+	c.Type = "text"
+	c.Text.Value = text
+	c.Text.Annotations = []any{}
+	return ThreadMessage{
+		ID:          s.newID("msg_"),
+		Object:      "thread.message",
+		CreatedAt:   s.now().Unix(),
+		ThreadID:    threadID,
+		Role:        role,
+		Content:     []ThreadMessageContent{c},
+		Attachments: []any{},
+		Metadata:    map[string]string{},
+	}
+}
+
+// addThreadMessage validates req and appends it to the thread. The caller
+// holds s.assistants.mu.
+func (s *Server) addThreadMessage(threadID string, req assistantMessageRequest) (ThreadMessage, error) {
+	if req.Role != "user" && req.Role != "assistant" {
+		return ThreadMessage{}, errors.New("role must be 'user' or 'assistant'")
+	}
+	text, err := assistantContentText(req.Content)
+	if err != nil {
+		return ThreadMessage{}, err
+	}
+	msg := s.newThreadMessage(threadID, req.Role, text)
+	if req.Metadata != nil {
+		msg.Metadata = req.Metadata
+	}
+	s.assistants.messages[threadID] = append(s.assistants.messages[threadID], msg)
+	return msg, nil
+}
+
+func (s *Server) handleCreateAssistant(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model        string            `json:"model"`
+		Name         *string           `json:"name"`
+		Description  *string           `json:"description"`
+		Instructions *string           `json:"instructions"`
+		Tools        []any             `json:"tools"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	if len(req.Tools) > 0 {
+		writeError(w, http.StatusBadRequest, "assistant tools are not supported")
+		return
+	}
+	if req.Metadata == nil {
+		req.Metadata = map[string]string{}
+	}
+	asst := &Assistant{
+		ID:           s.newID("asst_"),
+		Object:       "assistant",
+		CreatedAt:    s.now().Unix(),
+		Name:         req.Name,
+		Description:  req.Description,
+		Model:        req.Model,
+		Instructions: req.Instructions,
+		Tools:        []any{},
+		Metadata:     req.Metadata,
+	}
+	a := s.assistants
+	a.mu.Lock()
+	a.assistants[asst.ID] = asst
+	a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asst)
+}
+
+func (s *Server) handleGetAssistant(w http.ResponseWriter, r *http.Request) {
+	a := s.assistants
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	asst, ok := a.assistants[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such assistant: "+r.PathValue("id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asst)
+}
+
+func (s *Server) handleCreateThread(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []assistantMessageRequest `json:"messages"`
+		Metadata map[string]string         `json:"metadata"`
+	}
+	// An empty body creates an empty thread.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Metadata == nil {
+		req.Metadata = map[string]string{}
+	}
+	thread := &Thread{
+		ID:        s.newID("thread_"),
+		Object:    "thread",
+		CreatedAt: s.now().Unix(),
+		Metadata:  req.Metadata,
+	}
+	a := s.assistants
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, m := range req.Messages {
+		if _, err := s.addThreadMessage(thread.ID, m); err != nil {
+			delete(a.messages, thread.ID)
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	a.threads[thread.ID] = thread
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+func (s *Server) handleGetThread(w http.ResponseWriter, r *http.Request) {
+	a := s.assistants
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	thread, ok := a.threads[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such thread: "+r.PathValue("id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+func (s *Server) handleCreateThreadMessage(w http.ResponseWriter, r *http.Request) {
+	var req assistantMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	a := s.assistants
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	threadID := r.PathValue("id")
+	if _, ok := a.threads[threadID]; !ok {
+		writeError(w, http.StatusNotFound, "no such thread: "+threadID)
+		return
+	}
+	msg, err := s.addThreadMessage(threadID, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// handleListThreadMessages lists a thread's messages, newest first unless
+// ?order=asc. Pagination is limited to ?limit (default 20).
+func (s *Server) handleListThreadMessages(w http.ResponseWriter, r *http.Request) {
+	a := s.assistants
+	a.mu.Lock()
+	threadID := r.PathValue("id")
+	_, ok := a.threads[threadID]
+	msgs := append([]ThreadMessage{}, a.messages[threadID]...)
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such thread: "+threadID)
+		return
+	}
+	if r.URL.Query().Get("order") != "asc" {
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		}
+	}
+	limit := 20
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	hasMore := len(msgs) > limit
+	if hasMore {
+		msgs = msgs[:limit]
+	}
+	resp := map[string]any{
+		"object":   "list",
+		"data":     msgs,
+		"first_id": nil,
+		"last_id":  nil,
+		"has_more": hasMore,
+	}
+	if len(msgs) > 0 {
+		resp["first_id"] = msgs[0].ID
+		resp["last_id"] = msgs[len(msgs)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleCreateRun runs the assistant on the thread synchronously. The
+// response reports the run as queued, as the real API does; polling it
+// returns the finished run.
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AssistantID            string            `json:"assistant_id"`
+		Model                  string            `json:"model"`
+		Instructions           *string           `json:"instructions"`
+		AdditionalInstructions string            `json:"additional_instructions"`
+		Stream                 bool              `json:"stream"`
+		Metadata               map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Stream {
+		writeError(w, http.StatusBadRequest, "streaming runs are not supported")
+		return
+	}
+
+	a := s.assistants
+	a.mu.Lock()
+	threadID := r.PathValue("id")
+	_, threadOK := a.threads[threadID]
+	asst, asstOK := a.assistants[req.AssistantID]
+	var history []ThreadMessage
+	var asstCopy Assistant
+	if asstOK {
+		asstCopy = *asst
+	}
+	history = append(history, a.messages[threadID]...)
+	a.mu.Unlock()
+	if !threadOK {
+		writeError(w, http.StatusNotFound, "no such thread: "+threadID)
+		return
+	}
+	if !asstOK {
+		writeError(w, http.StatusNotFound, "no such assistant: "+req.AssistantID)
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = asstCopy.Model
+	}
+	instructions := ""
+	if asstCopy.Instructions != nil {
+		instructions = *asstCopy.Instructions
+	}
+	if req.Instructions != nil {
+		instructions = *req.Instructions
+	}
+	if req.AdditionalInstructions != "" {
+		instructions = strings.TrimSpace(instructions + "\n" + req.AdditionalInstructions)
+	}
+	if req.Metadata == nil {
+		req.Metadata = map[string]string{}
+	}
+
+	var internal []InternalMessage
+	if instructions != "" {
+		internal = append(internal, InternalMessage{Role: "system", Content: instructions})
+	}
+	for _, m := range history {
+		internal = append(internal, InternalMessage{Role: m.Role, Content: m.Content[0].Text.Value})
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "openai", false) {
+			return
+		}
+	}
+
+	now := s.now().Unix()
+	run := &Run{
+		ID:           s.newID("run_"),
+		Object:       "thread.run",
+		CreatedAt:    now,
+		ThreadID:     threadID,
+		AssistantID:  asstCopy.ID,
+		Status:       "queued",
+		Model:        model,
+		Instructions: instructions,
+		Tools:        []any{},
+		Metadata:     req.Metadata,
+	}
+	queued := *run
+
+	run.StartedAt = &now
+	ctx := RespondContext{
+		Messages: internal,
+		Model:    model,
+		Endpoint: EndpointOpenAI,
+		Session:  threadID,
+	}
+	response, err := s.respond(ctx)
+	var reply *ThreadMessage
+	if err != nil {
+		run.Status = "failed"
+		run.FailedAt = &now
+		run.LastError = &RunError{Code: "server_error", Message: err.Error()}
+	} else {
+		if response.IsToolCall() {
+			response = s.forceTextResponse(response, ctx)
+		}
+		s.logAdminRequest(r, internal, response.Text)
+		msg := s.newThreadMessage(threadID, "assistant", response.Text)
+		msg.AssistantID = &run.AssistantID
+		msg.RunID = &run.ID
+		reply = &msg
+		run.Status = "completed"
+		run.CompletedAt = &now
+		promptTokens := 0
+		for _, m := range internal {
+			promptTokens += countTokens(m.Content)
+		}
+		completionTokens := countTokens(response.Text)
+		run.Usage = &Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+
+	if run.Usage != nil && !s.waitForOutput(r, run.Usage.CompletionTokens) {
+		return
+	}
+
+	a.mu.Lock()
+	if reply != nil {
+		a.messages[threadID] = append(a.messages[threadID], *reply)
+	}
+	a.runs[run.ID] = run
+	a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queued)
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	a := s.assistants
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	run, ok := a.runs[r.PathValue("run_id")]
+	if !ok || run.ThreadID != r.PathValue("id") {
+		writeError(w, http.StatusNotFound, "no such run: "+r.PathValue("run_id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,125 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postAssistants(t *testing.T, ts *httptest.Server, path, body string, out any) int {
+	t.Helper()
+	resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func getAssistants(t *testing.T, ts *httptest.Server, path string, out any) int {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestAssistants_RunHappyPath(t *testing.T) {
+	s := llmock.New(llmock.WithAssistants(), llmock.WithResponder(llmock.EchoResponder{}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var asst, thread struct {
+		ID string `json:"id"`
+	}
+	postAssistants(t, ts, "/v1/assistants", `{"model":"gpt-4o","instructions":"be helpful"}`, &asst)
+	postAssistants(t, ts, "/v1/threads", `{"messages":[{"role":"user","content":"first message"}]}`, &thread)
+	if asst.ID == "" || thread.ID == "" {
+		t.Fatalf("expected ids, got assistant %q thread %q", asst.ID, thread.ID)
+	}
+	code := postAssistants(t, ts, "/v1/threads/"+thread.ID+"/messages",
+		`{"role":"user","content":[{"type":"text","text":"second message"}]}`, nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 adding a message, got %d", code)
+	}
+
+	var run struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Usage  *struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	postAssistants(t, ts, "/v1/threads/"+thread.ID+"/runs", `{"assistant_id":"`+asst.ID+`"}`, &run)
+	if run.Status != "queued" {
+		t.Errorf("expected queued run on create, got %q", run.Status)
+	}
+	getAssistants(t, ts, "/v1/threads/"+thread.ID+"/runs/"+run.ID, &run)
+	if run.Status != "completed" || run.Usage == nil || run.Usage.TotalTokens == 0 {
+		t.Errorf("expected completed run with usage, got %+v", run)
+	}
+
+	var list struct {
+		Data []struct {
+			Role    string `json:"role"`
+			RunID   string `json:"run_id"`
+			Content []struct {
+				Text struct {
+					Value string `json:"value"`
+				} `json:"text"`
+			} `json:"content"`
+		} `json:"data"`
+	}
+	getAssistants(t, ts, "/v1/threads/"+thread.ID+"/messages", &list)
+	if len(list.Data) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(list.Data))
+	}
+	reply := list.Data[0]
+	if reply.Role != "assistant" || reply.RunID != run.ID || reply.Content[0].Text.Value != "second message" {
+		t.Errorf("expected newest message to be the run's reply, got %+v", reply)
+	}
+
+	resp, err := http.Post(ts.URL+"/_mock/reset", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code := getAssistants(t, ts, "/v1/threads/"+thread.ID, nil); code != http.StatusNotFound {
+		t.Errorf("expected thread cleared by reset, got %d", code)
+	}
+}
+
+func TestAssistants_Errors(t *testing.T) {
+	s := llmock.New(llmock.WithAssistants())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var thread struct {
+		ID string `json:"id"`
+	}
+	postAssistants(t, ts, "/v1/threads", ``, &thread)
+	if code := postAssistants(t, ts, "/v1/threads/"+thread.ID+"/runs", `{"assistant_id":"asst_missing"}`, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown assistant, got %d", code)
+	}
+	if code := postAssistants(t, ts, "/v1/assistants", `{"model":"gpt-4o","tools":[{"type":"code_interpreter"}]}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unsupported tools, got %d", code)
+	}
+
+	plain := httptest.NewServer(llmock.New().Handler())
+	defer plain.Close()
+	if code := postAssistants(t, plain, "/v1/assistants", `{"model":"gpt-4o"}`, nil); code == http.StatusOK {
+		t.Error("expected the Assistants API to be disabled by default")
+	}
+}
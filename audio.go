@@ -0,0 +1,83 @@
+package llmock
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// maxAudioUploadMemory bounds how much of a multipart upload is held in
+// memory; the rest spills to temporary files.
+const maxAudioUploadMemory = 32 << 20
+
+// TranscriptionResponse represents an OpenAI audio transcription response.
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// WithTranscription sets a fixed transcript returned by
+// /v1/audio/transcriptions. When unset, the transcript is produced by the
+// responder, with the uploaded filename as the user message.
+func WithTranscription(text string) Option {
+	return func(s *Server) {
+		s.transcription = text
+	}
+}
+
+func (s *Server) handleAudioTranscriptions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxAudioUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form: "+err.Error())
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	// The audio itself is never decoded.
+	file.Close()
+
+	format := r.FormValue("response_format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "text" {
+		writeError(w, http.StatusBadRequest, "response_format must be 'json' or 'text'")
+		return
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(header.Filename); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "openai", false) {
+			return
+		}
+	}
+
+	internal := []InternalMessage{{Role: "user", Content: header.Filename}}
+	text := s.transcription
+	if text == "" {
+		response, err := s.respond(RespondContext{
+			Messages: internal,
+			Model:    r.FormValue("model"),
+			Endpoint: EndpointOpenAI,
+			Session:  r.Header.Get(sessionHeader),
+		})
+		if err != nil {
+			writeError(w, s.responderErrorStatus(err), err.Error())
+			return
+		}
+		text = response.Text
+	}
+
+	s.logAdminRequest(r, internal, text)
+	if !s.waitForOutput(r, countTokens(text)) {
+		return
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TranscriptionResponse{Text: text})
+}
@@ -0,0 +1,85 @@
+package llmock_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postAudio(t *testing.T, ts *httptest.Server, filename string, fields map[string]string) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if filename != "" {
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("RIFF....WAVEfmt "))
+	}
+	mw.Close()
+	resp, err := http.Post(ts.URL+"/v1/audio/transcriptions", mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAudio_RuleMatchesFilename(t *testing.T) {
+	s := llmock.New(llmock.WithRules(
+		llmock.Rule{Pattern: regexp.MustCompile(`order-(\d+)\.wav`), Responses: []string{"I'd like to check order $1."}},
+	))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := postAudio(t, ts, "order-42.wav", map[string]string{"model": "whisper-1"})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result llmock.TranscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "I'd like to check order 42." {
+		t.Errorf("unexpected transcript %q", result.Text)
+	}
+}
+
+func TestAudio_FixedTranscriptionAsText(t *testing.T) {
+	s := llmock.New(llmock.WithTranscription("hello from the mic"))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := postAudio(t, ts, "clip.mp3", map[string]string{"response_format": "text"})
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello from the mic" {
+		t.Errorf("expected plain transcript, got %q", body)
+	}
+}
+
+func TestAudio_MissingFile(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	resp := postAudio(t, ts, "", map[string]string{"model": "whisper-1"})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Contains(body, []byte("file is required")) {
+		t.Errorf("expected clear error, got %s", body)
+	}
+}
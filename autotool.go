@@ -6,6 +6,18 @@ import (
 	"strings"
 )
 
+// withMCPTools returns tools, or the MCP server's tools if tools is empty
+// and WithMCPToolsAsLLMTools is set.
+func (s *Server) withMCPTools(tools []RequestTool) []RequestTool {
+	if len(tools) > 0 || !s.mcpToolsAsLLMTools || s.mcp == nil {
+		return tools
+	}
+	for _, t := range s.mcp.getTools() {
+		tools = append(tools, RequestTool{Name: t.Name, Parameters: t.InputSchema})
+	}
+	return tools
+}
+
 // generateToolCallFromSchema picks a tool from the request and generates
 // arguments conforming to its JSON schema. The rng is used for all random
 // choices. If tools is empty, returns an empty ToolCall and false.
@@ -43,9 +55,10 @@ func generateFromSchema(schema map[string]any, rng *rand.Rand) any {
 		}
 	}
 
+	// Gemini schemas spell types in upper case ("OBJECT").
 	typ, _ := schema["type"].(string)
 
-	switch typ {
+	switch strings.ToLower(typ) {
 	case "object":
 		return generateObject(schema, rng)
 	case "array":
@@ -529,3 +529,33 @@ func TestAutoTool_EmptyParameters_GeneratesEmptyArgs(t *testing.T) {
 		t.Errorf("expected 'ping', got %q", tc.Function.Name)
 	}
 }
+
+func TestAutoTool_MCPToolsAsLLMTools(t *testing.T) {
+	ts := newAutoToolServer(t,
+		llmock.WithMCP(llmock.MCPConfig{Tools: []llmock.MCPToolConfig{{
+			Name:        "search_docs",
+			Description: "Search the docs",
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"query": map[string]any{"type": "string"}},
+				"required":   []any{"query"},
+			},
+		}}}),
+		llmock.WithMCPToolsAsLLMTools(true),
+	)
+	defer ts.Close()
+
+	var result llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"find the install guide"}]}`, &result)
+	calls := result.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "search_docs" {
+		t.Fatalf("expected an auto tool call to the MCP tool, got %+v", result.Choices[0].Message)
+	}
+	var args map[string]any
+	if err := json.Unmarshal([]byte(calls[0].Function.Arguments), &args); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := args["query"].(string); !ok {
+		t.Errorf("expected arguments from the MCP tool's schema, got %v", args)
+	}
+}
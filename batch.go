@@ -0,0 +1,351 @@
+package llmock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxFileUploadMemory bounds how much of a file upload is held in memory.
+const maxFileUploadMemory = 32 << 20
+
+// batchEndpoints lists the endpoints a batch may target.
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/responses":        true,
+}
+
+// FileObject represents an OpenAI file.
+type FileObject struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// BatchRequest represents a POST /v1/batches request.
+type BatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// Batch represents an OpenAI batch job.
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	InputFileID      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileID     *string            `json:"output_file_id"`
+	ErrorFileID      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+
+	created time.Time // precise creation time, for the batch delay
+	started bool      // set once a poll has started processing
+}
+
+// BatchRequestCounts reports how many of a batch's requests have run.
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// batchInputLine is one line of a batch input file.
+type batchInputLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchOutputLine is one line of a batch output or error file.
+type batchOutputLine struct {
+	ID       string               `json:"id"`
+	CustomID string               `json:"custom_id"`
+	Response *batchOutputResponse `json:"response"`
+	Error    *batchOutputError    `json:"error"`
+}
+
+type batchOutputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchOutputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// batchState stores uploaded files and batch jobs.
+type batchState struct {
+	mu      sync.Mutex
+	files   map[string]*FileObject
+	content map[string][]byte
+	batches map[string]*Batch
+}
+
+func newBatchState() *batchState {
+	return &batchState{
+		files:   make(map[string]*FileObject),
+		content: make(map[string][]byte),
+		batches: make(map[string]*Batch),
+	}
+}
+
+// addFile stores a file for the batch API and returns its metadata.
+func (s *Server) addFile(filename, purpose string, data []byte) FileObject {
+	b := s.batches
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f := &FileObject{
+		ID:        s.newID("file-"),
+		Object:    "file",
+		Bytes:     len(data),
+		CreatedAt: s.now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+	b.files[f.ID] = f
+	b.content[f.ID] = data
+	return *f
+}
+
+// WithBatchDelay sets how long a batch stays in progress before it is
+// processed. The delay follows WithClock. By default a batch completes on
+// the first poll.
+func WithBatchDelay(d time.Duration) Option {
+	return func(s *Server) {
+		s.batchDelay = d
+	}
+}
+
+func (s *Server) handleFileUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxFileUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form: "+err.Error())
+		return
+	}
+	purpose := r.FormValue("purpose")
+	if purpose == "" {
+		writeError(w, http.StatusBadRequest, "purpose is required")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading file: "+err.Error())
+		return
+	}
+	f := s.addFile(header.Filename, purpose, data)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+func (s *Server) handleFileGet(w http.ResponseWriter, r *http.Request) {
+	s.batches.mu.Lock()
+	f, ok := s.batches.files[r.PathValue("id")]
+	var out FileObject
+	if ok {
+		out = *f
+	}
+	s.batches.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such file: "+r.PathValue("id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handleFileContent(w http.ResponseWriter, r *http.Request) {
+	s.batches.mu.Lock()
+	data, ok := s.batches.content[r.PathValue("id")]
+	s.batches.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such file: "+r.PathValue("id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Write(data)
+}
+
+func (s *Server) handleBatchCreate(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if !batchEndpoints[req.Endpoint] {
+		writeError(w, http.StatusBadRequest, "endpoint must be /v1/chat/completions or /v1/responses")
+		return
+	}
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = "24h"
+	}
+
+	b := s.batches
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.files[req.InputFileID]; !ok {
+		writeError(w, http.StatusBadRequest, "no such file: "+req.InputFileID)
+		return
+	}
+	batch := &Batch{
+		ID:               s.newID("batch_"),
+		Object:           "batch",
+		Endpoint:         req.Endpoint,
+		InputFileID:      req.InputFileID,
+		CompletionWindow: req.CompletionWindow,
+		Status:           "validating",
+		CreatedAt:        s.now().Unix(),
+		Metadata:         req.Metadata,
+		created:          s.now(),
+	}
+	b.batches[batch.ID] = batch
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+}
+
+func (s *Server) handleBatchGet(w http.ResponseWriter, r *http.Request) {
+	b := s.batches
+	b.mu.Lock()
+	batch, ok := b.batches[r.PathValue("id")]
+	if !ok {
+		b.mu.Unlock()
+		writeError(w, http.StatusNotFound, "no such batch: "+r.PathValue("id"))
+		return
+	}
+	if batch.InProgressAt == nil {
+		now := s.now().Unix()
+		batch.Status = "in_progress"
+		batch.InProgressAt = &now
+	}
+	var input []byte
+	run := !batch.started && s.now().Sub(batch.created) >= s.batchDelay
+	if run {
+		batch.started = true
+		input = b.content[batch.InputFileID]
+	}
+	b.mu.Unlock()
+
+	if run {
+		s.runBatch(r, batch, input)
+	}
+
+	b.mu.Lock()
+	out := *batch
+	b.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// runBatch sends each line of input through the batch's endpoint and stores
+// the output and error files. Headers from the polling request, such as the
+// API key, are passed on to each request.
+func (s *Server) runBatch(poll *http.Request, batch *Batch, input []byte) {
+	var output, errs bytes.Buffer
+	var counts BatchRequestCounts
+	sc := bufio.NewScanner(bytes.NewReader(input))
+	sc.Buffer(nil, maxFileUploadMemory)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		counts.Total++
+		line := batchOutputLine{ID: s.newID("batch_req_")}
+		var in batchInputLine
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			line.Error = &batchOutputError{Code: "invalid_json", Message: err.Error()}
+		} else if in.URL != batch.Endpoint {
+			line.CustomID = in.CustomID
+			line.Error = &batchOutputError{Code: "invalid_url", Message: fmt.Sprintf("url %q does not match the batch endpoint %q", in.URL, batch.Endpoint)}
+		}
+		if line.Error != nil {
+			counts.Failed++
+			data, _ := json.Marshal(line)
+			errs.Write(append(data, '\n'))
+			continue
+		}
+
+		// in.URL is the batch endpoint, so the request can't fail to build.
+		req, _ := http.NewRequestWithContext(poll.Context(), http.MethodPost, in.URL, bytes.NewReader(in.Body))
+		req.Header = poll.Header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		req.Host = poll.Host
+		req.RemoteAddr = poll.RemoteAddr
+		rec := &batchResponseWriter{header: make(http.Header), code: http.StatusOK}
+		s.mux.ServeHTTP(rec, req)
+
+		line.CustomID = in.CustomID
+		line.Response = &batchOutputResponse{
+			StatusCode: rec.code,
+			RequestID:  s.newID("req_"),
+			Body:       json.RawMessage(bytes.TrimSpace(rec.body.Bytes())),
+		}
+		if rec.code == http.StatusOK {
+			counts.Completed++
+		} else {
+			counts.Failed++
+		}
+		data, _ := json.Marshal(line)
+		output.Write(append(data, '\n'))
+	}
+
+	outFile := s.addFile(batch.ID+"_output.jsonl", "batch_output", output.Bytes())
+	var errFileID *string
+	if errs.Len() > 0 {
+		errFile := s.addFile(batch.ID+"_error.jsonl", "batch_output", errs.Bytes())
+		errFileID = &errFile.ID
+	}
+
+	s.batches.mu.Lock()
+	defer s.batches.mu.Unlock()
+	now := s.now().Unix()
+	batch.Status = "completed"
+	batch.OutputFileID = &outFile.ID
+	batch.ErrorFileID = errFileID
+	batch.CompletedAt = &now
+	batch.RequestCounts = counts
+}
+
+// batchResponseWriter records the response to one request of a batch.
+type batchResponseWriter struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *batchResponseWriter) Header() http.Header { return rw.header }
+
+func (rw *batchResponseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.code = code
+		rw.wroteHeader = true
+	}
+}
+
+func (rw *batchResponseWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.body.Write(p)
+}
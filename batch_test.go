@@ -0,0 +1,171 @@
+package llmock_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/llmock"
+)
+
+type batchJSON struct {
+	ID            string  `json:"id"`
+	Status        string  `json:"status"`
+	OutputFileID  *string `json:"output_file_id"`
+	ErrorFileID   *string `json:"error_file_id"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+func uploadBatchFile(t *testing.T, ts *httptest.Server, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("purpose", "batch")
+	fw, _ := mw.CreateFormFile("file", "input.jsonl")
+	fw.Write([]byte(content))
+	mw.Close()
+	resp, err := http.Post(ts.URL+"/v1/files", mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var f struct {
+		ID    string `json:"id"`
+		Bytes int    `json:"bytes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&f)
+	if resp.StatusCode != http.StatusOK || f.Bytes != len(content) {
+		t.Fatalf("upload failed: %d %+v", resp.StatusCode, f)
+	}
+	return f.ID
+}
+
+func createBatch(t *testing.T, ts *httptest.Server, fileID string) batchJSON {
+	t.Helper()
+	body := `{"input_file_id":"` + fileID + `","endpoint":"/v1/chat/completions","completion_window":"24h"}`
+	resp, err := http.Post(ts.URL+"/v1/batches", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var b batchJSON
+	json.NewDecoder(resp.Body).Decode(&b)
+	if resp.StatusCode != http.StatusOK || b.Status != "validating" {
+		t.Fatalf("create failed: %d %+v", resp.StatusCode, b)
+	}
+	return b
+}
+
+func pollBatch(t *testing.T, ts *httptest.Server, id string) batchJSON {
+	t.Helper()
+	resp, err := http.Get(ts.URL + "/v1/batches/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var b batchJSON
+	json.NewDecoder(resp.Body).Decode(&b)
+	return b
+}
+
+func TestBatch_CompletesOnFirstPoll(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	input := `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4","messages":[{"role":"user","content":"first"}]}}
+{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4","messages":[{"role":"user","content":"second"}]}}
+{"custom_id":"c","method":"POST","url":"/v1/embeddings","body":{}}
+`
+	b := createBatch(t, ts, uploadBatchFile(t, ts, input))
+	b = pollBatch(t, ts, b.ID)
+	if b.Status != "completed" || b.OutputFileID == nil || b.ErrorFileID == nil {
+		t.Fatalf("expected completed batch with output and error files, got %+v", b)
+	}
+	if b.RequestCounts.Total != 3 || b.RequestCounts.Completed != 2 || b.RequestCounts.Failed != 1 {
+		t.Errorf("unexpected request counts %+v", b.RequestCounts)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/files/" + *b.OutputFileID + "/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got := map[string]string{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var line struct {
+			CustomID string `json:"custom_id"`
+			Response struct {
+				StatusCode int `json:"status_code"`
+				Body       struct {
+					Choices []struct {
+						Message struct {
+							Content string `json:"content"`
+						} `json:"message"`
+					} `json:"choices"`
+				} `json:"body"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if line.Response.StatusCode != http.StatusOK || len(line.Response.Body.Choices) != 1 {
+			t.Fatalf("unexpected output line %s", sc.Bytes())
+		}
+		got[line.CustomID] = line.Response.Body.Choices[0].Message.Content
+	}
+	if got["a"] != "first" || got["b"] != "second" {
+		t.Errorf("expected echoed responses per custom_id, got %v", got)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/files/" + *b.ErrorFileID + "/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	errData, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(errData), `"custom_id":"c"`) {
+		t.Errorf("expected the mismatched url in the error file, got %s", errData)
+	}
+}
+
+func TestBatch_Delay(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithBatchDelay(time.Minute),
+		llmock.WithClock(func() time.Time { return now }),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	input := `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}}`
+	b := createBatch(t, ts, uploadBatchFile(t, ts, input))
+	if b = pollBatch(t, ts, b.ID); b.Status != "in_progress" {
+		t.Fatalf("expected in_progress before the delay, got %q", b.Status)
+	}
+	now = now.Add(time.Minute)
+	if b = pollBatch(t, ts, b.ID); b.Status != "completed" || b.RequestCounts.Completed != 1 {
+		t.Errorf("expected completed after the delay, got %+v", b)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/batches/batch_missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown batch, got %d", resp.StatusCode)
+	}
+}
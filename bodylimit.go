@@ -0,0 +1,54 @@
+package llmock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WithMaxRequestBytes rejects request bodies larger than n bytes with a 413
+// in the provider's error format, before the body is decoded. Use it to test
+// prompt chunking and truncation fallbacks, or to guard a shared instance
+// against huge payloads. n <= 0 (the default) means no limit.
+func WithMaxRequestBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxRequestBytes = n
+	}
+}
+
+// maxBytesHandler wraps h so request bodies over the WithMaxRequestBytes
+// limit get a 413. The body is read up front, so handlers never see a
+// truncated body.
+func (s *Server) maxBytesHandler(h http.Handler) http.Handler {
+	if s.maxRequestBytes <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, ok := apiFormatForPath(r.URL.Path)
+		if !ok {
+			format = "openai"
+		}
+		tooLarge := func() {
+			msg := fmt.Sprintf("request body exceeds %d bytes", s.maxRequestBytes)
+			writeFaultError(w, http.StatusRequestEntityTooLarge, msg, "invalid_request_error", format)
+		}
+		if r.ContentLength > s.maxRequestBytes {
+			tooLarge()
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxRequestBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				tooLarge()
+				return
+			}
+			writeFaultError(w, http.StatusBadRequest, "reading request body: "+err.Error(), "invalid_request_error", format)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestMaxRequestBytes(t *testing.T) {
+	s := llmock.New(llmock.WithMaxRequestBytes(200))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// Within the limit.
+	resp := chatRequest(t, ts, "hello")
+	if len(resp.Choices) == 0 {
+		t.Fatal("expected a normal response")
+	}
+
+	huge := `{"model":"gpt-4","messages":[{"role":"user","content":"` + strings.Repeat("x", 500) + `"}]}`
+	r, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(huge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", r.StatusCode)
+	}
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Error.Type != "invalid_request_error" {
+		t.Errorf("expected an OpenAI error body, got %+v (%v)", body, err)
+	}
+}
+
+func TestMaxRequestBytes_Chunked(t *testing.T) {
+	s := llmock.New(llmock.WithMaxRequestBytes(200))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// An io.Reader without a known length is sent chunked, so the limit is
+	// enforced while reading rather than from Content-Length.
+	huge := `{"model":"claude-3","max_tokens":10,"messages":[{"role":"user","content":"` + strings.Repeat("x", 500) + `"}]}`
+	r, err := http.Post(ts.URL+"/v1/messages", "application/json", io.MultiReader(strings.NewReader(huge)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", r.StatusCode)
+	}
+	var body struct {
+		Type string `json:"type"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	if body.Type != "error" {
+		t.Errorf("expected an Anthropic error body, got %+v", body)
+	}
+}
@@ -0,0 +1,140 @@
+package llmock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithResponseCache models provider-side prompt caching: an identical
+// request made within ttl of the first gets the same response again,
+// without consulting the responder, with its prompt tokens reported as
+// cached (OpenAI prompt_tokens_details.cached_tokens, Anthropic
+// cache_read_input_tokens, Gemini cachedContentTokenCount, Responses
+// input_tokens_details.cached_tokens). Only the content is repeated: as
+// from a provider, each response gets a new id and creation time, and new
+// tool call ids where they would otherwise be generated (see WithSeed and
+// WithIDGenerator). Requests are identical when their
+// decoded bodies are equal, so key order and whitespace don't matter.
+// Gemini requests for several candidates aren't cached. Expiry follows
+// WithClock. ttl <= 0 (the default) disables the cache.
+func WithResponseCache(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl <= 0 {
+			s.responseCache = nil
+			return
+		}
+		s.responseCache = &responseCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+	}
+}
+
+// responseCache holds recent responses by request key. It holds the
+// responder's Response, not the encoded body, so ids and timestamps are
+// made afresh for each hit.
+type responseCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	resp    Response
+	expires time.Time
+}
+
+// cachedRespond returns the cached response for req, a decoded request
+// body, and true if an identical request to the same path was answered
+// within the TTL. The responder isn't consulted for a hit, so rule call
+// counts and RNG state are left alone. Otherwise it returns the response
+// from respond, storing it for later requests.
+func (s *Server) cachedRespond(r *http.Request, req any, respond func() (Response, error)) (Response, bool, error) {
+	c := s.responseCache
+	if c == nil {
+		resp, err := respond()
+		return resp, false, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		resp, err := respond()
+		return resp, false, err
+	}
+	sum := sha256.Sum256(append([]byte(r.URL.Path+"\x00"), body...))
+	key := hex.EncodeToString(sum[:])
+
+	if resp, ok := c.get(key, s.now()); ok {
+		return resp, true, nil
+	}
+	resp, err := respond()
+	if err != nil {
+		return resp, false, err
+	}
+	c.put(key, resp, s.now())
+	return resp, false, nil
+}
+
+// get returns the unexpired entry for key, dropping expired entries.
+func (c *responseCache) get(key string, now time.Time) (Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	e, ok := c.entries[key]
+	if !ok {
+		return Response{}, false
+	}
+	cached := e.resp
+	cached.ToolCalls = slices.Clone(cached.ToolCalls)
+	cached.Blocks = slices.Clone(cached.Blocks)
+	return cached, true
+}
+
+// put stores resp under key until the TTL from now.
+func (c *responseCache) put(key string, resp Response, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{resp: resp, expires: now.Add(c.ttl)}
+}
+
+// openAIUsage is the usage of a chat completion; for a cache hit, all of
+// its prompt tokens are reported as cached.
+func openAIUsage(promptTokens, completionTokens int, cached bool) Usage {
+	u := Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+	if cached {
+		u.PromptTokensDetails = &PromptTokensDetails{CachedTokens: promptTokens}
+	}
+	return u
+}
+
+// anthropicUsage is the usage of a message; for a cache hit, the input
+// tokens are reported as read from the cache instead.
+func anthropicUsage(inputTokens, outputTokens int, cached bool) AnthropicUsage {
+	if cached {
+		return AnthropicUsage{OutputTokens: outputTokens, CacheReadInputTokens: inputTokens}
+	}
+	return AnthropicUsage{InputTokens: inputTokens, OutputTokens: outputTokens}
+}
+
+// geminiUsage is the usage of a Gemini response; for a cache hit, all of
+// its prompt tokens are reported as cached content.
+func geminiUsage(promptTokens, candidatesTokens int, cached bool) GeminiUsageMetadata {
+	u := GeminiUsageMetadata{
+		PromptTokenCount:     promptTokens,
+		CandidatesTokenCount: candidatesTokens,
+		TotalTokenCount:      promptTokens + candidatesTokens,
+	}
+	if cached {
+		u.CachedContentTokenCount = promptTokens
+	}
+	return u
+}
@@ -0,0 +1,135 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := llmock.New(
+		llmock.WithResponseCache(time.Minute),
+		llmock.WithClock(func() time.Time { return now }),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// Markov output is unseeded, so only the cache makes repeats identical.
+	const body = `{"model":"gpt-4","temperature":1,"messages":[{"role":"user","content":"tell me something about distributed systems"}]}`
+	chat := func() llmock.ChatCompletionResponse {
+		var out llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions", body, &out)
+		return out
+	}
+	chatBody := func() map[string]any {
+		var out map[string]any
+		postJSON(t, ts, "/v1/chat/completions", body, &out)
+		return out
+	}
+
+	first := chatBody()
+	if _, ok := first["usage"].(map[string]any)["prompt_tokens_details"]; ok {
+		t.Errorf("first request reported cached tokens: %v", first["usage"])
+	}
+
+	// A hit repeats the whole body except for a new id and creation time,
+	// and the prompt tokens marked as cached.
+	now = now.Add(30 * time.Second)
+	second := chatBody()
+	if second["id"] == first["id"] || second["created"] == first["created"] {
+		t.Errorf("cache hit repeated the id or creation time: %v, %v", second["id"], second["created"])
+	}
+	usage := first["usage"].(map[string]any)
+	want := maps.Clone(first)
+	want["id"], want["created"] = second["id"], second["created"]
+	want["usage"] = map[string]any{
+		"prompt_tokens":         usage["prompt_tokens"],
+		"completion_tokens":     usage["completion_tokens"],
+		"total_tokens":          usage["total_tokens"],
+		"prompt_tokens_details": map[string]any{"cached_tokens": usage["prompt_tokens"]},
+	}
+	if !reflect.DeepEqual(second, want) {
+		got, _ := json.Marshal(second)
+		exp, _ := json.Marshal(want)
+		t.Errorf("cache hit body differs:\n got %s\nwant %s", got, exp)
+	}
+
+	var msg llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":200,"messages":[{"role":"user","content":"hi"}]}`, &msg)
+	postJSON(t, ts, "/v1/messages", `{"max_tokens":200, "model":"claude-3","messages":[{"role":"user","content":"hi"}]}`, &msg)
+	if msg.Usage.CacheReadInputTokens == 0 || msg.Usage.InputTokens != 0 {
+		t.Errorf("anthropic usage = %+v, want all input read from cache", msg.Usage)
+	}
+
+	now = now.Add(time.Minute)
+	if third := chat(); third.Usage.PromptTokensDetails != nil {
+		t.Errorf("request after TTL reported cached tokens: %+v", third.Usage.PromptTokensDetails)
+	}
+}
+
+func TestResponseCache_HitSkipsResponder(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxCalls := 2
+	s := llmock.New(
+		llmock.WithResponseCache(time.Minute),
+		llmock.WithClock(func() time.Time { return now }),
+		llmock.WithRules(llmock.Rule{
+			Pattern:   regexp.MustCompile(`weather`),
+			Responses: []string{"It's sunny."},
+			ToolCall:  &llmock.ToolCallConfig{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}},
+			MaxCalls:  &maxCalls,
+		}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// A hit mustn't use up one of the rule's two tool calls, so the first
+	// request after the TTL still gets one.
+	const body = `{"model":"gpt-4","messages":[{"role":"user","content":"what's the weather?"}]}`
+	var out llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", body, &out)
+	postJSON(t, ts, "/v1/chat/completions", body, &out)
+	if out.Usage.PromptTokensDetails == nil {
+		t.Fatalf("second request wasn't a cache hit: %+v", out.Usage)
+	}
+	now = now.Add(time.Minute)
+	postJSON(t, ts, "/v1/chat/completions", body, &out)
+	if len(out.Choices[0].Message.ToolCalls) != 1 {
+		t.Errorf("expected a tool call after the TTL, got %+v", out.Choices[0].Message)
+	}
+}
+
+func TestResponseCache_GeminiAndResponses(t *testing.T) {
+	ts := httptest.NewServer(llmock.New(llmock.WithResponseCache(time.Minute)).Handler())
+	defer ts.Close()
+
+	const geminiBody = `{"contents":[{"role":"user","parts":[{"text":"hello there"}]}]}`
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", geminiBody, &gemini)
+	if gemini.UsageMetadata.CachedContentTokenCount != 0 {
+		t.Errorf("first Gemini request reported cached tokens: %+v", gemini.UsageMetadata)
+	}
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", geminiBody, &gemini)
+	if u := gemini.UsageMetadata; u.CachedContentTokenCount == 0 || u.CachedContentTokenCount != u.PromptTokenCount {
+		t.Errorf("Gemini usage = %+v, want the prompt read from cache", u)
+	}
+
+	const responsesBody = `{"model":"gpt-4o","input":"hello there"}`
+	var resp llmock.ResponsesResponse
+	postJSON(t, ts, "/v1/responses", responsesBody, &resp)
+	if resp.Usage.InputTokensDetails != nil {
+		t.Errorf("first Responses request reported cached tokens: %+v", resp.Usage.InputTokensDetails)
+	}
+	postJSON(t, ts, "/v1/responses", responsesBody, &resp)
+	want := &llmock.ResponsesInputTokensDetails{CachedTokens: resp.Usage.InputTokens}
+	if !reflect.DeepEqual(resp.Usage.InputTokensDetails, want) {
+		t.Errorf("input_tokens_details = %+v, want %+v", resp.Usage.InputTokensDetails, want)
+	}
+}
@@ -0,0 +1,62 @@
+package llmock
+
+import "errors"
+
+// ErrNoMatch is returned by a Responder in a ChainResponder to pass the
+// request on to the next stage.
+var ErrNoMatch = errors.New("llmock: no responder matched")
+
+// ChainResponder tries an ordered list of responders and returns the first
+// response that has text or tool calls. A stage that returns ErrNoMatch or
+// an empty response passes the request on; any other error is returned.
+//
+// RuleResponder stages in a chain built by WithResponders pass on unmatched
+// requests instead of falling back to Markov text. When every stage passes,
+// the server's no-match behavior applies.
+type ChainResponder struct {
+	responders []Responder
+	fallback   Responder // set by New; nil means return ErrNoMatch
+}
+
+// NewChainResponder creates a ChainResponder that tries responders in
+// order.
+func NewChainResponder(responders ...Responder) *ChainResponder {
+	return &ChainResponder{responders: responders}
+}
+
+// Respond returns the first stage's non-empty response.
+func (c *ChainResponder) Respond(messages []InternalMessage) (Response, error) {
+	return c.RespondWithContext(RespondContext{Messages: messages})
+}
+
+// RespondWithContext is like Respond, but passes the request context to
+// stages that implement ContextResponder.
+func (c *ChainResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	for _, r := range c.responders {
+		resp, err := respondWith(r, ctx)
+		if errors.Is(err, ErrNoMatch) {
+			continue
+		}
+		if err != nil {
+			return Response{}, err
+		}
+		if resp.Text != "" || resp.IsToolCall() {
+			return resp, nil
+		}
+	}
+	if c.fallback != nil {
+		return respondWith(c.fallback, ctx)
+	}
+	return Response{}, ErrNoMatch
+}
+
+// WithResponders configures the server to use a ChainResponder that tries
+// the given responders in order, for example a custom scenario responder
+// ahead of the rules:
+//
+//	llmock.WithResponders(myScenario, llmock.NewRuleResponder(rules))
+func WithResponders(responders ...Responder) Option {
+	return func(s *Server) {
+		s.responder = NewChainResponder(responders...)
+	}
+}
@@ -0,0 +1,52 @@
+package llmock_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+// scenarioResponder answers "scenario: ..." prompts and passes on the rest.
+type scenarioResponder struct{}
+
+func (scenarioResponder) Respond(messages []llmock.InternalMessage) (llmock.Response, error) {
+	input := messages[len(messages)-1].Content
+	if rest, ok := strings.CutPrefix(input, "scenario: "); ok {
+		return llmock.Response{Text: "scripted " + rest}, nil
+	}
+	return llmock.Response{}, llmock.ErrNoMatch
+}
+
+func TestChainResponder_PassesThroughToRules(t *testing.T) {
+	s := llmock.New(
+		llmock.WithResponders(
+			scenarioResponder{},
+			llmock.NewRuleResponder([]llmock.Rule{{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}}}),
+		),
+		llmock.WithNoMatchBehavior(llmock.NoMatchConfig{Mode: llmock.NoMatchText, Text: "NO MATCH"}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for input, want := range map[string]string{
+		"scenario: login": "scripted login",
+		"hello":           "hi",
+		"something else":  "NO MATCH",
+	} {
+		if got := chatRequest(t, ts, input).Choices[0].Message.Content; got != want {
+			t.Errorf("%q: got %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestChainResponder_Exhausted(t *testing.T) {
+	chain := llmock.NewChainResponder(scenarioResponder{})
+	_, err := chain.Respond([]llmock.InternalMessage{{Role: "user", Content: "hello"}})
+	if !errors.Is(err, llmock.ErrNoMatch) {
+		t.Errorf("expected ErrNoMatch, got %v", err)
+	}
+}
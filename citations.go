@@ -0,0 +1,162 @@
+package llmock
+
+import (
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// OpenAIAnnotation is an annotation on an OpenAI chat message.
+type OpenAIAnnotation struct {
+	Type        string            `json:"type"`
+	URLCitation OpenAIURLCitation `json:"url_citation"`
+}
+
+// OpenAIURLCitation cites a source for a span of an OpenAI message.
+type OpenAIURLCitation struct {
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+}
+
+// ResponsesAnnotation is a url_citation annotation on Responses API output
+// text.
+type ResponsesAnnotation struct {
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+}
+
+// AnthropicCitation cites a span of a document in an Anthropic text block.
+type AnthropicCitation struct {
+	Type           string `json:"type"`
+	CitedText      string `json:"cited_text"`
+	DocumentIndex  int    `json:"document_index"`
+	DocumentTitle  string `json:"document_title"`
+	StartCharIndex int    `json:"start_char_index"`
+	EndCharIndex   int    `json:"end_char_index"`
+}
+
+// GeminiGroundingMetadata links spans of a Gemini candidate to the sources
+// that ground them.
+type GeminiGroundingMetadata struct {
+	GroundingChunks   []GeminiGroundingChunk   `json:"groundingChunks"`
+	GroundingSupports []GeminiGroundingSupport `json:"groundingSupports"`
+}
+
+// GeminiGroundingChunk is one source in Gemini grounding metadata.
+type GeminiGroundingChunk struct {
+	RetrievedContext *GeminiRetrievedContext `json:"retrievedContext,omitempty"`
+}
+
+// GeminiRetrievedContext is a retrieved document used for grounding.
+type GeminiRetrievedContext struct {
+	URI   string `json:"uri"`
+	Title string `json:"title"`
+	Text  string `json:"text,omitempty"`
+}
+
+// GeminiGroundingSupport ties a segment of the candidate to grounding chunks.
+type GeminiGroundingSupport struct {
+	Segment               GeminiSegment `json:"segment"`
+	GroundingChunkIndices []int         `json:"groundingChunkIndices"`
+	ConfidenceScores      []float64     `json:"confidenceScores"`
+}
+
+// GeminiSegment is a span of a Gemini candidate's text, in bytes.
+type GeminiSegment struct {
+	StartIndex int    `json:"startIndex"`
+	EndIndex   int    `json:"endIndex"`
+	Text       string `json:"text"`
+}
+
+// WithCitations attaches synthetic citations to text responses, pointing at
+// the Markov corpus: OpenAI annotations, Anthropic citations, and Gemini
+// grounding metadata. They are well-formed but not accurate; each cites the
+// whole response text.
+func WithCitations(enabled bool) Option {
+	return func(s *Server) {
+		s.citations = enabled
+	}
+}
+
+// citationSource returns the URI and title citations point at: the corpus
+// file if one is configured, or the built-in corpus.
+func (s *Server) citationSource() (uri, title string) {
+	if s.corpusFile != "" {
+		return "file://" + filepath.ToSlash(s.corpusFile), filepath.Base(s.corpusFile)
+	}
+	return "llmock://corpus", "llmock corpus"
+}
+
+// openAIAnnotations returns the annotations for an OpenAI chat message with
+// the given text, or nil if citations are off.
+func (s *Server) openAIAnnotations(text string) []OpenAIAnnotation {
+	if !s.citations || text == "" {
+		return nil
+	}
+	uri, title := s.citationSource()
+	return []OpenAIAnnotation{{
+		Type: "url_citation",
+		URLCitation: OpenAIURLCitation{
+			URL:        uri,
+			Title:      title,
+			StartIndex: 0,
+			EndIndex:   utf8.RuneCountInString(text),
+		},
+	}}
+}
+
+// responsesAnnotations returns the annotations for Responses API output
+// text. It is never nil, since the API always sends the array.
+func (s *Server) responsesAnnotations(text string) []any {
+	if !s.citations || text == "" {
+		return []any{}
+	}
+	uri, title := s.citationSource()
+	return []any{ResponsesAnnotation{
+		Type:       "url_citation",
+		URL:        uri,
+		Title:      title,
+		StartIndex: 0,
+		EndIndex:   utf8.RuneCountInString(text),
+	}}
+}
+
+// anthropicCitations returns the citations for an Anthropic text block, or
+// nil if citations are off.
+func (s *Server) anthropicCitations(text string) []AnthropicCitation {
+	if !s.citations || text == "" {
+		return nil
+	}
+	_, title := s.citationSource()
+	return []AnthropicCitation{{
+		Type:           "char_location",
+		CitedText:      text,
+		DocumentIndex:  0,
+		DocumentTitle:  title,
+		StartCharIndex: 0,
+		EndCharIndex:   utf8.RuneCountInString(text),
+	}}
+}
+
+// geminiGrounding returns the grounding metadata for a Gemini candidate, or
+// nil if citations are off.
+func (s *Server) geminiGrounding(text string) *GeminiGroundingMetadata {
+	if !s.citations || text == "" {
+		return nil
+	}
+	uri, title := s.citationSource()
+	return &GeminiGroundingMetadata{
+		GroundingChunks: []GeminiGroundingChunk{{
+			RetrievedContext: &GeminiRetrievedContext{URI: uri, Title: title},
+		}},
+		GroundingSupports: []GeminiGroundingSupport{{
+			Segment:               GeminiSegment{StartIndex: 0, EndIndex: len(text), Text: text},
+			GroundingChunkIndices: []int{0},
+			ConfidenceScores:      []float64{1},
+		}},
+	}
+}
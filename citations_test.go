@@ -0,0 +1,82 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postJSON(t *testing.T, ts *httptest.Server, path, body string, out any) {
+	t.Helper()
+	resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCitations_PerEndpoint(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithCitations(true))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var chat struct {
+		Choices []struct {
+			Message struct {
+				Annotations []llmock.OpenAIAnnotation `json:"annotations"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"cite me"}]}`, &chat)
+	if a := chat.Choices[0].Message.Annotations; len(a) != 1 || a[0].Type != "url_citation" ||
+		a[0].URLCitation.URL != "llmock://corpus" || a[0].URLCitation.EndIndex != len("cite me") {
+		t.Errorf("unexpected chat annotations %+v", a)
+	}
+
+	var responses struct {
+		Output []struct {
+			Content []struct {
+				Annotations []llmock.ResponsesAnnotation `json:"annotations"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	postJSON(t, ts, "/v1/responses", `{"model":"gpt-4o","input":"cite me"}`, &responses)
+	if a := responses.Output[0].Content[0].Annotations; len(a) != 1 || a[0].Type != "url_citation" {
+		t.Errorf("unexpected Responses annotations %+v", a)
+	}
+
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"cite me"}]}`, &anthropic)
+	if c := anthropic.Content[0].Citations; len(c) != 1 || c[0].Type != "char_location" || c[0].CitedText != "cite me" {
+		t.Errorf("unexpected Anthropic citations %+v", c)
+	}
+
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"cite me"}]}]}`, &gemini)
+	g := gemini.Candidates[0].GroundingMetadata
+	if g == nil || len(g.GroundingChunks) != 1 || g.GroundingChunks[0].RetrievedContext == nil ||
+		len(g.GroundingSupports) != 1 || g.GroundingSupports[0].Segment.Text != "cite me" {
+		t.Errorf("unexpected Gemini grounding metadata %+v", g)
+	}
+}
+
+func TestCitations_OffByDefault(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`, &anthropic)
+	if c := anthropic.Content[0].Citations; c != nil {
+		t.Errorf("expected no citations by default, got %+v", c)
+	}
+}
@@ -4,21 +4,153 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/shishberg/llmock"
 )
 
+// ruleFlags collects repeated --rule 'pattern=>response' flags.
+type ruleFlags []string
+
+func (f *ruleFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *ruleFlags) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// parseRuleFlag parses the --rule shorthand 'pattern=>response' into a Rule.
+func parseRuleFlag(v string) (llmock.Rule, error) {
+	pattern, response, ok := strings.Cut(v, "=>")
+	if !ok {
+		return llmock.Rule{}, fmt.Errorf("rule %q: expected 'pattern=>response'", v)
+	}
+	if pattern == "" {
+		return llmock.Rule{}, fmt.Errorf("rule %q: pattern must not be empty", v)
+	}
+	if response == "" {
+		return llmock.Rule{}, fmt.Errorf("rule %q: response must not be empty", v)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return llmock.Rule{}, fmt.Errorf("rule %q: invalid regex: %w", v, err)
+	}
+	return llmock.Rule{Pattern: re, Responses: []string{response}}, nil
+}
+
+// loadStdinConfig reads a config from r. JSON is detected by a leading '{',
+// anything else is treated as YAML.
+func loadStdinConfig(r io.Reader) (*llmock.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading config from stdin: %w", err)
+	}
+	name := "stdin.yaml"
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		name = "stdin.json"
+	}
+	return llmock.ParseConfig(data, name)
+}
+
+// logRuleWarnings logs rules that can never match; see llmock.RuleWarnings.
+func logRuleWarnings(rules []llmock.Rule) {
+	for _, w := range llmock.RuleWarnings(rules) {
+		log.Printf("llmock: warning: %s", w)
+	}
+}
+
+// reloadConfig re-reads the config file at path and swaps the server's
+// rules, faults, and MCP config. Rules from --rule flags are re-appended,
+// and a config without an mcp section clears the MCP tools, resources, and
+// prompts. Nothing is changed if the config fails to load or compile.
+//
+// Other sections only take effect on restart. reloadConfig returns the
+// names of those that differ from the startup config, so they can be
+// reported rather than silently ignored.
+func reloadConfig(s *llmock.Server, path string, startup *llmock.Config, flagRules []llmock.Rule) ([]string, error) {
+	switch path {
+	case "":
+		return nil, fmt.Errorf("no config file to reload")
+	case "-":
+		return nil, fmt.Errorf("cannot reload config read from stdin")
+	}
+	cfg, err := llmock.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cfg.ToOptions(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	rules, err := llmock.CompileRules(cfg.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	rules = append(rules, flagRules...)
+	if cfg.MCP != nil && startup.MCP == nil {
+		return nil, fmt.Errorf("cannot add an mcp section: MCP was not enabled at startup")
+	}
+
+	if err := s.SetRules(rules); err != nil {
+		return nil, err
+	}
+	logRuleWarnings(rules)
+	if err := s.SetFaults(cfg.Faults); err != nil {
+		return nil, err
+	}
+	if startup.MCP != nil {
+		var mcp llmock.MCPConfig
+		if cfg.MCP != nil {
+			mcp = *cfg.MCP
+		}
+		if err := s.SetMCPConfig(mcp); err != nil {
+			return nil, err
+		}
+	}
+	return restartOnly(startup, cfg), nil
+}
+
+// restartOnly names the sections of next that differ from prev but that
+// reloadConfig doesn't apply.
+func restartOnly(prev, next *llmock.Config) []string {
+	var changed []string
+	for _, section := range []struct {
+		name       string
+		prev, next any
+	}{
+		{"server", prev.Server, next.Server},
+		{"defaults", prev.Defaults, next.Defaults},
+		{"responder", prev.Responder, next.Responder},
+		{"corpus", prev.Corpus, next.Corpus},
+		{"corpus_file", prev.CorpusFile, next.CorpusFile},
+		{"fault_selection", prev.FaultSelection, next.FaultSelection},
+	} {
+		if !reflect.DeepEqual(section.prev, section.next) {
+			changed = append(changed, section.name)
+		}
+	}
+	return changed
+}
+
 func main() {
-	configPath := flag.String("config", "", "path to config file (YAML or JSON)")
+	configPath := flag.String("config", "", "path to config file (YAML or JSON), or - to read from stdin")
 	port := flag.Int("port", 0, "port to listen on (overrides config)")
 	verbose := flag.Bool("verbose", false, "log all requests/responses to stderr")
+	logFormat := flag.String("log-format", "", "verbose log format: text or json (overrides config)")
+	basePath := flag.String("base-path", "", "mount all routes under this path prefix (overrides config)")
 	mcpStdio := flag.Bool("mcp-stdio", false, "run MCP control plane over stdin/stdout (no HTTP server)")
+	var ruleArgs ruleFlags
+	flag.Var(&ruleArgs, "rule", "append a rule as 'pattern=>response' (repeatable)")
 	flag.Parse()
 
 	// Load config: explicit --config, or auto-discover, or defaults.
@@ -27,21 +159,50 @@ func main() {
 	if cfgPath == "" {
 		cfgPath = llmock.FindDefaultConfig()
 	}
-	if cfgPath != "" {
+	switch {
+	case cfgPath == "-":
+		if *mcpStdio {
+			log.Fatal("llmock: --config - cannot be combined with --mcp-stdio")
+		}
+		var err error
+		cfg, err = loadStdinConfig(os.Stdin)
+		if err != nil {
+			log.Fatalf("loading config from stdin: %v", err)
+		}
+	case cfgPath != "":
 		var err error
 		cfg, err = llmock.LoadConfig(cfgPath)
 		if err != nil {
 			log.Fatalf("loading config %s: %v", cfgPath, err)
 		}
-	} else {
+	default:
 		cfg = &llmock.Config{}
 	}
+	// Keep the config as loaded, before flag overrides, to tell which
+	// sections a SIGHUP reload has changed but can't apply.
+	startup := *cfg
+
+	// Parse --rule shorthands.
+	var flagRules []llmock.Rule
+	for _, v := range ruleArgs {
+		rule, err := parseRuleFlag(v)
+		if err != nil {
+			log.Fatalf("invalid --rule: %v", err)
+		}
+		flagRules = append(flagRules, rule)
+	}
 
 	// Apply --verbose flag.
 	if *verbose {
 		v := true
 		cfg.Server.Verbose = &v
 	}
+	if *logFormat != "" {
+		cfg.Server.LogFormat = *logFormat
+	}
+	if *basePath != "" {
+		cfg.Server.BasePath = *basePath
+	}
 
 	// Convert config to options.
 	opts, err := cfg.ToOptions()
@@ -49,6 +210,16 @@ func main() {
 		log.Fatalf("invalid config: %v", err)
 	}
 
+	// Append --rule rules after any config file rules.
+	rules, err := llmock.CompileRules(cfg.Rules)
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	rules = append(rules, flagRules...)
+	if len(flagRules) > 0 {
+		opts = append(opts, llmock.WithRules(rules...))
+	}
+
 	// Resolve port: --port flag > config > PORT env > 9090.
 	p := *port
 	if p == 0 {
@@ -63,6 +234,11 @@ func main() {
 		p = 9090
 	}
 
+	// JSON log lines must not carry the standard logger's timestamp prefix.
+	if cfg.Server.LogFormat == llmock.LogFormatJSON {
+		opts = append(opts, llmock.WithLogger(log.New(os.Stderr, "", 0)))
+	}
+
 	s := llmock.New(opts...)
 
 	// MCP stdio mode: run control plane over stdin/stdout instead of HTTP.
@@ -85,16 +261,21 @@ func main() {
 	if cfg.Server.AdminAPI != nil && !*cfg.Server.AdminAPI {
 		adminStatus = "disabled"
 	}
-	ruleCount := len(cfg.Rules)
+	ruleCount := len(cfg.Rules) + len(flagRules)
 	corpusInfo := "default"
 	if cfg.CorpusFile != "" {
 		corpusInfo = cfg.CorpusFile
+	} else if cfg.Corpus != "" {
+		corpusInfo = cfg.Corpus
 	}
-	if cfgPath != "" {
+	if cfgPath == "-" {
+		log.Printf("llmock: loaded config from stdin")
+	} else if cfgPath != "" {
 		log.Printf("llmock: loaded config from %s", cfgPath)
 	}
 	log.Printf("llmock: port=%d rules=%d corpus=%s admin=%s",
 		p, ruleCount, corpusInfo, adminStatus)
+	logRuleWarnings(rules)
 
 	// Set up server with graceful shutdown.
 	addr := fmt.Sprintf(":%d", p)
@@ -103,6 +284,23 @@ func main() {
 		Handler: handler,
 	}
 
+	// Reload rules, faults, and MCP config on SIGHUP.
+	go func() {
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		for range hupCh {
+			ignored, err := reloadConfig(s, cfgPath, &startup, flagRules)
+			if err != nil {
+				log.Printf("llmock: reload failed, keeping previous config: %v", err)
+				continue
+			}
+			log.Printf("llmock: reloaded rules, faults, and mcp from %s", cfgPath)
+			if len(ignored) > 0 {
+				log.Printf("llmock: warning: changes to %s need a restart and were not applied", strings.Join(ignored, ", "))
+			}
+		}
+	}()
+
 	// Listen for shutdown signals.
 	done := make(chan struct{})
 	go func() {
@@ -123,4 +321,3 @@ func main() {
 	}
 	<-done
 }
-
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestParseRuleFlag(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		value    string
+		match    string
+		response string
+		err      string
+	}{
+		{name: "simple", value: "ping=>pong", match: "ping", response: "pong"},
+		{name: "regex with group", value: `weather in (\w+)=>It is sunny in $1.`, match: "weather in Paris", response: "It is sunny in $1."},
+		{name: "first separator splits", value: "a=>b=>c", match: "a", response: "b=>c"},
+		{name: "missing separator", value: "ping->pong", err: "expected 'pattern=>response'"},
+		{name: "invalid regex", value: "(ping=>pong", err: "invalid regex"},
+		{name: "empty pattern", value: "=>pong", err: "pattern must not be empty"},
+		{name: "empty response", value: "ping=>", err: "response must not be empty"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRuleFlag(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseRuleFlag(%q) error = %v, want %q", tt.value, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRuleFlag(%q): %v", tt.value, err)
+			}
+			if !rule.Pattern.MatchString(tt.match) {
+				t.Errorf("pattern %q doesn't match %q", rule.Pattern, tt.match)
+			}
+			if len(rule.Responses) != 1 || rule.Responses[0] != tt.response {
+				t.Errorf("responses = %q, want [%q]", rule.Responses, tt.response)
+			}
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llmock.yaml")
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+rules:
+  - pattern: "^ping$"
+    responses: ["pong"]
+mcp:
+  tools:
+    - name: lookup
+      description: Look something up.
+`)
+	startup, err := llmock.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := startup.ToOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := llmock.New(opts...)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// The new file adds a fault, drops the mcp section, and changes a
+	// default that only applies on restart.
+	write(`
+defaults:
+  case_insensitive: true
+rules:
+  - pattern: "^ping$"
+    responses: ["pong again"]
+faults:
+  - type: error
+    status: 503
+    match: "^fail$"
+`)
+	ignored, err := reloadConfig(s, path, startup, nil)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if !slices.Equal(ignored, []string{"defaults"}) {
+		t.Errorf("expected defaults to be reported as needing a restart, got %v", ignored)
+	}
+
+	resp, err := http.Get(ts.URL + "/_mock/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Rules []struct {
+			Responses []string `json:"responses"`
+		} `json:"rules"`
+		Faults []llmock.Fault    `json:"faults"`
+		MCP    *llmock.MCPConfig `json:"mcp"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Rules) != 1 || !slices.Equal(doc.Rules[0].Responses, []string{"pong again"}) {
+		t.Errorf("expected the reloaded rule, got %+v", doc.Rules)
+	}
+	if len(doc.Faults) != 1 || doc.Faults[0].Status != 503 {
+		t.Errorf("expected the reloaded fault, got %+v", doc.Faults)
+	}
+	if doc.MCP == nil || len(doc.MCP.Tools) != 0 {
+		t.Errorf("expected the MCP tools to be cleared, got %+v", doc.MCP)
+	}
+
+	write(`rules: [{pattern: "(", responses: ["x"]}]`)
+	if _, err := reloadConfig(s, path, startup, nil); err == nil {
+		t.Error("expected an invalid config to fail to reload")
+	}
+}
@@ -1,10 +1,17 @@
 package llmock
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,16 +26,36 @@ type Config struct {
 	Defaults DefaultConfig `yaml:"defaults" json:"defaults"`
 	Rules    []RuleConfig  `yaml:"rules" json:"rules"`
 
-	CorpusFile string    `yaml:"corpus_file" json:"corpus_file"`
-	Faults     []Fault   `yaml:"faults" json:"faults"`
+	// Responder selects a responder registered with RegisterResponder
+	// instead of rules. It cannot be combined with Rules.
+	Responder *ResponderConfig `yaml:"responder,omitempty" json:"responder,omitempty"`
+
+	Corpus     string     `yaml:"corpus,omitempty" json:"corpus,omitempty"` // built-in corpus name
+	CorpusFile string     `yaml:"corpus_file" json:"corpus_file"`
+	Faults     []Fault    `yaml:"faults" json:"faults"`
 	MCP        *MCPConfig `yaml:"mcp,omitempty" json:"mcp,omitempty"`
+
+	// FaultSelection is "first" (the default) or "random"; see
+	// WithFaultSelection.
+	FaultSelection string `yaml:"fault_selection,omitempty" json:"fault_selection,omitempty"`
+
+	// Include lists other config files to merge into this one, resolved
+	// relative to this file's directory. See mergeConfig for precedence.
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
 }
 
 // ServerConfig holds server-level settings.
 type ServerConfig struct {
-	Port     int   `yaml:"port" json:"port"`
-	AdminAPI *bool `yaml:"admin_api" json:"admin_api"`
-	Verbose  *bool `yaml:"verbose" json:"verbose"`
+	Port       int   `yaml:"port" json:"port"`
+	AdminAPI   *bool `yaml:"admin_api" json:"admin_api"`
+	Verbose    *bool `yaml:"verbose" json:"verbose"`
+	Rerank     *bool `yaml:"rerank" json:"rerank"`
+	Realtime   *bool `yaml:"realtime" json:"realtime"`
+	Assistants *bool `yaml:"assistants" json:"assistants"`
+	// LogFormat is "text" (the default) or "json"; see WithLogFormat.
+	LogFormat string `yaml:"log_format,omitempty" json:"log_format,omitempty"`
+	// BasePath mounts all routes under a prefix; see WithBasePath.
+	BasePath string `yaml:"base_path,omitempty" json:"base_path,omitempty"`
 }
 
 // DefaultConfig holds default response behavior settings.
@@ -37,44 +64,535 @@ type DefaultConfig struct {
 	Seed          *int64 `yaml:"seed" json:"seed"`
 	Model         string `yaml:"model" json:"model"`
 	AutoToolCalls *bool  `yaml:"auto_tool_calls" json:"auto_tool_calls"`
+	// MCPToolsAsLLMTools offers MCP tools to auto tool calls; see
+	// WithMCPToolsAsLLMTools.
+	MCPToolsAsLLMTools *bool `yaml:"mcp_tools_as_llm_tools,omitempty" json:"mcp_tools_as_llm_tools,omitempty"`
+	// CaseInsensitive makes rule patterns ignore case; see WithCaseInsensitive.
+	CaseInsensitive bool `yaml:"case_insensitive,omitempty" json:"case_insensitive,omitempty"`
+	// MarkovMinWords is the shortest Markov response; see WithMarkovMinWords.
+	MarkovMinWords int `yaml:"markov_min_words,omitempty" json:"markov_min_words,omitempty"`
+	// LatencyPerTokenMS delays responses in proportion to their length.
+	LatencyPerTokenMS int `yaml:"latency_per_token_ms,omitempty" json:"latency_per_token_ms,omitempty"`
+	// LatencyProfile samples per-request latency; see WithLatencyProfile.
+	LatencyProfile *LatencyProfileConfig `yaml:"latency_profile,omitempty" json:"latency_profile,omitempty"`
+	// KeepAliveMS is the interval between SSE keep-alive comments.
+	KeepAliveMS int `yaml:"keep_alive_ms,omitempty" json:"keep_alive_ms,omitempty"`
+	// StreamByteRate caps streamed output in bytes per second; see
+	// WithStreamByteRate.
+	StreamByteRate int `yaml:"stream_byte_rate,omitempty" json:"stream_byte_rate,omitempty"`
+	// ForceModel and ModelSuffix change the model responses report; see
+	// WithForceModel and WithModelSuffix.
+	ForceModel  string `yaml:"force_model,omitempty" json:"force_model,omitempty"`
+	ModelSuffix string `yaml:"model_suffix,omitempty" json:"model_suffix,omitempty"`
+	// Citations attaches synthetic citations to text responses.
+	Citations *bool `yaml:"citations,omitempty" json:"citations,omitempty"`
+	// OutputMutation is the per-character rate of typos injected into
+	// response text; see WithOutputMutation.
+	OutputMutation float64 `yaml:"output_mutation,omitempty" json:"output_mutation,omitempty"`
+
+	// NoMatch selects the response when no rule matches; see NoMatchConfig.
+	NoMatch *NoMatchConfig `yaml:"no_match,omitempty" json:"no_match,omitempty"`
+	// RulesByEndpoint holds default rules per API family (openai,
+	// anthropic, gemini); see WithEndpointRules.
+	RulesByEndpoint map[string][]RuleConfig `yaml:"rules_by_endpoint,omitempty" json:"rules_by_endpoint,omitempty"`
+	// Strict fails unmatched requests with StrictStatus (default 422).
+	Strict       *bool `yaml:"strict,omitempty" json:"strict,omitempty"`
+	StrictStatus int   `yaml:"strict_status,omitempty" json:"strict_status,omitempty"`
+}
+
+// LatencyProfileConfig gives the percentiles of a latency profile in ms.
+type LatencyProfileConfig struct {
+	P50MS int `yaml:"p50_ms" json:"p50_ms"`
+	P95MS int `yaml:"p95_ms" json:"p95_ms"`
+	P99MS int `yaml:"p99_ms" json:"p99_ms"`
 }
 
 // RuleConfig is the config-file representation of a rule.
 type RuleConfig struct {
-	Pattern   string          `yaml:"pattern" json:"pattern"`
-	Responses []string        `yaml:"responses" json:"responses"`
-	DelayMS   int             `yaml:"delay_ms,omitempty" json:"delay_ms,omitempty"`
-	ToolCall  *ToolCallConfig `yaml:"tool_call,omitempty" json:"tool_call,omitempty"`
-	MaxCalls  *int            `yaml:"max_calls,omitempty" json:"max_calls,omitempty"`
+	Pattern   string            `yaml:"pattern" json:"pattern"`
+	Responses []string          `yaml:"responses" json:"responses"`
+	DelayMS   int               `yaml:"delay_ms,omitempty" json:"delay_ms,omitempty"`
+	ToolCall  *ToolCallConfig   `yaml:"tool_call,omitempty" json:"tool_call,omitempty"`
+	MaxCalls  *int              `yaml:"max_calls,omitempty" json:"max_calls,omitempty"`
+	Model     string            `yaml:"model,omitempty" json:"model,omitempty"`
+	User      string            `yaml:"user,omitempty" json:"user,omitempty"`
+	Priority  int               `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Markov    *RuleMarkovConfig `yaml:"markov,omitempty" json:"markov,omitempty"`
+
+	// FinishReason overrides the reported stop reason; see Rule.FinishReason.
+	FinishReason string `yaml:"finish_reason,omitempty" json:"finish_reason,omitempty"`
+	// Blocks answers with several text parts; see Rule.Blocks.
+	Blocks []string `yaml:"blocks,omitempty" json:"blocks,omitempty"`
+	// Preamble is streamed before the response; see Rule.Preamble.
+	Preamble string `yaml:"preamble,omitempty" json:"preamble,omitempty"`
+	// ToolCallText sends the text along with the tool call; see
+	// Rule.ToolCallText.
+	ToolCallText bool `yaml:"tool_call_text,omitempty" json:"tool_call_text,omitempty"`
+	// Media adds an image or document block; see Rule.Media.
+	Media *MediaConfig `yaml:"media,omitempty" json:"media,omitempty"`
+	// Mode "shuffle" cycles through Responses in a per-session shuffled
+	// order; see Rule.Mode.
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+
+	// MatchType says how Pattern is read: as a regex (the default), as
+	// literal text to find with "contains", "prefix", "suffix", or
+	// "exact", or as a "glob" matching the whole input.
+	MatchType string `yaml:"match_type,omitempty" json:"match_type,omitempty"`
+	// CaseInsensitive makes Pattern ignore case, whatever its MatchType.
+	// Either value overrides defaults.case_insensitive.
+	CaseInsensitive *bool `yaml:"case_insensitive,omitempty" json:"case_insensitive,omitempty"`
+}
+
+// Rule match types for RuleConfig.MatchType.
+const (
+	MatchRegex    = "regex"
+	MatchContains = "contains"
+	MatchPrefix   = "prefix"
+	MatchSuffix   = "suffix"
+	MatchExact    = "exact"
+	MatchGlob     = "glob"
+)
+
+// compilePattern compiles a rule pattern of the given match type to a
+// regex. Literal types match the pattern text as is, with no escaping
+// needed. In a glob, "*" matches any run of characters and "?" any one
+// character, "[...]" is a character class, and the glob must match the
+// whole input; each "*" is a capture group, so its text is available as
+// $1, $2, and so on.
+func compilePattern(pattern, matchType string, caseInsensitive bool) (*regexp.Regexp, error) {
+	var expr string
+	switch matchType {
+	case "", MatchRegex:
+		expr = pattern
+	case MatchContains:
+		expr = regexp.QuoteMeta(pattern)
+	case MatchPrefix:
+		expr = "^" + regexp.QuoteMeta(pattern)
+	case MatchSuffix:
+		expr = regexp.QuoteMeta(pattern) + "$"
+	case MatchExact:
+		expr = "^" + regexp.QuoteMeta(pattern) + "$"
+	case MatchGlob:
+		expr = "^" + globToRegex(pattern) + "$"
+	default:
+		return nil, fmt.Errorf("unknown match_type %q (want regex, contains, prefix, suffix, exact, or glob)", matchType)
+	}
+	if caseInsensitive && !strings.HasPrefix(expr, "(?i)") {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// globToRegex translates a glob to an unanchored regex; see compilePattern.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			sb.WriteString("((?s:.*))")
+		case '?':
+			sb.WriteString("(?s:.)")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// RuleMarkovConfig makes a rule answer with Markov text generated from its
+// own corpus: a built-in corpus name or a file path.
+type RuleMarkovConfig struct {
+	Corpus     string `yaml:"corpus,omitempty" json:"corpus,omitempty"`
+	CorpusFile string `yaml:"corpus_file,omitempty" json:"corpus_file,omitempty"`
+	Length     int    `yaml:"length,omitempty" json:"length,omitempty"`
+}
+
+// chain trains the rule's Markov chain.
+func (mc RuleMarkovConfig) chain() (*MarkovChain, error) {
+	var text string
+	switch {
+	case mc.Corpus != "" && mc.CorpusFile != "":
+		return nil, errors.New("markov sets both corpus and corpus_file")
+	case mc.Corpus != "":
+		var err error
+		if text, err = BuiltinCorpus(mc.Corpus); err != nil {
+			return nil, err
+		}
+	case mc.CorpusFile != "":
+		data, err := os.ReadFile(mc.CorpusFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading markov corpus: %w", err)
+		}
+		text = string(data)
+	default:
+		return nil, errors.New("markov needs a corpus or corpus_file")
+	}
+	chain := NewMarkovChain(2)
+	chain.Train(text)
+	return chain, nil
 }
 
 // LoadConfig reads a config file (YAML or JSON) from the given path.
 // The format is detected by file extension: .json for JSON, anything else
 // is treated as YAML.
-func LoadConfig(path string) (*Config, error) {
+func LoadConfig(path string, opts ...ConfigOption) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
-	return ParseConfig(data, path)
+	return ParseConfig(data, path, opts...)
 }
 
-// ParseConfig parses config data. The path is used only to detect format
-// by extension (.json for JSON, otherwise YAML).
-func ParseConfig(data []byte, path string) (*Config, error) {
+// ConfigOption configures how config files are parsed.
+type ConfigOption func(*configOptions)
+
+type configOptions struct {
+	lenient bool
+
+	// untrusted is set for documents from clients rather than files, such
+	// as POST /_mock/import bodies: the environment is not expanded, and
+	// includes, which would read the server's files, are rejected.
+	untrusted bool
+}
+
+// WithLenientConfig disables strict decoding, so unknown keys in a config
+// file are silently ignored instead of reported as errors. Useful when a
+// config is shared with a newer llmock version.
+func WithLenientConfig() ConfigOption {
+	return func(o *configOptions) {
+		o.lenient = true
+	}
+}
+
+// ParseConfig parses config data. The path is used to detect format
+// by extension (.json for JSON, otherwise YAML), in error messages, and as
+// the base directory for resolving include entries.
+//
+// Before parsing, ${VAR} and ${VAR:-default} references are expanded from
+// the environment (see expandEnv). Unknown keys are reported as errors
+// unless WithLenientConfig is given.
+func ParseConfig(data []byte, path string, opts ...ConfigOption) (*Config, error) {
+	var o configOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return parseConfig(data, path, nil, o)
+}
+
+// parseConfig parses data and resolves its includes. stack holds the
+// absolute paths of the files currently being included, for cycle detection.
+func parseConfig(data []byte, path string, stack []string, o configOptions) (*Config, error) {
+	if !o.untrusted {
+		data = expandEnv(data)
+	}
 	var cfg Config
 	if strings.HasSuffix(strings.ToLower(path), ".json") {
-		if err := json.Unmarshal(data, &cfg); err != nil {
-			return nil, fmt.Errorf("parsing JSON config: %w", err)
+		if err := decodeJSONConfig(data, &cfg, o.lenient); err != nil {
+			return nil, fmt.Errorf("parsing JSON config %s: %w", path, err)
 		}
 	} else {
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return nil, fmt.Errorf("parsing YAML config: %w", err)
+		if err := decodeYAMLConfig(data, &cfg, o.lenient); err != nil {
+			return nil, fmt.Errorf("parsing YAML config %s: %w", path, err)
+		}
+	}
+	if !o.untrusted {
+		unescapeDollars(reflect.ValueOf(&cfg))
+	}
+	if len(cfg.Include) == 0 {
+		return &cfg, nil
+	}
+	if o.untrusted {
+		return nil, fmt.Errorf("config %s: include is not allowed here", path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving config path %s: %w", path, err)
+	}
+	stack = append(stack, abs)
+	dir := filepath.Dir(abs)
+	for _, inc := range cfg.Include {
+		incPath := inc
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(dir, incPath)
+		}
+		if slices.Contains(stack, incPath) {
+			return nil, fmt.Errorf("config include cycle: %s includes %s", path, inc)
+		}
+		incData, err := os.ReadFile(incPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading included config %s: %w", inc, err)
 		}
+		child, err := parseConfig(incData, incPath, stack, o)
+		if err != nil {
+			return nil, fmt.Errorf("in included config %s: %w", inc, err)
+		}
+		mergeConfig(&cfg, child)
 	}
+	cfg.Include = nil
 	return &cfg, nil
 }
 
+// decodeYAMLConfig unmarshals YAML into cfg. Unless lenient, unknown keys
+// are errors; yaml.v3 reports each one with its line number.
+func decodeYAMLConfig(data []byte, cfg *Config, lenient bool) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(!lenient)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// decodeJSONConfig unmarshals JSON into cfg. Unless lenient, unknown keys
+// are errors. encoding/json doesn't report positions for unknown fields,
+// so the line of the key's first occurrence is added as an approximation.
+func decodeJSONConfig(data []byte, cfg *Config, lenient bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !lenient {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(cfg)
+	if err == nil {
+		return nil
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if idx := bytes.Index(data, []byte(field)); idx >= 0 {
+			line := bytes.Count(data[:idx], []byte("\n")) + 1
+			return fmt.Errorf("line %d: unknown field %s", line, field)
+		}
+	}
+	return err
+}
+
+// mergeConfig merges an included (child) config into its parent. Includes
+// are merged in the order listed, so later includes take precedence over
+// earlier ones, and every include takes precedence over the parent:
+//
+//   - rules and faults are appended after the parent's, and so are
+//     rules_by_endpoint rules for each endpoint
+//   - MCP tools, resources, and prompts are appended; a child entry with the
+//     same name (or URI) as an existing one replaces it in place
+//   - server, defaults, and other settings are overridden by any value the
+//     child sets. A zero value counts as unset, so a child can't turn a
+//     parent's port, token_delay_ms, or other number, string, or
+//     case_insensitive back to zero; options that are pointers, such as
+//     admin_api, seed, or strict, can be set to false or 0.
+func mergeConfig(parent, child *Config) {
+	ps, cs := &parent.Server, &child.Server
+	override(&ps.Port, cs.Port)
+	override(&ps.AdminAPI, cs.AdminAPI)
+	override(&ps.Verbose, cs.Verbose)
+	override(&ps.Rerank, cs.Rerank)
+	override(&ps.Realtime, cs.Realtime)
+	override(&ps.Assistants, cs.Assistants)
+	override(&ps.LogFormat, cs.LogFormat)
+	override(&ps.BasePath, cs.BasePath)
+
+	pd, cd := &parent.Defaults, &child.Defaults
+	override(&pd.TokenDelayMS, cd.TokenDelayMS)
+	override(&pd.Seed, cd.Seed)
+	override(&pd.Model, cd.Model)
+	override(&pd.AutoToolCalls, cd.AutoToolCalls)
+	override(&pd.MCPToolsAsLLMTools, cd.MCPToolsAsLLMTools)
+	override(&pd.CaseInsensitive, cd.CaseInsensitive)
+	override(&pd.MarkovMinWords, cd.MarkovMinWords)
+	override(&pd.LatencyPerTokenMS, cd.LatencyPerTokenMS)
+	override(&pd.LatencyProfile, cd.LatencyProfile)
+	override(&pd.KeepAliveMS, cd.KeepAliveMS)
+	override(&pd.StreamByteRate, cd.StreamByteRate)
+	override(&pd.ForceModel, cd.ForceModel)
+	override(&pd.ModelSuffix, cd.ModelSuffix)
+	override(&pd.Citations, cd.Citations)
+	override(&pd.OutputMutation, cd.OutputMutation)
+	override(&pd.NoMatch, cd.NoMatch)
+	override(&pd.Strict, cd.Strict)
+	override(&pd.StrictStatus, cd.StrictStatus)
+	if len(cd.RulesByEndpoint) > 0 {
+		merged := make(map[string][]RuleConfig, len(pd.RulesByEndpoint)+len(cd.RulesByEndpoint))
+		for endpoint, rules := range pd.RulesByEndpoint {
+			merged[endpoint] = rules
+		}
+		for endpoint, rules := range cd.RulesByEndpoint {
+			merged[endpoint] = append(cloneSlice(merged[endpoint]), rules...)
+		}
+		pd.RulesByEndpoint = merged
+	}
+
+	parent.Rules = append(parent.Rules, child.Rules...)
+	override(&parent.Responder, child.Responder)
+	override(&parent.Corpus, child.Corpus)
+	override(&parent.CorpusFile, child.CorpusFile)
+	parent.Faults = append(parent.Faults, child.Faults...)
+	parent.MCP = mergeMCPConfig(parent.MCP, child.MCP)
+	override(&parent.FaultSelection, child.FaultSelection)
+}
+
+// override sets *dst to v unless v is the zero value.
+func override[T comparable](dst *T, v T) {
+	var zero T
+	if v != zero {
+		*dst = v
+	}
+}
+
+// mergeMCPConfig merges child MCP entries into parent, replacing entries
+// that share a tool name, resource URI, or prompt name.
+func mergeMCPConfig(parent, child *MCPConfig) *MCPConfig {
+	if child == nil {
+		return parent
+	}
+	if parent == nil {
+		cp := *child
+		return &cp
+	}
+	merged := *parent
+	merged.Tools = mergeByKey(parent.Tools, child.Tools, func(t MCPToolConfig) string { return t.Name })
+	merged.Resources = mergeByKey(parent.Resources, child.Resources, func(r MCPResourceConfig) string { return r.URI })
+	merged.Prompts = mergeByKey(parent.Prompts, child.Prompts, func(p MCPPromptConfig) string { return p.Name })
+	merged.ResourceTemplates = mergeByKey(parent.ResourceTemplates, child.ResourceTemplates, func(t MCPResourceTemplateConfig) string { return t.URITemplate })
+	return &merged
+}
+
+// mergeByKey appends add to base, replacing base entries with the same key.
+func mergeByKey[T any](base, add []T, key func(T) string) []T {
+	out := cloneSlice(base)
+	for _, item := range add {
+		idx := slices.IndexFunc(out, func(existing T) bool { return key(existing) == key(item) })
+		if idx >= 0 {
+			out[idx] = item
+		} else {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} with values from the
+// environment. An unset ${VAR} expands to the empty string; the default is
+// used when VAR is unset or empty. $$ is kept as is, so $${VAR} is not
+// expanded; unescapeDollars turns it into a literal $ once the config is
+// decoded.
+//
+// Only upper-case names ([A-Z_][A-Z0-9_]*) are treated as variables, so
+// response placeholders such as ${input} and regex anchors like $1 or foo$
+// pass through untouched.
+func expandEnv(data []byte) []byte {
+	s := string(data)
+	var b strings.Builder
+	b.Grow(len(s))
+	i := 0
+	for i < len(s) {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '$' {
+			b.WriteString("$$")
+			i += 2
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end != -1 {
+				expr := s[i+2 : i+2+end]
+				name, def, hasDef := strings.Cut(expr, ":-")
+				if isEnvName(name) {
+					val, ok := os.LookupEnv(name)
+					if hasDef && (!ok || val == "") {
+						val = def
+					}
+					b.WriteString(val)
+					i += 2 + end + 1
+					continue
+				}
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return []byte(b.String())
+}
+
+// regexFields lists the config fields that hold regexes. Their $$ is left
+// as written, since in a pattern such as `costs \$$` it is not an escape.
+var regexFields = map[reflect.Type][]string{
+	reflect.TypeFor[RuleConfig]():      {"Pattern", "Model", "User"},
+	reflect.TypeFor[Fault]():           {"Match"},
+	reflect.TypeFor[MCPToolResponse](): {"Pattern"},
+}
+
+// unescapeDollars replaces $$ with $ in every string reachable from v,
+// except in regexFields.
+func unescapeDollars(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(strings.ReplaceAll(v.String(), "$$", "$"))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			unescapeDollars(v.Elem())
+		}
+	case reflect.Interface:
+		// An interface's value isn't settable, so unescape a copy.
+		if !v.IsNil() {
+			e := reflect.New(v.Elem().Type()).Elem()
+			e.Set(v.Elem())
+			unescapeDollars(e)
+			v.Set(e)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			unescapeDollars(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			unescapeDollars(e)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.Struct:
+		skip := regexFields[v.Type()]
+		for i := range v.NumField() {
+			if f := v.Type().Field(i); f.IsExported() && !slices.Contains(skip, f.Name) {
+				unescapeDollars(v.Field(i))
+			}
+		}
+	}
+}
+
+// isEnvName reports whether name looks like an environment variable:
+// upper-case letters, digits, and underscores, not starting with a digit.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // FindDefaultConfig looks for llmock.yaml or llmock.json in the current
 // directory. Returns the path if found, or empty string if neither exists.
 func FindDefaultConfig() string {
@@ -90,14 +608,76 @@ func FindDefaultConfig() string {
 func CompileRules(configs []RuleConfig) ([]Rule, error) {
 	rules := make([]Rule, len(configs))
 	for i, rc := range configs {
-		re, err := regexp.Compile(rc.Pattern)
+		re, err := compilePattern(rc.Pattern, rc.MatchType, rc.CaseInsensitive != nil && *rc.CaseInsensitive)
 		if err != nil {
 			return nil, fmt.Errorf("compiling rule %d pattern %q: %w", i, rc.Pattern, err)
 		}
-		if len(rc.Responses) == 0 && rc.ToolCall == nil {
-			return nil, fmt.Errorf("rule %d pattern %q has no responses or tool_call", i, rc.Pattern)
+		if len(rc.Responses) == 0 && len(rc.Blocks) == 0 && rc.ToolCall == nil && rc.Markov == nil && rc.FinishReason == "" && rc.Media == nil {
+			return nil, fmt.Errorf("rule %d pattern %q has no responses, blocks, markov, media, tool_call, or finish_reason", i, rc.Pattern)
+		}
+		if rc.Media != nil {
+			if err := rc.Media.validate(); err != nil {
+				return nil, fmt.Errorf("rule %d pattern %q: %w", i, rc.Pattern, err)
+			}
+		}
+		if len(rc.Blocks) > 0 && (len(rc.Responses) > 0 || rc.Markov != nil) {
+			return nil, fmt.Errorf("rule %d pattern %q has blocks with responses or markov", i, rc.Pattern)
+		}
+		if rc.Preamble != "" {
+			if len(rc.Responses) == 0 && len(rc.Blocks) == 0 && rc.Markov == nil {
+				return nil, fmt.Errorf("rule %d pattern %q has a preamble but no responses, blocks, or markov", i, rc.Pattern)
+			}
+			if err := validateTemplate(rc.Preamble); err != nil {
+				return nil, fmt.Errorf("rule %d pattern %q preamble: %w", i, rc.Pattern, err)
+			}
+		}
+		if rc.ToolCallText && (rc.ToolCall == nil || (len(rc.Responses) == 0 && len(rc.Blocks) == 0 && rc.Markov == nil)) {
+			return nil, fmt.Errorf("rule %d pattern %q has tool_call_text but no tool_call and text", i, rc.Pattern)
+		}
+		if rc.FinishReason != "" && !slices.Contains(finishReasons, rc.FinishReason) {
+			return nil, fmt.Errorf("rule %d pattern %q has unknown finish_reason %q (want one of %s)",
+				i, rc.Pattern, rc.FinishReason, strings.Join(finishReasons, ", "))
+		}
+		if rc.Mode != "" && rc.Mode != ModeShuffle {
+			return nil, fmt.Errorf("rule %d pattern %q has unknown mode %q (want %s)", i, rc.Pattern, rc.Mode, ModeShuffle)
+		}
+		if rc.Mode == ModeShuffle && len(rc.Responses) == 0 {
+			return nil, fmt.Errorf("rule %d pattern %q has mode %q but no responses", i, rc.Pattern, rc.Mode)
+		}
+		if len(rc.Responses) > 0 && rc.Markov != nil {
+			return nil, fmt.Errorf("rule %d pattern %q has both responses and markov", i, rc.Pattern)
 		}
-		rules[i] = Rule{Pattern: re, Responses: rc.Responses, ToolCall: rc.ToolCall, MaxCalls: rc.MaxCalls}
+		for j, resp := range rc.Responses {
+			if err := validateTemplate(resp); err != nil {
+				return nil, fmt.Errorf("rule %d pattern %q response %d: %w", i, rc.Pattern, j, err)
+			}
+		}
+		for j, block := range rc.Blocks {
+			if err := validateTemplate(block); err != nil {
+				return nil, fmt.Errorf("rule %d pattern %q block %d: %w", i, rc.Pattern, j, err)
+			}
+		}
+		rule := Rule{Pattern: re, Responses: rc.Responses, ToolCall: rc.ToolCall, MaxCalls: rc.MaxCalls, Priority: rc.Priority, FinishReason: rc.FinishReason, Blocks: rc.Blocks, Preamble: rc.Preamble, ToolCallText: rc.ToolCallText, Media: rc.Media, Mode: rc.Mode, CaseInsensitive: rc.CaseInsensitive}
+		if rc.Markov != nil {
+			if rule.Markov, err = rc.Markov.chain(); err != nil {
+				return nil, fmt.Errorf("rule %d pattern %q: %w", i, rc.Pattern, err)
+			}
+			rule.MarkovLength = rc.Markov.Length
+			rule.markovConfig = rc.Markov
+		}
+		if rc.Model != "" {
+			rule.Model, err = regexp.Compile(rc.Model)
+			if err != nil {
+				return nil, fmt.Errorf("compiling rule %d model pattern %q: %w", i, rc.Model, err)
+			}
+		}
+		if rc.User != "" {
+			rule.User, err = regexp.Compile(rc.User)
+			if err != nil {
+				return nil, fmt.Errorf("compiling rule %d user pattern %q: %w", i, rc.User, err)
+			}
+		}
+		rules[i] = rule
 	}
 	return rules, nil
 }
@@ -115,6 +695,27 @@ func (c *Config) ToOptions() ([]Option, error) {
 		))
 	}
 
+	if c.Defaults.LatencyPerTokenMS > 0 {
+		opts = append(opts, WithLatencyPerToken(
+			durationFromMS(c.Defaults.LatencyPerTokenMS),
+		))
+	}
+
+	if lp := c.Defaults.LatencyProfile; lp != nil {
+		p50, p95, p99 := durationFromMS(lp.P50MS), durationFromMS(lp.P95MS), durationFromMS(lp.P99MS)
+		if err := (latencyProfile{p50, p95, p99}).validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithLatencyProfile(p50, p95, p99))
+	}
+
+	if c.Defaults.KeepAliveMS > 0 {
+		opts = append(opts, WithStreamKeepAlive(durationFromMS(c.Defaults.KeepAliveMS)))
+	}
+	if c.Defaults.StreamByteRate > 0 {
+		opts = append(opts, WithStreamByteRate(c.Defaults.StreamByteRate))
+	}
+
 	if c.Defaults.Seed != nil {
 		opts = append(opts, WithSeed(*c.Defaults.Seed))
 	}
@@ -123,6 +724,62 @@ func (c *Config) ToOptions() ([]Option, error) {
 		opts = append(opts, WithAutoToolCalls(*c.Defaults.AutoToolCalls))
 	}
 
+	if c.Defaults.CaseInsensitive {
+		opts = append(opts, WithCaseInsensitive(true))
+	}
+
+	if c.Defaults.MarkovMinWords > 0 {
+		opts = append(opts, WithMarkovMinWords(c.Defaults.MarkovMinWords))
+	}
+
+	if c.Defaults.MCPToolsAsLLMTools != nil {
+		opts = append(opts, WithMCPToolsAsLLMTools(*c.Defaults.MCPToolsAsLLMTools))
+	}
+
+	if c.Defaults.ForceModel != "" {
+		opts = append(opts, WithForceModel(c.Defaults.ForceModel))
+	}
+
+	if c.Defaults.ModelSuffix != "" {
+		opts = append(opts, WithModelSuffix(c.Defaults.ModelSuffix))
+	}
+
+	if m := c.Defaults.OutputMutation; m != 0 {
+		if m < 0 || m > 1 {
+			return nil, fmt.Errorf("output_mutation must be between 0 and 1, got %v", m)
+		}
+		opts = append(opts, WithOutputMutation(m))
+	}
+
+	if c.Defaults.Citations != nil {
+		opts = append(opts, WithCitations(*c.Defaults.Citations))
+	}
+
+	if c.Defaults.NoMatch != nil {
+		opts = append(opts, WithNoMatchBehavior(*c.Defaults.NoMatch))
+	}
+
+	for _, endpoint := range slices.Sorted(maps.Keys(c.Defaults.RulesByEndpoint)) {
+		switch endpoint {
+		case EndpointOpenAI, EndpointAnthropic, EndpointGemini:
+		default:
+			return nil, fmt.Errorf("unknown endpoint %q in rules_by_endpoint (want openai, anthropic, or gemini)", endpoint)
+		}
+		rules, err := CompileRules(c.Defaults.RulesByEndpoint[endpoint])
+		if err != nil {
+			return nil, fmt.Errorf("rules_by_endpoint %s: %w", endpoint, err)
+		}
+		opts = append(opts, WithEndpointRules(endpoint, rules...))
+	}
+
+	if c.Defaults.Strict != nil {
+		opts = append(opts, WithStrictMatching(*c.Defaults.Strict))
+	}
+
+	if c.Defaults.StrictStatus != 0 {
+		opts = append(opts, WithStrictMatchingStatus(c.Defaults.StrictStatus))
+	}
+
 	if c.Server.AdminAPI != nil {
 		opts = append(opts, WithAdminAPI(*c.Server.AdminAPI))
 	}
@@ -131,6 +788,37 @@ func (c *Config) ToOptions() ([]Option, error) {
 		opts = append(opts, WithVerbose(*c.Server.Verbose))
 	}
 
+	switch c.Server.LogFormat {
+	case "":
+	case LogFormatText, LogFormatJSON:
+		opts = append(opts, WithLogFormat(c.Server.LogFormat))
+	default:
+		return nil, fmt.Errorf("unknown log_format %q (want text or json)", c.Server.LogFormat)
+	}
+
+	if c.Server.BasePath != "" {
+		opts = append(opts, WithBasePath(c.Server.BasePath))
+	}
+
+	if c.Server.Rerank != nil && *c.Server.Rerank {
+		opts = append(opts, WithRerank())
+	}
+
+	if c.Server.Realtime != nil && *c.Server.Realtime {
+		opts = append(opts, WithRealtime())
+	}
+
+	if c.Server.Assistants != nil && *c.Server.Assistants {
+		opts = append(opts, WithAssistants())
+	}
+
+	if c.Corpus != "" {
+		if _, err := BuiltinCorpus(c.Corpus); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithBuiltinCorpus(c.Corpus))
+	}
+
 	if c.CorpusFile != "" {
 		opts = append(opts, WithCorpusFile(c.CorpusFile))
 	}
@@ -143,9 +831,30 @@ func (c *Config) ToOptions() ([]Option, error) {
 		opts = append(opts, WithRules(rules...))
 	}
 
+	if c.Responder != nil {
+		if len(c.Rules) > 0 {
+			return nil, fmt.Errorf("config cannot set both rules and responder")
+		}
+		r, err := newRegisteredResponder(*c.Responder)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithResponder(r))
+	}
+
+	if err := validateFaults(c.Faults); err != nil {
+		return nil, err
+	}
 	for _, f := range c.Faults {
 		opts = append(opts, WithFault(f))
 	}
+	switch c.FaultSelection {
+	case "":
+	case FaultSelectionFirst, FaultSelectionRandom:
+		opts = append(opts, WithFaultSelection(c.FaultSelection))
+	default:
+		return nil, fmt.Errorf("unknown fault_selection %q (want first or random)", c.FaultSelection)
+	}
 
 	if c.MCP != nil {
 		opts = append(opts, WithMCP(*c.MCP))
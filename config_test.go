@@ -1,6 +1,7 @@
 package llmock
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -102,6 +103,156 @@ func TestParseConfigInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestParseConfigEnvInterpolation(t *testing.T) {
+	t.Setenv("LLMOCK_TEST_PORT", "4321")
+	t.Setenv("LLMOCK_TEST_EMPTY", "")
+	data := []byte(`
+server:
+  port: ${LLMOCK_TEST_PORT}
+corpus_file: ${LLMOCK_TEST_UNSET:-corpus.txt}
+defaults:
+  model: "${LLMOCK_TEST_EMPTY:-fallback-model}"
+rules:
+  - pattern: "price (\\d+)$"
+    responses: ["It costs $$$1 for ${input}, missing=[${LLMOCK_TEST_UNSET}]"]
+`)
+	cfg, err := ParseConfig(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Server.Port != 4321 {
+		t.Errorf("port = %d, want 4321", cfg.Server.Port)
+	}
+	if cfg.CorpusFile != "corpus.txt" {
+		t.Errorf("corpus_file = %q, want default %q", cfg.CorpusFile, "corpus.txt")
+	}
+	if cfg.Defaults.Model != "fallback-model" {
+		t.Errorf("model = %q, want default for empty var", cfg.Defaults.Model)
+	}
+	if cfg.Rules[0].Pattern != `price (\d+)$` {
+		t.Errorf("pattern mangled: %q", cfg.Rules[0].Pattern)
+	}
+	want := "It costs $$1 for ${input}, missing=[]"
+	if cfg.Rules[0].Responses[0] != want {
+		t.Errorf("response = %q, want %q", cfg.Rules[0].Responses[0], want)
+	}
+}
+
+func TestParseConfigDollarEscape(t *testing.T) {
+	t.Setenv("LLMOCK_TEST_DIR", "/data")
+	data := []byte(`
+corpus_file: ${LLMOCK_TEST_DIR}/$$x/$${LLMOCK_TEST_DIR}
+faults:
+  - type: error
+    match: "cost \\$$"
+    message: "costs $$5"
+mcp:
+  resources:
+    - uri: file:///price
+      name: price
+      content: "$$5"
+rules:
+  - pattern: "total \\$$"
+    responses: ["$$$$"]
+`)
+	cfg, err := ParseConfig(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.CorpusFile != "/data/$x/${LLMOCK_TEST_DIR}" {
+		t.Errorf("corpus_file = %q", cfg.CorpusFile)
+	}
+	if f := cfg.Faults[0]; f.Message != "costs $5" || f.Match != `cost \$$` {
+		t.Errorf("fault message = %q, match = %q", f.Message, f.Match)
+	}
+	if got := cfg.MCP.Resources[0].Content; got != "$5" {
+		t.Errorf("resource content = %q, want %q", got, "$5")
+	}
+	if r := cfg.Rules[0]; r.Pattern != `total \$$` || r.Responses[0] != "$$" {
+		t.Errorf("rule pattern = %q, response = %q", r.Pattern, r.Responses[0])
+	}
+}
+
+func TestParseConfigEnvInterpolationJSON(t *testing.T) {
+	t.Setenv("LLMOCK_TEST_PORT", "5555")
+	data := []byte(`{"server": {"port": ${LLMOCK_TEST_PORT}}}`)
+	cfg, err := ParseConfig(data, "test.json")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Server.Port != 5555 {
+		t.Errorf("port = %d, want 5555", cfg.Server.Port)
+	}
+}
+
+func TestParseConfigUnknownKeyYAML(t *testing.T) {
+	data := []byte(`
+rules:
+  - pattern: "hello"
+    respones: ["Hi there!"]
+`)
+	_, err := ParseConfig(data, "typo.yaml")
+	if err == nil {
+		t.Fatal("expected error for misspelled key")
+	}
+	msg := err.Error()
+	for _, want := range []string{"typo.yaml", "line 4", "respones"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q should mention %q", msg, want)
+		}
+	}
+}
+
+func TestParseConfigUnknownKeyJSON(t *testing.T) {
+	data := []byte(`{
+  "rules": [
+    {"pattern": "hello", "respones": ["Hi"]}
+  ]
+}`)
+	_, err := ParseConfig(data, "typo.json")
+	if err == nil {
+		t.Fatal("expected error for misspelled key")
+	}
+	msg := err.Error()
+	for _, want := range []string{"typo.json", "line 3", "respones"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q should mention %q", msg, want)
+		}
+	}
+}
+
+func TestParseConfigLenient(t *testing.T) {
+	data := []byte(`
+future_setting: true
+rules:
+  - pattern: "hello"
+    responses: ["Hi there!"]
+`)
+	cfg, err := ParseConfig(data, "test.yaml", WithLenientConfig())
+	if err != nil {
+		t.Fatalf("ParseConfig lenient: %v", err)
+	}
+	if len(cfg.Rules) != 1 {
+		t.Errorf("rules count = %d, want 1", len(cfg.Rules))
+	}
+}
+
+func TestParseConfigFaultKeysYAML(t *testing.T) {
+	data := []byte(`
+faults:
+  - type: error
+    error_type: overloaded_error
+    delay_ms: 100
+`)
+	cfg, err := ParseConfig(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Faults[0].ErrorType != "overloaded_error" || cfg.Faults[0].DelayMS != 100 {
+		t.Errorf("fault fields not decoded: %+v", cfg.Faults[0])
+	}
+}
+
 func TestLoadConfig(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test.yaml")
@@ -122,6 +273,105 @@ rules:
 	}
 }
 
+func TestLoadConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "teams"), 0755)
+	os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(`
+include: [teams/a.yaml]
+server:
+  port: 3000
+  admin_api: true
+defaults:
+  model: base-model
+  token_delay_ms: 5
+  rules_by_endpoint:
+    openai:
+      - pattern: "base endpoint"
+        responses: ["from base"]
+rules:
+  - pattern: "base"
+    responses: ["from base"]
+faults:
+  - type: delay
+    delay_ms: 10
+mcp:
+  tools:
+    - name: shared
+      description: base version
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "teams", "a.yaml"), []byte(`
+include: [b.yaml]
+defaults:
+  model: team-model
+rules:
+  - pattern: "team a"
+    responses: ["from a"]
+mcp:
+  tools:
+    - name: shared
+      description: team version
+    - name: team_tool
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "teams", "b.yaml"), []byte(`
+server:
+  admin_api: false
+defaults:
+  rules_by_endpoint:
+    openai:
+      - pattern: "b endpoint"
+        responses: ["from b"]
+rules:
+  - pattern: "team b"
+    responses: ["from b"]
+`), 0644)
+
+	cfg, err := LoadConfig(filepath.Join(dir, "base.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	var patterns []string
+	for _, r := range cfg.Rules {
+		patterns = append(patterns, r.Pattern)
+	}
+	if strings.Join(patterns, ",") != "base,team a,team b" {
+		t.Errorf("rules = %v, want base, team a, team b in order", patterns)
+	}
+	if cfg.Defaults.Model != "team-model" {
+		t.Errorf("model = %q, want child override %q", cfg.Defaults.Model, "team-model")
+	}
+	if cfg.Defaults.TokenDelayMS != 5 || cfg.Server.Port != 3000 {
+		t.Errorf("expected unset child fields to keep parent values, got delay=%d port=%d",
+			cfg.Defaults.TokenDelayMS, cfg.Server.Port)
+	}
+	if cfg.Server.AdminAPI == nil || *cfg.Server.AdminAPI {
+		t.Errorf("expected child to turn admin_api off, got %v", cfg.Server.AdminAPI)
+	}
+	if openai := cfg.Defaults.RulesByEndpoint["openai"]; len(openai) != 2 || openai[1].Pattern != "b endpoint" {
+		t.Errorf("expected endpoint rules appended, got %+v", openai)
+	}
+	if len(cfg.Faults) != 1 {
+		t.Errorf("faults = %d, want 1", len(cfg.Faults))
+	}
+	if cfg.MCP == nil || len(cfg.MCP.Tools) != 2 {
+		t.Fatalf("expected 2 merged MCP tools, got %+v", cfg.MCP)
+	}
+	if cfg.MCP.Tools[0].Name != "shared" || cfg.MCP.Tools[0].Description != "team version" {
+		t.Errorf("expected child to replace same-named tool, got %+v", cfg.MCP.Tools[0])
+	}
+}
+
+func TestLoadConfigIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("include: [b.yaml]\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("include: [a.yaml]\n"), 0644)
+
+	_, err := LoadConfig(filepath.Join(dir, "a.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected include cycle error, got %v", err)
+	}
+}
+
 func TestLoadConfigMissingFile(t *testing.T) {
 	_, err := LoadConfig("/nonexistent/config.yaml")
 	if err == nil {
@@ -175,6 +425,68 @@ func TestCompileRules(t *testing.T) {
 	}
 }
 
+func TestCompileRulesMatchTypes(t *testing.T) {
+	tests := []struct {
+		matchType       string
+		pattern         string
+		caseInsensitive bool
+		match, noMatch  []string
+	}{
+		{MatchRegex, `weather in \w+`, false, []string{"the weather in Paris"}, []string{"weather"}},
+		{MatchContains, "a.b (c)?", false, []string{"x a.b (c)? y"}, []string{"axb c"}},
+		{MatchPrefix, "/help", false, []string{"/help me"}, []string{"get /help"}},
+		{MatchSuffix, "?!", false, []string{"really?!"}, []string{"?! no"}},
+		{MatchExact, "ping", false, []string{"ping"}, []string{"ping!", "a ping"}},
+		{MatchExact, "ping", true, []string{"PING", "Ping"}, []string{"pinged"}},
+		{MatchContains, "Weather", false, []string{"Weather report"}, []string{"weather report"}},
+		{MatchGlob, "weather in *", false, []string{"weather in Paris", "weather in \nNew York"}, []string{"the weather in Paris"}},
+		{MatchGlob, "file?.[ch]", false, []string{"file1.c", "fileA.h"}, []string{"file12.c", "file1.go"}},
+		{MatchGlob, "[!a]*", false, []string{"b", "zebra"}, []string{"apple"}},
+	}
+	for _, tt := range tests {
+		rules, err := CompileRules([]RuleConfig{{
+			Pattern: tt.pattern, MatchType: tt.matchType, CaseInsensitive: &tt.caseInsensitive, Responses: []string{"ok"},
+		}})
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.matchType, tt.pattern, err)
+		}
+		for _, in := range tt.match {
+			if !rules[0].Pattern.MatchString(in) {
+				t.Errorf("%s %q (case_insensitive=%v) should match %q", tt.matchType, tt.pattern, tt.caseInsensitive, in)
+			}
+		}
+		for _, in := range tt.noMatch {
+			if rules[0].Pattern.MatchString(in) {
+				t.Errorf("%s %q (case_insensitive=%v) should not match %q", tt.matchType, tt.pattern, tt.caseInsensitive, in)
+			}
+		}
+	}
+
+	if _, err := CompileRules([]RuleConfig{{Pattern: "x", MatchType: "fuzzy", Responses: []string{"ok"}}}); err == nil {
+		t.Error("expected error for unknown match_type")
+	}
+
+	// Templates still see the input, and glob wildcards as captures.
+	rules, err := CompileRules([]RuleConfig{{
+		Pattern: "weather in *", MatchType: MatchGlob, Responses: []string{"${input}: sunny in $1"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New(WithRules(rules...)).Handler())
+	defer ts.Close()
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"m","messages":[{"role":"user","content":"weather in Paris"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "weather in Paris: sunny in Paris") {
+		t.Errorf("response %s does not contain the expanded template", body)
+	}
+}
+
 func TestCompileRulesInvalidRegex(t *testing.T) {
 	configs := []RuleConfig{
 		{Pattern: "[invalid", Responses: []string{"ok"}},
@@ -232,6 +544,31 @@ func TestConfigToOptions(t *testing.T) {
 	}
 }
 
+func TestParseConfigNoMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, path, data string
+		want             NoMatchConfig
+	}{
+		{"yaml mode", "c.yaml", "defaults:\n  no_match: echo\n", NoMatchConfig{Mode: NoMatchEcho}},
+		{"yaml text", "c.yaml", "defaults:\n  no_match:\n    text: nope\n", NoMatchConfig{Mode: NoMatchText, Text: "nope"}},
+		{"json mode", "c.json", `{"defaults": {"no_match": "empty"}}`, NoMatchConfig{Mode: NoMatchEmpty}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tc.data), tc.path)
+			if err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+			if cfg.Defaults.NoMatch == nil || *cfg.Defaults.NoMatch != tc.want {
+				t.Errorf("got %+v, want %+v", cfg.Defaults.NoMatch, tc.want)
+			}
+		})
+	}
+
+	if _, err := ParseConfig([]byte("defaults:\n  no_match: shrug\n"), "c.yaml"); err == nil {
+		t.Error("expected error for unknown no_match mode")
+	}
+}
+
 func TestConfigToOptionsInvalidRule(t *testing.T) {
 	cfg := &Config{
 		Rules: []RuleConfig{
@@ -295,8 +632,8 @@ func TestConfigTokenDelay(t *testing.T) {
 	for _, opt := range opts {
 		opt(s)
 	}
-	if s.tokenDelay != 50*time.Millisecond {
-		t.Errorf("tokenDelay = %v, want 50ms", s.tokenDelay)
+	if d := s.getTokenDelay(); d != 50*time.Millisecond {
+		t.Errorf("tokenDelay = %v, want 50ms", d)
 	}
 }
 
@@ -323,7 +660,58 @@ rules:
 	for _, opt := range opts {
 		opt(s)
 	}
-	if !s.verbose {
+	if !s.verbose.Load() {
 		t.Error("server verbose should be true after applying options")
 	}
 }
+
+type greetResponder struct{ greeting string }
+
+func (g greetResponder) Respond([]InternalMessage) (Response, error) {
+	return Response{Text: g.greeting}, nil
+}
+
+func TestConfigRegisteredResponder(t *testing.T) {
+	RegisterResponder("test-greet", func(options map[string]any) (Responder, error) {
+		greeting, _ := options["greeting"].(string)
+		return greetResponder{greeting: greeting}, nil
+	})
+
+	data := []byte(`
+responder:
+  name: test-greet
+  options:
+    greeting: "Howdy"
+`)
+	cfg, err := ParseConfig(data, "test.yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	opts, err := cfg.ToOptions()
+	if err != nil {
+		t.Fatalf("ToOptions: %v", err)
+	}
+	ts := httptest.NewServer(New(opts...).Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"Howdy"`) {
+		t.Errorf("expected registered responder's text, got %s", body)
+	}
+
+	cfg.Responder.Name = "missing"
+	if _, err := cfg.ToOptions(); err == nil || !strings.Contains(err.Error(), "test-greet") {
+		t.Errorf("expected unknown responder error listing registered names, got %v", err)
+	}
+	cfg.Responder.Name = "test-greet"
+	cfg.Rules = []RuleConfig{{Pattern: ".*", Responses: []string{"x"}}}
+	if _, err := cfg.ToOptions(); err == nil {
+		t.Error("expected error when both rules and responder are set")
+	}
+}
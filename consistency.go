@@ -0,0 +1,113 @@
+package llmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithStreamConsistencyCheck makes streaming chat completions and messages
+// requests check themselves: the stream is buffered, its text deltas are
+// concatenated, and the result is compared with the text the same request
+// would have returned without streaming. If they differ the client gets a
+// 500 with both texts instead of the stream. It is a development aid for
+// catching streaming drift and is off by default. Because the stream is
+// buffered, it reaches the client in one burst after the check.
+func WithStreamConsistencyCheck(enabled bool) Option {
+	return func(s *Server) {
+		s.streamConsistencyCheck = enabled
+	}
+}
+
+// checkedStream calls stream to write a streaming response to w. With
+// WithStreamConsistencyCheck, the stream goes to a buffer first and is only
+// passed on if its text equals want, the non-streaming response text.
+func (s *Server) checkedStream(w http.ResponseWriter, apiFormat, want string, stream func(w http.ResponseWriter)) {
+	if !s.streamConsistencyCheck {
+		stream(w)
+		return
+	}
+	buf := &streamBuffer{header: http.Header{}}
+	stream(buf)
+	if got := streamedText(buf.body.Bytes(), apiFormat); got != want {
+		msg := fmt.Sprintf("stream consistency check failed: streamed text %q does not match non-streamed text %q", got, want)
+		writeFaultError(w, http.StatusInternalServerError, msg, "server_error", apiFormat)
+		return
+	}
+	buf.replay(w)
+}
+
+// streamBuffer is a flushable http.ResponseWriter that keeps what is
+// written to it.
+type streamBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *streamBuffer) Header() http.Header         { return b.header }
+func (b *streamBuffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *streamBuffer) WriteHeader(status int)      { b.status = status }
+func (b *streamBuffer) Flush()                      {}
+
+// replay writes the buffered response to w, one SSE event per write so
+// that writers which look at individual events (such as mid-stream
+// faults) see the same writes as an unbuffered stream.
+func (b *streamBuffer) replay(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	flusher, _ := w.(http.Flusher)
+	for _, event := range strings.SplitAfter(b.body.String(), "\n\n") {
+		if event == "" {
+			continue
+		}
+		if _, err := w.Write([]byte(event)); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// streamedText concatenates the text deltas of an OpenAI chat or
+// Anthropic messages SSE stream.
+func streamedText(stream []byte, apiFormat string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(string(stream), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		if apiFormat == "anthropic" {
+			var event struct {
+				Type  string `json:"type"`
+				Delta struct {
+					Type string `json:"type"`
+					Text string `json:"text"`
+				} `json:"delta"`
+			}
+			if json.Unmarshal([]byte(data), &event) == nil && event.Type == "content_block_delta" && event.Delta.Type == "text_delta" {
+				sb.WriteString(event.Delta.Text)
+			}
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if json.Unmarshal([]byte(data), &chunk) == nil && len(chunk.Choices) > 0 {
+			sb.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package llmock_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestStreamConsistencyCheck(t *testing.T) {
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithTokenDelay(0),
+		llmock.WithStreamConsistencyCheck(true),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	stream := func(path, content string) (int, string) {
+		t.Helper()
+		body := `{"model":"test","stream":true,"max_tokens":100,"messages":[{"role":"user","content":` + jsonString(content) + `}]}`
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	for _, path := range []string{"/v1/chat/completions", "/v1/messages"} {
+		t.Run(path, func(t *testing.T) {
+			status, body := stream(path, "the quick brown fox jumps over the lazy dog")
+			if status != http.StatusOK {
+				t.Fatalf("consistent stream: status %d, body %s", status, body)
+			}
+			if !strings.Contains(body, "fox") {
+				t.Errorf("consistent stream body missing text: %s", body)
+			}
+
+			// The streamer splits on whitespace, so it can't reproduce a
+			// line break in the text.
+			status, body = stream(path, "first line\nsecond line")
+			if status != http.StatusInternalServerError {
+				t.Fatalf("inconsistent stream: status %d, want 500; body %s", status, body)
+			}
+			if !strings.Contains(body, "stream consistency check failed") {
+				t.Errorf("expected diagnostic, got %s", body)
+			}
+		})
+	}
+}
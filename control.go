@@ -3,7 +3,9 @@ package llmock
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"regexp"
+	"time"
 )
 
 // controlPlane handles MCP control plane requests (POST /mcp/control).
@@ -12,6 +14,7 @@ import (
 type controlPlane struct {
 	admin  *adminState
 	faults *faultState
+	srv    *Server
 }
 
 // controlToolDef describes an MCP tool for the tools/list response.
@@ -30,7 +33,9 @@ var controlTools = []controlToolDef{
 			"properties": map[string]any{
 				"pattern":   map[string]any{"type": "string", "description": "Regex pattern to match against user messages"},
 				"responses": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Response templates (one is chosen randomly)"},
-				"priority":  map[string]any{"type": "integer", "description": "0=prepend (default), -1=append, N=insert at index N"},
+				"priority":  map[string]any{"type": "integer", "description": "Higher priorities are matched first (default 0). Ties go ahead of existing rules."},
+				"model":     map[string]any{"type": "string", "description": "Optional regex the request model must also match"},
+				"user":      map[string]any{"type": "string", "description": "Optional regex the request user must also match"},
 			},
 			"required": []string{"pattern", "responses"},
 		},
@@ -53,23 +58,42 @@ var controlTools = []controlToolDef{
 	},
 	{
 		name:        "llmock_add_fault",
-		description: "Add a fault injection. Types: error (HTTP error), delay (latency), timeout (hang), malformed (bad response), rate_limit (429).",
+		description: "Add a fault injection. Types: error (HTTP error), delay (latency), timeout (hang), malformed (bad response), rate_limit (429), refusal (model refuses with message), bad_tool_args (invalid tool-call arguments JSON). Alternatively give a preset for a real provider error body.",
 		inputSchema: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
-				"type":        map[string]any{"type": "string", "enum": []string{"error", "delay", "timeout", "malformed", "rate_limit"}, "description": "Fault type"},
+				"type":        map[string]any{"type": "string", "enum": []string{"error", "delay", "timeout", "malformed", "rate_limit", "refusal", "bad_tool_args"}, "description": "Fault type"},
 				"status":      map[string]any{"type": "integer", "description": "HTTP status code (for error faults)"},
 				"message":     map[string]any{"type": "string", "description": "Error message"},
 				"delay_ms":    map[string]any{"type": "integer", "description": "Delay in milliseconds (for delay faults)"},
 				"probability": map[string]any{"type": "number", "description": "Probability of firing (0-1, default 1)"},
 				"count":       map[string]any{"type": "integer", "description": "Auto-clear after N triggers (0=unlimited)"},
+				"preset":      map[string]any{"type": "string", "enum": []string{"anthropic_overloaded", "openai_quota", "gemini_resource_exhausted"}, "description": "Provider error preset; type may be omitted"},
+				"match":       map[string]any{"type": "string", "description": "Only fire when the last user message matches this regex"},
+				"mid_stream":  map[string]any{"type": "boolean", "description": "For error faults on Anthropic and OpenAI streams, send a few deltas before the error"},
 			},
-			"required": []string{"type"},
+		},
+	},
+	{
+		name:        "llmock_update_fault",
+		description: "Change fields of one active fault, such as its probability or count, leaving the rest as they are. Faults are identified by the id from llmock_list_faults.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id":          map[string]any{"type": "integer", "description": "Fault id from llmock_list_faults"},
+				"status":      map[string]any{"type": "integer", "description": "HTTP status code (for error faults)"},
+				"message":     map[string]any{"type": "string", "description": "Error message"},
+				"delay_ms":    map[string]any{"type": "integer", "description": "Delay in milliseconds (for delay faults)"},
+				"probability": map[string]any{"type": "number", "description": "Probability of firing (0-1)"},
+				"count":       map[string]any{"type": "integer", "description": "Triggers left before auto-clearing (0=unlimited)"},
+				"match":       map[string]any{"type": "string", "description": "Only fire when the last user message matches this regex"},
+			},
+			"required": []string{"id"},
 		},
 	},
 	{
 		name:        "llmock_list_faults",
-		description: "List all active fault injections.",
+		description: "List all active fault injections with their ids.",
 		inputSchema: map[string]any{
 			"type":       "object",
 			"properties": map[string]any{},
@@ -99,6 +123,126 @@ var controlTools = []controlToolDef{
 			"properties": map[string]any{},
 		},
 	},
+	{
+		name:        "llmock_set_corpus",
+		description: "Retrain the Markov chain used for generated responses. Provide either the corpus text or a path to a corpus file.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text": map[string]any{"type": "string", "description": "Training text"},
+				"file": map[string]any{"type": "string", "description": "Path to a training text file"},
+			},
+		},
+	},
+	{
+		name:        "llmock_set_token_delay",
+		description: "Set the delay between streamed tokens. 0 restores the default of 15ms.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"delay_ms": map[string]any{"type": "integer", "description": "Delay between tokens in milliseconds"},
+			},
+			"required": []string{"delay_ms"},
+		},
+	},
+	{
+		name:        "llmock_add_mcp_tool",
+		description: "Add a tool to the mock MCP server.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":         map[string]any{"type": "string", "description": "Tool name"},
+				"description":  map[string]any{"type": "string", "description": "Tool description"},
+				"input_schema": map[string]any{"type": "object", "description": "JSON Schema for the tool's arguments"},
+				"responses":    map[string]any{"type": "array", "items": map[string]any{"type": "object"}, "description": "Pattern-matched results: {pattern, result, is_error, is_json}"},
+			},
+			"required": []string{"name"},
+		},
+	},
+	{
+		name:        "llmock_list_mcp_tools",
+		description: "List the mock MCP server's tools.",
+		inputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
+	{
+		name:        "llmock_add_mcp_resource",
+		description: "Add a resource to the mock MCP server, replacing any resource with the same URI.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"uri":       map[string]any{"type": "string", "description": "Resource URI"},
+				"name":      map[string]any{"type": "string", "description": "Resource name"},
+				"mime_type": map[string]any{"type": "string", "description": "MIME type of the content"},
+				"content":   map[string]any{"type": "string", "description": "Resource content"},
+			},
+			"required": []string{"uri"},
+		},
+	},
+	{
+		name:        "llmock_list_mcp_resources",
+		description: "List the mock MCP server's resources.",
+		inputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
+	{
+		name:        "llmock_add_mcp_resource_template",
+		description: "Add a resource template to the mock MCP server. {var} placeholders in uri_template are substituted into content.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"uri_template": map[string]any{"type": "string", "description": "URI template, e.g. file:///logs/{date}.txt"},
+				"name":         map[string]any{"type": "string", "description": "Template name"},
+				"description":  map[string]any{"type": "string", "description": "Template description"},
+				"mime_type":    map[string]any{"type": "string", "description": "MIME type of the content"},
+				"content":      map[string]any{"type": "string", "description": "Content with {var} placeholders"},
+				"completions":  map[string]any{"type": "object", "description": "Candidate values per variable for completion/complete"},
+			},
+			"required": []string{"uri_template"},
+		},
+	},
+	{
+		name:        "llmock_list_mcp_resource_templates",
+		description: "List the mock MCP server's resource templates.",
+		inputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
+	{
+		name:        "llmock_add_mcp_prompt",
+		description: "Add a prompt to the mock MCP server.",
+		inputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":        map[string]any{"type": "string", "description": "Prompt name"},
+				"description": map[string]any{"type": "string", "description": "Prompt description"},
+				"arguments":   map[string]any{"type": "array", "items": map[string]any{"type": "object"}, "description": "Prompt arguments: {name, required, completions}"},
+				"template":    map[string]any{"type": "string", "description": "Prompt template with {{arg}} placeholders"},
+			},
+			"required": []string{"name"},
+		},
+	},
+	{
+		name:        "llmock_list_mcp_prompts",
+		description: "List the mock MCP server's prompts.",
+		inputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
+	{
+		name:        "llmock_reset_mcp",
+		description: "Reset the mock MCP server's tools, resources, resource templates, and prompts to the initial configuration.",
+		inputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	},
 	{
 		name:        "llmock_reset",
 		description: "Full reset: restore rules to initial config, clear all faults, and clear the request log.",
@@ -160,11 +304,18 @@ func (cp *controlPlane) dispatch(req jsonRPCRequest) jsonRPCResponse {
 }
 
 func (cp *controlPlane) initialize(req jsonRPCRequest) jsonRPCResponse {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if req.Params != nil {
+		json.Unmarshal(req.Params, &params)
+	}
+	version, _ := negotiateMCPVersion(params.ProtocolVersion)
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
 		Result: map[string]any{
-			"protocolVersion": "2025-03-26",
+			"protocolVersion": version,
 			"serverInfo": map[string]any{
 				"name":    "llmock-control",
 				"version": "1.0.0",
@@ -235,6 +386,8 @@ func (cp *controlPlane) toolsCall(req jsonRPCRequest) jsonRPCResponse {
 		result, callErr = cp.callResetRules()
 	case "llmock_add_fault":
 		result, callErr = cp.callAddFault(params.Arguments)
+	case "llmock_update_fault":
+		result, callErr = cp.callUpdateFault(params.Arguments)
 	case "llmock_list_faults":
 		result, callErr = cp.callListFaults()
 	case "llmock_clear_faults":
@@ -243,6 +396,28 @@ func (cp *controlPlane) toolsCall(req jsonRPCRequest) jsonRPCResponse {
 		result, callErr = cp.callListRequests()
 	case "llmock_clear_requests":
 		result, callErr = cp.callClearRequests()
+	case "llmock_set_corpus":
+		result, callErr = cp.callSetCorpus(params.Arguments)
+	case "llmock_set_token_delay":
+		result, callErr = cp.callSetTokenDelay(params.Arguments)
+	case "llmock_add_mcp_tool":
+		result, callErr = cp.callAddMCPTool(params.Arguments)
+	case "llmock_list_mcp_tools":
+		result, callErr = cp.callListMCP(func(m *mcpState) any { return m.getTools() })
+	case "llmock_add_mcp_resource":
+		result, callErr = cp.callAddMCPResource(params.Arguments)
+	case "llmock_list_mcp_resources":
+		result, callErr = cp.callListMCP(func(m *mcpState) any { return m.getResources() })
+	case "llmock_add_mcp_resource_template":
+		result, callErr = cp.callAddMCPResourceTemplate(params.Arguments)
+	case "llmock_list_mcp_resource_templates":
+		result, callErr = cp.callListMCP(func(m *mcpState) any { return m.getResourceTemplates() })
+	case "llmock_add_mcp_prompt":
+		result, callErr = cp.callAddMCPPrompt(params.Arguments)
+	case "llmock_list_mcp_prompts":
+		result, callErr = cp.callListMCP(func(m *mcpState) any { return m.getPrompts() })
+	case "llmock_reset_mcp":
+		result, callErr = cp.callResetMCP()
 	case "llmock_reset":
 		result, callErr = cp.callReset()
 	default:
@@ -300,20 +475,31 @@ func (cp *controlPlane) callAddRule(args map[string]any) (string, error) {
 		if !ok {
 			return "", &controlError{"responses must be an array of strings"}
 		}
+		if err := validateTemplate(s); err != nil {
+			return "", &controlError{"invalid response template: " + err.Error()}
+		}
 		responses[i] = s
 	}
 
-	priority := 0
-	if p, ok := args["priority"]; ok {
-		// JSON numbers are float64.
-		if pf, ok := p.(float64); ok {
-			priority = int(pf)
+	rule := Rule{Pattern: re, Responses: responses}
+	// JSON numbers are float64.
+	if p, ok := args["priority"].(float64); ok {
+		rule.Priority = int(p)
+	}
+	if modelStr, _ := args["model"].(string); modelStr != "" {
+		rule.Model, err = regexp.Compile(modelStr)
+		if err != nil {
+			return "", &controlError{"invalid model regex: " + err.Error()}
+		}
+	}
+	if userStr, _ := args["user"].(string); userStr != "" {
+		rule.User, err = regexp.Compile(userStr)
+		if err != nil {
+			return "", &controlError{"invalid user regex: " + err.Error()}
 		}
 	}
 
-	cp.admin.addRules([]Rule{
-		{Pattern: re, Responses: responses},
-	}, priority)
+	cp.admin.addRules([]Rule{rule})
 
 	return "Rule added successfully", nil
 }
@@ -331,11 +517,12 @@ func (cp *controlPlane) callResetRules() (string, error) {
 
 func (cp *controlPlane) callAddFault(args map[string]any) (string, error) {
 	typeStr, _ := args["type"].(string)
-	if typeStr == "" {
-		return "", &controlError{"type is required"}
+	preset, _ := args["preset"].(string)
+	if typeStr == "" && preset == "" {
+		return "", &controlError{"type or preset is required"}
 	}
 
-	f := Fault{Type: FaultType(typeStr)}
+	f := Fault{Type: FaultType(typeStr), Preset: preset}
 	if v, ok := args["status"].(float64); ok {
 		f.Status = int(v)
 	}
@@ -354,13 +541,42 @@ func (cp *controlPlane) callAddFault(args map[string]any) (string, error) {
 	if v, ok := args["count"].(float64); ok {
 		f.Count = int(v)
 	}
+	if v, ok := args["match"].(string); ok {
+		f.Match = v
+	}
+	if v, ok := args["mid_stream"].(bool); ok {
+		f.MidStream = v
+	}
 
+	if err := validateFaults([]Fault{f}); err != nil {
+		return "", &controlError{err.Error()}
+	}
 	cp.faults.addFaults([]Fault{f})
 	return "Fault added successfully", nil
 }
 
+func (cp *controlPlane) callUpdateFault(args map[string]any) (string, error) {
+	id, ok := args["id"].(float64)
+	if !ok {
+		return "", &controlError{"id is required"}
+	}
+	fields := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != "id" {
+			fields[k] = v
+		}
+	}
+	patch, _ := json.Marshal(fields)
+	f, err := cp.faults.update(int(id), patch)
+	if err != nil {
+		return "", &controlError{err.Error()}
+	}
+	data, _ := json.Marshal(faultEntry{ID: int(id), Fault: f})
+	return string(data), nil
+}
+
 func (cp *controlPlane) callListFaults() (string, error) {
-	faults := cp.faults.getFaults()
+	faults := cp.faults.entries()
 	data, _ := json.Marshal(faults)
 	return string(data), nil
 }
@@ -381,6 +597,141 @@ func (cp *controlPlane) callClearRequests() (string, error) {
 	return "Request log cleared", nil
 }
 
+func (cp *controlPlane) callSetCorpus(args map[string]any) (string, error) {
+	text, _ := args["text"].(string)
+	file, _ := args["file"].(string)
+	source := "custom"
+	switch {
+	case text != "" && file != "":
+		return "", &controlError{"provide only one of text or file"}
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", &controlError{"reading corpus file: " + err.Error()}
+		}
+		text, source = string(data), "file:"+file
+	case text == "":
+		return "", &controlError{"text or file is required"}
+	}
+	cp.srv.markov.setCorpus(text, source)
+	return "Corpus updated", nil
+}
+
+func (cp *controlPlane) callSetTokenDelay(args map[string]any) (string, error) {
+	// JSON numbers are float64.
+	ms, ok := args["delay_ms"].(float64)
+	if !ok {
+		return "", &controlError{"delay_ms is required"}
+	}
+	if ms < 0 {
+		return "", &controlError{"delay_ms must not be negative"}
+	}
+	d := time.Duration(ms * float64(time.Millisecond))
+	cp.srv.tokenDelay.Store(int64(d))
+	return "Token delay set to " + cp.srv.getTokenDelay().String(), nil
+}
+
+// mcp returns the mock MCP server's state, or an error if MCP is not
+// enabled on this server.
+func (cp *controlPlane) mcp() (*mcpState, error) {
+	if cp.srv.mcp == nil {
+		return nil, &controlError{"MCP is not enabled"}
+	}
+	return cp.srv.mcp, nil
+}
+
+// decodeControlArgs converts tool call arguments into a config struct by
+// round-tripping them through JSON, so the config's json tags apply.
+func decodeControlArgs(args map[string]any, v any) error {
+	data, _ := json.Marshal(args)
+	if err := json.Unmarshal(data, v); err != nil {
+		return &controlError{"invalid arguments: " + err.Error()}
+	}
+	return nil
+}
+
+func (cp *controlPlane) callAddMCPTool(args map[string]any) (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	var tool MCPToolConfig
+	if err := decodeControlArgs(args, &tool); err != nil {
+		return "", err
+	}
+	if tool.Name == "" {
+		return "", &controlError{"name is required"}
+	}
+	state.addTools([]MCPToolConfig{tool})
+	return "MCP tool added successfully", nil
+}
+
+func (cp *controlPlane) callAddMCPResource(args map[string]any) (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	var res MCPResourceConfig
+	if err := decodeControlArgs(args, &res); err != nil {
+		return "", err
+	}
+	if res.URI == "" {
+		return "", &controlError{"uri is required"}
+	}
+	state.addResources([]MCPResourceConfig{res})
+	return "MCP resource added successfully", nil
+}
+
+func (cp *controlPlane) callAddMCPResourceTemplate(args map[string]any) (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	var tmpl MCPResourceTemplateConfig
+	if err := decodeControlArgs(args, &tmpl); err != nil {
+		return "", err
+	}
+	if tmpl.URITemplate == "" {
+		return "", &controlError{"uri_template is required"}
+	}
+	state.addResourceTemplates([]MCPResourceTemplateConfig{tmpl})
+	return "MCP resource template added successfully", nil
+}
+
+func (cp *controlPlane) callAddMCPPrompt(args map[string]any) (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	var prompt MCPPromptConfig
+	if err := decodeControlArgs(args, &prompt); err != nil {
+		return "", err
+	}
+	if prompt.Name == "" {
+		return "", &controlError{"name is required"}
+	}
+	state.addPrompts([]MCPPromptConfig{prompt})
+	return "MCP prompt added successfully", nil
+}
+
+func (cp *controlPlane) callListMCP(get func(*mcpState) any) (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(get(state))
+	return string(data), nil
+}
+
+func (cp *controlPlane) callResetMCP() (string, error) {
+	state, err := cp.mcp()
+	if err != nil {
+		return "", err
+	}
+	state.reset()
+	return "MCP configuration reset to initial state", nil
+}
+
 func (cp *controlPlane) callReset() (string, error) {
 	cp.admin.fullReset()
 	cp.faults.clear()
@@ -3,11 +3,13 @@ package llmock_test
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/shishberg/llmock"
 )
@@ -130,15 +132,27 @@ func TestControl_ToolsList(t *testing.T) {
 	}
 
 	expectedTools := map[string]bool{
-		"llmock_add_rule":      false,
-		"llmock_list_rules":    false,
-		"llmock_reset_rules":   false,
-		"llmock_add_fault":     false,
-		"llmock_list_faults":   false,
-		"llmock_clear_faults":  false,
-		"llmock_list_requests": false,
-		"llmock_clear_requests": false,
-		"llmock_reset":         false,
+		"llmock_add_rule":                    false,
+		"llmock_list_rules":                  false,
+		"llmock_reset_rules":                 false,
+		"llmock_add_fault":                   false,
+		"llmock_update_fault":                false,
+		"llmock_list_faults":                 false,
+		"llmock_clear_faults":                false,
+		"llmock_list_requests":               false,
+		"llmock_clear_requests":              false,
+		"llmock_set_corpus":                  false,
+		"llmock_set_token_delay":             false,
+		"llmock_add_mcp_tool":                false,
+		"llmock_list_mcp_tools":              false,
+		"llmock_add_mcp_resource":            false,
+		"llmock_list_mcp_resources":          false,
+		"llmock_add_mcp_resource_template":   false,
+		"llmock_list_mcp_resource_templates": false,
+		"llmock_add_mcp_prompt":              false,
+		"llmock_list_mcp_prompts":            false,
+		"llmock_reset_mcp":                   false,
+		"llmock_reset":                       false,
 	}
 
 	for _, tool := range result.Tools {
@@ -447,6 +461,147 @@ func TestControl_FullReset(t *testing.T) {
 	}
 }
 
+func TestControl_SetCorpus(t *testing.T) {
+	ts := controlTestServer(t, llmock.WithResponder(llmock.NewRuleResponder([]llmock.Rule{
+		{Pattern: regexp.MustCompile(".*"), Responses: []string{"{{markov}}"}},
+	})))
+	defer ts.Close()
+
+	resp := controlCallTool(t, ts, "llmock_set_corpus", map[string]any{
+		"text": "The zebra sings. The zebra dances. The zebra sleeps.",
+	})
+	getControlToolText(t, resp)
+
+	result := chatRequest(t, ts, "tell me something")
+	if !strings.Contains(result.Choices[0].Message.Content, "zebra") {
+		t.Errorf("expected response generated from the new corpus, got %q", result.Choices[0].Message.Content)
+	}
+
+	resp = controlCallTool(t, ts, "llmock_set_corpus", map[string]any{})
+	var errResult struct {
+		IsError bool `json:"isError"`
+	}
+	json.Unmarshal(resp.Result, &errResult)
+	if !errResult.IsError {
+		t.Error("expected isError when neither text nor file is given")
+	}
+}
+
+func TestControl_SetTokenDelay(t *testing.T) {
+	ts := controlTestServer(t, llmock.WithResponder(llmock.NewRuleResponder([]llmock.Rule{
+		{Pattern: regexp.MustCompile(".*"), Responses: []string{"one two three four"}},
+	})))
+	defer ts.Close()
+
+	resp := controlCallTool(t, ts, "llmock_set_token_delay", map[string]any{"delay_ms": 100})
+	if text := getControlToolText(t, resp); !strings.Contains(text, "100ms") {
+		t.Errorf("expected confirmation of 100ms delay, got: %s", text)
+	}
+
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"go"}]}`
+	start := time.Now()
+	httpResp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, httpResp.Body)
+	httpResp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected streaming to take at least 90ms with a 100ms token delay, took %v", elapsed)
+	}
+}
+
+func TestControl_MCPToolsAndReset(t *testing.T) {
+	ts := controlTestServer(t, llmock.WithMCP(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{{Name: "initial"}},
+	}))
+	defer ts.Close()
+
+	resp := controlCallTool(t, ts, "llmock_add_mcp_tool", map[string]any{
+		"name":        "lookup",
+		"description": "Look something up",
+		"responses":   []any{map[string]any{"pattern": ".*", "result": "found it"}},
+	})
+	getControlToolText(t, resp)
+
+	// The added tool is callable through the mock MCP server.
+	call := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "tools/call",
+		Params: map[string]any{"name": "lookup", "arguments": map[string]any{}},
+	})
+	if call.Error != nil || !strings.Contains(string(call.Result), "found it") {
+		t.Errorf("expected added tool to be callable, got %s", call.Result)
+	}
+
+	text := getControlToolText(t, controlCallTool(t, ts, "llmock_list_mcp_tools", nil))
+	if !strings.Contains(text, "initial") || !strings.Contains(text, "lookup") {
+		t.Errorf("expected both tools listed, got: %s", text)
+	}
+
+	getControlToolText(t, controlCallTool(t, ts, "llmock_reset_mcp", nil))
+	text = getControlToolText(t, controlCallTool(t, ts, "llmock_list_mcp_tools", nil))
+	if strings.Contains(text, "lookup") {
+		t.Errorf("expected added tool removed after reset, got: %s", text)
+	}
+}
+
+func TestControl_MCPResourcesAndPrompts(t *testing.T) {
+	ts := controlTestServer(t, llmock.WithMCP(llmock.MCPConfig{}))
+	defer ts.Close()
+
+	getControlToolText(t, controlCallTool(t, ts, "llmock_add_mcp_resource", map[string]any{
+		"uri": "file:///notes.txt", "name": "Notes", "content": "remember the milk",
+	}))
+	getControlToolText(t, controlCallTool(t, ts, "llmock_add_mcp_resource_template", map[string]any{
+		"uri_template": "file:///logs/{date}.txt", "name": "Daily log", "content": "Log for {date}",
+	}))
+	getControlToolText(t, controlCallTool(t, ts, "llmock_add_mcp_prompt", map[string]any{
+		"name": "greet", "template": "Hello {{name}}", "arguments": []any{map[string]any{"name": "name", "required": true}},
+	}))
+
+	read := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "resources/read",
+		Params: map[string]any{"uri": "file:///logs/2024-01-01.txt"},
+	})
+	if read.Error != nil || !strings.Contains(string(read.Result), "Log for 2024-01-01") {
+		t.Errorf("expected templated resource content, got %s", read.Result)
+	}
+
+	if text := getControlToolText(t, controlCallTool(t, ts, "llmock_list_mcp_resources", nil)); !strings.Contains(text, "notes.txt") {
+		t.Errorf("expected resource listed, got: %s", text)
+	}
+	if text := getControlToolText(t, controlCallTool(t, ts, "llmock_list_mcp_prompts", nil)); !strings.Contains(text, "greet") {
+		t.Errorf("expected prompt listed, got: %s", text)
+	}
+
+	// Required fields are validated.
+	resp := controlCallTool(t, ts, "llmock_add_mcp_resource", map[string]any{"name": "no uri"})
+	var errResult struct {
+		IsError bool `json:"isError"`
+	}
+	json.Unmarshal(resp.Result, &errResult)
+	if !errResult.IsError {
+		t.Error("expected isError when uri is missing")
+	}
+}
+
+func TestControl_MCPToolsRequireMCP(t *testing.T) {
+	ts := controlTestServer(t)
+	defer ts.Close()
+
+	resp := controlCallTool(t, ts, "llmock_list_mcp_tools", nil)
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	json.Unmarshal(resp.Result, &result)
+	if !result.IsError || !strings.Contains(result.Content[0].Text, "not enabled") {
+		t.Errorf("expected MCP not enabled error, got %s", resp.Result)
+	}
+}
+
 func TestControl_UnknownTool(t *testing.T) {
 	ts := controlTestServer(t)
 	defer ts.Close()
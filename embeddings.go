@@ -0,0 +1,158 @@
+package llmock
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// geminiEmbeddingDimensions is the default size of Gemini embedding vectors.
+const geminiEmbeddingDimensions = 768
+
+// embedVector returns a deterministic unit-length vector for text. The same
+// seed and text always produce the same vector, so similarity comparisons
+// in tests are stable without a real model.
+func embedVector(text string, dims int, seed int64) []float64 {
+	vec := make([]float64, dims)
+	var sum [sha256.Size]byte
+	for i := range vec {
+		// Each hash block yields four 64-bit values.
+		if i%4 == 0 {
+			sum = sha256.Sum256([]byte(fmt.Sprintf("%d\x00%d\x00%s", seed, i/4, text)))
+		}
+		u := binary.BigEndian.Uint64(sum[(i%4)*8:])
+		vec[i] = float64(u>>11)/(1<<52) - 1 // [-1, 1)
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	if norm > 0 {
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec
+}
+
+// GeminiEmbedRequest represents a Gemini embedContent request.
+type GeminiEmbedRequest struct {
+	Model                string        `json:"model,omitempty"`
+	Content              GeminiContent `json:"content"`
+	TaskType             string        `json:"taskType,omitempty"`
+	OutputDimensionality *int          `json:"outputDimensionality,omitempty"`
+}
+
+// GeminiBatchEmbedRequest represents a Gemini batchEmbedContents request.
+type GeminiBatchEmbedRequest struct {
+	Requests []GeminiEmbedRequest `json:"requests"`
+}
+
+// GeminiEmbedding holds a single embedding vector.
+type GeminiEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+// GeminiEmbedResponse represents a Gemini embedContent response.
+type GeminiEmbedResponse struct {
+	Embedding GeminiEmbedding `json:"embedding"`
+}
+
+// GeminiBatchEmbedResponse represents a Gemini batchEmbedContents response.
+type GeminiBatchEmbedResponse struct {
+	Embeddings []GeminiEmbedding `json:"embeddings"`
+}
+
+// geminiEmbedText joins the text parts of an embed request's content.
+func geminiEmbedText(c GeminiContent) string {
+	var texts []string
+	for _, p := range c.Parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// geminiEmbed validates one embed request and returns its vector.
+func (s *Server) geminiEmbed(req GeminiEmbedRequest) (GeminiEmbedding, error) {
+	text := geminiEmbedText(req.Content)
+	if text == "" {
+		return GeminiEmbedding{}, fmt.Errorf("content must contain at least one text part")
+	}
+	dims := geminiEmbeddingDimensions
+	if req.OutputDimensionality != nil {
+		if *req.OutputDimensionality < 1 {
+			return GeminiEmbedding{}, fmt.Errorf("outputDimensionality must be positive")
+		}
+		dims = *req.OutputDimensionality
+	}
+	var seed int64
+	if s.seed != nil {
+		seed = *s.seed
+	}
+	return GeminiEmbedding{Values: embedVector(text, dims, seed)}, nil
+}
+
+func (s *Server) handleGeminiEmbed(w http.ResponseWriter, r *http.Request) {
+	var req GeminiEmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	emb, err := s.geminiEmbed(req)
+	if err != nil {
+		writeGeminiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(geminiEmbedText(req.Content)); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "gemini", false) {
+			return
+		}
+	}
+
+	s.logAdminRequest(r, []InternalMessage{{Role: "user", Content: geminiEmbedText(req.Content)}}, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GeminiEmbedResponse{Embedding: emb})
+}
+
+func (s *Server) handleGeminiBatchEmbed(w http.ResponseWriter, r *http.Request) {
+	var req GeminiBatchEmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGeminiError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeGeminiError(w, http.StatusBadRequest, "requests array is required and must not be empty")
+		return
+	}
+	resp := GeminiBatchEmbedResponse{Embeddings: make([]GeminiEmbedding, len(req.Requests))}
+	for i, er := range req.Requests {
+		emb, err := s.geminiEmbed(er)
+		if err != nil {
+			writeGeminiError(w, http.StatusBadRequest, fmt.Sprintf("requests[%d]: %v", i, err))
+			return
+		}
+		resp.Embeddings[i] = emb
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(geminiEmbedText(req.Requests[0].Content)); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "gemini", false) {
+			return
+		}
+	}
+
+	s.logAdminRequest(r, []InternalMessage{{Role: "user", Content: geminiEmbedText(req.Requests[0].Content)}}, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,86 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestGemini_EmbedContent(t *testing.T) {
+	s := llmock.New(llmock.WithSeed(7))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	embed := func(text string) []float64 {
+		t.Helper()
+		body := `{"content": {"parts": [{"text": "` + text + `"}]}}`
+		resp, err := http.Post(ts.URL+"/v1beta/models/text-embedding-004:embedContent", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var result llmock.GeminiEmbedResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result.Embedding.Values
+	}
+
+	a := embed("hello world")
+	if len(a) != 768 {
+		t.Fatalf("expected 768 dimensions, got %d", len(a))
+	}
+	var norm float64
+	for _, v := range a {
+		norm += v * v
+	}
+	if math.Abs(norm-1) > 1e-9 {
+		t.Errorf("expected unit vector, got squared norm %f", norm)
+	}
+
+	b := embed("hello world")
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("expected identical vectors for identical text")
+		}
+	}
+	if c := embed("goodbye"); c[0] == a[0] && c[1] == a[1] {
+		t.Error("expected different text to produce a different vector")
+	}
+}
+
+func TestGemini_BatchEmbedContents(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	body := `{"requests": [
+		{"model": "models/text-embedding-004", "content": {"parts": [{"text": "one"}]}},
+		{"model": "models/text-embedding-004", "content": {"parts": [{"text": "two"}]}, "outputDimensionality": 16}
+	]}`
+	resp, err := http.Post(ts.URL+"/v1beta/models/text-embedding-004:batchEmbedContents", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result llmock.GeminiBatchEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Embeddings) != 2 {
+		t.Fatalf("expected 2 embeddings, got %d", len(result.Embeddings))
+	}
+	if len(result.Embeddings[0].Values) != 768 || len(result.Embeddings[1].Values) != 16 {
+		t.Errorf("unexpected dimensions %d, %d", len(result.Embeddings[0].Values), len(result.Embeddings[1].Values))
+	}
+}
@@ -0,0 +1,135 @@
+package llmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exportDocument is the body of GET /_mock/export: the part of a config
+// file that describes the server's mutable state. ParseConfig reads it
+// back, so it can be checked in as a config file or sent to
+// POST /_mock/import.
+type exportDocument struct {
+	Rules  []RuleConfig `yaml:"rules" json:"rules"`
+	Faults []Fault      `yaml:"faults,omitempty" json:"faults,omitempty"`
+	MCP    *MCPConfig   `yaml:"mcp,omitempty" json:"mcp,omitempty"`
+}
+
+// config converts a compiled rule back to its config form.
+func (r Rule) config() RuleConfig {
+	rc := RuleConfig{
+		Pattern:   r.Pattern.String(),
+		Responses: r.Responses,
+		ToolCall:  r.ToolCall,
+		MaxCalls:  r.MaxCalls,
+		Priority:  r.Priority,
+		Markov:    r.markovConfig,
+
+		FinishReason: r.FinishReason,
+		Blocks:       r.Blocks,
+		Preamble:     r.Preamble,
+		ToolCallText: r.ToolCallText,
+		Media:        r.Media,
+		Mode:         r.Mode,
+
+		CaseInsensitive: r.CaseInsensitive,
+	}
+	if r.Model != nil {
+		rc.Model = r.Model.String()
+	}
+	if r.User != nil {
+		rc.User = r.User.String()
+	}
+	return rc
+}
+
+// export returns the server's current rules, faults, and MCP config.
+// Count-limited faults are exported with the count they have left. The
+// built-in default rules are left out, since a server with no rules of
+// its own falls back to them anyway.
+func (s *Server) export() exportDocument {
+	var doc exportDocument
+	for _, r := range s.admin.snapshot() {
+		if r.builtin {
+			continue
+		}
+		doc.Rules = append(doc.Rules, r.config())
+	}
+	doc.Faults = s.faults.snapshot()
+	if s.mcp != nil {
+		doc.MCP = &MCPConfig{
+			Tools:             s.mcp.getTools(),
+			Resources:         s.mcp.getResources(),
+			Prompts:           s.mcp.getPrompts(),
+			ResourceTemplates: s.mcp.getResourceTemplates(),
+		}
+	}
+	return doc
+}
+
+// handleExport serves GET /_mock/export as JSON, or as YAML with
+// ?format=yaml or an Accept header asking for YAML.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	doc := s.export()
+	if r.URL.Query().Get("format") == "yaml" || strings.Contains(r.Header.Get("Accept"), "yaml") {
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// handleImport serves POST /_mock/import, replacing the rules, faults, and
+// (if given) MCP config with those in a config document, YAML or JSON.
+// Nothing changes if the document is invalid. Unlike a config file, the
+// document is not expanded from the server's environment and may not
+// include other files.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading body: "+err.Error())
+		return
+	}
+	name := "import.yaml"
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		name = "import.json"
+	}
+	cfg, err := parseConfig(data, name, nil, configOptions{untrusted: true})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := cfg.ToOptions(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid config: "+err.Error())
+		return
+	}
+	if cfg.MCP != nil && s.mcp == nil {
+		writeError(w, http.StatusBadRequest, "cannot import mcp config: MCP is not enabled")
+		return
+	}
+	rules, err := CompileRules(cfg.Rules)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid config: %v", err))
+		return
+	}
+
+	s.SetRules(rules)
+	s.faults.replace(cfg.Faults)
+	if cfg.MCP != nil {
+		s.SetMCPConfig(*cfg.MCP)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,141 @@
+package llmock_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	src := httptest.NewServer(llmock.New().Handler())
+	defer src.Close()
+
+	for path, body := range map[string]string{
+		"/_mock/rules":  `{"rules":[{"pattern":"deploy","responses":["Deploying now..."],"priority":5}]}`,
+		"/_mock/faults": `{"faults":[{"type":"error","status":503,"count":2,"match":"outage"}]}`,
+	} {
+		resp, err := http.Post(src.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s: status %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(src.URL + "/_mock/export?format=yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if _, err := llmock.ParseConfig(snapshot, "snapshot.yaml"); err != nil {
+		t.Fatalf("export is not a valid config file: %v\n%s", err, snapshot)
+	}
+
+	dst := httptest.NewServer(llmock.New().Handler())
+	defer dst.Close()
+	resp, err = http.Post(dst.URL+"/_mock/import", "application/yaml", strings.NewReader(string(snapshot)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d", resp.StatusCode)
+	}
+
+	for _, ts := range []*httptest.Server{src, dst} {
+		if got := chatRequest(t, ts, "please deploy").Choices[0].Message.Content; got != "Deploying now..." {
+			t.Errorf("expected the injected rule to answer, got %q", got)
+		}
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+			strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"outage"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected the injected fault to fire, got %d", resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Post(dst.URL+"/_mock/import", "application/json", strings.NewReader(`{"rules":[{"pattern":"[bad","responses":["x"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid import, got %d", resp.StatusCode)
+	}
+}
+
+func TestExportImport_DefaultRulesWithEndpointRules(t *testing.T) {
+	newServer := func() *httptest.Server {
+		return httptest.NewServer(llmock.New(llmock.WithEndpointRules(llmock.EndpointAnthropic,
+			llmock.Rule{Pattern: regexp.MustCompile(`(?i)hello`), Responses: []string{"Hello from Anthropic rules."}},
+		)).Handler())
+	}
+	src := newServer()
+	defer src.Close()
+
+	resp, err := http.Get(src.URL + "/_mock/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(snapshot), "How can I help") {
+		t.Errorf("expected the built-in rules to be left out, got %s", snapshot)
+	}
+
+	dst := newServer()
+	defer dst.Close()
+	resp, err = http.Post(dst.URL+"/_mock/import", "application/json", strings.NewReader(string(snapshot)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d", resp.StatusCode)
+	}
+
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, dst, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`, &anthropic)
+	if got := anthropic.Content[0].Text; got != "Hello from Anthropic rules." {
+		t.Errorf("expected the endpoint rule to answer after import, got %q", got)
+	}
+}
+
+func TestImport_NoEnvOrIncludes(t *testing.T) {
+	t.Setenv("LLMOCK_TEST_SECRET", "s3cret")
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/_mock/import", "application/yaml",
+		strings.NewReader(`rules: [{pattern: "secret", responses: ["${LLMOCK_TEST_SECRET}"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d", resp.StatusCode)
+	}
+	if got := chatRequest(t, ts, "secret").Choices[0].Message.Content; got != "${LLMOCK_TEST_SECRET}" {
+		t.Errorf("expected the reference to stay unexpanded, got %q", got)
+	}
+
+	resp, err = http.Post(ts.URL+"/_mock/import", "application/yaml", strings.NewReader("include: [/etc/llmock.yaml]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an import with include, got %d", resp.StatusCode)
+	}
+}
@@ -1,10 +1,15 @@
 package llmock
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,48 +28,165 @@ const (
 	FaultMalformed FaultType = "malformed"
 	// FaultRateLimit returns a 429 with Retry-After header and appropriate error body.
 	FaultRateLimit FaultType = "rate_limit"
+	// FaultRefusal returns a successful response in which the model refuses,
+	// signaled the way each provider reports a content-filter block.
+	FaultRefusal FaultType = "refusal"
+	// FaultBadToolArgs responds normally, but truncates any tool-call
+	// arguments so they are no longer valid JSON.
+	FaultBadToolArgs FaultType = "bad_tool_args"
 )
 
+// defaultRefusal is the refusal text used when a refusal fault has no message.
+const defaultRefusal = "I'm sorry, but I can't help with that."
+
 // Fault describes a fault to inject into the request pipeline.
 type Fault struct {
-	Type        FaultType `json:"type"`
-	Status      int       `json:"status,omitempty"`
-	Message     string    `json:"message,omitempty"`
-	ErrorType   string    `json:"error_type,omitempty"`
-	DelayMS     int       `json:"delay_ms,omitempty"`
-	Probability float64   `json:"probability,omitempty"`
-	Count       int       `json:"count,omitempty"`
+	Type        FaultType `yaml:"type" json:"type"`
+	Status      int       `yaml:"status,omitempty" json:"status,omitempty"`
+	Message     string    `yaml:"message,omitempty" json:"message,omitempty"`
+	ErrorType   string    `yaml:"error_type,omitempty" json:"error_type,omitempty"`
+	DelayMS     int       `yaml:"delay_ms,omitempty" json:"delay_ms,omitempty"`
+	Probability float64   `yaml:"probability,omitempty" json:"probability,omitempty"`
+	Count       int       `yaml:"count,omitempty" json:"count,omitempty"`
+	// Preset, if set, makes this an error fault that returns a real
+	// provider error body, such as "anthropic_overloaded" (see
+	// faultPresets). Type may be left empty. Status and Message override the
+	// preset's when set.
+	Preset string `yaml:"preset,omitempty" json:"preset,omitempty"`
+	// Match, if set, is a regex the request's input (the last user message)
+	// must match for the fault to fire. Unmatched requests neither trigger
+	// the fault nor use up its count.
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// MidStream, on an error fault (or preset) hit by a streaming
+	// Anthropic or OpenAI request, starts the stream normally and sends a
+	// couple of content deltas before the error, then ends the stream:
+	// Anthropic and the Responses API send an "error" SSE event, and OpenAI
+	// chat a chunk holding an error object, with no [DONE]. Other requests
+	// get the error as usual.
+	MidStream bool `yaml:"mid_stream,omitempty" json:"mid_stream,omitempty"`
+}
+
+// faultPreset is the error a preset produces for one API format.
+type faultPreset struct {
+	status  int
+	errType string // error type (OpenAI, Anthropic) or status (Gemini)
+	code    string // OpenAI error code
+	message string
 }
 
+// faultPresets maps each preset to its error for every API format. A
+// preset named after one provider produces that provider's error on its own
+// endpoints, and the nearest equivalent on the others.
+var faultPresets = map[string]map[string]faultPreset{
+	"anthropic_overloaded": {
+		"anthropic": {529, "overloaded_error", "", "Overloaded"},
+		"openai":    {503, "server_error", "", "The server is overloaded or not ready yet."},
+		"gemini":    {503, "UNAVAILABLE", "", "The model is overloaded. Please try again later."},
+	},
+	"openai_quota": {
+		"openai":    {429, "insufficient_quota", "insufficient_quota", "You exceeded your current quota, please check your plan and billing details."},
+		"anthropic": {400, "invalid_request_error", "", "Your credit balance is too low to access the Anthropic API."},
+		"gemini":    {429, "RESOURCE_EXHAUSTED", "", "You exceeded your current quota, please check your plan and billing details."},
+	},
+	"gemini_resource_exhausted": {
+		"gemini":    {429, "RESOURCE_EXHAUSTED", "", "Resource has been exhausted (e.g. check quota)."},
+		"openai":    {429, "requests", "rate_limit_exceeded", "Rate limit reached for requests."},
+		"anthropic": {429, "rate_limit_error", "", "Number of request tokens has exceeded your rate limit."},
+	},
+}
+
+// validateFaults checks that every fault's preset, if any, is known and
+// that its match pattern compiles.
+func validateFaults(faults []Fault) error {
+	for _, f := range faults {
+		if f.Preset != "" && faultPresets[f.Preset] == nil {
+			return fmt.Errorf("unknown fault preset %q", f.Preset)
+		}
+		if _, err := regexp.Compile(f.Match); err != nil {
+			return fmt.Errorf("invalid fault match %q: %w", f.Match, err)
+		}
+	}
+	return nil
+}
+
+// Fault selection modes for WithFaultSelection.
+const (
+	FaultSelectionFirst  = "first"  // the first triggered fault in insertion order wins (the default)
+	FaultSelectionRandom = "random" // a triggered fault is chosen at random
+)
+
 // faultState manages the global fault configuration.
 type faultState struct {
-	mu     sync.Mutex
-	faults []activeFault
-	rng    *rand.Rand
+	mu        sync.Mutex
+	faults    []activeFault
+	rng       *rand.Rand
+	selection string
+	lastID    int
 }
 
 // activeFault is a Fault with remaining count tracking.
 type activeFault struct {
 	Fault
-	remaining int // 0 means unlimited
+	id        int            // stable handle for updating or removing the fault
+	remaining int            // 0 means unlimited
+	match     *regexp.Regexp // nil if the fault has no Match
+	invalid   bool           // Match did not compile; the fault never fires
+}
+
+// faultEntry is an active fault as listed by the admin API, with the id
+// that addresses it.
+type faultEntry struct {
+	ID int `json:"id"`
+	Fault
+}
+
+// errFaultNotFound is returned for a fault id that isn't active.
+var errFaultNotFound = errors.New("fault not found")
+
+func newActiveFault(f Fault) activeFault {
+	af := activeFault{Fault: f, remaining: f.Count}
+	if f.Match != "" {
+		re, err := regexp.Compile(f.Match)
+		af.match, af.invalid = re, err != nil
+	}
+	return af
 }
 
 func newFaultState(initial []Fault, rng *rand.Rand) *faultState {
 	fs := &faultState{rng: rng}
 	for _, f := range initial {
-		fs.faults = append(fs.faults, activeFault{Fault: f, remaining: f.Count})
+		fs.faults = append(fs.faults, fs.nextFault(f))
 	}
 	return fs
 }
 
-// evaluate checks if a fault should fire. Returns the fault and true if so.
-// Decrements count-based faults and removes exhausted ones.
-func (fs *faultState) evaluate() (Fault, bool) {
+// nextFault wraps f with the next fault id. fs.mu must be held, or fs not
+// yet shared.
+func (fs *faultState) nextFault(f Fault) activeFault {
+	fs.lastID++
+	af := newActiveFault(f)
+	af.id = fs.lastID
+	return af
+}
+
+// evaluate checks if a fault should fire for a request with the given
+// input. Returns the fault and true if so. Decrements count-based faults and
+// removes exhausted ones.
+//
+// Faults are considered in insertion order. Each one whose Match accepts
+// the input rolls for its Probability; of those that trigger, the first
+// wins, or with FaultSelectionRandom a uniformly random one. Faults that
+// aren't chosen keep their count.
+func (fs *faultState) evaluate(input string) (Fault, bool) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	var triggered []int
 	for i := range fs.faults {
 		f := &fs.faults[i]
+		if f.invalid || (f.match != nil && !f.match.MatchString(input)) {
+			continue
+		}
 		prob := f.Probability
 		if prob <= 0 {
 			prob = 1.0
@@ -72,17 +194,29 @@ func (fs *faultState) evaluate() (Fault, bool) {
 		if prob < 1.0 && fs.rng.Float64() >= prob {
 			continue
 		}
-		result := f.Fault
-		if f.remaining > 0 {
-			f.remaining--
-			if f.remaining == 0 {
-				// Remove exhausted fault.
-				fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
-			}
+		triggered = append(triggered, i)
+		if fs.selection != FaultSelectionRandom {
+			break
 		}
-		return result, true
 	}
-	return Fault{}, false
+	if len(triggered) == 0 {
+		return Fault{}, false
+	}
+
+	i := triggered[0]
+	if len(triggered) > 1 {
+		i = triggered[fs.rng.IntN(len(triggered))]
+	}
+	f := &fs.faults[i]
+	result := f.Fault
+	if f.remaining > 0 {
+		f.remaining--
+		if f.remaining == 0 {
+			// Remove exhausted fault.
+			fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
+		}
+	}
+	return result, true
 }
 
 // addFaults appends faults to the active list.
@@ -90,10 +224,81 @@ func (fs *faultState) addFaults(faults []Fault) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	for _, f := range faults {
-		fs.faults = append(fs.faults, activeFault{Fault: f, remaining: f.Count})
+		fs.faults = append(fs.faults, fs.nextFault(f))
 	}
 }
 
+// replace swaps the active faults for faults.
+func (fs *faultState) replace(faults []Fault) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = nil
+	for _, f := range faults {
+		fs.faults = append(fs.faults, fs.nextFault(f))
+	}
+}
+
+// update applies patch, a JSON object of Fault fields, to the active fault
+// with the given id and returns the result, with Count set to the triggers
+// left. Fields not in patch keep their values. A "count" in patch restarts
+// the fault's remaining triggers; otherwise they carry over.
+func (fs *faultState) update(id int, patch []byte) (Fault, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return Fault{}, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i, af := range fs.faults {
+		if af.id != id {
+			continue
+		}
+		f := af.Fault
+		if err := json.Unmarshal(patch, &f); err != nil {
+			return Fault{}, err
+		}
+		if err := validateFaults([]Fault{f}); err != nil {
+			return Fault{}, err
+		}
+		updated := newActiveFault(f)
+		updated.id = id
+		if _, ok := fields["count"]; !ok {
+			updated.remaining = af.remaining
+		}
+		fs.faults[i] = updated
+		f.Count = updated.remaining
+		return f, nil
+	}
+	return Fault{}, errFaultNotFound
+}
+
+// remove deletes the active fault with the given id, reporting whether
+// there was one.
+func (fs *faultState) remove(id int) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i, af := range fs.faults {
+		if af.id == id {
+			fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns the active faults with Count set to the number of
+// triggers each has left.
+func (fs *faultState) snapshot() []Fault {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	out := make([]Fault, len(fs.faults))
+	for i, f := range fs.faults {
+		out[i] = f.Fault
+		out[i].Count = f.remaining
+	}
+	return out
+}
+
 // clear removes all active faults.
 func (fs *faultState) clear() {
 	fs.mu.Lock()
@@ -101,6 +306,19 @@ func (fs *faultState) clear() {
 	fs.faults = nil
 }
 
+// entries returns the active faults with their ids, with Count set to the
+// number of triggers each has left, as in snapshot.
+func (fs *faultState) entries() []faultEntry {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	out := make([]faultEntry, len(fs.faults))
+	for i, f := range fs.faults {
+		out[i] = faultEntry{ID: f.id, Fault: f.Fault}
+		out[i].Count = f.remaining
+	}
+	return out
+}
+
 // getFaults returns a copy of the current faults for inspection.
 func (fs *faultState) getFaults() []Fault {
 	fs.mu.Lock()
@@ -119,6 +337,15 @@ func WithFault(f Fault) Option {
 	}
 }
 
+// WithFaultSelection sets how one fault is chosen when several trigger on
+// the same request: FaultSelectionFirst (the default) picks the earliest
+// added, FaultSelectionRandom picks one at random using the server's RNG.
+func WithFaultSelection(mode string) Option {
+	return func(s *Server) {
+		s.faultSelection = mode
+	}
+}
+
 // WithSeed sets a deterministic random seed for fault probability evaluation.
 func WithSeed(seed int64) Option {
 	return func(s *Server) {
@@ -126,9 +353,28 @@ func WithSeed(seed int64) Option {
 	}
 }
 
+// faultRequest is what a fault that answers in place of the model, such
+// as a refusal, needs to know about the request.
+type faultRequest struct {
+	model        string // as requested, before WithForceModel or WithModelSuffix
+	promptTokens int    // estimated as the endpoint estimates them
+}
+
 // executeFault handles writing the fault response for an already-triggered fault.
 // It returns true if the fault was fully handled (caller should return).
-func (s *Server) executeFault(w http.ResponseWriter, r *http.Request, f Fault, apiFormat string, isStream bool) bool {
+func (s *Server) executeFault(w http.ResponseWriter, r *http.Request, f Fault, req faultRequest, apiFormat string, isStream bool) bool {
+	if f.midStreamError(apiFormat, isStream) {
+		return false // faultWriter ends the stream with the error.
+	}
+	if p, ok := faultPresets[f.Preset][apiFormat]; ok {
+		if f.Status != 0 {
+			p.status = f.Status
+		}
+		p.message = faultMsg(f.Message, p.message)
+		writePresetError(w, p, apiFormat)
+		return true
+	}
+
 	switch f.Type {
 	case FaultDelay:
 		if f.DelayMS > 0 {
@@ -174,8 +420,9 @@ func (s *Server) executeFault(w http.ResponseWriter, r *http.Request, f Fault, a
 						{"content": map[string]any{"role": "model", "parts": []map[string]any{{"text": ""}}}},
 					},
 				}
-				data, _ := json.Marshal(partial)
-				fmt.Fprintf(w, "data: %s\n\n", data)
+				if gs, ok := s.newGeminiStream(w, r); ok {
+					gs.write(partial)
+				}
 			} else {
 				fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-timeout\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"delta\":{\"role\":\"assistant\"},\"index\":0}]}\n\n")
 			}
@@ -185,6 +432,9 @@ func (s *Server) executeFault(w http.ResponseWriter, r *http.Request, f Fault, a
 		<-r.Context().Done()
 		return true
 
+	case FaultRefusal:
+		return s.writeRefusal(w, r, faultMsg(f.Message, defaultRefusal), req, apiFormat, isStream)
+
 	case FaultMalformed:
 		if isStream {
 			w.Header().Set("Content-Type", "text/event-stream")
@@ -203,6 +453,214 @@ func (s *Server) executeFault(w http.ResponseWriter, r *http.Request, f Fault, a
 	}
 }
 
+// faultWriter wraps w for faults that alter an otherwise normal response.
+// For any other fault it returns w unchanged.
+func faultWriter(w http.ResponseWriter, f Fault, apiFormat string, isStream bool) http.ResponseWriter {
+	if f.Type == FaultBadToolArgs {
+		return &badToolArgsWriter{ResponseWriter: w, stream: isStream}
+	}
+	if f.midStreamError(apiFormat, isStream) {
+		mw := &midStreamErrorWriter{ResponseWriter: w, format: apiFormat}
+		mw.errType, mw.message = "server_error", "The server had an error while processing your request."
+		if apiFormat == "anthropic" {
+			mw.errType, mw.message = "overloaded_error", "Overloaded"
+		}
+		if p, ok := faultPresets[f.Preset][apiFormat]; ok {
+			mw.errType, mw.message = p.errType, p.message
+		}
+		mw.errType = faultMsg(f.ErrorType, mw.errType)
+		mw.message = faultMsg(f.Message, mw.message)
+		return mw
+	}
+	return w
+}
+
+// midStreamDeltas is the number of content deltas a MidStream fault
+// lets through before the error.
+const midStreamDeltas = 2
+
+// midStreamError reports whether f fails a request of this format partway
+// through its stream rather than up front.
+func (f Fault) midStreamError(apiFormat string, isStream bool) bool {
+	return f.MidStream && isStream && (apiFormat == "anthropic" || apiFormat == "openai") &&
+		(f.Type == FaultError || f.Preset != "")
+}
+
+// midStreamErrorWriter passes a stream through until midStreamDeltas
+// content deltas have been written, then sends an error and drops the
+// rest. Streams too short for that get the error in place of their final
+// event. The error is an Anthropic or Responses API "error" event, or, for
+// OpenAI chat, a data line holding an error object (with no [DONE] after
+// it). Each write must hold a whole event, as the stream writers' do.
+type midStreamErrorWriter struct {
+	http.ResponseWriter
+	format           string
+	errType, message string
+
+	deltas int
+	events bool // the stream uses named events (Responses API)
+	failed bool
+}
+
+// Stream events that carry content, and that finish a stream.
+var (
+	midStreamDeltaPrefixes = []string{
+		"event: content_block_delta",
+		"event: response.output_text.delta",
+		"event: response.function_call_arguments.delta",
+		"data: {",
+	}
+	midStreamEndPrefixes = []string{
+		"event: message_delta",
+		"event: response.completed",
+		"event: response.incomplete",
+		"data: [DONE]",
+	}
+)
+
+func (mw *midStreamErrorWriter) Write(p []byte) (int, error) {
+	if mw.failed {
+		return len(p), nil
+	}
+	mw.events = mw.events || bytes.HasPrefix(p, []byte("event: "))
+	// An OpenAI chat chunk with a finish_reason ends the content.
+	if hasAnyPrefix(p, midStreamEndPrefixes) || (!mw.events && bytes.Contains(p, []byte(`"finish_reason":"`))) {
+		mw.fail()
+		return len(p), nil
+	}
+	n, err := mw.ResponseWriter.Write(p)
+	if hasAnyPrefix(p, midStreamDeltaPrefixes) {
+		if mw.deltas++; mw.deltas >= midStreamDeltas {
+			mw.fail()
+		}
+	}
+	return n, err
+}
+
+// hasAnyPrefix reports whether p starts with any of prefixes.
+func hasAnyPrefix(p []byte, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(p, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail writes the error in the stream's format.
+func (mw *midStreamErrorWriter) fail() {
+	switch {
+	case mw.format == "anthropic":
+		writeSSE(mw.ResponseWriter, "error", map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": mw.errType, "message": mw.message},
+		})
+	case mw.events:
+		writeSSE(mw.ResponseWriter, "error", map[string]any{
+			"type": "error", "code": mw.errType, "message": mw.message, "param": nil,
+		})
+	default:
+		data, _ := json.Marshal(map[string]any{
+			"error": map[string]any{"message": mw.message, "type": mw.errType, "code": nil},
+		})
+		fmt.Fprintf(mw.ResponseWriter, "data: %s\n\n", data)
+	}
+	mw.Flush()
+	mw.failed = true
+}
+
+// streamStopped tells waitForToken that nothing more will be sent.
+func (mw *midStreamErrorWriter) streamStopped() bool {
+	return mw.failed
+}
+
+func (mw *midStreamErrorWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// badToolArgsWriter truncates the tool-call arguments in each JSON body or
+// SSE event written through it, leaving the envelope valid. Anthropic's
+// non-streaming input and Gemini's args are JSON objects, so they are
+// replaced with a string holding the truncated JSON. Each write must hold a
+// whole body or event, as the handlers' writes do.
+type badToolArgsWriter struct {
+	http.ResponseWriter
+	stream bool
+}
+
+func (bw *badToolArgsWriter) Write(p []byte) (int, error) {
+	out := p
+	if bytes.HasPrefix(p, []byte("event: ")) || bytes.HasPrefix(p, []byte("data: ")) {
+		lines := bytes.Split(p, []byte("\n"))
+		for i, line := range lines {
+			if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok {
+				if corrupted, ok := corruptToolArgsJSON(data, bw.stream); ok {
+					lines[i] = append([]byte("data: "), corrupted...)
+				}
+			}
+		}
+		out = bytes.Join(lines, []byte("\n"))
+	} else if corrupted, ok := corruptToolArgsJSON(bytes.TrimSpace(p), bw.stream); ok {
+		out = append(corrupted, '\n')
+	}
+	if _, err := bw.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (bw *badToolArgsWriter) Flush() {
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// corruptToolArgsJSON returns data with its tool-call arguments truncated,
+// and whether there were any to truncate.
+func corruptToolArgsJSON(data []byte, stream bool) ([]byte, bool) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil || !corruptToolArgs(v, stream) {
+		return nil, false
+	}
+	out, err := json.Marshal(v)
+	return out, err == nil
+}
+
+// corruptToolArgs truncates, in place, the tool-call arguments found in a
+// decoded OpenAI, Anthropic, Gemini or Responses body or stream event. It
+// reports whether anything changed.
+func corruptToolArgs(v any, stream bool) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			str, isStr := child.(string)
+			obj, isObj := child.(map[string]any)
+			switch {
+			case isStr && (k == "arguments" || k == "partial_json" ||
+				(k == "delta" && v["type"] == "response.function_call_arguments.delta")):
+				if t := strings.TrimSuffix(str, "}"); t != str {
+					v[k] = t
+					changed = true
+				}
+			case isObj && (k == "args" || (k == "input" && v["type"] == "tool_use" && !stream)):
+				data, _ := json.Marshal(obj)
+				v[k] = strings.TrimSuffix(string(data), "}")
+				changed = true
+			default:
+				changed = corruptToolArgs(child, stream) || changed
+			}
+		}
+	case []any:
+		for _, child := range v {
+			changed = corruptToolArgs(child, stream) || changed
+		}
+	}
+	return changed
+}
+
 // writeFaultError writes an error response in the appropriate API format.
 func writeFaultError(w http.ResponseWriter, status int, message, errType, apiFormat string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -242,6 +700,215 @@ func writeFaultError(w http.ResponseWriter, status int, message, errType, apiFor
 	}
 }
 
+// writePresetError writes a preset's error body in the given API format.
+func writePresetError(w http.ResponseWriter, p faultPreset, apiFormat string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(p.status)
+
+	switch apiFormat {
+	case "anthropic":
+		json.NewEncoder(w).Encode(map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    p.errType,
+				"message": p.message,
+			},
+		})
+	case "gemini":
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{
+				"code":    p.status,
+				"message": p.message,
+				"status":  p.errType,
+			},
+		})
+	default:
+		var code any
+		if p.code != "" {
+			code = p.code
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{
+				"message": p.message,
+				"type":    p.errType,
+				"param":   nil,
+				"code":    code,
+			},
+		})
+	}
+}
+
+// writeRefusal writes a 200 response in which the model refuses with msg.
+// It has the same id, model and usage as a normal response; only the text
+// and the stop reason differ. Endpoints that have no notion of a refusal,
+// such as embeddings, are left to respond normally, and false is returned.
+func (s *Server) writeRefusal(w http.ResponseWriter, r *http.Request, msg string, req faultRequest, apiFormat string, isStream bool) bool {
+	now := s.now().Unix()
+	model := s.responseModel(req.model)
+	outputTokens := countTokens(msg)
+	switch {
+	case apiFormat == "anthropic":
+		id := s.newID("msg_")
+		if !isStream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(AnthropicResponse{
+				ID:         id,
+				Type:       "message",
+				Role:       "assistant",
+				Content:    []AnthropicContentBlock{{Type: "text", Text: msg}},
+				Model:      model,
+				StopReason: "refusal",
+				Usage:      anthropicUsage(req.promptTokens, outputTokens, false),
+			})
+			return true
+		}
+		startSSE(w)
+		writeSSE(w, "message_start", map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id": id, "type": "message", "role": "assistant", "content": []any{}, "model": model,
+				"stop_reason": nil, "stop_sequence": nil,
+				"usage": map[string]any{"input_tokens": req.promptTokens, "output_tokens": 0},
+			},
+		})
+		writeSSE(w, "content_block_start", map[string]any{
+			"type": "content_block_start", "index": 0,
+			"content_block": map[string]any{"type": "text", "text": ""},
+		})
+		writeSSE(w, "content_block_delta", map[string]any{
+			"type": "content_block_delta", "index": 0,
+			"delta": map[string]any{"type": "text_delta", "text": msg},
+		})
+		writeSSE(w, "content_block_stop", map[string]any{"type": "content_block_stop", "index": 0})
+		writeSSE(w, "message_delta", map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": "refusal", "stop_sequence": nil},
+			"usage": map[string]any{"output_tokens": outputTokens},
+		})
+		writeSSE(w, "message_stop", map[string]any{"type": "message_stop"})
+		flushSSE(w)
+		return true
+
+	case apiFormat == "gemini":
+		if strings.Contains(r.URL.Path, "embed") {
+			return false
+		}
+		resp := s.withGeminiSafety(GeminiResponse{
+			Candidates: []GeminiCandidate{{
+				Content:      GeminiContent{Role: "model", Parts: []GeminiPart{{Text: msg}}},
+				FinishReason: "SAFETY",
+			}},
+			UsageMetadata: geminiUsage(req.promptTokens, outputTokens, false),
+			ModelVersion:  model,
+		}, true)
+		ratings := slices.Clone(resp.Candidates[0].SafetyRatings)
+		for i := range ratings {
+			if ratings[i].Category == "HARM_CATEGORY_DANGEROUS_CONTENT" {
+				ratings[i].Probability, ratings[i].Blocked = "HIGH", true
+			}
+		}
+		resp.Candidates[0].SafetyRatings = ratings
+		if !isStream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return true
+		}
+		if gs, ok := s.newGeminiStream(w, r); ok {
+			gs.write(resp)
+			gs.close()
+		}
+		return true
+
+	case r.URL.Path == "/v1/chat/completions":
+		id := s.chatCompletionID()
+		setResponseID(w, r, id)
+		if !isStream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"id":                 id,
+				"object":             "chat.completion",
+				"created":            now,
+				"model":              model,
+				"system_fingerprint": s.fingerprint,
+				"choices": []map[string]any{{
+					"index":         0,
+					"message":       map[string]any{"role": "assistant", "content": nil, "refusal": msg},
+					"finish_reason": "content_filter",
+				}},
+				"usage": openAIUsage(req.promptTokens, outputTokens, false),
+			})
+			return true
+		}
+		startSSE(w)
+		for _, choice := range []map[string]any{
+			{"index": 0, "delta": map[string]any{"role": "assistant", "content": nil, "refusal": msg}, "finish_reason": nil},
+			{"index": 0, "delta": map[string]any{}, "finish_reason": "content_filter"},
+		} {
+			data, _ := json.Marshal(map[string]any{
+				"id": id, "object": "chat.completion.chunk", "created": now, "model": model,
+				"system_fingerprint": s.fingerprint,
+				"choices":            []map[string]any{choice},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flushSSE(w)
+		return true
+
+	case r.URL.Path == "/v1/responses":
+		item := map[string]any{
+			"type":    "message",
+			"id":      s.newID("msg_"),
+			"status":  "completed",
+			"role":    "assistant",
+			"content": []map[string]any{{"type": "refusal", "refusal": msg}},
+		}
+		resp := map[string]any{
+			"id":         s.newID("resp_"),
+			"object":     "response",
+			"created_at": now,
+			"status":     "completed",
+			"model":      model,
+			"output":     []map[string]any{item},
+			"usage": ResponsesUsage{
+				InputTokens:  req.promptTokens,
+				OutputTokens: outputTokens,
+				TotalTokens:  req.promptTokens + outputTokens,
+			},
+		}
+		setResponseID(w, r, resp["id"].(string))
+		if !isStream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return true
+		}
+		startSSE(w)
+		writeSSE(w, "response.refusal.delta", map[string]any{
+			"type": "response.refusal.delta", "item_id": item["id"], "output_index": 0, "content_index": 0, "delta": msg,
+		})
+		writeSSE(w, "response.refusal.done", map[string]any{
+			"type": "response.refusal.done", "item_id": item["id"], "output_index": 0, "content_index": 0, "refusal": msg,
+		})
+		writeSSE(w, "response.completed", map[string]any{"type": "response.completed", "response": resp})
+		flushSSE(w)
+		return true
+	}
+	return false
+}
+
+// startSSE sets the headers for a server-sent event stream.
+func startSSE(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+func flushSSE(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func faultMsg(msg, fallback string) string {
 	if msg != "" {
 		return msg
@@ -3,9 +3,12 @@ package llmock_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -373,6 +376,52 @@ func TestFault_Probability_WithSeed(t *testing.T) {
 	}
 }
 
+func TestFault_Selection(t *testing.T) {
+	statuses := func(prob float64, opts ...llmock.Option) []int {
+		t.Helper()
+		opts = append(opts,
+			llmock.WithSeed(7),
+			llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 500, Probability: prob}),
+			llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 503, Probability: prob}),
+		)
+		ts := newFaultServer(t, opts...)
+		defer ts.Close()
+		var got []int
+		for range 30 {
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+				strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"hi"}]}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			got = append(got, resp.StatusCode)
+		}
+		return got
+	}
+
+	// When both always trigger, the first added wins by default.
+	for _, code := range statuses(1) {
+		if code != 500 {
+			t.Fatalf("expected the first fault to win, got %d", code)
+		}
+	}
+	// Random selection picks either.
+	if got := statuses(1, llmock.WithFaultSelection(llmock.FaultSelectionRandom)); !slices.Contains(got, 500) || !slices.Contains(got, 503) {
+		t.Errorf("expected random selection to pick both faults, got %v", got)
+	}
+
+	// Probabilistic faults select the same sequence for the same seed.
+	for _, mode := range []string{llmock.FaultSelectionFirst, llmock.FaultSelectionRandom} {
+		a, b := statuses(0.5, llmock.WithFaultSelection(mode)), statuses(0.5, llmock.WithFaultSelection(mode))
+		if !slices.Equal(a, b) {
+			t.Errorf("%s: expected a stable selection under a fixed seed, got %v and %v", mode, a, b)
+		}
+		if !slices.Contains(a, 500) || !slices.Contains(a, 503) || !slices.Contains(a, 200) {
+			t.Errorf("%s: expected a mix of 500, 503, and 200, got %v", mode, a)
+		}
+	}
+}
+
 // --- Admin API for faults ---
 
 func TestFault_AdminAPI_PostAndGet(t *testing.T) {
@@ -457,6 +506,77 @@ func TestFault_AdminAPI_Delete(t *testing.T) {
 	}
 }
 
+func TestFault_AdminAPI_UpdateAndRemoveByID(t *testing.T) {
+	ts := newFaultServer(t,
+		llmock.WithSeed(1),
+		llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 500}),
+		llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 503}),
+	)
+	defer ts.Close()
+
+	do := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	chat := func() int {
+		t.Helper()
+		return do(http.MethodPost, "/v1/chat/completions", `{"model":"test","messages":[{"role":"user","content":"hi"}]}`)
+	}
+
+	var list struct {
+		Faults []struct {
+			ID     int `json:"id"`
+			Status int `json:"status"`
+		} `json:"faults"`
+	}
+	resp, err := http.Get(ts.URL + "/_mock/faults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Faults) != 2 || list.Faults[0].ID == list.Faults[1].ID {
+		t.Fatalf("expected 2 faults with distinct ids, got %+v", list.Faults)
+	}
+	first, second := list.Faults[0].ID, list.Faults[1].ID
+
+	// Removing one fault leaves the other's id valid.
+	if code := do(http.MethodDelete, fmt.Sprintf("/_mock/faults/%d", first), ""); code != 200 {
+		t.Fatalf("expected 200 removing fault %d, got %d", first, code)
+	}
+	if code := do(http.MethodDelete, fmt.Sprintf("/_mock/faults/%d", first), ""); code != 404 {
+		t.Errorf("expected 404 removing fault %d again, got %d", first, code)
+	}
+	if code := chat(); code != 503 {
+		t.Fatalf("expected 503 before the update, got %d", code)
+	}
+
+	// Turning the probability down stops the fault firing.
+	if code := do(http.MethodPatch, fmt.Sprintf("/_mock/faults/%d", second), `{"probability":0.0001}`); code != 200 {
+		t.Fatalf("expected 200 updating fault %d, got %d", second, code)
+	}
+	for range 10 {
+		if code := chat(); code != 200 {
+			t.Fatalf("expected 200 after lowering the probability, got %d", code)
+		}
+	}
+
+	// Other fields are kept, and turning it back up restores it.
+	do(http.MethodPatch, fmt.Sprintf("/_mock/faults/%d", second), `{"probability":1}`)
+	if code := chat(); code != 503 {
+		t.Errorf("expected 503 after raising the probability, got %d", code)
+	}
+	if code := do(http.MethodPatch, fmt.Sprintf("/_mock/faults/%d", second), `{"match":"("}`); code != 400 {
+		t.Errorf("expected 400 for an invalid match, got %d", code)
+	}
+}
+
 // --- Faults evaluated before rules ---
 
 func TestFault_EvaluatedBeforeRules(t *testing.T) {
@@ -578,3 +698,509 @@ func TestFault_FullResetClearsFaults(t *testing.T) {
 	// This test documents that faults persist across full reset — they must be explicitly
 	// cleared via DELETE /_mock/faults.
 }
+
+// --- Presets ---
+
+func TestFault_Presets(t *testing.T) {
+	openai := `{"model":"test","messages":[{"role":"user","content":"hi"}]}`
+	anthropic := `{"model":"test","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`
+	gemini := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`
+
+	tests := []struct {
+		preset, path, body string
+		status             int
+		errType            string // error.type, or error.status for Gemini
+	}{
+		{"anthropic_overloaded", "/v1/messages", anthropic, 529, "overloaded_error"},
+		{"openai_quota", "/v1/chat/completions", openai, 429, "insufficient_quota"},
+		{"gemini_resource_exhausted", "/v1beta/models/gemini-pro:generateContent", gemini, 429, "RESOURCE_EXHAUSTED"},
+		// Presets render as the nearest equivalent on other providers.
+		{"anthropic_overloaded", "/v1/chat/completions", openai, 503, "server_error"},
+		{"openai_quota", "/v1beta/models/gemini-pro:generateContent", gemini, 429, "RESOURCE_EXHAUSTED"},
+		{"gemini_resource_exhausted", "/v1/messages", anthropic, 429, "rate_limit_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.preset+tt.path, func(t *testing.T) {
+			ts := newFaultServer(t, llmock.WithFault(llmock.Fault{Preset: tt.preset}))
+			defer ts.Close()
+
+			resp, err := http.Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+			var result struct {
+				Type  string `json:"type"`
+				Error struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			got := result.Error.Type
+			if strings.HasPrefix(tt.path, "/v1beta/") {
+				got = result.Error.Status
+			}
+			if got != tt.errType {
+				t.Errorf("expected error type %q, got %q", tt.errType, got)
+			}
+		})
+	}
+}
+
+func TestFault_UnknownPresetRejected(t *testing.T) {
+	ts := newFaultServer(t)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/_mock/faults", "application/json", strings.NewReader(`{"faults":[{"preset":"nope"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown preset, got %d", resp.StatusCode)
+	}
+}
+
+// --- Refusal fault ---
+
+func postRefusal(t *testing.T, path, body string) []byte {
+	t.Helper()
+	ts := newFaultServer(t, llmock.WithFault(llmock.Fault{Type: llmock.FaultRefusal, Message: "I won't do that."}))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a refusal, got %d", resp.StatusCode)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return data
+}
+
+func TestFault_Refusal_OpenAI(t *testing.T) {
+	data := postRefusal(t, "/v1/chat/completions", `{"model":"test","messages":[{"role":"user","content":"hi"}]}`)
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+				Refusal string  `json:"refusal"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	choice := result.Choices[0]
+	if choice.Message.Refusal != "I won't do that." || choice.Message.Content != nil || choice.FinishReason != "content_filter" {
+		t.Errorf("expected refusal with content_filter, got %s", data)
+	}
+
+	stream := postRefusal(t, "/v1/chat/completions", `{"model":"test","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if !strings.Contains(string(stream), `"refusal":"I won't do that."`) || !strings.Contains(string(stream), `"finish_reason":"content_filter"`) {
+		t.Errorf("expected streamed refusal, got %s", stream)
+	}
+}
+
+func TestFault_Refusal_Anthropic(t *testing.T) {
+	data := postRefusal(t, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.StopReason != "refusal" || len(result.Content) != 1 || result.Content[0].Text != "I won't do that." {
+		t.Errorf("expected refusal stop_reason with text, got %s", data)
+	}
+
+	stream := postRefusal(t, "/v1/messages", `{"model":"claude","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if !strings.Contains(string(stream), `"stop_reason":"refusal"`) {
+		t.Errorf("expected streamed refusal stop_reason, got %s", stream)
+	}
+}
+
+func TestFault_Refusal_Gemini(t *testing.T) {
+	data := postRefusal(t, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	var result struct {
+		Candidates []struct {
+			FinishReason  string `json:"finishReason"`
+			SafetyRatings []struct {
+				Category string `json:"category"`
+				Blocked  bool   `json:"blocked"`
+			} `json:"safetyRatings"`
+		} `json:"candidates"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	c := result.Candidates[0]
+	blocked := false
+	for _, rating := range c.SafetyRatings {
+		blocked = blocked || rating.Blocked
+	}
+	if c.FinishReason != "SAFETY" || !blocked {
+		t.Errorf("expected SAFETY with a blocked rating, got %s", data)
+	}
+}
+
+func TestFault_Refusal_Responses(t *testing.T) {
+	data := postRefusal(t, "/v1/responses", `{"model":"test","input":"hi"}`)
+	if !strings.Contains(string(data), `{"refusal":"I won't do that.","type":"refusal"}`) {
+		t.Errorf("expected a refusal content part, got %s", data)
+	}
+}
+
+func TestFault_Refusal_ReportsResponseModel(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opt  llmock.Option
+		want func(requested string) string
+	}{
+		{"force", llmock.WithForceModel("other-model"), func(string) string { return "other-model" }},
+		{"suffix", llmock.WithModelSuffix("-0613"), func(requested string) string { return requested + "-0613" }},
+	} {
+		ts := newFaultServer(t, tc.opt, llmock.WithFault(llmock.Fault{Type: llmock.FaultRefusal}))
+		for _, req := range []struct{ path, model, body string }{
+			{"/v1/chat/completions", "gpt-4", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/chat/completions", "gpt-4", `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/messages", "claude", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/messages", "claude", `{"model":"claude","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/responses", "gpt-4o", `{"model":"gpt-4o","input":"hi"}`},
+		} {
+			resp, err := http.Post(ts.URL+req.path, "application/json", strings.NewReader(req.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			want := tc.want(req.model)
+			if !strings.Contains(string(data), `"model":"`+want+`"`) {
+				t.Errorf("%s %s: expected model %q, got %s", tc.name, req.path, want, data)
+			}
+		}
+		ts.Close()
+	}
+}
+
+func TestFault_Refusal_MatchesNormalEnvelope(t *testing.T) {
+	opts := []llmock.Option{llmock.WithSeed(1), llmock.WithIDGenerator(func() string { return "x" })}
+	normal := newFaultServer(t, opts...)
+	defer normal.Close()
+	refusing := newFaultServer(t, append(opts, llmock.WithFault(llmock.Fault{Type: llmock.FaultRefusal}))...)
+	defer refusing.Close()
+
+	for _, tc := range []struct {
+		path, body string
+		fields     []string
+	}{
+		{"/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"tell me a story"}]}`,
+			[]string{"id", "model", "system_fingerprint", "usage.prompt_tokens"}},
+		{"/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"tell me a story"}]}`,
+			[]string{"id", "model", "usage.input_tokens"}},
+		{"/v1/responses", `{"model":"gpt-4o","input":"tell me a story"}`,
+			[]string{"id", "model", "usage.input_tokens"}},
+		{"/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"tell me a story"}]}]}`,
+			[]string{"modelVersion", "usageMetadata.promptTokenCount"}},
+	} {
+		get := func(url string) map[string]any {
+			resp, err := http.Post(url+tc.path, "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var m map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+			return m
+		}
+		want, got := get(normal.URL), get(refusing.URL)
+		for _, field := range tc.fields {
+			w, g := any(want), any(got)
+			for _, key := range strings.Split(field, ".") {
+				w, _ = w.(map[string]any)[key]
+				g, _ = g.(map[string]any)[key]
+			}
+			if w == nil || g != w {
+				t.Errorf("%s: %s = %v in a refusal, want %v as in a normal response", tc.path, field, g, w)
+			}
+		}
+	}
+}
+
+// --- Targeted faults ---
+
+func TestFault_Match(t *testing.T) {
+	ts := newFaultServer(t,
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 500, Match: "(?i)expensive", Count: 1}),
+	)
+	defer ts.Close()
+
+	post := func(content string) int {
+		body := `{"model":"test","messages":[{"role":"user","content":"` + content + `"}]}`
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Unmatched requests succeed and don't use up the fault's count.
+	if code := post("just chatting"); code != http.StatusOK {
+		t.Errorf("expected 200 for unmatched request, got %d", code)
+	}
+	if code := post("an EXPENSIVE prompt"); code != 500 {
+		t.Errorf("expected 500 for matched request, got %d", code)
+	}
+	if code := post("another expensive prompt"); code != http.StatusOK {
+		t.Errorf("expected count-limited fault to be exhausted, got %d", code)
+	}
+
+	resp, err := http.Post(ts.URL+"/_mock/faults", "application/json", strings.NewReader(`{"faults":[{"type":"error","match":"("}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid match pattern, got %d", resp.StatusCode)
+	}
+}
+
+// --- Bad tool args fault ---
+
+func TestFault_BadToolArgs(t *testing.T) {
+	ts := newFaultServer(t,
+		llmock.WithRules(llmock.Rule{
+			Pattern:  regexp.MustCompile(`weather`),
+			ToolCall: &llmock.ToolCallConfig{Name: "get_weather", Arguments: map[string]any{"city": "London"}},
+		}),
+		llmock.WithFault(llmock.Fault{Type: llmock.FaultBadToolArgs}),
+	)
+	defer ts.Close()
+
+	post := func(path, body string) []byte {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return data
+	}
+	assertInvalid := func(args string) {
+		t.Helper()
+		var v any
+		if args == "" || json.Unmarshal([]byte(args), &v) == nil {
+			t.Errorf("expected invalid arguments JSON, got %q", args)
+		}
+	}
+
+	var openai struct {
+		Choices []struct {
+			Message struct {
+				ToolCalls []struct {
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	data := post("/v1/chat/completions", `{"model":"test","messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`)
+	if err := json.Unmarshal(data, &openai); err != nil {
+		t.Fatalf("expected a valid envelope: %v", err)
+	}
+	fn := openai.Choices[0].Message.ToolCalls[0].Function
+	if fn.Name != "get_weather" {
+		t.Errorf("expected get_weather, got %q", fn.Name)
+	}
+	assertInvalid(fn.Arguments)
+
+	var anthropic struct {
+		Content []struct {
+			Type  string `json:"type"`
+			Input string `json:"input"`
+		} `json:"content"`
+	}
+	data = post("/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"name":"get_weather","input_schema":{"type":"object"}}]}`)
+	if err := json.Unmarshal(data, &anthropic); err != nil {
+		t.Fatalf("expected a valid envelope: %v", err)
+	}
+	assertInvalid(anthropic.Content[0].Input)
+
+	var gemini struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					FunctionCall struct {
+						Args string `json:"args"`
+					} `json:"functionCall"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	data = post("/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"weather?"}]}],
+		"tools":[{"functionDeclarations":[{"name":"get_weather"}]}]}`)
+	if err := json.Unmarshal(data, &gemini); err != nil {
+		t.Fatalf("expected a valid envelope: %v", err)
+	}
+	assertInvalid(gemini.Candidates[0].Content.Parts[0].FunctionCall.Args)
+
+	// Streamed fragments concatenate to invalid JSON.
+	data = post("/v1/messages", `{"model":"claude","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"name":"get_weather","input_schema":{"type":"object"}}]}`)
+	var partial string
+	for _, line := range strings.Split(string(data), "\n") {
+		var ev struct {
+			Delta struct {
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if rest, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(rest), &ev); err != nil {
+				t.Fatalf("expected valid event JSON, got %q", rest)
+			}
+			partial += ev.Delta.PartialJSON
+		}
+	}
+	assertInvalid(partial)
+}
+
+func TestFault_MidStreamAnthropicError(t *testing.T) {
+	ts := newFaultServer(t,
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"one two three four five six seven eight nine ten"}}),
+		llmock.WithTokenDelay(0),
+		llmock.WithFault(llmock.Fault{Preset: "anthropic_overloaded", MidStream: true}),
+	)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/messages", "application/json",
+		strings.NewReader(`{"model":"claude-3","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the stream to start with 200, got %d", resp.StatusCode)
+	}
+
+	events := readSSEEvents(t, resp)
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Event)
+	}
+	if len(events) == 0 || events[0].Event != "message_start" {
+		t.Fatalf("expected message_start first, got %v", names)
+	}
+	last := events[len(events)-1]
+	if last.Event != "error" {
+		t.Fatalf("expected the stream to end with an error event, got %v", names)
+	}
+	if !slices.Contains(names, "content_block_delta") {
+		t.Errorf("expected content deltas before the error, got %v", names)
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(last.Data), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Type != "error" || body.Error.Type != "overloaded_error" {
+		t.Errorf("unexpected error event: %s", last.Data)
+	}
+}
+
+func TestFault_MidStreamOpenAIError(t *testing.T) {
+	ts := newFaultServer(t,
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"one two three four five six seven eight nine ten"}}),
+		llmock.WithTokenDelay(0),
+		llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Message: "upstream failed", MidStream: true}),
+	)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := readSSEData(t, resp)
+	if slices.Contains(lines, "[DONE]") {
+		t.Errorf("expected no [DONE] after a mid-stream error, got %v", lines)
+	}
+	if len(lines) < 2 {
+		t.Fatalf("expected content chunks before the error, got %v", lines)
+	}
+	var last struct {
+		Error *struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Error == nil || last.Error.Message != "upstream failed" || last.Error.Type != "server_error" {
+		t.Errorf("expected a final error chunk, got %s", lines[len(lines)-1])
+	}
+	var first struct {
+		Choices []any `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || len(first.Choices) == 0 {
+		t.Errorf("expected a content chunk first, got %s", lines[0])
+	}
+}
+
+func TestFault_AdminAPI_ListsRemainingCount(t *testing.T) {
+	ts := newFaultServer(t, llmock.WithFault(llmock.Fault{Type: llmock.FaultError, Status: 500, Count: 3}))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var list struct {
+		Faults []struct {
+			ID    int `json:"id"`
+			Count int `json:"count"`
+		} `json:"faults"`
+	}
+	resp, err = http.Get(ts.URL + "/_mock/faults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Faults) != 1 || list.Faults[0].Count != 2 {
+		t.Errorf("expected one fault with 2 triggers left, got %+v", list.Faults)
+	}
+}
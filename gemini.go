@@ -3,17 +3,19 @@ package llmock
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
-	"time"
 )
 
 // GeminiRequest represents a Google Gemini generateContent request.
 type GeminiRequest struct {
-	Contents          []GeminiContent          `json:"contents"`
-	SystemInstruction *GeminiContent           `json:"systemInstruction,omitempty"`
-	GenerationConfig  *GeminiGenerationConfig  `json:"generationConfig,omitempty"`
-	Tools             []GeminiToolDef          `json:"tools,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GeminiToolDef         `json:"tools,omitempty"`
 }
 
 // GeminiContent represents a content entry with a role and parts.
@@ -28,11 +30,12 @@ type GeminiPart struct {
 	Text             string                  `json:"text,omitempty"`
 	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *GeminiInlineData       `json:"inlineData,omitempty"`
 }
 
 // GeminiFunctionCall represents a function call in a Gemini response part.
 type GeminiFunctionCall struct {
-	Name string         `json:"name"`
+	Name string         `json:"name,omitempty"`
 	Args map[string]any `json:"args"`
 }
 
@@ -42,12 +45,36 @@ type GeminiFunctionResponse struct {
 	Response map[string]any `json:"response"`
 }
 
+// text returns the function's result for rule matching and Markov
+// context: a string "result" as is, or else the whole response object as
+// JSON, so structured results can be matched on any field.
+func (fr *GeminiFunctionResponse) text() string {
+	if result, ok := fr.Response["result"].(string); ok {
+		return result
+	}
+	if len(fr.Response) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(fr.Response)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
 // GeminiGenerationConfig holds generation parameters.
 type GeminiGenerationConfig struct {
 	Temperature     *float64 `json:"temperature,omitempty"`
 	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
 	TopP            *float64 `json:"topP,omitempty"`
 	TopK            *int     `json:"topK,omitempty"`
+	CandidateCount  *int     `json:"candidateCount,omitempty"`
+
+	// ResponseMimeType "application/json" turns on JSON mode. The reply
+	// then conforms to ResponseSchema (or ResponseJSONSchema) if set.
+	ResponseMimeType   string         `json:"responseMimeType,omitempty"`
+	ResponseSchema     map[string]any `json:"responseSchema,omitempty"`
+	ResponseJSONSchema map[string]any `json:"responseJsonSchema,omitempty"`
 }
 
 // GeminiToolDef represents a tool definition in a Gemini request.
@@ -64,14 +91,75 @@ type GeminiFunctionDecl struct {
 
 // GeminiResponse represents a Gemini generateContent response.
 type GeminiResponse struct {
-	Candidates    []GeminiCandidate    `json:"candidates"`
-	UsageMetadata GeminiUsageMetadata  `json:"usageMetadata"`
+	Candidates     []GeminiCandidate     `json:"candidates"`
+	PromptFeedback *GeminiPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  GeminiUsageMetadata   `json:"usageMetadata"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
 }
 
 // GeminiCandidate represents a candidate in a Gemini response.
 type GeminiCandidate struct {
-	Content       GeminiContent `json:"content"`
-	FinishReason  string        `json:"finishReason,omitempty"`
+	Content           GeminiContent            `json:"content"`
+	FinishReason      string                   `json:"finishReason,omitempty"`
+	Index             int                      `json:"index"`
+	SafetyRatings     []GeminiSafetyRating     `json:"safetyRatings,omitempty"`
+	GroundingMetadata *GeminiGroundingMetadata `json:"groundingMetadata,omitempty"`
+}
+
+// GeminiSafetyRating rates a Gemini prompt or candidate in one harm category.
+type GeminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// GeminiPromptFeedback carries the safety ratings of a Gemini prompt.
+type GeminiPromptFeedback struct {
+	BlockReason   string               `json:"blockReason,omitempty"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings"`
+}
+
+// geminiHarmCategories are the categories Gemini rates by default.
+var geminiHarmCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// defaultGeminiSafetyRatings rates every harm category NEGLIGIBLE.
+func defaultGeminiSafetyRatings() []GeminiSafetyRating {
+	ratings := make([]GeminiSafetyRating, len(geminiHarmCategories))
+	for i, c := range geminiHarmCategories {
+		ratings[i] = GeminiSafetyRating{Category: c, Probability: "NEGLIGIBLE"}
+	}
+	return ratings
+}
+
+// WithGeminiSafetyRatings sets the safetyRatings reported on Gemini
+// candidates and prompt feedback. By default every harm category is rated
+// NEGLIGIBLE.
+func WithGeminiSafetyRatings(ratings ...GeminiSafetyRating) Option {
+	return func(s *Server) {
+		s.geminiSafetyRatings = append([]GeminiSafetyRating{}, ratings...)
+	}
+}
+
+// withGeminiSafety adds safety ratings to every candidate in resp, and
+// prompt feedback if promptFeedback is set. Streams report prompt feedback
+// on their first chunk only.
+func (s *Server) withGeminiSafety(resp GeminiResponse, promptFeedback bool) GeminiResponse {
+	ratings := s.geminiSafetyRatings
+	if ratings == nil {
+		ratings = defaultGeminiSafetyRatings()
+	}
+	for i := range resp.Candidates {
+		resp.Candidates[i].SafetyRatings = ratings
+	}
+	if promptFeedback {
+		resp.PromptFeedback = &GeminiPromptFeedback{SafetyRatings: ratings}
+	}
+	return resp
 }
 
 // GeminiUsageMetadata represents token usage in a Gemini response.
@@ -79,6 +167,10 @@ type GeminiUsageMetadata struct {
 	PromptTokenCount     int `json:"promptTokenCount"`
 	CandidatesTokenCount int `json:"candidatesTokenCount"`
 	TotalTokenCount      int `json:"totalTokenCount"`
+
+	// CachedContentTokenCount is the part of the prompt served from the
+	// cache on a WithResponseCache hit.
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
 }
 
 func geminiToInternal(contents []GeminiContent, sysInstruction *GeminiContent) []InternalMessage {
@@ -121,10 +213,8 @@ func geminiContentText(c GeminiContent) string {
 		}
 		if p.FunctionResponse != nil {
 			// Include function response as text for rule matching.
-			if result, ok := p.FunctionResponse.Response["result"]; ok {
-				if s, ok := result.(string); ok {
-					parts = append(parts, s)
-				}
+			if s := p.FunctionResponse.text(); s != "" {
+				parts = append(parts, s)
 			}
 		}
 	}
@@ -163,6 +253,137 @@ func geminiToRequestTools(tools []GeminiToolDef) []RequestTool {
 	return out
 }
 
+// geminiJSONMode makes a text response valid JSON when the request's
+// generationConfig asks for application/json. Text that is already JSON
+// (say, from a rule) is kept; otherwise an object is generated from the
+// response schema, or the text is wrapped as {"text": ...} if there is none.
+func (s *Server) geminiJSONMode(req GeminiRequest, response Response) Response {
+	gc := req.GenerationConfig
+	if gc == nil || gc.ResponseMimeType != "application/json" || response.IsToolCall() {
+		return response
+	}
+	if json.Valid([]byte(response.Text)) {
+		return response
+	}
+	schema := gc.ResponseSchema
+	if schema == nil {
+		schema = gc.ResponseJSONSchema
+	}
+	var v any = map[string]any{"text": response.Text}
+	if schema != nil {
+		v = generateFromSchema(schema, s.rng)
+	}
+	data, _ := json.Marshal(v)
+	return Response{Text: string(data), FinishReason: response.FinishReason}
+}
+
+// geminiTruncate caps text at the request's maxOutputTokens and returns it
+// with the matching finish reason.
+func geminiTruncate(req GeminiRequest, text string) (string, string) {
+	if req.GenerationConfig == nil {
+		return text, "STOP"
+	}
+	text, truncated := truncateToTokens(text, req.GenerationConfig.MaxOutputTokens)
+	if truncated {
+		return text, "MAX_TOKENS"
+	}
+	return text, "STOP"
+}
+
+// geminiFinishReasons maps OpenAI finish reasons to Gemini's. Gemini
+// reports function calls with STOP.
+var geminiFinishReasons = map[string]string{
+	"stop":           "STOP",
+	"length":         "MAX_TOKENS",
+	"content_filter": "SAFETY",
+	"tool_calls":     "STOP",
+}
+
+// maxGeminiCandidates is the most candidates Gemini returns for one request.
+const maxGeminiCandidates = 8
+
+// geminiCandidateCount returns the number of candidates requested by
+// generationConfig.candidateCount, which defaults to 1.
+func geminiCandidateCount(req GeminiRequest) (int, error) {
+	if req.GenerationConfig == nil || req.GenerationConfig.CandidateCount == nil {
+		return 1, nil
+	}
+	n := *req.GenerationConfig.CandidateCount
+	if n < 1 || n > maxGeminiCandidates {
+		return 0, fmt.Errorf("candidateCount must be between 1 and %d", maxGeminiCandidates)
+	}
+	return n, nil
+}
+
+// geminiCandidateText is the text and finish reason of one text candidate.
+type geminiCandidateText struct {
+	text         string
+	finishReason string
+	media        *MediaConfig
+}
+
+// geminiCandidates returns the text candidates for req: first, followed by
+// independently sampled replies up to candidateCount. Each is put through
+// JSON mode and truncated to maxOutputTokens.
+func (s *Server) geminiCandidates(req GeminiRequest, ctx RespondContext, first Response, n int) []geminiCandidateText {
+	cands := make([]geminiCandidateText, 0, n)
+	response := first
+	for {
+		text, finishReason := geminiTruncate(req, response.Text)
+		if response.FinishReason != "" {
+			finishReason = geminiFinishReasons[response.FinishReason]
+		}
+		cands = append(cands, geminiCandidateText{text, finishReason, response.Media})
+		if len(cands) == n {
+			return cands
+		}
+		var err error
+		if response, err = s.respond(ctx); err != nil {
+			return cands
+		}
+		if response.IsToolCall() {
+			response = s.forceTextResponse(response, ctx)
+		}
+		response = s.geminiJSONMode(req, response)
+	}
+}
+
+// geminiRespond gets the response to a Gemini request, from the response
+// cache if there is one, and reports whether it was cached. Requests for
+// several candidates bypass the cache, since the others are sampled afresh.
+func (s *Server) geminiRespond(r *http.Request, req GeminiRequest, ctx RespondContext, candidateCount int) (Response, bool, error) {
+	respond := func() (Response, error) {
+		response, err := s.respondWithTools(ctx, geminiHasToolResults(req.Contents))
+		if err != nil {
+			return response, err
+		}
+		return s.geminiJSONMode(req, response), nil
+	}
+	if candidateCount > 1 {
+		response, err := respond()
+		return response, false, err
+	}
+	return s.cachedRespond(r, req, respond)
+}
+
+// geminiRespondContext builds the responder context for a Gemini request.
+func geminiRespondContext(req GeminiRequest, internal []InternalMessage, model string, stream bool) RespondContext {
+	ctx := RespondContext{
+		Messages: internal,
+		Model:    model,
+		Endpoint: EndpointGemini,
+		Tools:    geminiToRequestTools(req.Tools),
+		Stream:   stream,
+
+		ToolResults: geminiToolResults(req.Contents),
+	}
+	if gc := req.GenerationConfig; gc != nil {
+		ctx.Temperature = gc.Temperature
+		ctx.MaxTokens = gc.MaxOutputTokens
+	}
+	return ctx
+}
+
 // handleGeminiRoute dispatches Gemini API requests based on the method suffix.
 func (s *Server) handleGeminiRoute(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
@@ -171,6 +392,10 @@ func (s *Server) handleGeminiRoute(w http.ResponseWriter, r *http.Request) {
 		s.handleGeminiGenerate(w, r)
 	case strings.HasSuffix(path, ":streamGenerateContent"):
 		s.handleGeminiStream(w, r)
+	case strings.HasSuffix(path, ":embedContent"):
+		s.handleGeminiEmbed(w, r)
+	case strings.HasSuffix(path, ":batchEmbedContents"):
+		s.handleGeminiBatchEmbed(w, r)
 	default:
 		writeGeminiError(w, http.StatusNotFound, "unknown Gemini method")
 	}
@@ -190,43 +415,33 @@ func (s *Server) handleGeminiGenerate(w http.ResponseWriter, r *http.Request) {
 		writeGeminiError(w, http.StatusBadRequest, "contents array is required and must not be empty")
 		return
 	}
-
-	// Evaluate faults before normal processing.
-	if f, ok := s.faults.evaluate(); ok {
-		if s.executeFault(w, r, f, "gemini", false) {
-			return
-		}
-	}
-
-	internal := geminiToInternal(req.Contents, req.SystemInstruction)
-	response, err := s.responder.Respond(internal)
+	candidateCount, err := geminiCandidateCount(req)
 	if err != nil {
 		writeGeminiError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// If the conversation contains tool results, suppress tool call responses
-	// to avoid infinite tool-call loops.
-	hasToolResults := geminiHasToolResults(req.Contents)
+	internal := geminiToInternal(req.Contents, req.SystemInstruction)
 
-	// Auto-generate a tool call if enabled and no rule produced one.
-	if !hasToolResults && s.autoToolCalls && !response.IsToolCall() && len(req.Tools) > 0 {
-		reqTools := geminiToRequestTools(req.Tools)
-		if tc, ok := generateToolCallFromSchema(reqTools, s.rng); ok {
-			response = Response{ToolCalls: []ToolCall{tc}}
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{model: model, promptTokens: estimateGeminiTokens(req.Contents)}, "gemini", false) {
+			return
 		}
+		w = faultWriter(w, f, "gemini", false)
 	}
 
-	// Force text response when tool results are present.
-	if hasToolResults && response.IsToolCall() {
-		response = s.forceTextResponse(response, internal)
+	ctx := geminiRespondContext(req, internal, model, false)
+	ctx.Session = r.Header.Get(sessionHeader)
+	response, cached, err := s.geminiRespond(r, req, ctx, candidateCount)
+	if err != nil {
+		writeGeminiError(w, s.responderErrorStatus(err), err.Error())
+		return
 	}
 
 	s.logAdminRequest(r, internal, response.Text)
 
-	if model == "" {
-		model = "llmock-1"
-	}
+	model = s.responseModel(model)
 
 	if response.IsToolCall() {
 		// Validate tool calls against request tools.
@@ -250,18 +465,13 @@ func (s *Server) handleGeminiGenerate(w http.ResponseWriter, r *http.Request) {
 		}
 
 		promptTokens := estimateGeminiTokens(req.Contents)
-		completionTokens := 5
-
-		parts := make([]GeminiPart, len(response.ToolCalls))
-		for i, tc := range response.ToolCalls {
-			parts[i] = GeminiPart{
-				FunctionCall: &GeminiFunctionCall{
-					Name: tc.Name,
-					Args: tc.Arguments,
-				},
-			}
-		}
+		completionTokens := 5 + countTokens(response.Text)
 
+		parts := geminiToolCallParts(response.Text, response.ToolCalls)
+
+		if !s.waitForOutput(r, completionTokens) {
+			return
+		}
 		resp := GeminiResponse{
 			Candidates: []GeminiCandidate{
 				{
@@ -269,41 +479,50 @@ func (s *Server) handleGeminiGenerate(w http.ResponseWriter, r *http.Request) {
 					FinishReason: "STOP",
 				},
 			},
-			UsageMetadata: GeminiUsageMetadata{
-				PromptTokenCount:     promptTokens,
-				CandidatesTokenCount: completionTokens,
-				TotalTokenCount:      promptTokens + completionTokens,
-			},
+			UsageMetadata: geminiUsage(promptTokens, completionTokens, cached),
+			ModelVersion:  model,
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		json.NewEncoder(w).Encode(s.withGeminiSafety(resp, true))
 		return
 	}
 
 geminiTextResponse:
-	responseText := response.Text
+	cands := s.geminiCandidates(req, ctx, response, candidateCount)
 	promptTokens := estimateGeminiTokens(req.Contents)
-	completionTokens := countTokens(responseText)
+	completionTokens := 0
+	candidates := make([]GeminiCandidate, len(cands))
+	for i, c := range cands {
+		completionTokens += countTokens(c.text)
+		parts := []GeminiPart{{Text: c.text}}
+		if c.media != nil {
+			if c.text == "" {
+				parts = nil
+			}
+			parts = append(parts, geminiMediaPart(*c.media))
+		}
+		candidates[i] = GeminiCandidate{
+			Content: GeminiContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason:      c.finishReason,
+			Index:             i,
+			GroundingMetadata: s.geminiGrounding(c.text),
+		}
+	}
+	if !s.waitForOutput(r, completionTokens) {
+		return
+	}
 
 	resp := GeminiResponse{
-		Candidates: []GeminiCandidate{
-			{
-				Content: GeminiContent{
-					Role:  "model",
-					Parts: []GeminiPart{{Text: responseText}},
-				},
-				FinishReason: "STOP",
-			},
-		},
-		UsageMetadata: GeminiUsageMetadata{
-			PromptTokenCount:     promptTokens,
-			CandidatesTokenCount: completionTokens,
-			TotalTokenCount:      promptTokens + completionTokens,
-		},
+		Candidates:    candidates,
+		UsageMetadata: geminiUsage(promptTokens, completionTokens, cached),
+		ModelVersion:  model,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(s.withGeminiSafety(resp, true))
 }
 
 func (s *Server) handleGeminiStream(w http.ResponseWriter, r *http.Request) {
@@ -320,85 +539,158 @@ func (s *Server) handleGeminiStream(w http.ResponseWriter, r *http.Request) {
 		writeGeminiError(w, http.StatusBadRequest, "contents array is required and must not be empty")
 		return
 	}
-
-	// Evaluate faults before normal processing.
-	if f, ok := s.faults.evaluate(); ok {
-		if s.executeFault(w, r, f, "gemini", true) {
-			return
-		}
-	}
-
-	internal := geminiToInternal(req.Contents, req.SystemInstruction)
-	response, err := s.responder.Respond(internal)
+	candidateCount, err := geminiCandidateCount(req)
 	if err != nil {
 		writeGeminiError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// If the conversation contains tool results, suppress tool call responses
-	// to avoid infinite tool-call loops.
-	hasToolResults := geminiHasToolResults(req.Contents)
+	internal := geminiToInternal(req.Contents, req.SystemInstruction)
 
-	// Auto-generate a tool call if enabled and no rule produced one.
-	if !hasToolResults && s.autoToolCalls && !response.IsToolCall() && len(req.Tools) > 0 {
-		reqTools := geminiToRequestTools(req.Tools)
-		if tc, ok := generateToolCallFromSchema(reqTools, s.rng); ok {
-			response = Response{ToolCalls: []ToolCall{tc}}
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{model: model, promptTokens: estimateGeminiTokens(req.Contents)}, "gemini", true) {
+			return
 		}
+		w = faultWriter(w, f, "gemini", true)
 	}
 
-	// Force text response when tool results are present.
-	if hasToolResults && response.IsToolCall() {
-		response = s.forceTextResponse(response, internal)
+	ctx := geminiRespondContext(req, internal, model, true)
+	ctx.Session = r.Header.Get(sessionHeader)
+	response, _, err := s.geminiRespond(r, req, ctx, candidateCount)
+	if err != nil {
+		writeGeminiError(w, s.responderErrorStatus(err), err.Error())
+		return
 	}
 
 	s.logAdminRequest(r, internal, response.Text)
 
-	if model == "" {
-		model = "llmock-1"
-	}
+	model = s.responseModel(model)
 
 	promptTokens := estimateGeminiTokens(req.Contents)
 
 	if response.IsToolCall() {
 		// For tool calls, stream as a single chunk.
-		s.streamGeminiToolCall(w, r, response.ToolCalls, promptTokens)
+		s.streamGeminiToolCall(w, r, response.Text, response.ToolCalls, model, promptTokens)
 		return
 	}
 
-	s.streamGemini(w, r, response.Text, promptTokens)
+	s.streamGemini(w, r, s.geminiCandidates(req, ctx, response, candidateCount), model, promptTokens)
 }
 
-// streamGemini writes the response as Gemini-format SSE chunks.
-func (s *Server) streamGemini(w http.ResponseWriter, r *http.Request, responseText string, promptTokens int) {
+// geminiStream writes streamGenerateContent chunks: as SSE events when the
+// request has alt=sse, or otherwise as the elements of a JSON array written
+// incrementally, which is what the API returns by default.
+type geminiStream struct {
+	s       *Server
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+	chunks  int
+}
+
+// newGeminiStream sets the response headers for a stream to w, or returns
+// false if w can't stream.
+func (s *Server) newGeminiStream(w http.ResponseWriter, r *http.Request) (*geminiStream, bool) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		writeGeminiError(w, http.StatusInternalServerError, "streaming not supported")
+		return nil, false
+	}
+	gs := &geminiStream{s: s, w: w, flusher: flusher, sse: r.URL.Query().Get("alt") == "sse"}
+	if gs.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "keep-alive")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	return gs, true
+}
+
+// write sends one chunk. In array mode the separators are written
+// separately, so each chunk is a whole JSON value for fault writers.
+func (gs *geminiStream) write(v any) {
+	data, _ := json.Marshal(v)
+	if gs.sse {
+		fmt.Fprintf(gs.w, "data: %s\n\n", data)
+	} else {
+		if gs.chunks == 0 {
+			io.WriteString(gs.w, "[")
+		} else {
+			io.WriteString(gs.w, ",\r\n")
+		}
+		gs.w.Write(data)
+	}
+	gs.chunks++
+	gs.flusher.Flush()
+}
+
+// close ends the JSON array. It does nothing for SSE.
+func (gs *geminiStream) close() {
+	if gs.sse {
 		return
 	}
+	if gs.chunks == 0 {
+		io.WriteString(gs.w, "[")
+	}
+	io.WriteString(gs.w, "]")
+	gs.flusher.Flush()
+}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+// wait sleeps between chunks like waitForToken. In array mode keep-alives
+// are newlines, which JSON parsers skip.
+func (gs *geminiStream) wait(r *http.Request) bool {
+	if gs.sse {
+		return gs.s.waitForToken(gs.w, r)
+	}
+	return gs.s.waitForTokenKeepAlive(gs.w, r, "\n")
+}
 
-	chunks := tokenize(responseText)
-	outputTokens := countTokens(responseText)
+// streamGemini writes the candidates as Gemini-format stream chunks. With
+// several candidates, each chunk carries the next piece of every candidate
+// that has one left, tagged with its index.
+func (s *Server) streamGemini(w http.ResponseWriter, r *http.Request, cands []geminiCandidateText, model string, promptTokens int) {
+	gs, ok := s.newGeminiStream(w, r)
+	if !ok {
+		writeGeminiError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
 
-	for i, chunk := range chunks {
-		candidate := GeminiCandidate{
-			Content: GeminiContent{
-				Role:  "model",
-				Parts: []GeminiPart{{Text: chunk}},
-			},
+	chunks := make([][]string, len(cands))
+	outputTokens, steps := 0, 0
+	for j, c := range cands {
+		chunks[j] = tokenize(c.text)
+		if len(chunks[j]) == 0 {
+			// An empty reply still needs a chunk for its finish reason.
+			chunks[j] = []string{""}
 		}
+		outputTokens += countTokens(c.text)
+		steps = max(steps, len(chunks[j]))
+	}
 
-		// Last chunk gets finish reason and usage.
-		resp := GeminiResponse{
-			Candidates: []GeminiCandidate{candidate},
+	for i := range steps {
+		// Each candidate's last chunk gets its finish reason.
+		resp := GeminiResponse{ModelVersion: model}
+		for j, c := range cands {
+			if i >= len(chunks[j]) {
+				continue
+			}
+			candidate := GeminiCandidate{
+				Content: GeminiContent{
+					Role:  "model",
+					Parts: []GeminiPart{{Text: chunks[j][i]}},
+				},
+				Index: j,
+			}
+			if i == len(chunks[j])-1 {
+				candidate.FinishReason = c.finishReason
+				candidate.GroundingMetadata = s.geminiGrounding(c.text)
+			}
+			resp.Candidates = append(resp.Candidates, candidate)
 		}
 
-		if i == len(chunks)-1 {
-			resp.Candidates[0].FinishReason = "STOP"
+		// The last chunk carries usage.
+		if i == steps-1 {
 			resp.UsageMetadata = GeminiUsageMetadata{
 				PromptTokenCount:     promptTokens,
 				CandidatesTokenCount: outputTokens,
@@ -406,42 +698,52 @@ func (s *Server) streamGemini(w http.ResponseWriter, r *http.Request, responseTe
 			}
 		}
 
-		data, _ := json.Marshal(resp)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
+		gs.write(s.withGeminiSafety(resp, i == 0))
 
-		if i < len(chunks)-1 {
-			select {
-			case <-r.Context().Done():
+		if i < steps-1 {
+			if !gs.wait(r) {
 				return
-			case <-time.After(s.getTokenDelay()):
 			}
 		}
 	}
+	gs.close()
 }
 
-// streamGeminiToolCall streams a tool call response in Gemini SSE format.
-func (s *Server) streamGeminiToolCall(w http.ResponseWriter, r *http.Request, toolCalls []ToolCall, promptTokens int) {
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		writeGeminiError(w, http.StatusInternalServerError, "streaming not supported")
-		return
+// geminiToolCallParts returns the parts of a tool call response: a text
+// part if text is set, then one functionCall part per tool call.
+func geminiToolCallParts(text string, toolCalls []ToolCall) []GeminiPart {
+	var parts []GeminiPart
+	if text != "" {
+		parts = append(parts, GeminiPart{Text: text})
 	}
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	parts := make([]GeminiPart, len(toolCalls))
-	for i, tc := range toolCalls {
-		parts[i] = GeminiPart{
+	for _, tc := range toolCalls {
+		parts = append(parts, GeminiPart{
 			FunctionCall: &GeminiFunctionCall{
 				Name: tc.Name,
 				Args: tc.Arguments,
 			},
-		}
+		})
+	}
+	return parts
+}
+
+// streamGeminiToolCall streams a tool call response in Gemini format. Any
+// text comes before the function calls.
+func (s *Server) streamGeminiToolCall(w http.ResponseWriter, r *http.Request, text string, toolCalls []ToolCall, model string, promptTokens int) {
+	gs, ok := s.newGeminiStream(w, r)
+	if !ok {
+		writeGeminiError(w, http.StatusInternalServerError, "streaming not supported")
+		return
 	}
 
+	if s.geminiStreamToolChunks {
+		s.streamGeminiToolCallChunks(gs, r, text, toolCalls, model, promptTokens)
+		return
+	}
+
+	parts := geminiToolCallParts(text, toolCalls)
+	completionTokens := 5 + countTokens(text)
+
 	resp := GeminiResponse{
 		Candidates: []GeminiCandidate{
 			{
@@ -451,14 +753,79 @@ func (s *Server) streamGeminiToolCall(w http.ResponseWriter, r *http.Request, to
 		},
 		UsageMetadata: GeminiUsageMetadata{
 			PromptTokenCount:     promptTokens,
-			CandidatesTokenCount: 5,
-			TotalTokenCount:      promptTokens + 5,
+			CandidatesTokenCount: completionTokens,
+			TotalTokenCount:      promptTokens + completionTokens,
 		},
+		ModelVersion: model,
 	}
 
-	data, _ := json.Marshal(resp)
-	fmt.Fprintf(w, "data: %s\n\n", data)
-	flusher.Flush()
+	gs.write(s.withGeminiSafety(resp, true))
+	gs.close()
+}
+
+// streamGeminiToolCallChunks streams each function call across several
+// chunks, one argument key per chunk. The first chunk of each call carries
+// the name; merging the args of all its chunks gives the original args. Any
+// text is sent in a chunk of its own first.
+func (s *Server) streamGeminiToolCallChunks(gs *geminiStream, r *http.Request, text string, toolCalls []ToolCall, model string, promptTokens int) {
+	if text != "" {
+		candidate := GeminiCandidate{
+			Content: GeminiContent{Role: "model", Parts: []GeminiPart{{Text: text}}},
+		}
+		gs.write(s.withGeminiSafety(GeminiResponse{Candidates: []GeminiCandidate{candidate}, ModelVersion: model}, true))
+		if !gs.wait(r) {
+			return
+		}
+	}
+
+	var chunks []*GeminiFunctionCall
+	for _, tc := range toolCalls {
+		keys := slices.Sorted(maps.Keys(tc.Arguments))
+		if len(keys) == 0 {
+			chunks = append(chunks, &GeminiFunctionCall{Name: tc.Name, Args: map[string]any{}})
+			continue
+		}
+		for j, k := range keys {
+			fc := &GeminiFunctionCall{Args: map[string]any{k: tc.Arguments[k]}}
+			if j == 0 {
+				fc.Name = tc.Name
+			}
+			chunks = append(chunks, fc)
+		}
+	}
+
+	for i, fc := range chunks {
+		candidate := GeminiCandidate{
+			Content: GeminiContent{Role: "model", Parts: []GeminiPart{{FunctionCall: fc}}},
+		}
+		resp := GeminiResponse{Candidates: []GeminiCandidate{candidate}, ModelVersion: model}
+		if i == len(chunks)-1 {
+			resp.Candidates[0].FinishReason = "STOP"
+			resp.UsageMetadata = GeminiUsageMetadata{
+				PromptTokenCount:     promptTokens,
+				CandidatesTokenCount: 5 + countTokens(text),
+				TotalTokenCount:      promptTokens + 5 + countTokens(text),
+			}
+		}
+		gs.write(s.withGeminiSafety(resp, i == 0 && text == ""))
+
+		if i == len(chunks)-1 {
+			break
+		}
+		if !gs.wait(r) {
+			return
+		}
+	}
+	gs.close()
+}
+
+// WithGeminiStreamToolChunks makes streamed Gemini function calls span
+// multiple chunks instead of arriving in one. Default is off, matching
+// Gemini's usual behavior.
+func WithGeminiStreamToolChunks(enabled bool) Option {
+	return func(s *Server) {
+		s.geminiStreamToolChunks = enabled
+	}
 }
 
 // extractGeminiModel extracts the model name from Gemini API paths like
@@ -467,6 +834,8 @@ func extractGeminiModel(path string) string {
 	// Remove the method suffix.
 	path = strings.TrimSuffix(path, ":generateContent")
 	path = strings.TrimSuffix(path, ":streamGenerateContent")
+	path = strings.TrimSuffix(path, ":embedContent")
+	path = strings.TrimSuffix(path, ":batchEmbedContents")
 	// Extract model name after /v1beta/models/
 	const prefix = "/v1beta/models/"
 	if strings.HasPrefix(path, prefix) {
@@ -475,6 +844,23 @@ func extractGeminiModel(path string) string {
 	return ""
 }
 
+// geminiToolResults returns the result text of every functionResponse
+// part.
+func geminiToolResults(contents []GeminiContent) []string {
+	var out []string
+	for _, c := range contents {
+		for _, p := range c.Parts {
+			if p.FunctionResponse == nil {
+				continue
+			}
+			if result := p.FunctionResponse.text(); result != "" {
+				out = append(out, result)
+			}
+		}
+	}
+	return out
+}
+
 // geminiHasToolResults returns true if any content contains a functionResponse part.
 func geminiHasToolResults(contents []GeminiContent) bool {
 	for _, c := range contents {
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -292,6 +293,40 @@ func TestGemini_StreamGenerateContent(t *testing.T) {
 	}
 }
 
+func TestGemini_StreamJSONArray(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"contents": [{"role": "user", "parts": [{"text": "Hello streaming world"}]}]}`
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected application/json without alt=sse, got %q", ct)
+	}
+	var chunks []llmock.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chunks); err != nil {
+		t.Fatalf("expected a JSON array of chunks: %v", err)
+	}
+	if len(chunks) == 0 {
+		t.Fatal("expected at least 1 chunk")
+	}
+	var fullText strings.Builder
+	for _, c := range chunks {
+		fullText.WriteString(c.Candidates[0].Content.Parts[0].Text)
+	}
+	if got := fullText.String(); got != "Hello streaming world" {
+		t.Errorf("expected 'Hello streaming world', got %q", got)
+	}
+	if last := chunks[len(chunks)-1]; last.Candidates[0].FinishReason != "STOP" {
+		t.Errorf("expected last chunk finishReason 'STOP', got %q", last.Candidates[0].FinishReason)
+	}
+}
+
 func TestGemini_StreamNonStreamStillWorks(t *testing.T) {
 	ts := newGeminiEchoServer(t)
 	defer ts.Close()
@@ -491,6 +526,37 @@ func TestGemini_FunctionResponseMultiTurn(t *testing.T) {
 	}
 }
 
+func TestGemini_FunctionResponseStructured(t *testing.T) {
+	rules := []llmock.Rule{
+		{Pattern: regexp.MustCompile(`"conditions":"foggy"`), Responses: []string{"Bring a torch."}},
+	}
+	s := llmock.New(llmock.WithRules(rules...), llmock.WithTokenDelay(0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"contents": [
+			{"role": "user", "parts": [{"text": "What's the weather?"}]},
+			{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "London"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"weather": {"conditions": "foggy"}}}}]}
+		]
+	}`
+
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result llmock.GeminiResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	got := result.Candidates[0].Content.Parts[0].Text
+	if got != "Bring a torch." {
+		t.Errorf("expected rule to match structured functionResponse, got %q", got)
+	}
+}
+
 func TestGemini_StreamToolCall(t *testing.T) {
 	rules := []llmock.Rule{
 		{
@@ -547,6 +613,67 @@ func TestGemini_StreamToolCall(t *testing.T) {
 	}
 }
 
+func TestGemini_StreamToolCallChunks(t *testing.T) {
+	args := map[string]any{"city": "Paris", "days": float64(3), "units": "metric"}
+	rules := []llmock.Rule{
+		{
+			Pattern:  regexp.MustCompile(`weather`),
+			ToolCall: &llmock.ToolCallConfig{Name: "get_weather", Arguments: args},
+		},
+	}
+	s := llmock.New(llmock.WithRules(rules...), llmock.WithTokenDelay(0), llmock.WithGeminiStreamToolChunks(true))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"contents": [{"role": "user", "parts": [{"text": "What is the weather?"}]}],
+		"tools": [{"functionDeclarations": [{"name": "get_weather"}]}]
+	}`
+
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var chunks []llmock.GeminiResponse
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var chunk llmock.GeminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			t.Fatalf("failed to parse chunk: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks (one per arg), got %d", len(chunks))
+	}
+	got := map[string]any{}
+	for i, chunk := range chunks {
+		fc := chunk.Candidates[0].Content.Parts[0].FunctionCall
+		if fc == nil {
+			t.Fatalf("chunk %d: expected function call", i)
+		}
+		if i == 0 && fc.Name != "get_weather" {
+			t.Errorf("expected name in first chunk, got %q", fc.Name)
+		}
+		for k, v := range fc.Args {
+			got[k] = v
+		}
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("reconstructed args = %v, want %v", got, args)
+	}
+	if chunks[len(chunks)-1].Candidates[0].FinishReason != "STOP" {
+		t.Error("expected finishReason STOP on the last chunk")
+	}
+}
+
 func TestGemini_ErrorFault(t *testing.T) {
 	s := llmock.New(
 		llmock.WithResponder(llmock.EchoResponder{}),
@@ -786,3 +913,226 @@ rules:
 		t.Errorf("expected 'Hi from config!', got %q", result.Candidates[0].Content.Parts[0].Text)
 	}
 }
+
+const geminiJSONModeBody = `{
+	"contents": [{"role": "user", "parts": [{"text": "extract the person"}]}],
+	"generationConfig": {
+		"responseMimeType": "application/json",
+		"responseSchema": {
+			"type": "OBJECT",
+			"properties": {
+				"name": {"type": "STRING"},
+				"age": {"type": "INTEGER"},
+				"tags": {"type": "ARRAY", "items": {"type": "STRING"}}
+			},
+			"required": ["name", "age", "tags"]
+		}
+	}
+}`
+
+func checkGeminiJSONModeText(t *testing.T, text string) {
+	t.Helper()
+	var obj struct {
+		Name *string  `json:"name"`
+		Age  *int     `json:"age"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(text), &obj); err != nil {
+		t.Fatalf("expected JSON text conforming to the schema, got %q: %v", text, err)
+	}
+	if obj.Name == nil || obj.Age == nil || len(obj.Tags) == 0 {
+		t.Errorf("expected all required fields, got %q", text)
+	}
+}
+
+func TestGemini_JSONModeResponseSchema(t *testing.T) {
+	// The default rules answer with prose, which JSON mode must replace.
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(geminiJSONModeBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result llmock.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	checkGeminiJSONModeText(t, result.Candidates[0].Content.Parts[0].Text)
+}
+
+func TestGemini_JSONModeStreaming(t *testing.T) {
+	s := llmock.New(llmock.WithTokenDelay(0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse", "application/json", strings.NewReader(geminiJSONModeBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var fullText strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var chunk llmock.GeminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("failed to parse chunk: %v", err)
+		}
+		if len(chunk.Candidates) > 0 && len(chunk.Candidates[0].Content.Parts) > 0 {
+			fullText.WriteString(chunk.Candidates[0].Content.Parts[0].Text)
+		}
+	}
+	checkGeminiJSONModeText(t, fullText.String())
+}
+
+func TestGemini_MaxOutputTokens(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"contents": [{"role": "user", "parts": [{"text": "one two three four five six seven"}]}],
+		"generationConfig": {"maxOutputTokens": 3}
+	}`
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result llmock.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	c := result.Candidates[0]
+	if c.FinishReason != "MAX_TOKENS" || c.Content.Parts[0].Text != "one two three" {
+		t.Errorf("expected truncated text with MAX_TOKENS, got %q / %q", c.Content.Parts[0].Text, c.FinishReason)
+	}
+	if result.UsageMetadata.CandidatesTokenCount > 3 {
+		t.Errorf("expected candidate tokens within the cap, got %d", result.UsageMetadata.CandidatesTokenCount)
+	}
+
+	stream, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	var last llmock.GeminiResponse
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			json.Unmarshal([]byte(data), &last)
+		}
+	}
+	if last.Candidates[0].FinishReason != "MAX_TOKENS" {
+		t.Errorf("expected streamed MAX_TOKENS finish reason, got %q", last.Candidates[0].FinishReason)
+	}
+}
+
+func TestGemini_SafetyRatings(t *testing.T) {
+	ts := newGeminiEchoServer(t)
+	defer ts.Close()
+
+	body := `{"contents":[{"role":"user","parts":[{"text":"hello"}]}]}`
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result llmock.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	ratings := result.Candidates[0].SafetyRatings
+	if len(ratings) != 4 {
+		t.Fatalf("expected 4 default safety ratings, got %+v", ratings)
+	}
+	for _, r := range ratings {
+		if r.Probability != "NEGLIGIBLE" || r.Blocked {
+			t.Errorf("expected benign rating, got %+v", r)
+		}
+	}
+	if result.PromptFeedback == nil || len(result.PromptFeedback.SafetyRatings) != 4 {
+		t.Errorf("expected prompt feedback with safety ratings, got %+v", result.PromptFeedback)
+	}
+
+	custom := llmock.GeminiSafetyRating{Category: "HARM_CATEGORY_HARASSMENT", Probability: "MEDIUM"}
+	s := llmock.New(llmock.WithGeminiSafetyRatings(custom))
+	ts2 := httptest.NewServer(s.Handler())
+	defer ts2.Close()
+	resp2, err := http.Post(ts2.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	var result2 llmock.GeminiResponse
+	json.NewDecoder(resp2.Body).Decode(&result2)
+	if got := result2.Candidates[0].SafetyRatings; len(got) != 1 || got[0] != custom {
+		t.Errorf("expected configured rating, got %+v", got)
+	}
+}
+
+func TestGemini_CandidateCount(t *testing.T) {
+	ts := newGeminiEchoServer(t)
+	defer ts.Close()
+
+	body := `{"contents":[{"role":"user","parts":[{"text":"pick one of these"}]}],"generationConfig":{"candidateCount":3}}`
+	resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result llmock.GeminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 3 {
+		t.Fatalf("expected 3 candidates, got %d", len(result.Candidates))
+	}
+	for i, c := range result.Candidates {
+		if c.Index != i || c.FinishReason != "STOP" || c.Content.Parts[0].Text != "pick one of these" {
+			t.Errorf("unexpected candidate %d: %+v", i, c)
+		}
+	}
+
+	// Streaming tags each candidate's chunks with its index.
+	resp, err = http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	texts := map[int]string{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var chunk llmock.GeminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range chunk.Candidates {
+			texts[c.Index] += c.Content.Parts[0].Text
+		}
+	}
+	if len(texts) != 3 || texts[2] != "pick one of these" {
+		t.Errorf("expected 3 streamed candidates, got %v", texts)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1beta/models/gemini-pro:generateContent", "application/json",
+		strings.NewReader(`{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"generationConfig":{"candidateCount":9}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many candidates, got %d", resp.StatusCode)
+	}
+}
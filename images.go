@@ -0,0 +1,127 @@
+package llmock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"sync"
+)
+
+// ImageGenerationRequest represents an OpenAI image generation request.
+type ImageGenerationRequest struct {
+	Model          string `json:"model,omitempty"`
+	Prompt         string `json:"prompt"`
+	N              *int   `json:"n,omitempty"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// ImageGenerationResponse represents an OpenAI image generation response.
+type ImageGenerationResponse struct {
+	Created int64       `json:"created"`
+	Data    []ImageData `json:"data"`
+}
+
+// ImageData is a single generated image. Exactly one of URL or B64JSON is
+// set, depending on the request's response_format.
+type ImageData struct {
+	URL           string `json:"url,omitempty"`
+	B64JSON       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+// maxImagesPerRequest mirrors OpenAI's limit on n.
+const maxImagesPerRequest = 10
+
+// WithImagePlaceholder sets the bytes returned for b64_json image responses.
+// By default a 1x1 transparent PNG is used.
+func WithImagePlaceholder(data []byte) Option {
+	return func(s *Server) {
+		s.imagePlaceholder = data
+	}
+}
+
+// defaultImagePNG returns a tiny valid PNG, encoded once on first use.
+var defaultImagePNG = sync.OnceValue(func() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.NRGBA{})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+})
+
+// imageHash derives a stable identifier for the i'th image of a prompt, so
+// the same prompt and seed always produce the same URLs.
+func (s *Server) imageHash(prompt string, i int) string {
+	var seed int64
+	if s.seed != nil {
+		seed = *s.seed
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%d\x00%s", seed, i, prompt)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Server) handleImageGenerations(w http.ResponseWriter, r *http.Request) {
+	var req ImageGenerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Prompt == "" {
+		writeError(w, http.StatusBadRequest, "prompt is required")
+		return
+	}
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	if n < 1 || n > maxImagesPerRequest {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %d", maxImagesPerRequest))
+		return
+	}
+	format := req.ResponseFormat
+	if format == "" {
+		format = "url"
+	}
+	if format != "url" && format != "b64_json" {
+		writeError(w, http.StatusBadRequest, "response_format must be 'url' or 'b64_json'")
+		return
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(req.Prompt); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "openai", false) {
+			return
+		}
+	}
+
+	s.logAdminRequest(r, []InternalMessage{{Role: "user", Content: req.Prompt}}, "")
+
+	placeholder := s.imagePlaceholder
+	if placeholder == nil {
+		placeholder = defaultImagePNG()
+	}
+
+	resp := ImageGenerationResponse{
+		Created: s.now().Unix(),
+		Data:    make([]ImageData, n),
+	}
+	for i := range resp.Data {
+		if format == "b64_json" {
+			resp.Data[i].B64JSON = base64.StdEncoding.EncodeToString(placeholder)
+		} else {
+			resp.Data[i].URL = "https://llmock.invalid/img/" + s.imageHash(req.Prompt, i) + ".png"
+		}
+		resp.Data[i].RevisedPrompt = req.Prompt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,106 @@
+package llmock_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postImages(t *testing.T, ts *httptest.Server, body string) llmock.ImageGenerationResponse {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/v1/images/generations", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result llmock.ImageGenerationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestImages_DeterministicURLs(t *testing.T) {
+	s := llmock.New(llmock.WithSeed(42))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"prompt": "a red fox", "n": 2, "size": "1024x1024"}`
+	first := postImages(t, ts, body)
+	if len(first.Data) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(first.Data))
+	}
+	for _, d := range first.Data {
+		if !strings.HasPrefix(d.URL, "https://llmock.invalid/img/") || !strings.HasSuffix(d.URL, ".png") {
+			t.Errorf("unexpected url %q", d.URL)
+		}
+	}
+	if first.Data[0].URL == first.Data[1].URL {
+		t.Error("expected distinct URLs for each image")
+	}
+
+	second := postImages(t, ts, body)
+	if second.Data[0].URL != first.Data[0].URL {
+		t.Errorf("expected reproducible URL, got %q then %q", first.Data[0].URL, second.Data[0].URL)
+	}
+	other := postImages(t, ts, `{"prompt": "a blue fox"}`)
+	if other.Data[0].URL == first.Data[0].URL {
+		t.Error("expected different prompt to produce a different URL")
+	}
+}
+
+func TestImages_B64JSON(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	result := postImages(t, ts, `{"prompt": "a cat", "response_format": "b64_json"}`)
+	if len(result.Data) != 1 || result.Data[0].URL != "" {
+		t.Fatalf("expected 1 b64 image, got %+v", result.Data)
+	}
+	raw, err := base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(raw)); err != nil {
+		t.Errorf("expected valid PNG: %v", err)
+	}
+
+	custom := []byte("not really a png")
+	ts2 := httptest.NewServer(llmock.New(llmock.WithImagePlaceholder(custom)).Handler())
+	defer ts2.Close()
+	result = postImages(t, ts2, `{"prompt": "a cat", "response_format": "b64_json"}`)
+	if result.Data[0].B64JSON != base64.StdEncoding.EncodeToString(custom) {
+		t.Errorf("expected placeholder bytes, got %q", result.Data[0].B64JSON)
+	}
+}
+
+func TestImages_Validation(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	for _, body := range []string{
+		`{"prompt": ""}`,
+		`{"prompt": "x", "n": 0}`,
+		`{"prompt": "x", "n": 11}`,
+		`{"prompt": "x", "response_format": "gif"}`,
+	} {
+		resp, err := http.Post(ts.URL+"/v1/images/generations", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package llmock
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// z-scores of the 95th and 99th percentiles of the standard normal.
+const (
+	z95 = 1.6449
+	z99 = 2.3263
+)
+
+// latencyProfile is a per-request latency distribution given by its
+// median and tail percentiles.
+type latencyProfile struct {
+	p50, p95, p99 time.Duration
+}
+
+// WithLatencyProfile delays each LLM API request by a latency sampled from
+// a distribution with the given 50th, 95th, and 99th percentiles, so load
+// tests see a realistic tail. The delay comes before the response starts,
+// so streams are delayed to their first chunk. Samples use the server's
+// RNG and are reproducible under WithSeed.
+func WithLatencyProfile(p50, p95, p99 time.Duration) Option {
+	return func(s *Server) {
+		s.latencyProfile = &latencyProfile{p50: p50, p95: p95, p99: p99}
+	}
+}
+
+// validate checks that the percentiles are positive and ordered.
+func (lp latencyProfile) validate() error {
+	if lp.p50 <= 0 || lp.p95 < lp.p50 || lp.p99 < lp.p95 {
+		return errors.New("latency profile needs 0 < p50 <= p95 <= p99")
+	}
+	return nil
+}
+
+// sample maps a standard normal z to a latency. It is log-normal around
+// p50, with a spread chosen to hit p95 at z95; above that the spread
+// switches to reach p99 at z99, so all three percentiles are exact.
+func (lp latencyProfile) sample(z float64) time.Duration {
+	if lp.validate() != nil {
+		return 0
+	}
+	lo := math.Log(float64(lp.p95)/float64(lp.p50)) / z95
+	if z <= z95 {
+		return time.Duration(float64(lp.p50) * math.Exp(z*lo))
+	}
+	hi := math.Log(float64(lp.p99)/float64(lp.p95)) / (z99 - z95)
+	return time.Duration(float64(lp.p95) * math.Exp((z-z95)*hi))
+}
+
+// WithWarmupDelay delays the first LLM API request from each client by d,
+// and serves later ones from that client without it, modelling JIT
+// compilation or a cache warming up. Clients are told apart by API key, or
+// by remote address (one per connection) for requests without a key. Up to
+// 10000 warm clients are remembered; past that, an arbitrary one is
+// forgotten and pays the delay again on its next request.
+func WithWarmupDelay(d time.Duration) Option {
+	return func(s *Server) {
+		s.warmup = &warmupState{delay: d, warmed: make(map[string]bool)}
+	}
+}
+
+// maxWarmClients bounds how many clients a warmupState remembers, since
+// every new connection without an API key is a new client.
+const maxWarmClients = 10000
+
+// warmupState records which clients have already paid the warmup delay.
+type warmupState struct {
+	delay time.Duration
+
+	mu     sync.Mutex
+	warmed map[string]bool
+}
+
+// take returns the delay owed by a request from client, marking the
+// client warm.
+func (ws *warmupState) take(client string) time.Duration {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.warmed[client] {
+		return 0
+	}
+	if len(ws.warmed) >= maxWarmClients {
+		for k := range ws.warmed {
+			delete(ws.warmed, k)
+			break
+		}
+	}
+	ws.warmed[client] = true
+	return ws.delay
+}
+
+// warmupClient identifies the client a request counts against for the
+// warmup delay.
+func warmupClient(r *http.Request) string {
+	if key := apiKeyFromRequest(r); key != anonymousKey {
+		return "key:" + key
+	}
+	return "addr:" + r.RemoteAddr
+}
+
+// latencyHandler holds LLM API requests for the warmup delay, if one is
+// owed, plus a latency sampled from the latency profile, if one is set.
+// Cancelled requests are dropped.
+func (s *Server) latencyHandler(h http.Handler) http.Handler {
+	if s.latencyProfile == nil && s.warmup == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := apiFormatForPath(r.URL.Path); ok {
+			var d time.Duration
+			if s.warmup != nil {
+				d = s.warmup.take(warmupClient(r))
+			}
+			if s.latencyProfile != nil {
+				// s.rng is shared with the fault state, which guards it.
+				s.faults.mu.Lock()
+				z := s.rng.NormFloat64()
+				s.faults.mu.Unlock()
+				d += s.latencyProfile.sample(z)
+			}
+			if d > 0 && !s.sleepFor(r.Context(), d) {
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withSleep replaces how sleepFor waits, so the warmup and latency profile
+// delays can be observed without waiting them out.
+func withSleep(sleep func(ctx context.Context, d time.Duration) bool) Option {
+	return func(s *Server) {
+		s.sleep = sleep
+	}
+}
+
+// sleepFor waits for d, or until ctx is done, and reports whether the full
+// d passed.
+func (s *Server) sleepFor(ctx context.Context, d time.Duration) bool {
+	if s.sleep != nil {
+		return s.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,91 @@
+package llmock
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyProfile_Percentiles(t *testing.T) {
+	lp := latencyProfile{p50: 10 * time.Millisecond, p95: 40 * time.Millisecond, p99: 80 * time.Millisecond}
+
+	// The percentiles are exact at their z-scores.
+	for _, tt := range []struct {
+		z    float64
+		want time.Duration
+	}{{0, lp.p50}, {z95, lp.p95}, {z99, lp.p99}} {
+		if got := lp.sample(tt.z); got < tt.want*99/100 || got > tt.want*101/100 {
+			t.Errorf("sample(%v) = %v, want %v", tt.z, got, tt.want)
+		}
+	}
+
+	// Samples drawn from a seeded RNG land near them.
+	rng := rand.New(rand.NewPCG(1, 2))
+	const n = 20000
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = lp.sample(rng.NormFloat64())
+	}
+	slices.Sort(samples)
+	for _, tt := range []struct {
+		q    int
+		want time.Duration
+	}{{50, lp.p50}, {95, lp.p95}, {99, lp.p99}} {
+		if got := samples[n*tt.q/100]; got < tt.want*9/10 || got > tt.want*11/10 {
+			t.Errorf("p%d = %v, want near %v", tt.q, got, tt.want)
+		}
+	}
+
+	if got := (latencyProfile{p50: 20 * time.Millisecond, p95: 10 * time.Millisecond, p99: 30 * time.Millisecond}).sample(0); got != 0 {
+		t.Errorf("invalid profile sampled %v, want 0", got)
+	}
+}
+
+func TestWarmupDelay_FirstRequestOnly(t *testing.T) {
+	const warmup = 200 * time.Millisecond
+	var waits []time.Duration
+	s := New(WithResponder(EchoResponder{}), WithTokenDelay(0), WithWarmupDelay(warmup),
+		withSleep(func(ctx context.Context, d time.Duration) bool {
+			waits = append(waits, d)
+			return true
+		}))
+	h := s.Handler()
+
+	send := func(key string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	// Only each client's first request waits.
+	send("a")
+	send("a")
+	send("b")
+	if want := []time.Duration{warmup, warmup}; !slices.Equal(waits, want) {
+		t.Errorf("waits = %v, want %v", waits, want)
+	}
+}
+
+func TestWarmupDelay_BoundsClients(t *testing.T) {
+	ws := &warmupState{delay: time.Second, warmed: make(map[string]bool)}
+	for i := range maxWarmClients + 100 {
+		if d := ws.take(fmt.Sprintf("addr:10.0.0.1:%d", i)); d != time.Second {
+			t.Fatalf("new client %d owed %v, want %v", i, d, time.Second)
+		}
+	}
+	if n := len(ws.warmed); n != maxWarmClients {
+		t.Errorf("remembered %d clients, want at most %d", n, maxWarmClients)
+	}
+}
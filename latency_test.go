@@ -0,0 +1,44 @@
+package llmock_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestLatencyProfile_DelaysOnlyLLMRequests(t *testing.T) {
+	// Equal percentiles make every sample the same.
+	const d = 300 * time.Millisecond
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithSeed(1),
+		llmock.WithLatencyProfile(d, d, d),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if took := time.Since(start); took < d {
+		t.Errorf("chat request took %v, want at least %v", took, d)
+	}
+
+	start = time.Now()
+	resp, err = http.Get(ts.URL + "/_mock/faults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if took := time.Since(start); took >= d {
+		t.Errorf("admin request took %v, expected no simulated latency", took)
+	}
+}
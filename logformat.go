@@ -0,0 +1,58 @@
+package llmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Log formats for WithLogFormat.
+const (
+	LogFormatText = "text" // one human-readable line per request (the default)
+	LogFormatJSON = "json" // one JSON object per request, for log aggregators
+)
+
+// WithLogFormat sets how verbose request logging is written: LogFormatText
+// or LogFormatJSON. It has no effect unless verbose logging is enabled.
+// With LogFormatJSON, give WithLogger a logger without a prefix or flags so
+// each line is a bare JSON object.
+func WithLogFormat(format string) Option {
+	return func(s *Server) {
+		s.logFormat = format
+	}
+}
+
+// requestLog is one verbose log entry, written by the Handler middleware.
+type requestLog struct {
+	Time        time.Time     `json:"ts"`
+	Method      string        `json:"method"`
+	Path        string        `json:"path"`
+	Status      int           `json:"status"`
+	Duration    time.Duration `json:"-"`
+	DurationMS  float64       `json:"duration_ms"`
+	UserMessage string        `json:"user_message,omitempty"`
+	MatchedRule string        `json:"matched_rule,omitempty"`
+}
+
+// format renders the entry in the given log format.
+func (e requestLog) format(format string) string {
+	if format == LogFormatJSON {
+		e.DurationMS = float64(e.Duration.Microseconds()) / 1000
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Sprintf(`{"error":%q}`, err.Error())
+		}
+		return string(data)
+	}
+	var parts []string
+	parts = append(parts, fmt.Sprintf("%s %s", e.Method, e.Path))
+	if e.UserMessage != "" {
+		parts = append(parts, fmt.Sprintf("user=%q", e.UserMessage))
+	}
+	if e.MatchedRule != "" {
+		parts = append(parts, fmt.Sprintf("rule=%q", e.MatchedRule))
+	}
+	parts = append(parts, fmt.Sprintf("-> %d (%s)", e.Status, e.Duration.Round(time.Millisecond)))
+	return "llmock: " + strings.Join(parts, " ")
+}
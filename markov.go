@@ -1,22 +1,54 @@
 package llmock
 
 import (
-	_ "embed"
+	"embed"
+	"fmt"
 	"io"
+	"maps"
+	"math"
 	"math/rand/v2"
 	"slices"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 //go:embed corpus.txt
 var defaultCorpus string
 
+//go:embed corpus.txt corpora/*.txt
+var builtinCorpora embed.FS
+
 // DefaultCorpusText returns the embedded default corpus text.
 func DefaultCorpusText() string {
 	return defaultCorpus
 }
 
+// builtinCorpusFiles maps built-in corpus names to their embedded files.
+var builtinCorpusFiles = map[string]string{
+	"conversational": "corpus.txt", // the default
+	"lorem":          "corpora/lorem.txt",
+	"technical":      "corpora/technical.txt",
+}
+
+// BuiltinCorpora returns the names of the built-in corpora, sorted.
+func BuiltinCorpora() []string {
+	return slices.Sorted(maps.Keys(builtinCorpusFiles))
+}
+
+// BuiltinCorpus returns the text of the named built-in corpus.
+func BuiltinCorpus(name string) (string, error) {
+	file, ok := builtinCorpusFiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown built-in corpus %q (want one of %s)", name, strings.Join(BuiltinCorpora(), ", "))
+	}
+	data, err := builtinCorpora.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 // MarkovChain generates text using a Markov chain trained on a corpus.
 // It is safe for concurrent reads after training.
 type MarkovChain struct {
@@ -54,31 +86,160 @@ func (mc *MarkovChain) Train(text string) {
 // Generate produces text of up to maxTokens words using the given random source.
 // Generation stops at maxTokens or when it hits a natural sentence ending.
 func (mc *MarkovChain) Generate(maxTokens int, rng *rand.Rand) string {
+	return mc.GenerateWithTemperature(maxTokens, rng, 1)
+}
+
+// GenerateWithTemperature is like Generate, but blends between the greedy
+// path and random sampling. At temperature 0 generation starts from the
+// first prefix and always follows the most common next word, so the output
+// is identical every time. At each step a random follower is chosen with
+// probability temperature (capped at 1), otherwise the most common one.
+func (mc *MarkovChain) GenerateWithTemperature(maxTokens int, rng *rand.Rand, temperature float64) string {
+	return mc.generate(maxTokens, rng, markovSampling{temperature: temperature})
+}
+
+// markovSampling controls word choice during generation. The penalties and
+// bias mirror the OpenAI request parameters of the same names.
+type markovSampling struct {
+	temperature      float64
+	frequencyPenalty float64
+	presencePenalty  float64
+	logitBias        map[string]float64 // keyed by lowercased word
+}
+
+// weighted reports whether any penalty or bias is set. Without them
+// generation takes the unweighted path, keeping seeded output unchanged.
+func (sp markovSampling) weighted() bool {
+	return sp.frequencyPenalty != 0 || sp.presencePenalty != 0 || len(sp.logitBias) > 0
+}
+
+// forbidden reports whether word has a bias of -100 or lower, which removes
+// it from the output entirely.
+func (sp markovSampling) forbidden(word string) bool {
+	return sp.logitBias[biasKey(word)] <= -100
+}
+
+// weight scores a follower seen count times in the chain, given how often
+// it has already been used in the output.
+func (sp markovSampling) weight(word string, count, used int) float64 {
+	if sp.forbidden(word) {
+		return 0
+	}
+	logit := sp.logitBias[biasKey(word)] - sp.frequencyPenalty*float64(used)
+	if used > 0 {
+		logit -= sp.presencePenalty
+	}
+	return float64(count) * math.Exp(logit)
+}
+
+// biasKey normalizes a word for logit_bias lookups, ignoring case and
+// surrounding punctuation.
+func biasKey(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+}
+
+// choose picks the next word from followers, weighting each distinct word
+// by weight. It returns false if every follower is forbidden.
+func (sp markovSampling) choose(followers []string, used map[string]int, rng *rand.Rand, sample bool) (string, bool) {
+	var (
+		words   []string
+		weights []float64
+		total   float64
+	)
+	counts := make(map[string]int, len(followers))
+	for _, f := range followers {
+		if counts[f] == 0 {
+			words = append(words, f)
+		}
+		counts[f]++
+	}
+	for _, w := range words {
+		wt := sp.weight(w, counts[w], used[biasKey(w)])
+		weights = append(weights, wt)
+		total += wt
+	}
+	if total == 0 {
+		return "", false
+	}
+	if !sample {
+		best := 0
+		for i, wt := range weights {
+			if wt > weights[best] {
+				best = i
+			}
+		}
+		return words[best], true
+	}
+	r := rng.Float64() * total
+	for i, wt := range weights {
+		if r < wt {
+			return words[i], true
+		}
+		r -= wt
+	}
+	return words[len(words)-1], true
+}
+
+// generate implements GenerateWithTemperature with optional penalties.
+func (mc *MarkovChain) generate(maxTokens int, rng *rand.Rand, sp markovSampling) string {
+	temperature := sp.temperature
 	mc.mu.RLock()
 	defer mc.mu.RUnlock()
 
 	if len(mc.chain) == 0 || maxTokens <= 0 {
 		return ""
 	}
+	sample := func() bool {
+		return temperature >= 1 || (temperature > 0 && rng.Float64() < temperature)
+	}
 
-	// Pick a random starting prefix (sorted for determinism).
+	// Pick a starting prefix (sorted for determinism).
 	keys := make([]string, 0, len(mc.chain))
 	for k := range mc.chain {
 		keys = append(keys, k)
 	}
 	slices.Sort(keys)
-	prefix := keys[rng.IntN(len(keys))]
+	if len(sp.logitBias) > 0 {
+		keys = slices.DeleteFunc(keys, func(k string) bool {
+			return slices.ContainsFunc(strings.Fields(k), sp.forbidden)
+		})
+		if len(keys) == 0 {
+			return ""
+		}
+	}
+	prefix := keys[0]
+	if sample() {
+		prefix = keys[rng.IntN(len(keys))]
+	}
 	words := strings.Fields(prefix)
 	result := make([]string, len(words))
 	copy(result, words)
+	used := make(map[string]int)
+	for _, w := range words {
+		used[biasKey(w)]++
+	}
 
 	for len(result) < maxTokens {
 		followers, ok := mc.chain[prefix]
 		if !ok || len(followers) == 0 {
 			break
 		}
-		next := followers[rng.IntN(len(followers))]
+		var next string
+		switch {
+		case sp.weighted():
+			next, _ = sp.choose(followers, used, rng, sample()) // "" if all forbidden
+		case sample():
+			next = followers[rng.IntN(len(followers))]
+		default:
+			next = mostCommon(followers)
+		}
+		if next == "" {
+			break
+		}
 		result = append(result, next)
+		used[biasKey(next)]++
 
 		// Update prefix.
 		prefixWords := strings.Fields(prefix)
@@ -94,6 +255,20 @@ func (mc *MarkovChain) Generate(maxTokens int, rng *rand.Rand) string {
 	return strings.Join(result, " ")
 }
 
+// mostCommon returns the most frequent word, preferring the earliest seen
+// on ties.
+func mostCommon(words []string) string {
+	counts := make(map[string]int, len(words))
+	best := words[0]
+	for _, w := range words {
+		counts[w]++
+		if counts[w] > counts[best] {
+			best = w
+		}
+	}
+	return best
+}
+
 // endsWithSentence returns true if the word ends with sentence-ending punctuation.
 func endsWithSentence(word string) bool {
 	if len(word) == 0 {
@@ -105,9 +280,12 @@ func endsWithSentence(word string) bool {
 
 // MarkovResponder uses a MarkovChain to generate responses.
 type MarkovResponder struct {
-	chain *MarkovChain
-	rng   *rand.Rand
-	mu    sync.Mutex
+	chain  *MarkovChain
+	source string // where the corpus came from, as shown by /_mock/config
+	rng    *rand.Rand
+	mu     sync.Mutex
+
+	minWords int // see WithMarkovMinWords
 }
 
 // NewMarkovResponder creates a MarkovResponder trained on the default corpus.
@@ -122,34 +300,156 @@ func NewMarkovResponder(seed *int64) *MarkovResponder {
 		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
 	}
 
-	return &MarkovResponder{chain: mc, rng: rng}
+	return &MarkovResponder{chain: mc, source: "builtin:conversational", rng: rng}
 }
 
 // Respond generates a Markov chain response.
 func (mr *MarkovResponder) Respond(messages []InternalMessage) (Response, error) {
-	if extractInput(messages) == "" {
+	return mr.RespondWithContext(RespondContext{Messages: messages})
+}
+
+// RespondWithContext generates a Markov chain response at the request's
+// temperature. At temperature 0 the output is the same for every request.
+func (mr *MarkovResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	if extractInput(ctx.Messages) == "" {
 		return Response{}, errNoMessages
 	}
+	sp := markovSampling{temperature: 1, logitBias: toolResultBias(normalizeLogitBias(ctx.LogitBias), ctx.ToolResults)}
+	if ctx.Temperature != nil {
+		sp.temperature = *ctx.Temperature
+	}
+	if ctx.FrequencyPenalty != nil {
+		sp.frequencyPenalty = *ctx.FrequencyPenalty
+	}
+	if ctx.PresencePenalty != nil {
+		sp.presencePenalty = *ctx.PresencePenalty
+	}
 	mr.mu.Lock()
-	text := mr.chain.Generate(100, mr.rng)
+	chain := mr.chain
 	mr.mu.Unlock()
-	if text == "" {
-		return Response{Text: "I understand. Could you tell me more about that?"}, nil
+	text := mr.generateSampled(chain, 100, sp)
+	for i := 0; i < markovMaxExtensions && len(strings.Fields(text)) < mr.minWords; i++ {
+		text += " " + mr.generateSampled(chain, 100, sp)
 	}
 	return Response{Text: text}, nil
 }
 
+// markovMaxExtensions bounds how many times a response shorter than
+// WithMarkovMinWords is extended, so a large minimum can't loop for long.
+const markovMaxExtensions = 20
+
+// toolResultWordBias is the logit bias given to words from tool results.
+const toolResultWordBias = 3
+
+// toolResultBias adds toolResultWordBias to bias for each word of the tool
+// results that the request didn't bias itself. Words shorter than four
+// letters are skipped, so the boost goes to content words rather than
+// "the" and "and".
+func toolResultBias(bias map[string]float64, results []string) map[string]float64 {
+	for _, result := range results {
+		for _, word := range strings.Fields(result) {
+			key := biasKey(word)
+			if len([]rune(key)) < 4 {
+				continue
+			}
+			if _, ok := bias[key]; ok {
+				continue
+			}
+			if bias == nil {
+				bias = make(map[string]float64)
+			}
+			bias[key] = toolResultWordBias
+		}
+	}
+	return bias
+}
+
+// normalizeLogitBias keys bias by lowercased word. Keys that are not words
+// (such as OpenAI token IDs) never match and are dropped.
+func normalizeLogitBias(bias map[string]float64) map[string]float64 {
+	if len(bias) == 0 {
+		return nil
+	}
+	out := make(map[string]float64, len(bias))
+	for k, v := range bias {
+		if key := biasKey(k); key != "" {
+			out[key] = v
+		}
+	}
+	return out
+}
+
 // GenerateMarkov produces Markov text with the given token limit, for use in templates.
 func (mr *MarkovResponder) GenerateMarkov(maxTokens int) string {
+	return mr.generate(maxTokens, nil)
+}
+
+// generate produces Markov text at the given temperature; nil means fully
+// random sampling. A stock sentence is returned if the chain is empty.
+func (mr *MarkovResponder) generate(maxTokens int, temperature *float64) string {
 	mr.mu.Lock()
-	defer mr.mu.Unlock()
-	text := mr.chain.Generate(maxTokens, mr.rng)
+	chain := mr.chain
+	mr.mu.Unlock()
+	return mr.generateFrom(chain, maxTokens, temperature)
+}
+
+// generateFrom is like generate, but samples chain instead of the
+// responder's own. Rules with their own corpus use it to share the
+// responder's seeded RNG.
+func (mr *MarkovResponder) generateFrom(chain *MarkovChain, maxTokens int, temperature *float64) string {
+	sp := markovSampling{temperature: 1}
+	if temperature != nil {
+		sp.temperature = *temperature
+	}
+	return mr.generateSampled(chain, maxTokens, sp)
+}
+
+// generateSampled is like generateFrom, with penalties and bias applied.
+func (mr *MarkovResponder) generateSampled(chain *MarkovChain, maxTokens int, sp markovSampling) string {
+	mr.mu.Lock()
+	text := chain.generate(maxTokens, mr.rng, sp)
+	mr.mu.Unlock()
 	if text == "" {
 		return "I understand. Could you tell me more about that?"
 	}
 	return text
 }
 
+// preview returns a copy of the responder with an RNG of its own, so text
+// generated from the copy leaves the responder's sequence untouched.
+func (mr *MarkovResponder) preview() *MarkovResponder {
+	if mr == nil {
+		return nil
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return &MarkovResponder{
+		chain:    mr.chain,
+		source:   mr.source,
+		rng:      rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		minWords: mr.minWords,
+	}
+}
+
+// setCorpus retrains the responder on text from source, replacing its
+// current chain. It is safe to call while requests are being served.
+func (mr *MarkovResponder) setCorpus(text, source string) {
+	mc := NewMarkovChain(2)
+	mc.Train(text)
+	mr.mu.Lock()
+	mr.chain = mc
+	mr.source = source
+	mr.mu.Unlock()
+}
+
+// corpusSource describes where the current corpus came from: a built-in
+// name, a file, or custom text.
+func (mr *MarkovResponder) corpusSource() string {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return mr.source
+}
+
 // WithCorpus provides a custom training corpus via an io.Reader.
 func WithCorpus(r io.Reader) Option {
 	return func(s *Server) {
@@ -157,7 +457,29 @@ func WithCorpus(r io.Reader) Option {
 		if err != nil {
 			return
 		}
-		s.corpusText = string(data)
+		s.corpusText, s.corpusName = string(data), ""
+	}
+}
+
+// WithBuiltinCorpus trains the Markov chain on one of the built-in corpora
+// (see BuiltinCorpora) instead of the default. Unknown names are ignored;
+// config files reject them.
+func WithBuiltinCorpus(name string) Option {
+	return func(s *Server) {
+		if text, err := BuiltinCorpus(name); err == nil {
+			s.corpusText, s.corpusName = text, name
+		}
+	}
+}
+
+// WithMarkovMinWords makes Markov responses at least n words long: a
+// response that stops short is extended with further generated text until
+// it reaches n words. Extensions are bounded, so a very large n may still
+// fall short. The extra text comes from the same RNG, so output stays
+// deterministic under WithSeed. n <= 0 (the default) means no minimum.
+func WithMarkovMinWords(n int) Option {
+	return func(s *Server) {
+		s.markovMinWords = n
 	}
 }
 
@@ -31,6 +31,20 @@ func TestMarkovChain_DeterministicWithSeed(t *testing.T) {
 	}
 }
 
+func TestMarkovChain_TemperatureZeroIsGreedy(t *testing.T) {
+	mc := llmock.NewMarkovChain(1)
+	mc.Train("a b a b a c a b")
+
+	for seed := uint64(0); seed < 5; seed++ {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		out := mc.GenerateWithTemperature(5, rng, 0)
+		// Sorted first prefix is "a"; the most common follower of "a" is "b".
+		if out != "a b a b a" {
+			t.Errorf("seed %d: expected greedy path %q, got %q", seed, "a b a b a", out)
+		}
+	}
+}
+
 func TestMarkovChain_DifferentSeeds(t *testing.T) {
 	corpus := "the quick brown fox jumps over the lazy dog the quick red fox runs through the green field the lazy cat sleeps on the warm mat"
 	mc := llmock.NewMarkovChain(2)
@@ -330,3 +344,158 @@ func TestMarkov_AnthropicEndpoint(t *testing.T) {
 		t.Error("expected non-empty Markov response via Anthropic endpoint")
 	}
 }
+
+func TestBuiltinCorpus_DisjointVocabularies(t *testing.T) {
+	words := func(corpus string) map[string]bool {
+		t.Helper()
+		s := llmock.New(
+			llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^never$`), Responses: []string{"x"}}),
+			llmock.WithBuiltinCorpus(corpus),
+			llmock.WithSeed(7),
+		)
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+		seen := map[string]bool{}
+		for range 5 {
+			for _, w := range strings.Fields(chatRequest(t, ts, "tell me something").Choices[0].Message.Content) {
+				seen[strings.ToLower(strings.Trim(w, ".,;:!?"))] = true
+			}
+		}
+		return seen
+	}
+	lorem, technical := words("lorem"), words("technical")
+	if len(lorem) == 0 || len(technical) == 0 {
+		t.Fatal("expected generated text from both corpora")
+	}
+	for w := range lorem {
+		if technical[w] {
+			t.Errorf("word %q generated from both the lorem and technical corpora", w)
+		}
+	}
+
+	if _, err := llmock.BuiltinCorpus("klingon"); err == nil || !strings.Contains(err.Error(), "lorem") {
+		t.Errorf("expected an error listing the built-in corpora, got %v", err)
+	}
+	cfg := &llmock.Config{Corpus: "klingon"}
+	if _, err := cfg.ToOptions(); err == nil {
+		t.Error("expected ToOptions to reject an unknown corpus")
+	}
+}
+
+// markovChat sends a chat request with extra top-level fields to a server
+// trained on corpus and returns the Markov output.
+func markovChat(t *testing.T, corpus, extra string) string {
+	t.Helper()
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^nomatch$`), Responses: []string{"nope"}}),
+		llmock.WithCorpus(strings.NewReader(corpus)),
+		llmock.WithSeed(42),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"model":"test","messages":[{"role":"user","content":"anything"}]` + extra + `}`
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result llmock.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Choices[0].Message.Content
+}
+
+func TestMarkovResponder_FrequencyPenaltyReducesRepetition(t *testing.T) {
+	corpus := "the cat sat on the mat and the cat sat on the mat and the dog ran to the park and the cat sat on the mat and"
+	repeats := func(text string) int {
+		words := strings.Fields(text)
+		seen := make(map[string]bool)
+		for _, w := range words {
+			seen[w] = true
+		}
+		return len(words) - len(seen)
+	}
+
+	plain := markovChat(t, corpus, `,"temperature":0`)
+	penalized := markovChat(t, corpus, `,"temperature":0,"frequency_penalty":2,"presence_penalty":1`)
+	if repeats(penalized) >= repeats(plain) {
+		t.Errorf("expected fewer repeated tokens with penalty, got %d (%q) vs %d (%q)",
+			repeats(penalized), penalized, repeats(plain), plain)
+	}
+	if again := markovChat(t, corpus, `,"temperature":0,"frequency_penalty":2,"presence_penalty":1`); again != penalized {
+		t.Errorf("expected reproducible output, got %q and %q", penalized, again)
+	}
+}
+
+func TestMarkovResponder_LogitBiasForbidsWords(t *testing.T) {
+	corpus := "the cat sat on the mat and the dog sat on the rug and the cat ran to the park"
+	out := markovChat(t, corpus, `,"temperature":1,"logit_bias":{"cat":-100}`)
+	if out == "" {
+		t.Fatal("expected non-empty output")
+	}
+	for _, w := range strings.Fields(out) {
+		if w == "cat" {
+			t.Errorf("forbidden word in output %q", out)
+		}
+	}
+}
+
+func TestMarkovResponder_ToolResultBiasesWords(t *testing.T) {
+	corpus := "the wind is calm and the wind is warm and the wind is calm and the wind is zephyr and"
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^nomatch$`), Responses: []string{"nope"}}),
+		llmock.WithCorpus(strings.NewReader(corpus)),
+		llmock.WithSeed(42),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	chat := func(toolResult string) string {
+		messages := `[{"role":"user","content":"how is the weather"}]`
+		if toolResult != "" {
+			messages = `[{"role":"user","content":"how is the weather"},` +
+				`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},` +
+				`{"role":"tool","tool_call_id":"call_1","content":"` + toolResult + `"}]`
+		}
+		var result llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions", `{"model":"test","temperature":0,"messages":`+messages+`}`, &result)
+		return result.Choices[0].Message.Content
+	}
+
+	plain := chat("")
+	informed := chat("a zephyr from the west")
+	if got, base := strings.Count(informed, "zephyr"), strings.Count(plain, "zephyr"); got <= base {
+		t.Errorf("expected tool result word to appear more often, got %d (%q) vs %d (%q)", got, informed, base, plain)
+	}
+	if again := chat("a zephyr from the west"); again != informed {
+		t.Errorf("expected deterministic output, got %q then %q", informed, again)
+	}
+}
+
+func TestMarkovResponder_MinWords(t *testing.T) {
+	// Short sentences and a dead end make short responses common.
+	corpus := "I see it now. Yes it is done. No it is not. Okay then."
+	const minWords = 15
+	respond := func(seed int64) string {
+		s := llmock.New(
+			llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^nomatch$`), Responses: []string{"nope"}}),
+			llmock.WithCorpus(strings.NewReader(corpus)),
+			llmock.WithSeed(seed),
+			llmock.WithMarkovMinWords(minWords),
+		)
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+		return chatRequest(t, ts, "anything").Choices[0].Message.Content
+	}
+	for seed := int64(0); seed < 50; seed++ {
+		text := respond(seed)
+		if n := len(strings.Fields(text)); n < minWords {
+			t.Errorf("seed %d: got %d words, want at least %d: %q", seed, n, minWords, text)
+		}
+		if again := respond(seed); again != text {
+			t.Errorf("seed %d: not deterministic: %q then %q", seed, text, again)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package llmock
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -20,10 +25,18 @@ type jsonRPCRequest struct {
 
 // jsonRPCResponse represents a JSON-RPC 2.0 response message.
 type jsonRPCResponse struct {
-	JSONRPC string       `json:"jsonrpc"`
-	ID      any          `json:"id,omitempty"`
-	Result  any          `json:"result,omitempty"`
-	Error   *jsonRPCErr  `json:"error,omitempty"`
+	JSONRPC string      `json:"jsonrpc"`
+	ID      any         `json:"id,omitempty"`
+	Result  any         `json:"result,omitempty"`
+	Error   *jsonRPCErr `json:"error,omitempty"`
+}
+
+// jsonRPCNotification represents a JSON-RPC 2.0 notification (no ID, no
+// response expected).
+type jsonRPCNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
 }
 
 // jsonRPCErr represents a JSON-RPC 2.0 error object.
@@ -39,22 +52,28 @@ const (
 	jsonRPCInvalidRequest = -32600
 	jsonRPCMethodNotFound = -32601
 	jsonRPCInvalidParams  = -32602
+	jsonRPCInternalError  = -32603
 )
 
 // MCP configuration types.
 
 // MCPToolConfig describes a tool advertised by the MCP server.
 type MCPToolConfig struct {
-	Name        string         `yaml:"name" json:"name"`
-	Description string         `yaml:"description" json:"description"`
-	InputSchema map[string]any `yaml:"input_schema" json:"input_schema"`
+	Name        string            `yaml:"name" json:"name"`
+	Description string            `yaml:"description" json:"description"`
+	InputSchema map[string]any    `yaml:"input_schema" json:"input_schema"`
 	Responses   []MCPToolResponse `yaml:"responses" json:"responses"`
 }
 
 // MCPToolResponse is a pattern-matched response for an MCP tool call.
+// IsError marks the result as a tool error (isError: true). IsJSON treats
+// Result as JSON: it is returned compacted as the text block and also as
+// structuredContent.
 type MCPToolResponse struct {
 	Pattern string `yaml:"pattern" json:"pattern"`
 	Result  string `yaml:"result" json:"result"`
+	IsError bool   `yaml:"is_error,omitempty" json:"is_error,omitempty"`
+	IsJSON  bool   `yaml:"is_json,omitempty" json:"is_json,omitempty"`
 }
 
 // MCPResourceConfig describes a resource advertised by the MCP server.
@@ -65,6 +84,21 @@ type MCPResourceConfig struct {
 	Content  string `yaml:"content" json:"content"`
 }
 
+// MCPResourceTemplateConfig describes a parameterized resource advertised
+// by the MCP server. URITemplate contains {var} placeholders (for example
+// "file:///logs/{date}.txt"); each matches one path segment of a requested
+// URI, and the captured values are substituted for {var} in Content.
+type MCPResourceTemplateConfig struct {
+	URITemplate string `yaml:"uri_template" json:"uri_template"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	MimeType    string `yaml:"mime_type,omitempty" json:"mime_type,omitempty"`
+	Content     string `yaml:"content" json:"content"`
+	// Completions maps template variable names to candidate values offered
+	// by completion/complete.
+	Completions map[string][]string `yaml:"completions,omitempty" json:"completions,omitempty"`
+}
+
 // MCPPromptConfig describes a prompt advertised by the MCP server.
 type MCPPromptConfig struct {
 	Name        string              `yaml:"name" json:"name"`
@@ -73,10 +107,12 @@ type MCPPromptConfig struct {
 	Template    string              `yaml:"template" json:"template"`
 }
 
-// MCPPromptArgument describes an argument to an MCP prompt.
+// MCPPromptArgument describes an argument to an MCP prompt. Completions
+// lists candidate values offered by completion/complete.
 type MCPPromptArgument struct {
-	Name     string `yaml:"name" json:"name"`
-	Required bool   `yaml:"required" json:"required"`
+	Name        string   `yaml:"name" json:"name"`
+	Required    bool     `yaml:"required" json:"required"`
+	Completions []string `yaml:"completions,omitempty" json:"completions,omitempty"`
 }
 
 // MCPConfig holds the full MCP configuration section.
@@ -84,6 +120,8 @@ type MCPConfig struct {
 	Tools     []MCPToolConfig     `yaml:"tools" json:"tools"`
 	Resources []MCPResourceConfig `yaml:"resources" json:"resources"`
 	Prompts   []MCPPromptConfig   `yaml:"prompts" json:"prompts"`
+
+	ResourceTemplates []MCPResourceTemplateConfig `yaml:"resource_templates,omitempty" json:"resource_templates,omitempty"`
 }
 
 // mcpState holds the runtime MCP state (tools, resources, prompts).
@@ -92,10 +130,27 @@ type mcpState struct {
 	tools     []MCPToolConfig
 	resources []MCPResourceConfig
 	prompts   []MCPPromptConfig
+	templates []MCPResourceTemplateConfig
 	// Keep initial state for reset support.
 	initialTools     []MCPToolConfig
 	initialResources []MCPResourceConfig
 	initialPrompts   []MCPPromptConfig
+	initialTemplates []MCPResourceTemplateConfig
+	// Connected sessions that receive notifications.
+	subscribers []*mcpSubscriber
+	// logLevel is the minimum level for notifications/message, set by
+	// logging/setLevel. Empty means logging is off.
+	logLevel string
+}
+
+// mcpLogLevels are the MCP (syslog) log levels in increasing severity.
+var mcpLogLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// mcpSubscriber is a client connection that can receive notifications,
+// such as a stdio session or the shared HTTP event stream.
+type mcpSubscriber struct {
+	notify func(jsonRPCNotification)
+	uris   map[string]bool // guarded by mcpState.mu
 }
 
 func newMCPState(cfg MCPConfig) *mcpState {
@@ -103,9 +158,11 @@ func newMCPState(cfg MCPConfig) *mcpState {
 		tools:            cloneSlice(cfg.Tools),
 		resources:        cloneSlice(cfg.Resources),
 		prompts:          cloneSlice(cfg.Prompts),
+		templates:        cloneSlice(cfg.ResourceTemplates),
 		initialTools:     cloneSlice(cfg.Tools),
 		initialResources: cloneSlice(cfg.Resources),
 		initialPrompts:   cloneSlice(cfg.Prompts),
+		initialTemplates: cloneSlice(cfg.ResourceTemplates),
 	}
 }
 
@@ -136,6 +193,12 @@ func (m *mcpState) getPrompts() []MCPPromptConfig {
 	return cloneSlice(m.prompts)
 }
 
+func (m *mcpState) getResourceTemplates() []MCPResourceTemplateConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return cloneSlice(m.templates)
+}
+
 func (m *mcpState) setTools(tools []MCPToolConfig) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -154,16 +217,27 @@ func (m *mcpState) setPrompts(prompts []MCPPromptConfig) {
 	m.prompts = cloneSlice(prompts)
 }
 
+func (m *mcpState) setResourceTemplates(templates []MCPResourceTemplateConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.templates = cloneSlice(templates)
+}
+
 func (m *mcpState) addTools(tools []MCPToolConfig) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.tools = append(m.tools, tools...)
 }
 
+// addResources adds resources, replacing any with the same URI, and
+// notifies subscribers of each URI.
 func (m *mcpState) addResources(resources []MCPResourceConfig) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.resources = append(m.resources, resources...)
+	m.resources = mergeByKey(m.resources, resources, func(r MCPResourceConfig) string { return r.URI })
+	m.mu.Unlock()
+	for _, r := range resources {
+		m.notifyResourceUpdated(r.URI)
+	}
 }
 
 func (m *mcpState) addPrompts(prompts []MCPPromptConfig) {
@@ -172,12 +246,120 @@ func (m *mcpState) addPrompts(prompts []MCPPromptConfig) {
 	m.prompts = append(m.prompts, prompts...)
 }
 
+func (m *mcpState) addResourceTemplates(templates []MCPResourceTemplateConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.templates = append(m.templates, templates...)
+}
+
+// addSubscriber registers a session to receive notifications.
+func (m *mcpState) addSubscriber(sub *mcpSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.subscribers, sub) {
+		m.subscribers = append(m.subscribers, sub)
+	}
+}
+
+func (m *mcpState) subscribe(sub *mcpSubscriber, uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub.uris == nil {
+		sub.uris = make(map[string]bool)
+	}
+	sub.uris[uri] = true
+	if !slices.Contains(m.subscribers, sub) {
+		m.subscribers = append(m.subscribers, sub)
+	}
+}
+
+func (m *mcpState) unsubscribe(sub *mcpSubscriber, uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(sub.uris, uri)
+}
+
+// removeSubscriber drops all of a subscriber's subscriptions, e.g. when
+// its connection closes.
+func (m *mcpState) removeSubscriber(sub *mcpSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = slices.DeleteFunc(m.subscribers, func(s *mcpSubscriber) bool { return s == sub })
+}
+
+// notifyResourceUpdated sends notifications/resources/updated to every
+// subscriber of uri.
+func (m *mcpState) notifyResourceUpdated(uri string) {
+	m.mu.RLock()
+	var subs []*mcpSubscriber
+	for _, sub := range m.subscribers {
+		if sub.uris[uri] {
+			subs = append(subs, sub)
+		}
+	}
+	m.mu.RUnlock()
+	for _, sub := range subs {
+		sub.notify(jsonRPCNotification{
+			JSONRPC: "2.0",
+			Method:  "notifications/resources/updated",
+			Params:  map[string]any{"uri": uri},
+		})
+	}
+}
+
+func (m *mcpState) setLogLevel(level string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logLevel = level
+}
+
+func (m *mcpState) getLogLevel() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.logLevel
+}
+
+// log sends a notifications/message to every session if level is at or
+// above the level set by logging/setLevel.
+func (m *mcpState) log(level string, data any) {
+	m.mu.RLock()
+	threshold := slices.Index(mcpLogLevels, m.logLevel)
+	subs := cloneSlice(m.subscribers)
+	m.mu.RUnlock()
+	if threshold < 0 || slices.Index(mcpLogLevels, level) < threshold {
+		return
+	}
+	for _, sub := range subs {
+		sub.notify(jsonRPCNotification{
+			JSONRPC: "2.0",
+			Method:  "notifications/message",
+			Params:  map[string]any{"level": level, "logger": "llmock", "data": data},
+		})
+	}
+}
+
 func (m *mcpState) reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.logLevel = ""
 	m.tools = cloneSlice(m.initialTools)
 	m.resources = cloneSlice(m.initialResources)
 	m.prompts = cloneSlice(m.initialPrompts)
+	m.templates = cloneSlice(m.initialTemplates)
+}
+
+// replace swaps in a new configuration and makes it the reset baseline.
+func (m *mcpState) replace(cfg MCPConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools = cloneSlice(cfg.Tools)
+	m.resources = cloneSlice(cfg.Resources)
+	m.prompts = cloneSlice(cfg.Prompts)
+	m.templates = cloneSlice(cfg.ResourceTemplates)
+	m.initialTools = cloneSlice(cfg.Tools)
+	m.initialResources = cloneSlice(cfg.Resources)
+	m.initialPrompts = cloneSlice(cfg.Prompts)
+	m.initialTemplates = cloneSlice(cfg.ResourceTemplates)
 }
 
 // WithMCP enables the MCP server with the given configuration.
@@ -231,10 +413,20 @@ func (s *Server) dispatchMCP(req jsonRPCRequest) jsonRPCResponse {
 		return s.mcpResourcesList(req)
 	case "resources/read":
 		return s.mcpResourcesRead(req)
+	case "resources/templates/list":
+		return s.mcpResourceTemplatesList(req)
+	case "resources/subscribe":
+		return s.mcpResourcesSubscribe(req, s.mcpEvents.sub, true)
+	case "resources/unsubscribe":
+		return s.mcpResourcesSubscribe(req, s.mcpEvents.sub, false)
 	case "prompts/list":
 		return s.mcpPromptsList(req)
 	case "prompts/get":
 		return s.mcpPromptsGet(req)
+	case "completion/complete":
+		return s.mcpComplete(req)
+	case "logging/setLevel":
+		return s.mcpSetLogLevel(req)
 	default:
 		return jsonRPCResponse{
 			JSONRPC: "2.0",
@@ -247,27 +439,119 @@ func (s *Server) dispatchMCP(req jsonRPCRequest) jsonRPCResponse {
 	}
 }
 
+// mcpProtocolVersions lists the MCP protocol versions llmock accepts,
+// oldest first. The last entry is offered when the client names none.
+var mcpProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// negotiateMCPVersion picks the protocol version to answer initialize with.
+// A supported version is echoed back; otherwise the newest supported version
+// older than the requested one is chosen, falling back to the oldest. ok is
+// false when the requested version is not supported exactly.
+func negotiateMCPVersion(requested string) (version string, ok bool) {
+	latest := mcpProtocolVersions[len(mcpProtocolVersions)-1]
+	if requested == "" {
+		return latest, true
+	}
+	if slices.Contains(mcpProtocolVersions, requested) {
+		return requested, true
+	}
+	// Versions are dates, so they compare lexically.
+	version = mcpProtocolVersions[0]
+	for _, v := range mcpProtocolVersions {
+		if v < requested {
+			version = v
+		}
+	}
+	return version, false
+}
+
+// WithMCPStrictVersion makes initialize fail with an invalid params error
+// when the client requests a protocol version llmock does not support,
+// instead of answering with the closest supported version.
+func WithMCPStrictVersion() Option {
+	return func(s *Server) {
+		s.mcpStrictVersion = true
+	}
+}
+
 func (s *Server) mcpInitialize(req jsonRPCRequest) jsonRPCResponse {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if req.Params != nil {
+		json.Unmarshal(req.Params, &params)
+	}
+	version, ok := negotiateMCPVersion(params.ProtocolVersion)
+	if !ok && s.mcpStrictVersion {
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &jsonRPCErr{
+				Code:    jsonRPCInvalidParams,
+				Message: "Unsupported protocol version",
+				Data: map[string]any{
+					"supported": mcpProtocolVersions,
+					"requested": params.ProtocolVersion,
+				},
+			},
+		}
+	}
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
 		Result: map[string]any{
-			"protocolVersion": "2025-03-26",
+			"protocolVersion": version,
 			"serverInfo": map[string]any{
 				"name":    "llmock",
 				"version": "1.0.0",
 			},
-			"capabilities": map[string]any{
-				"tools":     map[string]any{},
-				"resources": map[string]any{},
-				"prompts":   map[string]any{},
-			},
+			"capabilities": s.mcpCapabilities(),
 		},
 	}
 }
 
+// mcpCapabilities reports the capabilities backed by the current MCP
+// config: tools, resources (with subscribe) and prompts only when some are
+// configured, and completions only when there is something to complete.
+// Logging is always available. WithMCPAdvertiseAll reports everything.
+func (s *Server) mcpCapabilities() map[string]any {
+	caps := map[string]any{
+		"logging": map[string]any{},
+	}
+	tools := s.mcp.getTools()
+	resources := s.mcp.getResources()
+	templates := s.mcp.getResourceTemplates()
+	prompts := s.mcp.getPrompts()
+	if s.mcpAdvertiseAll || len(tools) > 0 {
+		caps["tools"] = map[string]any{}
+	}
+	if s.mcpAdvertiseAll || len(resources) > 0 || len(templates) > 0 {
+		caps["resources"] = map[string]any{"subscribe": true}
+	}
+	if s.mcpAdvertiseAll || len(prompts) > 0 {
+		caps["prompts"] = map[string]any{}
+	}
+	if s.mcpAdvertiseAll || len(prompts) > 0 || len(templates) > 0 {
+		caps["completions"] = map[string]any{}
+	}
+	return caps
+}
+
+// WithMCPAdvertiseAll makes MCP initialize advertise every capability,
+// whether or not anything is configured for it.
+func WithMCPAdvertiseAll() Option {
+	return func(s *Server) {
+		s.mcpAdvertiseAll = true
+	}
+}
+
 func (s *Server) mcpToolsList(req jsonRPCRequest) jsonRPCResponse {
 	tools := s.mcp.getTools()
+	start, end, next, errResp := s.mcpPage(req, len(tools))
+	if errResp != nil {
+		return *errResp
+	}
+	tools = tools[start:end]
 	toolList := make([]map[string]any, len(tools))
 	for i, t := range tools {
 		entry := map[string]any{
@@ -282,9 +566,9 @@ func (s *Server) mcpToolsList(req jsonRPCRequest) jsonRPCResponse {
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]any{
+		Result: withNextCursor(map[string]any{
 			"tools": toolList,
-		},
+		}, next),
 	}
 }
 
@@ -337,18 +621,22 @@ func (s *Server) mcpToolsCall(req jsonRPCRequest) jsonRPCResponse {
 		}
 	}
 
+	s.mcp.log("info", map[string]any{"event": "tools/call", "tool": params.Name, "arguments": params.Arguments})
+
 	// Match arguments against response patterns.
 	argsJSON, _ := json.Marshal(params.Arguments)
 	argsStr := string(argsJSON)
 
 	resultText := ""
-	for _, resp := range tool.Responses {
+	var matched *MCPToolResponse
+	for i, resp := range tool.Responses {
 		re, err := regexp.Compile(resp.Pattern)
 		if err != nil {
 			continue
 		}
 		if re.MatchString(argsStr) {
-			resultText = resp.Result
+			resultText = expandToolResult(resp.Result, params.Arguments)
+			matched = &tool.Responses[i]
 			break
 		}
 	}
@@ -361,22 +649,51 @@ func (s *Server) mcpToolsCall(req jsonRPCRequest) jsonRPCResponse {
 		resultText = "{}"
 	}
 
-	return jsonRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result: map[string]any{
-			"content": []map[string]any{
-				{
-					"type": "text",
-					"text": resultText,
+	var structured any
+	if matched != nil && matched.IsJSON {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(resultText)); err != nil {
+			return jsonRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &jsonRPCErr{
+					Code:    jsonRPCInternalError,
+					Message: fmt.Sprintf("Tool %s: result is not valid JSON: %v", params.Name, err),
 				},
+			}
+		}
+		resultText = buf.String()
+		json.Unmarshal(buf.Bytes(), &structured)
+	}
+
+	result := map[string]any{
+		"content": []map[string]any{
+			{
+				"type": "text",
+				"text": resultText,
 			},
 		},
 	}
+	if structured != nil {
+		result["structuredContent"] = structured
+	}
+	if matched != nil && matched.IsError {
+		result["isError"] = true
+	}
+	return jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  result,
+	}
 }
 
 func (s *Server) mcpResourcesList(req jsonRPCRequest) jsonRPCResponse {
 	resources := s.mcp.getResources()
+	start, end, next, errResp := s.mcpPage(req, len(resources))
+	if errResp != nil {
+		return *errResp
+	}
+	resources = resources[start:end]
 	resourceList := make([]map[string]any, len(resources))
 	for i, r := range resources {
 		entry := map[string]any{
@@ -391,9 +708,9 @@ func (s *Server) mcpResourcesList(req jsonRPCRequest) jsonRPCResponse {
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]any{
+		Result: withNextCursor(map[string]any{
 			"resources": resourceList,
-		},
+		}, next),
 	}
 }
 
@@ -448,6 +765,34 @@ func (s *Server) mcpResourcesRead(req jsonRPCRequest) jsonRPCResponse {
 		}
 	}
 
+	for _, t := range s.mcp.getResourceTemplates() {
+		vars, ok := matchURITemplate(t.URITemplate, params.URI)
+		if !ok {
+			continue
+		}
+		text := t.Content
+		for k, v := range vars {
+			text = replaceAll(text, "{"+k+"}", v)
+		}
+		mimeType := t.MimeType
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result: map[string]any{
+				"contents": []map[string]any{
+					{
+						"uri":      params.URI,
+						"mimeType": mimeType,
+						"text":     text,
+					},
+				},
+			},
+		}
+	}
+
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -458,8 +803,205 @@ func (s *Server) mcpResourcesRead(req jsonRPCRequest) jsonRPCResponse {
 	}
 }
 
+// mcpResourcesSubscribe adds or removes a subscription to a resource URI
+// for the given subscriber.
+func (s *Server) mcpResourcesSubscribe(req jsonRPCRequest, sub *mcpSubscriber, subscribe bool) jsonRPCResponse {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return jsonRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &jsonRPCErr{
+					Code:    jsonRPCInvalidParams,
+					Message: "Invalid params: " + err.Error(),
+				},
+			}
+		}
+	}
+	if params.URI == "" {
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &jsonRPCErr{
+				Code:    jsonRPCInvalidParams,
+				Message: "Invalid params: uri is required",
+			},
+		}
+	}
+	if subscribe {
+		s.mcp.subscribe(sub, params.URI)
+	} else {
+		s.mcp.unsubscribe(sub, params.URI)
+	}
+	return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+}
+
+// mcpSetLogLevel handles logging/setLevel. Once a level is set, tool calls
+// are reported as notifications/message log entries at "info".
+func (s *Server) mcpSetLogLevel(req jsonRPCRequest) jsonRPCResponse {
+	var params struct {
+		Level string `json:"level"`
+	}
+	if req.Params != nil {
+		json.Unmarshal(req.Params, &params)
+	}
+	if !slices.Contains(mcpLogLevels, params.Level) {
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &jsonRPCErr{
+				Code:    jsonRPCInvalidParams,
+				Message: fmt.Sprintf("Invalid params: unknown log level %q", params.Level),
+			},
+		}
+	}
+	s.mcp.setLogLevel(params.Level)
+	return jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+}
+
+// mcpEventHub fans out notifications for HTTP clients. Subscriptions made
+// over POST /mcp are shared by all HTTP clients, and notifications are
+// delivered to every open GET /mcp event stream.
+type mcpEventHub struct {
+	sub       *mcpSubscriber
+	mu        sync.Mutex
+	listeners map[chan []byte]struct{}
+}
+
+func newMCPEventHub() *mcpEventHub {
+	h := &mcpEventHub{listeners: make(map[chan []byte]struct{})}
+	h.sub = &mcpSubscriber{notify: h.broadcast}
+	return h
+}
+
+func (h *mcpEventHub) broadcast(n jsonRPCNotification) {
+	data, _ := json.Marshal(n)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.listeners {
+		select {
+		case ch <- data:
+		default: // drop rather than block on a slow listener
+		}
+	}
+}
+
+// handleMCPEvents handles GET /mcp: a server-sent event stream carrying
+// notifications, per the MCP streamable HTTP transport.
+func (s *Server) handleMCPEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	ch := make(chan []byte, 16)
+	h := s.mcpEvents
+	h.mu.Lock()
+	h.listeners[ch] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.listeners, ch)
+		h.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) mcpResourceTemplatesList(req jsonRPCRequest) jsonRPCResponse {
+	templates := s.mcp.getResourceTemplates()
+	start, end, next, errResp := s.mcpPage(req, len(templates))
+	if errResp != nil {
+		return *errResp
+	}
+	templates = templates[start:end]
+	templateList := make([]map[string]any, len(templates))
+	for i, t := range templates {
+		entry := map[string]any{
+			"uriTemplate": t.URITemplate,
+			"name":        t.Name,
+		}
+		if t.Description != "" {
+			entry["description"] = t.Description
+		}
+		if t.MimeType != "" {
+			entry["mimeType"] = t.MimeType
+		}
+		templateList[i] = entry
+	}
+	return jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: withNextCursor(map[string]any{
+			"resourceTemplates": templateList,
+		}, next),
+	}
+}
+
+// matchURITemplate matches uri against a template such as
+// "file:///logs/{date}.txt" and returns the values of its variables. Each
+// variable matches one or more characters other than "/".
+func matchURITemplate(template, uri string) (map[string]string, bool) {
+	var pattern []byte
+	var names []string
+	pattern = append(pattern, '^')
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			pattern = append(pattern, regexp.QuoteMeta(rest)...)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, false
+		}
+		pattern = append(pattern, regexp.QuoteMeta(rest[:open])...)
+		pattern = append(pattern, "([^/]+)"...)
+		names = append(names, rest[open+1:open+end])
+		rest = rest[open+end+1:]
+	}
+	pattern = append(pattern, '$')
+	re, err := regexp.Compile(string(pattern))
+	if err != nil {
+		return nil, false
+	}
+	m := re.FindStringSubmatch(uri)
+	if m == nil {
+		return nil, false
+	}
+	vars := make(map[string]string, len(names))
+	for i, name := range names {
+		vars[name] = m[i+1]
+	}
+	return vars, true
+}
+
 func (s *Server) mcpPromptsList(req jsonRPCRequest) jsonRPCResponse {
 	prompts := s.mcp.getPrompts()
+	start, end, next, errResp := s.mcpPage(req, len(prompts))
+	if errResp != nil {
+		return *errResp
+	}
+	prompts = prompts[start:end]
 	promptList := make([]map[string]any, len(prompts))
 	for i, p := range prompts {
 		args := make([]map[string]any, len(p.Arguments))
@@ -478,12 +1020,20 @@ func (s *Server) mcpPromptsList(req jsonRPCRequest) jsonRPCResponse {
 	return jsonRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]any{
+		Result: withNextCursor(map[string]any{
 			"prompts": promptList,
-		},
+		}, next),
 	}
 }
 
+// withNextCursor adds nextCursor to a list result when there is a next page.
+func withNextCursor(result map[string]any, next string) map[string]any {
+	if next != "" {
+		result["nextCursor"] = next
+	}
+	return result
+}
+
 func (s *Server) mcpPromptsGet(req jsonRPCRequest) jsonRPCResponse {
 	var params struct {
 		Name      string            `json:"name"`
@@ -549,6 +1099,185 @@ func (s *Server) mcpPromptsGet(req jsonRPCRequest) jsonRPCResponse {
 	}
 }
 
+// WithMCPPageSize paginates the MCP list methods (tools/list,
+// resources/list, resources/templates/list, prompts/list): each call
+// returns at most n items plus a nextCursor while more remain. Zero (the
+// default) returns everything in one page.
+func WithMCPPageSize(n int) Option {
+	return func(s *Server) {
+		s.mcpPageSize = n
+	}
+}
+
+// mcpPage returns the [start, end) bounds of the page of a list of length
+// n selected by the request's cursor param, and the cursor for the next
+// page ("" on the last page). A non-nil error response is returned for an
+// unknown cursor.
+func (s *Server) mcpPage(req jsonRPCRequest, n int) (start, end int, next string, errResp *jsonRPCResponse) {
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	if req.Params != nil {
+		json.Unmarshal(req.Params, &params)
+	}
+	if params.Cursor != "" {
+		offset, err := decodeMCPCursor(params.Cursor)
+		if err != nil || offset > n || s.mcpPageSize <= 0 {
+			return 0, 0, "", &jsonRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &jsonRPCErr{
+					Code:    jsonRPCInvalidParams,
+					Message: "Invalid params: invalid cursor",
+				},
+			}
+		}
+		start = offset
+	}
+	end = n
+	if s.mcpPageSize > 0 && start+s.mcpPageSize < n {
+		end = start + s.mcpPageSize
+		next = encodeMCPCursor(end)
+	}
+	return start, end, next, nil
+}
+
+// encodeMCPCursor turns a list offset into an opaque cursor token.
+func encodeMCPCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeMCPCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	const prefix = "offset:"
+	if len(raw) <= len(prefix) || string(raw[:len(prefix)]) != prefix {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	offset, err := strconv.Atoi(string(raw[len(prefix):]))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	return offset, nil
+}
+
+// expandToolResult replaces {{argName}} in an MCP tool result with the
+// call's argument values. Strings are inserted as-is; other values are
+// JSON-encoded.
+func expandToolResult(result string, args map[string]any) string {
+	for k, v := range args {
+		text, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			text = string(b)
+		}
+		result = replaceAll(result, "{{"+k+"}}", text)
+	}
+	return result
+}
+
+// maxCompletionValues is the most values completion/complete returns, per
+// the MCP spec.
+const maxCompletionValues = 100
+
+// mcpComplete handles completion/complete for prompt arguments
+// (ref/prompt) and resource template variables (ref/resource), returning
+// the configured candidates that start with the partial value.
+func (s *Server) mcpComplete(req jsonRPCRequest) jsonRPCResponse {
+	var params struct {
+		Ref struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+			URI  string `json:"uri"`
+		} `json:"ref"`
+		Argument struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"argument"`
+	}
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return jsonRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &jsonRPCErr{
+					Code:    jsonRPCInvalidParams,
+					Message: "Invalid params: " + err.Error(),
+				},
+			}
+		}
+	}
+
+	var candidates []string
+	found := false
+	switch params.Ref.Type {
+	case "ref/prompt":
+		for _, p := range s.mcp.getPrompts() {
+			if p.Name != params.Ref.Name {
+				continue
+			}
+			found = true
+			for _, a := range p.Arguments {
+				if a.Name == params.Argument.Name {
+					candidates = a.Completions
+				}
+			}
+			break
+		}
+	case "ref/resource":
+		for _, t := range s.mcp.getResourceTemplates() {
+			if t.URITemplate == params.Ref.URI {
+				found = true
+				candidates = t.Completions[params.Argument.Name]
+				break
+			}
+		}
+	default:
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &jsonRPCErr{
+				Code:    jsonRPCInvalidParams,
+				Message: fmt.Sprintf("Invalid params: unsupported ref type %q", params.Ref.Type),
+			},
+		}
+	}
+	if !found {
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &jsonRPCErr{
+				Code:    jsonRPCInvalidParams,
+				Message: "Invalid params: unknown ref",
+			},
+		}
+	}
+
+	values := []string{}
+	for _, c := range candidates {
+		if len(c) >= len(params.Argument.Value) && c[:len(params.Argument.Value)] == params.Argument.Value {
+			values = append(values, c)
+		}
+	}
+	total := len(values)
+	if total > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return jsonRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]any{
+			"completion": map[string]any{
+				"values":  values,
+				"total":   total,
+				"hasMore": total > len(values),
+			},
+		},
+	}
+}
+
 // replaceAll is a simple string replacement (avoids importing strings just for this).
 func replaceAll(s, old, new string) string {
 	result := make([]byte, 0, len(s))
@@ -634,6 +1363,37 @@ func registerMCPAdminRoutes(mux *http.ServeMux, state *mcpState) {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 
+	// Resource templates
+	mux.HandleFunc("GET /_mock/mcp/resource_templates", func(w http.ResponseWriter, r *http.Request) {
+		templates := state.getResourceTemplates()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"resource_templates": templates})
+	})
+
+	mux.HandleFunc("POST /_mock/mcp/resource_templates", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceTemplates []MCPResourceTemplateConfig `json:"resource_templates"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if len(req.ResourceTemplates) == 0 {
+			writeError(w, http.StatusBadRequest, "resource_templates array is required and must not be empty")
+			return
+		}
+		state.addResourceTemplates(req.ResourceTemplates)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("DELETE /_mock/mcp/resource_templates", func(w http.ResponseWriter, r *http.Request) {
+		state.setResourceTemplates(nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
 	// Prompts
 	mux.HandleFunc("GET /_mock/mcp/prompts", func(w http.ResponseWriter, r *http.Request) {
 		prompts := state.getPrompts()
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/shishberg/llmock"
@@ -69,7 +70,8 @@ func TestMCPDisabledByDefault(t *testing.T) {
 }
 
 func TestMCPInitialize(t *testing.T) {
-	ts := mcpTestServer(llmock.MCPConfig{})
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{}), llmock.WithMCPAdvertiseAll())
+	ts := httptest.NewServer(s.Handler())
 	defer ts.Close()
 
 	result := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "initialize"})
@@ -109,6 +111,81 @@ func TestMCPInitialize(t *testing.T) {
 	}
 }
 
+func TestMCPInitializeCapabilitiesReflectConfig(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{{Name: "lookup"}},
+	})
+	defer ts.Close()
+
+	result := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "initialize"})
+	var initResult struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	json.Unmarshal(result.Result, &initResult)
+
+	if _, ok := initResult.Capabilities["tools"]; !ok {
+		t.Error("expected tools capability")
+	}
+	for _, cap := range []string{"prompts", "resources", "completions"} {
+		if _, ok := initResult.Capabilities[cap]; ok {
+			t.Errorf("did not expect %s capability with only tools configured", cap)
+		}
+	}
+}
+
+func TestMCPInitializeVersionNegotiation(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{})
+	defer ts.Close()
+
+	negotiate := func(requested string) string {
+		t.Helper()
+		result := mcpCall(t, ts, jsonRPCRequest{
+			JSONRPC: "2.0", ID: 1, Method: "initialize",
+			Params: map[string]any{"protocolVersion": requested},
+		})
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		var initResult struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(result.Result, &initResult)
+		return initResult.ProtocolVersion
+	}
+
+	if v := negotiate("2024-11-05"); v != "2024-11-05" {
+		t.Errorf("expected older supported version to be echoed, got %q", v)
+	}
+	if v := negotiate("2025-01-01"); v != "2024-11-05" {
+		t.Errorf("expected downgrade to 2024-11-05, got %q", v)
+	}
+}
+
+func TestMCPInitializeStrictVersion(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{}), llmock.WithMCPStrictVersion())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	result := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "initialize",
+		Params: map[string]any{"protocolVersion": "2023-01-01"},
+	})
+	if result.Error == nil {
+		t.Fatal("expected error for unsupported protocol version")
+	}
+	if result.Error.Code != -32602 {
+		t.Errorf("expected invalid params code -32602, got %d", result.Error.Code)
+	}
+
+	result = mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 2, Method: "initialize",
+		Params: map[string]any{"protocolVersion": "2024-11-05"},
+	})
+	if result.Error != nil {
+		t.Fatalf("unexpected error for supported version: %v", result.Error)
+	}
+}
+
 func TestMCPInvalidJSON(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{})
 	defer ts.Close()
@@ -211,6 +288,56 @@ func TestMCPToolsList(t *testing.T) {
 	}
 }
 
+func TestMCPListPagination(t *testing.T) {
+	var tools []llmock.MCPToolConfig
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		tools = append(tools, llmock.MCPToolConfig{Name: name})
+	}
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{Tools: tools}), llmock.WithMCPPageSize(2))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var names []string
+	cursor := ""
+	pages := 0
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		result := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: pages + 1, Method: "tools/list", Params: params})
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		var page struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		json.Unmarshal(result.Result, &page)
+		if len(page.Tools) > 2 {
+			t.Fatalf("page has %d tools, want at most 2", len(page.Tools))
+		}
+		for _, tool := range page.Tools {
+			names = append(names, tool.Name)
+		}
+		pages++
+		if page.NextCursor == "" || pages > 5 {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if pages != 3 || strings.Join(names, "") != "abcde" {
+		t.Errorf("got %d pages with tools %v, want 3 pages of abcde", pages, names)
+	}
+
+	bad := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 9, Method: "tools/list", Params: map[string]any{"cursor": "bogus"}})
+	if bad.Error == nil || bad.Error.Code != -32602 {
+		t.Errorf("expected invalid params for bad cursor, got %+v", bad.Error)
+	}
+}
+
 func TestMCPToolsCall(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{
 		Tools: []llmock.MCPToolConfig{
@@ -302,6 +429,116 @@ func TestMCPToolsCallSecondPattern(t *testing.T) {
 	}
 }
 
+func TestMCPToolsCallArgumentTemplate(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{
+			{
+				Name: "greet",
+				Responses: []llmock.MCPToolResponse{
+					{Pattern: ".*", Result: `{"greeting":"Hello {{name}}","times":{{count}},"missing":"{{other}}"}`},
+				},
+			},
+		},
+	})
+	defer ts.Close()
+
+	result := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "tools/call",
+		Params: map[string]any{
+			"name":      "greet",
+			"arguments": map[string]any{"name": "Ada", "count": 3},
+		},
+	})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+
+	var callResult struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	json.Unmarshal(result.Result, &callResult)
+	want := `{"greeting":"Hello Ada","times":3,"missing":"{{other}}"}`
+	if callResult.Content[0].Text != want {
+		t.Errorf("got %q, want %q", callResult.Content[0].Text, want)
+	}
+}
+
+func TestMCPToolsCallIsError(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{
+			{
+				Name: "fetch",
+				Responses: []llmock.MCPToolResponse{
+					{Pattern: `"url":"bad`, Result: "connection refused", IsError: true},
+					{Pattern: ".*", Result: "ok"},
+				},
+			},
+		},
+	})
+	defer ts.Close()
+
+	call := func(url string) map[string]any {
+		t.Helper()
+		result := mcpCall(t, ts, jsonRPCRequest{
+			JSONRPC: "2.0", ID: 1, Method: "tools/call",
+			Params: map[string]any{"name": "fetch", "arguments": map[string]any{"url": url}},
+		})
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		var m map[string]any
+		json.Unmarshal(result.Result, &m)
+		return m
+	}
+
+	if got := call("bad://host"); got["isError"] != true {
+		t.Errorf("expected isError true, got %v", got)
+	}
+	if got := call("https://ok"); got["isError"] != nil {
+		t.Errorf("expected isError absent on success, got %v", got["isError"])
+	}
+}
+
+func TestMCPToolsCallStructuredJSON(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{
+			{
+				Name: "weather",
+				Responses: []llmock.MCPToolResponse{
+					{Pattern: ".*", Result: `{ "city": "{{city}}", "temp": 21 }`, IsJSON: true},
+				},
+			},
+		},
+	})
+	defer ts.Close()
+
+	result := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "tools/call",
+		Params: map[string]any{"name": "weather", "arguments": map[string]any{"city": "Oslo"}},
+	})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	var got struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StructuredContent map[string]any `json:"structuredContent"`
+	}
+	json.Unmarshal(result.Result, &got)
+	if got.Content[0].Type != "text" || got.Content[0].Text != `{"city":"Oslo","temp":21}` {
+		t.Errorf("expected compact JSON text block, got %+v", got.Content)
+	}
+	if got.StructuredContent["city"] != "Oslo" || got.StructuredContent["temp"] != float64(21) {
+		t.Errorf("unexpected structuredContent %v", got.StructuredContent)
+	}
+}
+
 func TestMCPToolsCallUnknownTool(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{
 		Tools: []llmock.MCPToolConfig{
@@ -438,6 +675,66 @@ func TestMCPResourcesRead(t *testing.T) {
 	}
 }
 
+func TestMCPResourceTemplates(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		ResourceTemplates: []llmock.MCPResourceTemplateConfig{
+			{
+				URITemplate: "file:///logs/{date}.txt",
+				Name:        "Daily log",
+				MimeType:    "text/plain",
+				Content:     "log entries for {date}",
+			},
+		},
+	})
+	defer ts.Close()
+
+	list := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "resources/templates/list"})
+	if list.Error != nil {
+		t.Fatalf("unexpected error: %v", list.Error)
+	}
+	var listResult struct {
+		ResourceTemplates []map[string]any `json:"resourceTemplates"`
+	}
+	json.Unmarshal(list.Result, &listResult)
+	if len(listResult.ResourceTemplates) != 1 || listResult.ResourceTemplates[0]["uriTemplate"] != "file:///logs/{date}.txt" {
+		t.Fatalf("unexpected templates list: %s", list.Result)
+	}
+
+	read := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "resources/read",
+		Params:  map[string]any{"uri": "file:///logs/2024-01-15.txt"},
+	})
+	if read.Error != nil {
+		t.Fatalf("unexpected error: %v", read.Error)
+	}
+	var readResult struct {
+		Contents []map[string]any `json:"contents"`
+	}
+	json.Unmarshal(read.Result, &readResult)
+	if len(readResult.Contents) != 1 {
+		t.Fatalf("expected 1 content, got %d", len(readResult.Contents))
+	}
+	if readResult.Contents[0]["text"] != "log entries for 2024-01-15" {
+		t.Errorf("unexpected content %v", readResult.Contents[0]["text"])
+	}
+	if readResult.Contents[0]["uri"] != "file:///logs/2024-01-15.txt" {
+		t.Errorf("expected requested uri, got %v", readResult.Contents[0]["uri"])
+	}
+
+	// Variables don't span path segments.
+	miss := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      3,
+		Method:  "resources/read",
+		Params:  map[string]any{"uri": "file:///logs/a/b.txt"},
+	})
+	if miss.Error == nil {
+		t.Error("expected not found for URI spanning segments")
+	}
+}
+
 func TestMCPResourcesReadNotFound(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{
 		Resources: []llmock.MCPResourceConfig{
@@ -577,6 +874,62 @@ func TestMCPPromptsGet(t *testing.T) {
 	}
 }
 
+func TestMCPCompletionComplete(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{
+		Prompts: []llmock.MCPPromptConfig{
+			{
+				Name: "review",
+				Arguments: []llmock.MCPPromptArgument{
+					{Name: "language", Completions: []string{"python", "perl", "php", "go"}},
+				},
+				Template: "Review this {{language}} code",
+			},
+		},
+	})
+	defer ts.Close()
+
+	result := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "completion/complete",
+		Params: map[string]any{
+			"ref":      map[string]any{"type": "ref/prompt", "name": "review"},
+			"argument": map[string]any{"name": "language", "value": "p"},
+		},
+	})
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	var got struct {
+		Completion struct {
+			Values  []string `json:"values"`
+			Total   int      `json:"total"`
+			HasMore bool     `json:"hasMore"`
+		} `json:"completion"`
+	}
+	json.Unmarshal(result.Result, &got)
+	want := []string{"python", "perl", "php"}
+	if strings.Join(got.Completion.Values, ",") != strings.Join(want, ",") {
+		t.Errorf("values = %v, want %v", got.Completion.Values, want)
+	}
+	if got.Completion.Total != 3 || got.Completion.HasMore {
+		t.Errorf("unexpected total/hasMore: %+v", got.Completion)
+	}
+
+	unknown := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "completion/complete",
+		Params: map[string]any{
+			"ref":      map[string]any{"type": "ref/prompt", "name": "missing"},
+			"argument": map[string]any{"name": "language", "value": ""},
+		},
+	})
+	if unknown.Error == nil || unknown.Error.Code != -32602 {
+		t.Errorf("expected invalid params for unknown prompt, got %+v", unknown.Error)
+	}
+}
+
 func TestMCPPromptsGetNotFound(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{
 		Prompts: []llmock.MCPPromptConfig{
@@ -613,6 +966,24 @@ func TestMCPPromptsGetNoName(t *testing.T) {
 	}
 }
 
+func TestMCPLoggingSetLevel(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{})
+	defer ts.Close()
+
+	ok := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "logging/setLevel", Params: map[string]any{"level": "debug"}})
+	if ok.Error != nil {
+		t.Fatalf("expected logging/setLevel to be accepted, got %v", ok.Error)
+	}
+	if string(ok.Result) != "{}" {
+		t.Errorf("expected empty result, got %s", ok.Result)
+	}
+
+	bad := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 2, Method: "logging/setLevel", Params: map[string]any{"level": "loud"}})
+	if bad.Error == nil || bad.Error.Code != -32602 {
+		t.Errorf("expected invalid params for unknown level, got %+v", bad.Error)
+	}
+}
+
 func TestMCPRequestIDPreserved(t *testing.T) {
 	ts := mcpTestServer(llmock.MCPConfig{})
 	defer ts.Close()
@@ -862,6 +1233,56 @@ func TestMCPAdminPromptsEndpoints(t *testing.T) {
 	}
 }
 
+func TestMCPAdminResourceTemplatesEndpoints(t *testing.T) {
+	ts := mcpTestServer(llmock.MCPConfig{})
+	defer ts.Close()
+
+	addBody, _ := json.Marshal(map[string]any{
+		"resource_templates": []map[string]any{
+			{"uri_template": "db://users/{id}", "name": "User", "content": `{"id": "{id}"}`},
+		},
+	})
+	postResp, err := http.Post(ts.URL+"/_mock/mcp/resource_templates", "application/json", bytes.NewReader(addBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	postResp.Body.Close()
+	if postResp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201, got %d", postResp.StatusCode)
+	}
+
+	read := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "resources/read",
+		Params: map[string]any{"uri": "db://users/42"},
+	})
+	if read.Error != nil {
+		t.Fatalf("unexpected error: %v", read.Error)
+	}
+	if !bytes.Contains(read.Result, []byte(`{\"id\": \"42\"}`)) {
+		t.Errorf("expected filled template, got %s", read.Result)
+	}
+
+	delReq, _ := http.NewRequest("DELETE", ts.URL+"/_mock/mcp/resource_templates", nil)
+	delResp, err := http.DefaultClient.Do(delReq)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	delResp.Body.Close()
+
+	getResp, err := http.Get(ts.URL + "/_mock/mcp/resource_templates")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer getResp.Body.Close()
+	var getResult struct {
+		ResourceTemplates []llmock.MCPResourceTemplateConfig `json:"resource_templates"`
+	}
+	json.NewDecoder(getResp.Body).Decode(&getResult)
+	if len(getResult.ResourceTemplates) != 0 {
+		t.Errorf("expected templates cleared, got %+v", getResult.ResourceTemplates)
+	}
+}
+
 func TestMCPConfigIntegration(t *testing.T) {
 	cfgYAML := `
 mcp:
@@ -973,3 +1394,33 @@ func TestMCPEmptyToolsList(t *testing.T) {
 		t.Errorf("expected 0 tools, got %d", len(tools))
 	}
 }
+
+func TestMCPSetConfig(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{{Name: "old_tool"}},
+	}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	err := s.SetMCPConfig(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{{Name: "new_tool"}, {Name: "other_tool"}},
+	})
+	if err != nil {
+		t.Fatalf("SetMCPConfig: %v", err)
+	}
+
+	result := mcpCall(t, ts, jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "tools/list"})
+	var listResult struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(result.Result, &listResult)
+	if len(listResult.Tools) != 2 || listResult.Tools[0].Name != "new_tool" {
+		t.Errorf("expected swapped tools, got %+v", listResult.Tools)
+	}
+
+	if err := llmock.New().SetMCPConfig(llmock.MCPConfig{}); err == nil {
+		t.Error("expected error when MCP is not enabled")
+	}
+}
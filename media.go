@@ -0,0 +1,113 @@
+package llmock
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// MediaConfig is a binary content block, such as an image or a PDF, that a
+// rule returns after its text. Data is the base64 payload; if empty, a
+// tiny placeholder of the media type is sent instead, since the bytes are
+// only there to exercise a client's handling of non-text output.
+type MediaConfig struct {
+	MediaType string `yaml:"media_type,omitempty" json:"media_type,omitempty"` // default "image/png"
+	Data      string `yaml:"data,omitempty" json:"data,omitempty"`
+}
+
+// mediaPlaceholders holds the placeholder payloads for MediaConfig.Data,
+// by media type.
+var mediaPlaceholders = map[string]string{
+	// A 1x1 transparent PNG.
+	"image/png": "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg==",
+	// A PDF with no pages.
+	"application/pdf": base64.StdEncoding.EncodeToString([]byte(
+		"%PDF-1.4\n1 0 obj <</Type /Catalog /Pages 2 0 R>> endobj\n2 0 obj <</Type /Pages /Kids [] /Count 0>> endobj\ntrailer <</Root 1 0 R>>\n%%EOF\n")),
+}
+
+// mediaType returns the block's media type, "image/png" by default.
+func (m MediaConfig) mediaType() string {
+	if m.MediaType == "" {
+		return "image/png"
+	}
+	return m.MediaType
+}
+
+// data returns the block's base64 payload, or a placeholder for its media
+// type if none is set.
+func (m MediaConfig) data() string {
+	if m.Data != "" {
+		return m.Data
+	}
+	if p, ok := mediaPlaceholders[m.mediaType()]; ok {
+		return p
+	}
+	return base64.StdEncoding.EncodeToString([]byte("llmock placeholder"))
+}
+
+// validate checks that the media type looks like a MIME type and that
+// Data, if set, is valid base64.
+func (m MediaConfig) validate() error {
+	if !strings.Contains(m.mediaType(), "/") {
+		return fmt.Errorf("media_type %q is not a MIME type", m.MediaType)
+	}
+	if _, err := base64.StdEncoding.DecodeString(m.Data); err != nil {
+		return fmt.Errorf("media data is not base64: %w", err)
+	}
+	return nil
+}
+
+// AnthropicMediaSource is the source of an Anthropic image or document
+// block.
+type AnthropicMediaSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// anthropicMediaBlock returns m as an Anthropic content block: an "image"
+// block for image types, otherwise a "document" block.
+func anthropicMediaBlock(m MediaConfig) AnthropicContentBlock {
+	typ := "document"
+	if strings.HasPrefix(m.mediaType(), "image/") {
+		typ = "image"
+	}
+	return AnthropicContentBlock{
+		Type:   typ,
+		Source: &AnthropicMediaSource{Type: "base64", MediaType: m.mediaType(), Data: m.data()},
+	}
+}
+
+// OpenAIImagePart is an image_url content part on an OpenAI chat message.
+type OpenAIImagePart struct {
+	Type     string         `json:"type"`
+	ImageURL OpenAIImageURL `json:"image_url"`
+}
+
+// OpenAIImageURL holds the URL of an OpenAIImagePart.
+type OpenAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// openAIImageParts returns m as OpenAI image_url parts carrying a data
+// URL, or nil if m is nil.
+func openAIImageParts(m *MediaConfig) []OpenAIImagePart {
+	if m == nil {
+		return nil
+	}
+	return []OpenAIImagePart{{
+		Type:     "image_url",
+		ImageURL: OpenAIImageURL{URL: "data:" + m.mediaType() + ";base64," + m.data()},
+	}}
+}
+
+// GeminiInlineData is binary data in a Gemini part.
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiMediaPart returns m as a Gemini inlineData part.
+func geminiMediaPart(m MediaConfig) GeminiPart {
+	return GeminiPart{InlineData: &GeminiInlineData{MimeType: m.mediaType(), Data: m.data()}}
+}
@@ -0,0 +1,68 @@
+package llmock_test
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestMedia_PerEndpoint(t *testing.T) {
+	ts := newTestServerWithRules(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`draw`), Responses: []string{"Here it is."}, Media: &llmock.MediaConfig{}},
+		llmock.Rule{Pattern: regexp.MustCompile(`report`), Media: &llmock.MediaConfig{MediaType: "application/pdf"}},
+	)
+	defer ts.Close()
+
+	var chat llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"draw a cat"}]}`, &chat)
+	msg := chat.Choices[0].Message
+	if msg.Content != "Here it is." || len(msg.Images) != 1 || msg.Images[0].Type != "image_url" ||
+		!strings.HasPrefix(msg.Images[0].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("unexpected chat message %+v", msg)
+	}
+
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"draw a cat"}]}`, &anthropic)
+	if c := anthropic.Content; len(c) != 2 || c[0].Text != "Here it is." || c[1].Type != "image" ||
+		c[1].Source == nil || c[1].Source.Type != "base64" || c[1].Source.MediaType != "image/png" {
+		t.Fatalf("unexpected Anthropic content %+v", c)
+	}
+	png, err := base64.StdEncoding.DecodeString(anthropic.Content[1].Source.Data)
+	if err != nil || !strings.HasPrefix(string(png), "\x89PNG") {
+		t.Errorf("expected a base64 PNG placeholder, got %q (%v)", png, err)
+	}
+
+	postJSON(t, ts, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"send the report"}]}`, &anthropic)
+	if c := anthropic.Content; len(c) != 1 || c[0].Type != "document" || c[0].Source == nil || c[0].Source.MediaType != "application/pdf" {
+		t.Errorf("expected a lone document block, got %+v", c)
+	}
+
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"draw a cat"}]}]}`, &gemini)
+	parts := gemini.Candidates[0].Content.Parts
+	if len(parts) != 2 || parts[0].Text != "Here it is." || parts[1].InlineData == nil ||
+		parts[1].InlineData.MimeType != "image/png" || parts[1].InlineData.Data == "" {
+		t.Errorf("unexpected Gemini parts %+v", parts)
+	}
+}
+
+func TestMedia_AfterSetRules(t *testing.T) {
+	s := llmock.New()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	if err := s.SetRules([]llmock.Rule{
+		{Pattern: regexp.MustCompile(`report`), Media: &llmock.MediaConfig{MediaType: "application/pdf"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"send the report"}]}`, &anthropic)
+	if c := anthropic.Content; len(c) != 1 || c[0].Type != "document" || c[0].Source == nil || c[0].Source.MediaType != "application/pdf" {
+		t.Errorf("expected a lone document block, got %+v", c)
+	}
+}
@@ -0,0 +1,108 @@
+package llmock
+
+import (
+	mrand "math/rand/v2"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// WithOutputMutation dirties response text for testing output parsers:
+// each character is, with probability rate, swapped with the next one,
+// dropped, or has its case flipped. Only text is changed; response
+// envelopes and tool call arguments stay valid. Under WithSeed the
+// mutations are the same on every run. A rate of 0 (the default) disables
+// mutation.
+func WithOutputMutation(rate float64) Option {
+	return func(s *Server) {
+		s.mutationRate = rate
+	}
+}
+
+// outputMutator perturbs response text. It has its own RNG so that
+// mutations don't shift fault or Markov sampling.
+type outputMutator struct {
+	rate float64
+	mu   sync.Mutex // guards rng
+	rng  *mrand.Rand
+}
+
+// newOutputMutator returns a mutator for rate, or nil if rate is 0.
+func newOutputMutator(rate float64, seed *int64) *outputMutator {
+	if rate <= 0 {
+		return nil
+	}
+	var rng *mrand.Rand
+	if seed != nil {
+		rng = mrand.New(mrand.NewPCG(uint64(*seed), 1))
+	} else {
+		rng = mrand.New(mrand.NewPCG(mrand.Uint64(), mrand.Uint64()))
+	}
+	return &outputMutator{rate: min(rate, 1), rng: rng}
+}
+
+// mutate returns text with random swaps, drops, and case flips. A nil
+// mutator returns text unchanged.
+func (m *outputMutator) mutate(text string) string {
+	if m == nil || text == "" {
+		return text
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	in := []rune(text)
+	out := make([]rune, 0, len(in))
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if m.rng.Float64() >= m.rate {
+			out = append(out, c)
+			continue
+		}
+		switch m.rng.IntN(3) {
+		case 0: // swap with the next character
+			if i+1 < len(in) {
+				out = append(out, in[i+1], c)
+				i++
+			} else {
+				out = append(out, c)
+			}
+		case 1: // drop
+		case 2: // flip case
+			if unicode.IsUpper(c) {
+				c = unicode.ToLower(c)
+			} else {
+				c = unicode.ToUpper(c)
+			}
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// respond gets the response to ctx from the server's responder and applies
+// output mutation to its text. Handlers use it instead of calling the
+// responder directly, so streamed chunks carry the mutated text too. It
+// also passes on the server's seed and, under WithSeed, its RNG.
+func (s *Server) respond(ctx RespondContext) (Response, error) {
+	ctx.seed = s.seed
+	if s.seed != nil {
+		ctx.rng = mrand.New(serverRandSource{s})
+	}
+	resp, ok := s.endpointRulesFirst(ctx)
+	if !ok {
+		var err error
+		if resp, err = respondWith(s.responder, ctx); err != nil {
+			return resp, err
+		}
+	}
+	if len(resp.Blocks) > 0 && s.mutator != nil {
+		blocks := make([]string, len(resp.Blocks))
+		for i, b := range resp.Blocks {
+			blocks[i] = s.mutator.mutate(b)
+		}
+		resp.Blocks = blocks
+		resp.Text = strings.Join(blocks, "")
+		return resp, nil
+	}
+	resp.Text = s.mutator.mutate(resp.Text)
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+const mutationText = "The quick brown fox jumps over the lazy dog."
+
+func newMutationServer(t *testing.T, rate float64) *httptest.Server {
+	t.Helper()
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{mutationText}}),
+		llmock.WithOutputMutation(rate),
+		llmock.WithSeed(7),
+	)
+	return httptest.NewServer(s.Handler())
+}
+
+func TestOutputMutation(t *testing.T) {
+	reply := func(rate float64) string {
+		t.Helper()
+		ts := newMutationServer(t, rate)
+		defer ts.Close()
+		return chatRequest(t, ts, "hello").Choices[0].Message.Content
+	}
+
+	if got := reply(0); got != mutationText {
+		t.Errorf("rate 0: expected untouched text, got %q", got)
+	}
+	first := reply(0.2)
+	if first == mutationText {
+		t.Errorf("rate 0.2: expected mutated text, got %q", first)
+	}
+	if again := reply(0.2); again != first {
+		t.Errorf("expected the same mutation under seed, got %q and %q", first, again)
+	}
+}
+
+func TestOutputMutation_Streaming(t *testing.T) {
+	ts := newMutationServer(t, 0.2)
+	defer ts.Close()
+	want := chatRequest(t, ts, "hello").Choices[0].Message.Content
+
+	ts2 := newMutationServer(t, 0.2)
+	defer ts2.Close()
+	body := `{"model":"test","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+	resp, err := http.Post(ts2.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got strings.Builder
+	for _, line := range readSSEData(t, resp) {
+		if line == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("chunk is not valid JSON: %v", err)
+		}
+		if len(chunk.Choices) > 0 {
+			got.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if got.String() != want {
+		t.Errorf("streamed text %q differs from non-streamed %q", got.String(), want)
+	}
+}
@@ -0,0 +1,253 @@
+package llmock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// No-match modes for NoMatchConfig.
+const (
+	NoMatchMarkov = "markov" // Markov-generated text (the default)
+	NoMatchEcho   = "echo"   // echo the user's message back
+	NoMatchEmpty  = "empty"  // empty content with a normal stop
+	NoMatchText   = "text"   // a fixed Text
+)
+
+// API families for RespondContext.Endpoint and WithEndpointRules. The
+// Responses, Assistants, audio, and realtime APIs count as EndpointOpenAI.
+const (
+	EndpointOpenAI    = "openai"
+	EndpointAnthropic = "anthropic"
+	EndpointGemini    = "gemini"
+)
+
+// NoMatchConfig selects what the server responds with when no rule
+// matches a request. In config files it is written either as a mode name
+// (no_match: echo) or as a fixed text (no_match: {text: "..."}).
+type NoMatchConfig struct {
+	Mode string `yaml:"mode" json:"mode"`
+	Text string `yaml:"text,omitempty" json:"text,omitempty"`
+}
+
+// UnmarshalYAML accepts a bare mode name or a mapping.
+func (c *NoMatchConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Mode = value.Value
+		return c.validate()
+	}
+	type plain NoMatchConfig
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+// UnmarshalJSON accepts a bare mode name or an object.
+func (c *NoMatchConfig) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Mode); err == nil {
+		return c.validate()
+	}
+	type plain NoMatchConfig
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+// validate fills in the text mode when only Text is given and rejects
+// unknown modes.
+func (c *NoMatchConfig) validate() error {
+	if c.Mode == "" && c.Text != "" {
+		c.Mode = NoMatchText
+	}
+	switch c.Mode {
+	case "", NoMatchMarkov, NoMatchEcho, NoMatchEmpty, NoMatchText:
+		return nil
+	}
+	return fmt.Errorf("unknown no_match mode %q (want markov, echo, empty, or text)", c.Mode)
+}
+
+// WithNoMatchBehavior sets what the server responds with when no rule
+// matches, instead of Markov text. It applies to every endpoint.
+func WithNoMatchBehavior(cfg NoMatchConfig) Option {
+	return func(s *Server) {
+		s.noMatch = cfg
+	}
+}
+
+// WithStrictMatching makes a request that matches no rule fail with an
+// HTTP 422 naming the unmatched input, instead of using the no-match
+// behavior. A catchall rule still matches everything.
+func WithStrictMatching(enabled bool) Option {
+	return func(s *Server) {
+		s.strictMatching = enabled
+	}
+}
+
+// WithStrictMatchingStatus sets the HTTP status returned for unmatched
+// requests in strict mode. The default is 422.
+func WithStrictMatchingStatus(code int) Option {
+	return func(s *Server) {
+		s.strictStatus = code
+	}
+}
+
+// noMatchError is returned by the no-match responder in strict mode.
+type noMatchError struct {
+	input string
+}
+
+func (e *noMatchError) Error() string {
+	return fmt.Sprintf("no rule matched input %q", e.input)
+}
+
+// responderErrorStatus returns the HTTP status for an error from the
+// responder: the strict-mode status for unmatched input, else 400.
+func (s *Server) responderErrorStatus(err error) int {
+	var nm *noMatchError
+	if !errors.As(err, &nm) {
+		return http.StatusBadRequest
+	}
+	if s.strictStatus != 0 {
+		return s.strictStatus
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// noMatchResponder returns the responder used when no rule matches.
+func (s *Server) noMatchResponder() Responder {
+	base := s.baseNoMatchResponder()
+	if len(s.endpointRules) == 0 {
+		return base
+	}
+	if s.endpointResponder == nil {
+		s.endpointResponder = &endpointRuleResponder{
+			rules:      s.endpointRules,
+			fallback:   base,
+			markov:     s.markov,
+			callCounts: make(map[string]map[int]int),
+		}
+	}
+	return s.endpointResponder
+}
+
+// endpointRulesFirst answers ctx from the endpoint rules when the server
+// has no rules of the user's own. The built-in defaults end with a
+// catch-all, so behind them the endpoint rules would never be reached.
+func (s *Server) endpointRulesFirst(ctx RespondContext) (Response, bool) {
+	if s.endpointResponder == nil || !s.usingDefaultRules() {
+		return Response{}, false
+	}
+	return s.endpointResponder.match(ctx)
+}
+
+// usingDefaultRules reports whether the server's rules are the built-in
+// defaults alone.
+func (s *Server) usingDefaultRules() bool {
+	if s.admin != nil {
+		return onlyBuiltin(s.admin.snapshot())
+	}
+	if rr, ok := s.responder.(*RuleResponder); ok {
+		return onlyBuiltin(rr.rules)
+	}
+	return false
+}
+
+// baseNoMatchResponder is noMatchResponder without endpoint rules.
+func (s *Server) baseNoMatchResponder() Responder {
+	if s.strictMatching {
+		return strictResponder{}
+	}
+	switch s.noMatch.Mode {
+	case NoMatchEcho:
+		return EchoResponder{}
+	case NoMatchEmpty:
+		return fixedResponder{}
+	case NoMatchText:
+		return fixedResponder{text: s.noMatch.Text}
+	default:
+		return s.markov
+	}
+}
+
+// WithEndpointRules adds default rules for one API family (EndpointOpenAI,
+// EndpointAnthropic, or EndpointGemini). They are tried only when no other
+// rule matches a request to that family, before the no-match behavior, so
+// each provider can answer in its own voice. Without rules of the user's
+// own, they are tried before the built-in DefaultRules.
+func WithEndpointRules(endpoint string, rules ...Rule) Option {
+	return func(s *Server) {
+		if s.endpointRules == nil {
+			s.endpointRules = make(map[string][]Rule)
+		}
+		s.endpointRules[endpoint] = sortRules(append(s.endpointRules[endpoint], rules...))
+	}
+}
+
+// endpointRuleResponder answers from the rules for the request's endpoint,
+// or from fallback if none of them match.
+type endpointRuleResponder struct {
+	rules    map[string][]Rule
+	fallback Responder
+	markov   *MarkovResponder
+
+	mu         sync.Mutex             // guards callCounts
+	callCounts map[string]map[int]int // endpoint → rule index → tool calls
+}
+
+func (e *endpointRuleResponder) Respond(messages []InternalMessage) (Response, error) {
+	return e.RespondWithContext(RespondContext{Messages: messages})
+}
+
+func (e *endpointRuleResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	if resp, ok := e.match(ctx); ok {
+		return resp, nil
+	}
+	return respondWith(e.fallback, ctx)
+}
+
+// match answers from the rules for the request's endpoint, reporting
+// whether one of them matched.
+func (e *endpointRuleResponder) match(ctx RespondContext) (Response, bool) {
+	rules := e.rules[ctx.Endpoint]
+	if len(rules) == 0 || extractInput(ctx.Messages) == "" {
+		return Response{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	counts := e.callCounts[ctx.Endpoint]
+	if counts == nil {
+		counts = make(map[int]int)
+		e.callCounts[ctx.Endpoint] = counts
+	}
+	resp, idx := findRuleResponse(rules, counts, ctx, e.markov)
+	return resp, idx >= 0
+}
+
+// strictResponder fails every request with a noMatchError.
+type strictResponder struct{}
+
+func (strictResponder) Respond(messages []InternalMessage) (Response, error) {
+	input := extractInput(messages)
+	if input == "" {
+		return Response{}, errNoMessages
+	}
+	return Response{}, &noMatchError{input: input}
+}
+
+// fixedResponder always responds with the same text, which may be empty.
+type fixedResponder struct {
+	text string
+}
+
+func (f fixedResponder) Respond(messages []InternalMessage) (Response, error) {
+	if extractInput(messages) == "" {
+		return Response{}, errNoMessages
+	}
+	return Response{Text: f.text}, nil
+}
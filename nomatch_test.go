@@ -0,0 +1,231 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestNoMatch_FixedTextOnAllEndpoints(t *testing.T) {
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}}),
+		llmock.WithNoMatchBehavior(llmock.NoMatchConfig{Mode: llmock.NoMatchText, Text: "UNEXPECTED PROMPT"}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	post := func(path, body string) string {
+		t.Helper()
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, resp.StatusCode)
+		}
+		var raw json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&raw)
+		return string(raw)
+	}
+
+	if got := chatRequest(t, ts, "hello").Choices[0].Message.Content; got != "hi" {
+		t.Errorf("expected matching rule to still apply, got %q", got)
+	}
+	if got := chatRequest(t, ts, "what is the capital of France?").Choices[0].Message.Content; got != "UNEXPECTED PROMPT" {
+		t.Errorf("OpenAI: expected fixed no-match text, got %q", got)
+	}
+	if got := post("/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"something else"}]}`); !strings.Contains(got, "UNEXPECTED PROMPT") {
+		t.Errorf("Anthropic: expected fixed no-match text, got %s", got)
+	}
+	if got := post("/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"something else"}]}]}`); !strings.Contains(got, "UNEXPECTED PROMPT") {
+		t.Errorf("Gemini: expected fixed no-match text, got %s", got)
+	}
+}
+
+func TestNoMatch_Empty(t *testing.T) {
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}}),
+		llmock.WithNoMatchBehavior(llmock.NoMatchConfig{Mode: llmock.NoMatchEmpty}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	result := chatRequest(t, ts, "something unexpected")
+	if result.Choices[0].Message.Content != "" {
+		t.Errorf("expected empty content, got %q", result.Choices[0].Message.Content)
+	}
+	if result.Choices[0].FinishReason != "stop" {
+		t.Errorf("expected finish_reason stop, got %q", result.Choices[0].FinishReason)
+	}
+}
+
+func TestStrictMatching_Unprocessable(t *testing.T) {
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}}),
+		llmock.WithStrictMatching(true),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, tc := range []struct{ path, body string }{
+		{"/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"missing fixture"}]}`},
+		{"/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"missing fixture"}]}`},
+		{"/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"missing fixture"}]}]}`},
+	} {
+		resp, err := http.Post(ts.URL+tc.path, "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d", tc.path, resp.StatusCode)
+		}
+		if !strings.Contains(body.Error.Message, "missing fixture") {
+			t.Errorf("%s: expected error naming the input, got %q", tc.path, body.Error.Message)
+		}
+	}
+
+	if got := chatRequest(t, ts, "hello").Choices[0].Message.Content; got != "hi" {
+		t.Errorf("expected matching rule to still apply, got %q", got)
+	}
+}
+
+func TestStrictMatching_CatchallAndStatus(t *testing.T) {
+	s := llmock.New(
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"catchall"}}),
+		llmock.WithStrictMatching(true),
+		llmock.WithStrictMatchingStatus(http.StatusConflict),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	if got := chatRequest(t, ts, "anything").Choices[0].Message.Content; got != "catchall" {
+		t.Errorf("expected catchall to bypass strict mode, got %q", got)
+	}
+
+	// Without the catchall, the configured status is used.
+	if err := s.SetRules([]llmock.Rule{{Pattern: regexp.MustCompile(`^hello$`), Responses: []string{"hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"anything"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409, got %d", resp.StatusCode)
+	}
+}
+
+func TestEndpointRules_ProviderIdentity(t *testing.T) {
+	cfg, err := llmock.ParseConfig([]byte(`
+rules:
+  - pattern: "^hello$"
+    responses: ["hi"]
+defaults:
+  rules_by_endpoint:
+    openai:
+      - pattern: "(?i)who are you"
+        responses: ["I'm GPT."]
+    anthropic:
+      - pattern: "(?i)who are you"
+        responses: ["I'm Claude."]
+`), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := cfg.ToOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(llmock.New(opts...).Handler())
+	defer ts.Close()
+
+	var openAI llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"Who are you?"}]}`, &openAI)
+	if got := openAI.Choices[0].Message.Content; got != "I'm GPT." {
+		t.Errorf("openai: got %q", got)
+	}
+	var anthropic llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"Who are you?"}]}`, &anthropic)
+	if got := anthropic.Content[0].Text; got != "I'm Claude." {
+		t.Errorf("anthropic: got %q", got)
+	}
+
+	// User rules still win on every endpoint.
+	postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`, &anthropic)
+	if got := anthropic.Content[0].Text; got != "hi" {
+		t.Errorf("anthropic user rule: got %q", got)
+	}
+	// Endpoints without their own rules fall through to the no-match behavior.
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"Who are you?"}]}]}`, &gemini)
+	if got := gemini.Candidates[0].Content.Parts[0].Text; got == "I'm GPT." || got == "I'm Claude." {
+		t.Errorf("gemini: expected no endpoint rule to apply, got %q", got)
+	}
+}
+
+func TestEndpointRules_WithoutUserRules(t *testing.T) {
+	cfg, err := llmock.ParseConfig([]byte(`
+defaults:
+  rules_by_endpoint:
+    openai:
+      - pattern: "(?i)who are you"
+        responses: ["I'm GPT."]
+`), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := cfg.ToOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(llmock.New(opts...).Handler())
+	defer ts.Close()
+
+	ask := func() string {
+		var resp llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"Who are you?"}]}`, &resp)
+		return resp.Choices[0].Message.Content
+	}
+
+	// Endpoint rules come before the built-in defaults' catch-all.
+	if got := ask(); got != "I'm GPT." {
+		t.Errorf("openai: got %q", got)
+	}
+	// The defaults still answer what the endpoint rules don't.
+	var hello llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"hello"}]}`, &hello)
+	if got := hello.Choices[0].Message.Content; !strings.HasPrefix(got, "H") {
+		t.Errorf("expected a default greeting, got %q", got)
+	}
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"Who are you?"}]}]}`, &gemini)
+	if got := gemini.Candidates[0].Content.Parts[0].Text; !strings.Contains(got, "Who are you?") {
+		t.Errorf("gemini: expected the default catch-all, got %q", got)
+	}
+
+	// Once the user adds a rule of their own, it wins again.
+	resp, err := http.Post(ts.URL+"/_mock/rules", "application/json",
+		strings.NewReader(`{"rules":[{"pattern":"(?i)who","responses":["A user rule."]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := ask(); got != "A user rule." {
+		t.Errorf("after adding a user rule: got %q", got)
+	}
+}
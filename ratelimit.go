@@ -0,0 +1,162 @@
+package llmock
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all LLM endpoints. It holds up
+// to burst tokens and refills continuously at rate tokens per second.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(requestsPerMinute, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   float64(requestsPerMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take consumes a token if one is available. Otherwise it returns false
+// and how long until the next token is due.
+func (rl *rateLimiter) take() (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	rl.tokens = math.Min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.rate)
+	rl.last = now
+	if rl.tokens >= 1 {
+		rl.tokens--
+		return true, 0
+	}
+	if rl.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := (1 - rl.tokens) / rl.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// WithRateLimit enables sustained rate limiting of the LLM endpoints with a
+// token bucket that holds burst requests and refills at requestsPerMinute.
+// Requests over the limit get a 429 in the provider's error format, with a
+// Retry-After header giving the seconds until the bucket refills. Admin and
+// MCP endpoints are not limited.
+func WithRateLimit(requestsPerMinute, burst int) Option {
+	return func(s *Server) {
+		s.rateLimit = newRateLimiter(requestsPerMinute, burst)
+	}
+}
+
+// WithMaxConcurrency limits the LLM endpoints to n requests in flight at
+// once, counting a streamed response until its last chunk is written.
+// Requests over the limit get a 503 in the provider's error format with
+// Retry-After: 1, like a saturated self-hosted model server. Admin and MCP
+// endpoints are not limited. n <= 0 means no limit.
+func WithMaxConcurrency(n int) Option {
+	return func(s *Server) {
+		s.inFlight = nil
+		if n > 0 {
+			s.inFlight = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithColdStart makes the LLM endpoints answer 503 "model is loading" in the
+// provider's error format for d after the server is created, with a
+// Retry-After header giving the seconds left, like a self-hosted backend
+// still loading its weights. Time is read from WithClock if set, so tests
+// can end the window without sleeping.
+func WithColdStart(d time.Duration) Option {
+	return func(s *Server) {
+		s.coldStart = d
+	}
+}
+
+// loading reports whether the server is still within its cold-start
+// window, and if so how long is left.
+func (s *Server) loading() (bool, time.Duration) {
+	if s.coldStart <= 0 {
+		return false, 0
+	}
+	left := s.coldStart - s.now().Sub(s.started)
+	return left > 0, left
+}
+
+// rateLimitHandler wraps h so requests to the LLM endpoints are subject to
+// the cold start, concurrency limit, rate limiter, and per-key quota, and
+// are counted in the key's usage.
+func (s *Server) rateLimitHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, limited := apiFormatForPath(r.URL.Path)
+		if !limited {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if loading, left := s.loading(); loading {
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(left.Seconds())), 1)))
+			writeUnavailable(w, "model is loading", format)
+			return
+		}
+		if s.inFlight != nil {
+			select {
+			case s.inFlight <- struct{}{}:
+				defer func() { <-s.inFlight }()
+			default:
+				w.Header().Set("Retry-After", "1")
+				writeUnavailable(w, "too many concurrent requests", format)
+				return
+			}
+		}
+		if s.rateLimit != nil {
+			if ok, wait := s.rateLimit.take(); !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+				writeFaultError(w, http.StatusTooManyRequests, "rate limit exceeded", "rate_limit_error", format)
+				return
+			}
+		}
+		if !s.usage.addRequest(apiKeyFromRequest(r)) {
+			writeFaultError(w, http.StatusTooManyRequests, "API key quota exceeded", "rate_limit_error", format)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeUnavailable writes a 503 in the provider's error format, with the
+// overloaded error type for Anthropic.
+func writeUnavailable(w http.ResponseWriter, message, apiFormat string) {
+	errType := "server_error"
+	if apiFormat == "anthropic" {
+		errType = "overloaded_error"
+	}
+	writeFaultError(w, http.StatusServiceUnavailable, message, errType, apiFormat)
+}
+
+// apiFormatForPath returns the error format for an LLM endpoint path, and
+// false for paths that are not LLM endpoints.
+func apiFormatForPath(path string) (string, bool) {
+	switch {
+	case path == "/v1/messages":
+		return "anthropic", true
+	case strings.HasPrefix(path, "/v1beta/"):
+		return "gemini", true
+	case strings.HasPrefix(path, "/v1/"):
+		return "openai", true
+	}
+	return "", false
+}
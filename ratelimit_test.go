@@ -0,0 +1,211 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestRateLimit_FloodThenRecover(t *testing.T) {
+	// 1200/min refills one token every 50ms.
+	s := llmock.New(llmock.WithRateLimit(1200, 3))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	post := func() *http.Response {
+		t.Helper()
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	var ok, limited int
+	var last *http.Response
+	for range 10 {
+		resp := post()
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			ok++
+		case http.StatusTooManyRequests:
+			limited++
+			last = resp
+		}
+	}
+	if ok < 3 || limited == 0 {
+		t.Fatalf("expected the burst to pass and later requests to be limited, got %d ok, %d limited", ok, limited)
+	}
+	if last.Header.Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After: 1, got %q", last.Header.Get("Retry-After"))
+	}
+
+	// Admin endpoints are exempt.
+	resp, err := http.Get(ts.URL + "/_mock/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected admin endpoint to be exempt, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	resp = post()
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected recovery after refill, got %d", resp.StatusCode)
+	}
+}
+
+func TestRateLimit_AnthropicErrorShape(t *testing.T) {
+	s := llmock.New(llmock.WithRateLimit(1, 1))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`
+	for i := range 2 {
+		resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type string `json:"type"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if i == 0 {
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %d", resp.StatusCode)
+		}
+		if result.Type != "error" || result.Error.Type != "rate_limit_error" {
+			t.Errorf("expected Anthropic rate_limit_error, got %+v", result)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "60" {
+			t.Errorf("expected Retry-After: 60 at 1/min, got %q", got)
+		}
+	}
+}
+
+func TestMaxConcurrency_Overflow(t *testing.T) {
+	s := llmock.New(
+		llmock.WithMaxConcurrency(2),
+		llmock.WithTokenDelay(50*time.Millisecond),
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"one two three four five six"}}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	statuses := make(chan *http.Response, 3)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body) // hold the slot until the stream ends
+			resp.Body.Close()
+			statuses <- resp
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	var ok, overflow int
+	for resp := range statuses {
+		switch resp.StatusCode {
+		case http.StatusOK:
+			ok++
+		case http.StatusServiceUnavailable:
+			overflow++
+			if got := resp.Header.Get("Retry-After"); got != "1" {
+				t.Errorf("expected Retry-After: 1, got %q", got)
+			}
+		}
+	}
+	if ok != 2 || overflow != 1 {
+		t.Fatalf("expected 2 ok and 1 overflow, got %d ok, %d overflow", ok, overflow)
+	}
+
+	// Slots are released once requests complete.
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a free slot after completion, got %d", resp.StatusCode)
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	s := llmock.New(llmock.WithColdStart(3*time.Second), llmock.WithClock(clock))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	post := func() *http.Response {
+		t.Helper()
+		body := `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`
+		resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post()
+	var result struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 during cold start, got %d", resp.StatusCode)
+	}
+	if result.Error.Type != "overloaded_error" || result.Error.Message != "model is loading" {
+		t.Errorf("unexpected error body: %+v", result.Error)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "3" {
+		t.Errorf("expected Retry-After: 3, got %q", got)
+	}
+
+	mu.Lock()
+	now = now.Add(3 * time.Second)
+	mu.Unlock()
+	resp = post()
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected success after the cold start, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,310 @@
+package llmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithRealtime enables the OpenAI Realtime API WebSocket endpoint at
+// GET /v1/realtime. Only text turns are supported: audio input and output,
+// function calling, and response cancellation are not.
+func WithRealtime() Option {
+	return func(s *Server) {
+		s.realtimeEnabled = true
+	}
+}
+
+// realtimeSession is the session object sent in session.created and
+// session.updated.
+type realtimeSession struct {
+	ID           string   `json:"id"`
+	Object       string   `json:"object"`
+	Model        string   `json:"model"`
+	Modalities   []string `json:"modalities"`
+	Instructions string   `json:"instructions"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+}
+
+// realtimeItem is a conversation item. Only message items are supported.
+type realtimeItem struct {
+	ID      string                `json:"id"`
+	Object  string                `json:"object"`
+	Type    string                `json:"type"`
+	Status  string                `json:"status"`
+	Role    string                `json:"role"`
+	Content []realtimeContentPart `json:"content"`
+}
+
+// realtimeContentPart is one part of a message item's content.
+type realtimeContentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// realtimeClientEvent is an event sent by the client.
+type realtimeClientEvent struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id,omitempty"`
+	Session *struct {
+		Instructions *string  `json:"instructions,omitempty"`
+		Modalities   []string `json:"modalities,omitempty"`
+		Temperature  *float64 `json:"temperature,omitempty"`
+	} `json:"session,omitempty"`
+	Item     *realtimeItem `json:"item,omitempty"`
+	Response *struct {
+		Instructions *string `json:"instructions,omitempty"`
+	} `json:"response,omitempty"`
+}
+
+// realtimeConn holds the state of one Realtime session.
+type realtimeConn struct {
+	s       *Server
+	r       *http.Request
+	ws      *wsConn
+	session realtimeSession
+	items   []realtimeItem
+}
+
+// handleRealtime upgrades the request to a WebSocket and runs a Realtime
+// session until the client disconnects.
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	model := s.responseModel(r.URL.Query().Get("model"))
+	rc := &realtimeConn{
+		s:  s,
+		r:  r,
+		ws: ws,
+		session: realtimeSession{
+			ID:         s.newID("sess_"),
+			Object:     "realtime.session",
+			Model:      model,
+			Modalities: []string{"text"},
+		},
+	}
+	if rc.send("session.created", map[string]any{"session": rc.session}) != nil {
+		return
+	}
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if rc.handleEvent(data) != nil {
+			return
+		}
+	}
+}
+
+// send writes a server event of the given type.
+func (rc *realtimeConn) send(eventType string, fields map[string]any) error {
+	event := map[string]any{
+		"type":     eventType,
+		"event_id": rc.s.newID("event_"),
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+	data, _ := json.Marshal(event)
+	return rc.ws.WriteText(data)
+}
+
+// sendError writes an error event in reply to the client event eventID.
+func (rc *realtimeConn) sendError(code, msg, eventID string) error {
+	return rc.send("error", map[string]any{
+		"error": map[string]any{
+			"type":     "invalid_request_error",
+			"code":     code,
+			"message":  msg,
+			"param":    nil,
+			"event_id": eventID,
+		},
+	})
+}
+
+// handleEvent dispatches one client event. Invalid events are reported to
+// the client as error events; the returned error is only for write
+// failures, which end the session.
+func (rc *realtimeConn) handleEvent(data []byte) error {
+	var ev realtimeClientEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return rc.sendError("invalid_json", "invalid JSON: "+err.Error(), "")
+	}
+	switch ev.Type {
+	case "session.update":
+		if ev.Session == nil {
+			return rc.sendError("missing_required_parameter", "session.update requires a session", ev.EventID)
+		}
+		if ev.Session.Instructions != nil {
+			rc.session.Instructions = *ev.Session.Instructions
+		}
+		if ev.Session.Modalities != nil {
+			rc.session.Modalities = ev.Session.Modalities
+		}
+		if ev.Session.Temperature != nil {
+			rc.session.Temperature = ev.Session.Temperature
+		}
+		return rc.send("session.updated", map[string]any{"session": rc.session})
+
+	case "conversation.item.create":
+		if ev.Item == nil {
+			return rc.sendError("missing_required_parameter", "conversation.item.create requires an item", ev.EventID)
+		}
+		item := *ev.Item
+		if item.Type != "message" {
+			return rc.sendError("unsupported_item_type", "only message items are supported, got "+item.Type, ev.EventID)
+		}
+		if item.ID == "" {
+			item.ID = rc.s.newID("item_")
+		}
+		item.Object = "realtime.item"
+		item.Status = "completed"
+		return rc.addItem(item)
+
+	case "response.create":
+		instructions := rc.session.Instructions
+		if ev.Response != nil && ev.Response.Instructions != nil {
+			instructions = *ev.Response.Instructions
+		}
+		return rc.respond(instructions, ev.EventID)
+
+	default:
+		return rc.sendError("unknown_event", "unsupported event type: "+ev.Type, ev.EventID)
+	}
+}
+
+// addItem appends item to the conversation and emits
+// conversation.item.created.
+func (rc *realtimeConn) addItem(item realtimeItem) error {
+	var previous any
+	if len(rc.items) > 0 {
+		previous = rc.items[len(rc.items)-1].ID
+	}
+	rc.items = append(rc.items, item)
+	return rc.send("conversation.item.created", map[string]any{
+		"previous_item_id": previous,
+		"item":             item,
+	})
+}
+
+// respond generates an assistant reply to the conversation and streams it
+// as response.* events.
+func (rc *realtimeConn) respond(instructions, eventID string) error {
+	s := rc.s
+	var internal []InternalMessage
+	if instructions != "" {
+		internal = append(internal, InternalMessage{Role: "system", Content: instructions})
+	}
+	for _, item := range rc.items {
+		var texts []string
+		for _, part := range item.Content {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		internal = append(internal, InternalMessage{Role: item.Role, Content: strings.Join(texts, "\n")})
+	}
+
+	ctx := RespondContext{
+		Messages:    internal,
+		Model:       rc.session.Model,
+		Endpoint:    EndpointOpenAI,
+		Temperature: rc.session.Temperature,
+		Stream:      true,
+		ToolResults: toolRoleResults(internal),
+		Session:     rc.session.ID,
+	}
+	response, err := s.respond(ctx)
+	if err != nil {
+		return rc.sendError("response_failed", err.Error(), eventID)
+	}
+	if response.IsToolCall() {
+		response = s.forceTextResponse(response, ctx)
+	}
+	s.logAdminRequest(rc.r, internal, response.Text)
+
+	respID := s.newID("resp_")
+	item := realtimeItem{
+		ID:      s.newID("item_"),
+		Object:  "realtime.item",
+		Type:    "message",
+		Status:  "in_progress",
+		Role:    "assistant",
+		Content: []realtimeContentPart{},
+	}
+	resp := map[string]any{
+		"id":     respID,
+		"object": "realtime.response",
+		"status": "in_progress",
+		"output": []realtimeItem{},
+	}
+	part := map[string]any{
+		"response_id":   respID,
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+	}
+	with := func(k string, v any) map[string]any {
+		m := map[string]any{k: v}
+		for pk, pv := range part {
+			m[pk] = pv
+		}
+		return m
+	}
+
+	if err := rc.send("response.created", map[string]any{"response": resp}); err != nil {
+		return err
+	}
+	if err := rc.send("response.output_item.added", map[string]any{"response_id": respID, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+	if err := rc.addItem(item); err != nil {
+		return err
+	}
+	if err := rc.send("response.content_part.added", with("part", realtimeContentPart{Type: "text"})); err != nil {
+		return err
+	}
+	delay := s.getTokenDelay()
+	for i, chunk := range tokenize(response.Text) {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		if err := rc.send("response.text.delta", with("delta", chunk)); err != nil {
+			return err
+		}
+	}
+	if err := rc.send("response.text.done", with("text", response.Text)); err != nil {
+		return err
+	}
+	done := realtimeContentPart{Type: "text", Text: response.Text}
+	if err := rc.send("response.content_part.done", with("part", done)); err != nil {
+		return err
+	}
+
+	item.Status = "completed"
+	item.Content = []realtimeContentPart{done}
+	rc.items[len(rc.items)-1] = item
+	if err := rc.send("response.output_item.done", map[string]any{"response_id": respID, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+
+	inputTokens := 0
+	for _, m := range internal {
+		inputTokens += countTokens(m.Content)
+	}
+	outputTokens := countTokens(response.Text)
+	resp["status"] = "completed"
+	resp["output"] = []realtimeItem{item}
+	resp["usage"] = map[string]any{
+		"total_tokens":  inputTokens + outputTokens,
+		"input_tokens":  inputTokens,
+		"output_tokens": outputTokens,
+	}
+	return rc.send("response.done", map[string]any{"response": resp})
+}
@@ -0,0 +1,193 @@
+package llmock_test
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shishberg/llmock"
+)
+
+// wsClient is a minimal WebSocket client for exercising /v1/realtime.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialRealtime(t *testing.T, ts *httptest.Server) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET /v1/realtime?model=gpt-4o-realtime-preview HTTP/1.1\r\n" +
+		"Host: " + conn.RemoteAddr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	// Example key and accept value from RFC 6455.
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", got)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+// send writes v as a masked text frame.
+func (c *wsClient) send(t *testing.T, v any) {
+	t.Helper()
+	payload, _ := json.Marshal(v)
+	frame := []byte{0x81}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next reads the next server event.
+func (c *wsClient) next(t *testing.T) map[string]any {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatal(err)
+	}
+	var event map[string]any
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("invalid event %q: %v", payload, err)
+	}
+	return event
+}
+
+func TestRealtime_TextTurn(t *testing.T) {
+	s := llmock.New(llmock.WithRealtime(), llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(time.Millisecond))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	c := dialRealtime(t, ts)
+	defer c.conn.Close()
+
+	if ev := c.next(t); ev["type"] != "session.created" {
+		t.Fatalf("expected session.created, got %v", ev)
+	}
+	c.send(t, map[string]any{"type": "session.update", "session": map[string]any{"instructions": "be brief"}})
+	ev := c.next(t)
+	session, _ := ev["session"].(map[string]any)
+	if ev["type"] != "session.updated" || session["instructions"] != "be brief" {
+		t.Fatalf("expected session.updated with instructions, got %v", ev)
+	}
+
+	c.send(t, map[string]any{"type": "conversation.item.create", "item": map[string]any{
+		"type": "message", "role": "user",
+		"content": []map[string]any{{"type": "input_text", "text": "hello realtime world"}},
+	}})
+	if ev := c.next(t); ev["type"] != "conversation.item.created" {
+		t.Fatalf("expected conversation.item.created, got %v", ev)
+	}
+
+	c.send(t, map[string]any{"type": "response.create"})
+	var deltas, text string
+	var types []string
+	for {
+		ev := c.next(t)
+		typ := ev["type"].(string)
+		types = append(types, typ)
+		switch typ {
+		case "response.text.delta":
+			deltas += ev["delta"].(string)
+		case "response.text.done":
+			text = ev["text"].(string)
+		}
+		if typ == "response.done" {
+			resp := ev["response"].(map[string]any)
+			if resp["status"] != "completed" {
+				t.Errorf("expected completed response, got %v", resp["status"])
+			}
+			break
+		}
+	}
+	if deltas != "hello realtime world" || text != deltas {
+		t.Errorf("expected echoed text, got deltas %q and text %q", deltas, text)
+	}
+	if types[0] != "response.created" {
+		t.Errorf("expected response.created first, got %v", types)
+	}
+}
+
+func TestRealtime_UnknownEventAndDisabled(t *testing.T) {
+	s := llmock.New(llmock.WithRealtime())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	c := dialRealtime(t, ts)
+	defer c.conn.Close()
+	c.next(t) // session.created
+
+	c.send(t, map[string]any{"type": "input_audio_buffer.append", "event_id": "evt_1"})
+	ev := c.next(t)
+	errObj, _ := ev["error"].(map[string]any)
+	if ev["type"] != "error" || errObj["event_id"] != "evt_1" {
+		t.Fatalf("expected error event for evt_1, got %v", ev)
+	}
+	// The session stays usable after an error.
+	c.send(t, map[string]any{"type": "session.update", "session": map[string]any{}})
+	if ev := c.next(t); ev["type"] != "session.updated" {
+		t.Errorf("expected session.updated after error, got %v", ev)
+	}
+
+	plain := httptest.NewServer(llmock.New().Handler())
+	defer plain.Close()
+	resp, err := http.Get(plain.URL + "/v1/realtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected realtime to be disabled by default, got %d", resp.StatusCode)
+	}
+}
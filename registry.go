@@ -0,0 +1,104 @@
+package llmock
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ResponderFactory builds a Responder from the options given in a config
+// file's responder section.
+type ResponderFactory func(options map[string]any) (Responder, error)
+
+var (
+	respondersMu sync.RWMutex
+	responders   = map[string]ResponderFactory{
+		"echo":     newEchoResponderFromOptions,
+		"template": newTemplateResponderFromOptions,
+	}
+)
+
+// RegisterResponder makes a custom responder available to config files
+// under name, typically from an init function:
+//
+//	responder:
+//	  name: my-responder
+//	  options: {model_path: ./weights}
+//
+// The factory receives the options map. "echo" (options target and index)
+// and "template" (option template) are registered by default.
+// RegisterResponder panics if name is already registered or factory is nil.
+func RegisterResponder(name string, factory ResponderFactory) {
+	respondersMu.Lock()
+	defer respondersMu.Unlock()
+	if factory == nil {
+		panic("llmock: RegisterResponder factory is nil")
+	}
+	if _, dup := responders[name]; dup {
+		panic("llmock: RegisterResponder called twice for " + name)
+	}
+	responders[name] = factory
+}
+
+// ResponderConfig selects a registered responder by name.
+type ResponderConfig struct {
+	Name    string         `yaml:"name" json:"name"`
+	Options map[string]any `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// newRegisteredResponder builds the responder that rc names.
+func newRegisteredResponder(rc ResponderConfig) (Responder, error) {
+	respondersMu.RLock()
+	factory, ok := responders[rc.Name]
+	var names []string
+	for name := range responders {
+		names = append(names, name)
+	}
+	respondersMu.RUnlock()
+	if !ok {
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown responder %q (registered: %v)", rc.Name, names)
+	}
+	r, err := factory(rc.Options)
+	if err != nil {
+		return nil, fmt.Errorf("responder %q: %w", rc.Name, err)
+	}
+	return r, nil
+}
+
+// newEchoResponderFromOptions builds the registered "echo" responder.
+func newEchoResponderFromOptions(options map[string]any) (Responder, error) {
+	var e EchoResponder
+	if v, ok := options["target"]; ok {
+		target, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("target must be a string, got %T", v)
+		}
+		e.Target = target
+	}
+	switch v := options["index"].(type) {
+	case nil:
+	case int:
+		e.Index = v
+	case float64:
+		e.Index = int(v)
+	default:
+		return nil, fmt.Errorf("index must be an integer, got %T", v)
+	}
+	switch e.Target {
+	case "", EchoLastUser, EchoLast, EchoFirstUser, EchoSystem, EchoIndex:
+	default:
+		return nil, fmt.Errorf("unknown echo target %q", e.Target)
+	}
+	return e, nil
+}
+
+// newTemplateResponderFromOptions builds the registered "template"
+// responder.
+func newTemplateResponderFromOptions(options map[string]any) (Responder, error) {
+	text, ok := options["template"].(string)
+	if !ok {
+		return nil, fmt.Errorf("template option must be a string")
+	}
+	return NewTemplateResponder(text)
+}
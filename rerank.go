@@ -0,0 +1,162 @@
+package llmock
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RerankRequest represents a Cohere- or Jina-style rerank request.
+// Documents may be plain strings or objects with a "text" field.
+type RerankRequest struct {
+	Model           string            `json:"model,omitempty"`
+	Query           string            `json:"query"`
+	Documents       []json.RawMessage `json:"documents"`
+	TopN            *int              `json:"top_n,omitempty"`
+	ReturnDocuments bool              `json:"return_documents,omitempty"`
+}
+
+// RerankResponse represents a rerank response. Results are sorted by
+// descending relevance score.
+type RerankResponse struct {
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   RerankUsage    `json:"usage"`
+}
+
+// RerankResult is the score for one input document.
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+// RerankDocument echoes a document's text when return_documents is set.
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+// RerankUsage reports token usage for a rerank request.
+type RerankUsage struct {
+	TotalTokens int `json:"total_tokens"`
+}
+
+// WithRerank enables the POST /v1/rerank endpoint.
+func WithRerank() Option {
+	return func(s *Server) {
+		s.rerankEnabled = true
+	}
+}
+
+// rerankDocumentText extracts the text of a document given either as a
+// string or as an object with a "text" field.
+func rerankDocumentText(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var obj struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", fmt.Errorf("documents must be strings or objects with a text field")
+	}
+	return obj.Text, nil
+}
+
+// rerankScore returns a deterministic relevance score in [0, 1). Half the
+// score comes from how many query terms appear in the document, so
+// documents mentioning the query rank higher; the other half is a hash of
+// the seed, query, and document, which breaks ties reproducibly.
+func (s *Server) rerankScore(query, doc string) float64 {
+	var seed int64
+	if s.seed != nil {
+		seed = *s.seed
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", seed, query, doc)))
+	noise := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return noise / 2
+	}
+	lowerDoc := strings.ToLower(doc)
+	hits := 0
+	for _, t := range terms {
+		if strings.Contains(lowerDoc, t) {
+			hits++
+		}
+	}
+	return (float64(hits)/float64(len(terms)) + noise) / 2
+}
+
+func (s *Server) handleRerank(w http.ResponseWriter, r *http.Request) {
+	var req RerankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	if len(req.Documents) == 0 {
+		writeError(w, http.StatusBadRequest, "documents is required and must not be empty")
+		return
+	}
+	if req.TopN != nil && *req.TopN < 1 {
+		writeError(w, http.StatusBadRequest, "top_n must be at least 1")
+		return
+	}
+
+	docs := make([]string, len(req.Documents))
+	for i, raw := range req.Documents {
+		text, err := rerankDocumentText(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		docs[i] = text
+	}
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(req.Query); ok {
+		if s.executeFault(w, r, f, faultRequest{}, "openai", false) {
+			return
+		}
+	}
+
+	s.logAdminRequest(r, []InternalMessage{{Role: "user", Content: req.Query}}, "")
+
+	results := make([]RerankResult, len(docs))
+	totalTokens := countTokens(req.Query)
+	for i, doc := range docs {
+		results[i] = RerankResult{Index: i, RelevanceScore: s.rerankScore(req.Query, doc)}
+		if req.ReturnDocuments {
+			results[i].Document = &RerankDocument{Text: doc}
+		}
+		totalTokens += countTokens(doc)
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].RelevanceScore > results[b].RelevanceScore
+	})
+	if req.TopN != nil && *req.TopN < len(results) {
+		results = results[:*req.TopN]
+	}
+
+	model := s.responseModel(cmp.Or(req.Model, "llmock-rerank-1"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RerankResponse{
+		ID:      s.newID("rerank-"),
+		Model:   model,
+		Results: results,
+		Usage:   RerankUsage{TotalTokens: totalTokens},
+	})
+}
@@ -0,0 +1,74 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postRerank(t *testing.T, ts *httptest.Server, body string) llmock.RerankResponse {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/v1/rerank", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result llmock.RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRerank_QueryTermRanksHigher(t *testing.T) {
+	s := llmock.New(llmock.WithRerank(), llmock.WithSeed(1))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"query": "kubernetes",
+		"documents": ["Bananas are yellow.", {"text": "Deploying to Kubernetes with Helm."}, "The sea is blue."],
+		"top_n": 2,
+		"return_documents": true
+	}`
+	result := postRerank(t, ts, body)
+	if len(result.Results) != 2 {
+		t.Fatalf("expected top_n=2 results, got %d", len(result.Results))
+	}
+	top := result.Results[0]
+	if top.Index != 1 {
+		t.Errorf("expected document 1 to rank first, got index %d", top.Index)
+	}
+	if top.Document == nil || !strings.Contains(top.Document.Text, "Kubernetes") {
+		t.Errorf("expected returned document text, got %+v", top.Document)
+	}
+	if result.Results[0].RelevanceScore < result.Results[1].RelevanceScore {
+		t.Error("expected results sorted by descending score")
+	}
+
+	again := postRerank(t, ts, body)
+	if again.Results[1].RelevanceScore != result.Results[1].RelevanceScore {
+		t.Error("expected deterministic scores for the same seed")
+	}
+}
+
+func TestRerank_DisabledByDefault(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/rerank", "application/json", strings.NewReader(`{"query":"x","documents":["y"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Error("expected rerank endpoint to be disabled without WithRerank")
+	}
+}
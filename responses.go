@@ -0,0 +1,428 @@
+package llmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponsesRequest represents an OpenAI Responses API request.
+// Input is either a plain string or an array of input items.
+type ResponsesRequest struct {
+	Model           string             `json:"model"`
+	Input           json.RawMessage    `json:"input"`
+	Instructions    string             `json:"instructions,omitempty"`
+	Stream          bool               `json:"stream,omitempty"`
+	Temperature     *float64           `json:"temperature,omitempty"`
+	MaxOutputTokens *int               `json:"max_output_tokens,omitempty"`
+	Tools           []ResponsesToolDef `json:"tools,omitempty"`
+}
+
+// ResponsesToolDef represents a tool definition in a Responses API request.
+// Unlike Chat Completions, function fields are not nested under "function".
+type ResponsesToolDef struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// ResponsesInputItem represents an item in a Responses API input array.
+// Messages have a Role and Content (a string or array of content parts);
+// function_call and function_call_output items carry tool-use turns.
+type ResponsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    string          `json:"output,omitempty"`
+}
+
+// ResponsesResponse represents an OpenAI Responses API response.
+type ResponsesResponse struct {
+	ID         string                `json:"id"`
+	Object     string                `json:"object"`
+	CreatedAt  int64                 `json:"created_at"`
+	Status     string                `json:"status"`
+	Model      string                `json:"model"`
+	Output     []ResponsesOutputItem `json:"output"`
+	OutputText string                `json:"output_text"`
+	Usage      ResponsesUsage        `json:"usage"`
+
+	// IncompleteDetails says why Status is "incomplete".
+	IncompleteDetails *ResponsesIncompleteDetails `json:"incomplete_details"`
+}
+
+// ResponsesIncompleteDetails gives the reason a response is incomplete.
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// ResponsesOutputItem represents an item in the response output array.
+// For messages: Type="message", Role and Content are set.
+// For tool calls: Type="function_call", CallID/Name/Arguments are set.
+type ResponsesOutputItem struct {
+	Type      string                 `json:"type"`
+	ID        string                 `json:"id"`
+	Status    string                 `json:"status"`
+	Role      string                 `json:"role,omitempty"`
+	Content   []ResponsesContentPart `json:"content,omitempty"`
+	CallID    string                 `json:"call_id,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Arguments string                 `json:"arguments,omitempty"`
+}
+
+// ResponsesContentPart represents a content part of an output message.
+type ResponsesContentPart struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponsesUsage represents token usage in a Responses API response.
+type ResponsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+
+	// InputTokensDetails is set when the response came from the cache
+	// (see WithResponseCache).
+	InputTokensDetails *ResponsesInputTokensDetails `json:"input_tokens_details,omitempty"`
+}
+
+// ResponsesInputTokensDetails breaks down a Responses API input token count.
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// responsesInputItems decodes the input field, wrapping a plain string as a
+// single user message.
+func responsesInputItems(input json.RawMessage) ([]ResponsesInputItem, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(input, &s); err == nil {
+		if s == "" {
+			return nil, nil
+		}
+		content, _ := json.Marshal(s)
+		return []ResponsesInputItem{{Type: "message", Role: "user", Content: content}}, nil
+	}
+	var items []ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array of items: %w", err)
+	}
+	return items, nil
+}
+
+// responsesItemText extracts the text of a message item. Content may be a
+// string or an array of input_text/output_text parts.
+func responsesItemText(item ResponsesInputItem) string {
+	if len(item.Content) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(item.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(item.Content, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func responsesToInternal(items []ResponsesInputItem, instructions string) []InternalMessage {
+	internal := make([]InternalMessage, 0, len(items)+1)
+	if instructions != "" {
+		internal = append(internal, InternalMessage{Role: "system", Content: instructions})
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "function_call_output":
+			internal = append(internal, InternalMessage{Role: "tool", Content: item.Output})
+		case "", "message":
+			text := responsesItemText(item)
+			// Skip assistant messages without text (like tool-call-only turns).
+			if item.Role == "assistant" && text == "" {
+				continue
+			}
+			internal = append(internal, InternalMessage{Role: item.Role, Content: text})
+		}
+	}
+	return internal
+}
+
+// responsesHasToolResults returns true if any input item is a function_call_output.
+func responsesHasToolResults(items []ResponsesInputItem) bool {
+	for _, item := range items {
+		if item.Type == "function_call_output" {
+			return true
+		}
+	}
+	return false
+}
+
+// responsesToRequestTools converts Responses API function tools to the
+// internal RequestTool format. Built-in tools (web_search etc.) are skipped.
+func responsesToRequestTools(tools []ResponsesToolDef) []RequestTool {
+	out := make([]RequestTool, 0, len(tools))
+	for _, t := range tools {
+		if t.Type != "function" || t.Name == "" {
+			continue
+		}
+		out = append(out, RequestTool{Name: t.Name, Parameters: t.Parameters})
+	}
+	return out
+}
+
+func estimateResponsesTokens(messages []InternalMessage) int {
+	total := 0
+	for _, m := range messages {
+		total += countTokens(m.Content)
+		total += 4
+	}
+	return total
+}
+
+func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
+	var req ResponsesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	items, err := responsesInputItems(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, http.StatusBadRequest, "input is required and must not be empty")
+		return
+	}
+
+	internal := responsesToInternal(items, req.Instructions)
+
+	// Evaluate faults before normal processing.
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{model: req.Model, promptTokens: estimateResponsesTokens(internal)}, "openai", req.Stream) {
+			return
+		}
+		w = faultWriter(w, f, "openai", req.Stream)
+	}
+
+	reqTools := responsesToRequestTools(req.Tools)
+	ctx := RespondContext{
+		Messages:    internal,
+		Model:       req.Model,
+		Endpoint:    EndpointOpenAI,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxOutputTokens,
+		Tools:       reqTools,
+		Stream:      req.Stream,
+		ToolResults: toolRoleResults(internal),
+		Session:     r.Header.Get(sessionHeader),
+	}
+	response, cached, err := s.cachedRespond(r, req, func() (Response, error) {
+		return s.respondWithTools(ctx, responsesHasToolResults(items))
+	})
+	if err != nil {
+		writeError(w, s.responderErrorStatus(err), err.Error())
+		return
+	}
+
+	// Drop tool calls for tools the request didn't define.
+	if response.IsToolCall() && len(reqTools) > 0 {
+		toolNames := make(map[string]bool)
+		for _, t := range reqTools {
+			toolNames[t.Name] = true
+		}
+		var validCalls []ToolCall
+		for _, tc := range response.ToolCalls {
+			if toolNames[tc.Name] {
+				validCalls = append(validCalls, tc)
+			}
+		}
+		response.ToolCalls = validCalls
+	}
+
+	s.logAdminRequest(r, internal, response.Text)
+	response.ToolCalls = s.withToolCallIDs(response.ToolCalls)
+
+	model := s.responseModel(req.Model)
+
+	resp := ResponsesResponse{
+		ID:        s.newID("resp_"),
+		Object:    "response",
+		CreatedAt: s.now().Unix(),
+		Status:    "completed",
+		Model:     model,
+	}
+	setResponseID(w, r, resp.ID)
+	inputTokens := estimateResponsesTokens(internal)
+	outputTokens := 5 // rough estimate for tool call tokens
+
+	if response.IsToolCall() {
+		for _, tc := range response.ToolCalls {
+			argsJSON, _ := json.Marshal(tc.Arguments)
+			resp.Output = append(resp.Output, ResponsesOutputItem{
+				Type:      "function_call",
+				ID:        s.newID("fc_"),
+				Status:    "completed",
+				CallID:    tc.ID,
+				Name:      tc.Name,
+				Arguments: string(argsJSON),
+			})
+		}
+	} else {
+		text, truncated := truncateToTokens(response.Text, req.MaxOutputTokens)
+		itemStatus := "completed"
+		if truncated {
+			itemStatus = "incomplete"
+			resp.Status = "incomplete"
+			resp.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+		}
+		// A rule's finish reason overrides truncation.
+		switch response.FinishReason {
+		case "stop", "tool_calls":
+			itemStatus = "completed"
+			resp.Status = "completed"
+			resp.IncompleteDetails = nil
+		case "length":
+			itemStatus = "incomplete"
+			resp.Status = "incomplete"
+			resp.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+		case "content_filter":
+			itemStatus = "incomplete"
+			resp.Status = "incomplete"
+			resp.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "content_filter"}
+		}
+		outputTokens = countTokens(text)
+		resp.OutputText = text
+		resp.Output = []ResponsesOutputItem{{
+			Type:    "message",
+			ID:      s.newID("msg_"),
+			Status:  itemStatus,
+			Role:    "assistant",
+			Content: []ResponsesContentPart{{Type: "output_text", Text: text, Annotations: s.responsesAnnotations(text)}},
+		}}
+	}
+	resp.Usage = ResponsesUsage{
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		TotalTokens:  inputTokens + outputTokens,
+	}
+	if cached {
+		resp.Usage.InputTokensDetails = &ResponsesInputTokensDetails{CachedTokens: inputTokens}
+	}
+
+	if req.Stream {
+		s.streamResponses(w, r, resp)
+		return
+	}
+	if !s.waitForOutput(r, outputTokens) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// streamResponses writes a completed response as Responses API SSE events:
+// response.created, then per output item the added/delta/done events, and
+// finally response.completed (or response.incomplete, if the output was cut
+// short by max_output_tokens) carrying the full response.
+func (s *Server) streamResponses(w http.ResponseWriter, r *http.Request, resp ResponsesResponse) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	seq := 0
+	emit := func(event string, data map[string]any) {
+		data["type"] = event
+		data["sequence_number"] = seq
+		seq++
+		writeSSE(w, event, data)
+		flusher.Flush()
+	}
+
+	inProgress := resp
+	inProgress.Status = "in_progress"
+	inProgress.Output = []ResponsesOutputItem{}
+	inProgress.OutputText = ""
+	inProgress.Usage = ResponsesUsage{}
+	inProgress.IncompleteDetails = nil
+	emit("response.created", map[string]any{"response": inProgress})
+
+	for i, item := range resp.Output {
+		added := item
+		added.Status = "in_progress"
+		if item.Type == "function_call" {
+			added.Arguments = ""
+			emit("response.output_item.added", map[string]any{"output_index": i, "item": added})
+			chunks := splitString(item.Arguments, toolArgChunkSize)
+			for j, chunk := range chunks {
+				emit("response.function_call_arguments.delta", map[string]any{
+					"item_id": item.ID, "output_index": i, "delta": chunk,
+				})
+				if j < len(chunks)-1 && !s.waitForToken(w, r) {
+					return
+				}
+			}
+			emit("response.function_call_arguments.done", map[string]any{
+				"item_id": item.ID, "output_index": i, "arguments": item.Arguments,
+			})
+		} else {
+			added.Content = []ResponsesContentPart{}
+			emit("response.output_item.added", map[string]any{"output_index": i, "item": added})
+			for k, part := range item.Content {
+				emptyPart := ResponsesContentPart{Type: part.Type, Text: "", Annotations: []any{}}
+				emit("response.content_part.added", map[string]any{
+					"item_id": item.ID, "output_index": i, "content_index": k, "part": emptyPart,
+				})
+				chunks := tokenize(part.Text)
+				for j, chunk := range chunks {
+					emit("response.output_text.delta", map[string]any{
+						"item_id": item.ID, "output_index": i, "content_index": k, "delta": chunk,
+					})
+					if j < len(chunks)-1 && !s.waitForToken(w, r) {
+						return
+					}
+				}
+				emit("response.output_text.done", map[string]any{
+					"item_id": item.ID, "output_index": i, "content_index": k, "text": part.Text,
+				})
+				emit("response.content_part.done", map[string]any{
+					"item_id": item.ID, "output_index": i, "content_index": k, "part": part,
+				})
+			}
+		}
+		emit("response.output_item.done", map[string]any{"output_index": i, "item": item})
+	}
+
+	if resp.Status == "incomplete" {
+		emit("response.incomplete", map[string]any{"response": resp})
+		return
+	}
+	emit("response.completed", map[string]any{"response": resp})
+}
@@ -0,0 +1,224 @@
+package llmock_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func postResponses(t *testing.T, ts *httptest.Server, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/v1/responses", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestResponses_StringInput(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := postResponses(t, ts, `{"model": "gpt-4.1", "input": "Hello, Responses!"}`)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var result llmock.ResponsesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(result.ID, "resp_") {
+		t.Errorf("expected id prefix 'resp_', got %q", result.ID)
+	}
+	if result.Object != "response" || result.Status != "completed" {
+		t.Errorf("expected completed response object, got %q/%q", result.Object, result.Status)
+	}
+	if result.Model != "gpt-4.1" {
+		t.Errorf("expected model 'gpt-4.1', got %q", result.Model)
+	}
+	if result.OutputText != "Hello, Responses!" {
+		t.Errorf("expected output_text 'Hello, Responses!', got %q", result.OutputText)
+	}
+	if len(result.Output) != 1 || result.Output[0].Type != "message" {
+		t.Fatalf("expected 1 message output item, got %+v", result.Output)
+	}
+	item := result.Output[0]
+	if item.Role != "assistant" || len(item.Content) != 1 || item.Content[0].Type != "output_text" {
+		t.Fatalf("unexpected message item: %+v", item)
+	}
+	if item.Content[0].Text != "Hello, Responses!" {
+		t.Errorf("expected content text 'Hello, Responses!', got %q", item.Content[0].Text)
+	}
+	if result.Usage.TotalTokens != result.Usage.InputTokens+result.Usage.OutputTokens {
+		t.Errorf("total_tokens mismatch: %+v", result.Usage)
+	}
+}
+
+func TestResponses_ItemArrayInput(t *testing.T) {
+	s := llmock.New(llmock.WithRules(
+		llmock.Rule{Pattern: regexp.MustCompile(`weather in (\w+)`), Responses: []string{"It's sunny in $1."}},
+	))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"instructions": "You are terse.",
+		"input": [
+			{"role": "user", "content": "Hi"},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Hello!"}]},
+			{"role": "user", "content": [{"type": "input_text", "text": "What's the weather in Paris?"}]}
+		]
+	}`
+	resp := postResponses(t, ts, body)
+	defer resp.Body.Close()
+
+	var result llmock.ResponsesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.OutputText != "It's sunny in Paris." {
+		t.Errorf("expected rule response, got %q", result.OutputText)
+	}
+	if result.Model != "llmock-1" {
+		t.Errorf("expected default model 'llmock-1', got %q", result.Model)
+	}
+}
+
+func TestResponses_ToolCall(t *testing.T) {
+	s := llmock.New(llmock.WithRules(llmock.Rule{
+		Pattern:  regexp.MustCompile(`weather in (\w+)`),
+		ToolCall: &llmock.ToolCallConfig{Name: "get_weather", Arguments: map[string]any{"location": "$1"}},
+	}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{
+		"input": "What's the weather in Paris?",
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}]
+	}`
+	resp := postResponses(t, ts, body)
+	defer resp.Body.Close()
+
+	var result llmock.ResponsesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Output) != 1 || result.Output[0].Type != "function_call" {
+		t.Fatalf("expected 1 function_call item, got %+v", result.Output)
+	}
+	fc := result.Output[0]
+	if fc.Name != "get_weather" || !strings.HasPrefix(fc.CallID, "call_") {
+		t.Errorf("unexpected function_call item: %+v", fc)
+	}
+	if fc.Arguments != `{"location":"Paris"}` {
+		t.Errorf("expected arguments JSON, got %q", fc.Arguments)
+	}
+
+	// Sending the function output back yields a text response, not another call.
+	body = `{
+		"input": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"type": "function_call", "call_id": "` + fc.CallID + `", "name": "get_weather", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "` + fc.CallID + `", "output": "Sunny"}
+		],
+		"tools": [{"type": "function", "name": "get_weather"}]
+	}`
+	resp2 := postResponses(t, ts, body)
+	defer resp2.Body.Close()
+
+	var result2 llmock.ResponsesResponse
+	if err := json.NewDecoder(resp2.Body).Decode(&result2); err != nil {
+		t.Fatal(err)
+	}
+	if len(result2.Output) != 1 || result2.Output[0].Type != "message" || result2.OutputText == "" {
+		t.Errorf("expected text message after function_call_output, got %+v", result2.Output)
+	}
+}
+
+func TestResponses_Stream(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := postResponses(t, ts, `{"input": "Hello streaming world", "stream": true}`)
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	var events []string
+	var deltas strings.Builder
+	var completed struct {
+		Response llmock.ResponsesResponse `json:"response"`
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+			events = append(events, event)
+			continue
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := []byte(strings.TrimPrefix(line, "data: "))
+		switch event {
+		case "response.output_text.delta":
+			var d struct {
+				Delta string `json:"delta"`
+			}
+			if err := json.Unmarshal(data, &d); err != nil {
+				t.Fatal(err)
+			}
+			deltas.WriteString(d.Delta)
+		case "response.completed":
+			if err := json.Unmarshal(data, &completed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if len(events) == 0 || events[0] != "response.created" || events[len(events)-1] != "response.completed" {
+		t.Fatalf("unexpected event sequence: %v", events)
+	}
+	if deltas.String() != "Hello streaming world" {
+		t.Errorf("expected deltas to reconstruct text, got %q", deltas.String())
+	}
+	if completed.Response.OutputText != "Hello streaming world" || completed.Response.Status != "completed" {
+		t.Errorf("unexpected completed response: %+v", completed.Response)
+	}
+}
+
+func TestResponses_MaxOutputTokens(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp := postResponses(t, ts, `{"model": "gpt-4.1", "max_output_tokens": 3, "input": "one two three four five six seven"}`)
+	defer resp.Body.Close()
+
+	var result llmock.ResponsesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "incomplete" || result.IncompleteDetails == nil || result.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("expected incomplete response for max_output_tokens, got %q %+v", result.Status, result.IncompleteDetails)
+	}
+	if result.OutputText != "one two three" || result.Usage.OutputTokens > 3 {
+		t.Errorf("expected truncated output within the cap, got %q (%d tokens)", result.OutputText, result.Usage.OutputTokens)
+	}
+}
@@ -1,10 +1,13 @@
 package llmock
 
 import (
+	"cmp"
 	"fmt"
+	"hash/fnv"
 	"math/rand/v2"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,20 +23,209 @@ import (
 // MaxCalls limits how many times this rule's tool call fires. After that
 // many invocations, the rule falls through to its text Responses instead
 // (or is skipped if it has no text responses). Nil means unlimited.
+//
+// Model, if set, must also match the request's model name for the rule to
+// apply. Nil matches any model. User works the same way for the request's
+// user (the OpenAI "user" field); requests without a user match as "".
+//
+// Priority orders rules: higher priorities are tried first, and rules of
+// equal priority keep their list order. The default is 0.
+//
+// Markov, if set, replaces Responses: the rule answers with up to
+// MarkovLength words (default 100) generated from its own chain.
+//
+// FinishReason, if set, overrides the stop reason of the rule's text
+// responses: "stop", "length", "content_filter", or "tool_calls". A rule
+// with a FinishReason needs no Responses; it then answers with empty text.
+//
+// Blocks, if set, replaces Responses: each template is expanded into one
+// part of the reply. Anthropic returns the parts as separate text content
+// blocks; other APIs return them joined.
+//
+// Preamble, if set, is a template expanded and put before the rule's text
+// response, such as visible reasoning followed by a delimiter. It is part
+// of the ordinary content, so it streams first on every API. With Blocks
+// it becomes a block of its own.
+//
+// ToolCallText, if set on a rule with both a ToolCall and text, answers
+// with the text and the tool call in the same assistant turn instead of
+// the tool call alone. The finish reason stays that of the tool call.
+//
+// Media, if set, adds a binary content block, such as an image, after the
+// rule's text in non-streaming replies. A rule with Media needs no text.
+//
+// Mode, if ModeShuffle, answers with the Responses in an order shuffled
+// once per session and then cycled, so a session sees every response
+// before any repeats. The order is seeded by the session and WithSeed. By
+// default a response is picked per request (see pickResponse).
+//
+// CaseInsensitive, if set, records whether the rule's pattern was meant to
+// ignore case, and keeps WithCaseInsensitive from changing it. Nil follows
+// the server-wide setting.
 type Rule struct {
-	Pattern   *regexp.Regexp
-	Responses []string
-	ToolCall  *ToolCallConfig
-	MaxCalls  *int
+	Pattern      *regexp.Regexp
+	Responses    []string
+	ToolCall     *ToolCallConfig
+	MaxCalls     *int
+	Model        *regexp.Regexp
+	User         *regexp.Regexp
+	Priority     int
+	Markov       *MarkovChain
+	MarkovLength int
+	FinishReason string
+	Blocks       []string
+	Preamble     string
+	ToolCallText bool
+	Media        *MediaConfig
+	Mode         string
+
+	CaseInsensitive *bool
+
+	markovConfig *RuleMarkovConfig // where Markov came from, for export
+	builtin      bool              // one of DefaultRules
+	shuffle      *responseShuffle  // per-session orders for ModeShuffle
+}
+
+// ModeShuffle is the Rule.Mode that cycles through the responses in a
+// per-session shuffled order.
+const ModeShuffle = "shuffle"
+
+// hasText reports whether the rule can answer with text.
+func (r Rule) hasText() bool {
+	return len(r.Responses) > 0 || r.Markov != nil || len(r.Blocks) > 0 || r.Media != nil
+}
+
+// text returns the rule's text response for a match: Markov output from
+// its own chain, or one of its templates expanded.
+func (r Rule) text(matches []string, input string, ctx RespondContext, markov *MarkovResponder) string {
+	if r.Markov == nil && len(r.Responses) == 0 {
+		return ""
+	}
+	if r.Markov == nil {
+		var template string
+		switch {
+		case r.shuffle != nil && ctx.dryRun:
+			template = r.Responses[r.shuffle.peek(ctx.Session, len(r.Responses), ctx.seed)]
+		case r.shuffle != nil:
+			template = r.Responses[r.shuffle.next(ctx.Session, len(r.Responses), ctx.seed)]
+		default:
+			template = pickResponse(r.Responses, ctx.Temperature, ctx.rng)
+		}
+		return expandTemplate(template, matches, input, ctx.Messages, markov, ctx.Temperature)
+	}
+	n := r.MarkovLength
+	if n <= 0 {
+		n = 100
+	}
+	if markov == nil {
+		markov = &MarkovResponder{rng: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+	}
+	return markov.generateFrom(r.Markov, n, ctx.Temperature)
+}
+
+// textResponse wraps the rule's text for a match in a Response.
+func (r Rule) textResponse(matches []string, input string, ctx RespondContext, markov *MarkovResponder) Response {
+	history, temperature := ctx.Messages, ctx.Temperature
+	var preamble string
+	if r.Preamble != "" {
+		preamble = expandTemplate(r.Preamble, matches, input, history, markov, temperature)
+	}
+	if len(r.Blocks) > 0 {
+		var blocks []string
+		if preamble != "" {
+			blocks = append(blocks, preamble)
+		}
+		for _, b := range r.Blocks {
+			blocks = append(blocks, expandTemplate(b, matches, input, history, markov, temperature))
+		}
+		return Response{Text: strings.Join(blocks, ""), Blocks: blocks, FinishReason: r.FinishReason, Media: r.Media}
+	}
+	return Response{Text: preamble + r.text(matches, input, ctx, markov), FinishReason: r.FinishReason, Media: r.Media}
+}
+
+// finishReasons are the values Rule.FinishReason accepts.
+var finishReasons = []string{"stop", "length", "content_filter", "tool_calls"}
+
+// RuleWarnings reports rules that can never answer because an earlier rule,
+// in priority order, matches every input first. Only catch-all patterns
+// such as ".*" are recognized, so no warnings doesn't prove that every rule
+// is reachable.
+func RuleWarnings(rules []Rule) []string {
+	sorted := sortRules(rules)
+	for i, r := range sorted {
+		if !r.catchAll() {
+			continue
+		}
+		var warnings []string
+		for _, later := range sorted[i+1:] {
+			warnings = append(warnings, fmt.Sprintf("rule %q is unreachable: rule %q before it matches every input",
+				later.Pattern.String(), r.Pattern.String()))
+		}
+		return warnings
+	}
+	return nil
+}
+
+// catchAllFlags matches a leading inline flag group such as "(?i)".
+var catchAllFlags = regexp.MustCompile(`^\(\?[a-zA-Z]+\)`)
+
+// catchAll reports whether the rule answers every request: its pattern
+// matches any input, it has no model or user condition, and it can't run
+// out of MaxCalls without text to fall back on.
+func (r Rule) catchAll() bool {
+	if r.Model != nil || r.User != nil {
+		return false
+	}
+	if r.ToolCall != nil && r.MaxCalls != nil && !r.hasText() {
+		return false
+	}
+	pattern := r.Pattern.String()
+	flags := catchAllFlags.FindString(pattern)
+	pattern = strings.TrimPrefix(pattern, flags)
+	switch pattern {
+	case "", ".*", "^.*", "(.*)", "^(.*)":
+		return true
+	case ".*$", "^.*$", "(.*)$", "^(.*)$":
+		// "." stops at a newline, so "$" is only reached with (?s), or
+		// with (?m), where it also matches at the end of a line.
+		return strings.ContainsAny(flags, "sm")
+	}
+	return false
+}
+
+// sortRules returns a copy of rules ordered by descending priority,
+// preserving the existing order of rules with equal priority. Shuffle-mode
+// rules that have no session state yet are given it.
+func sortRules(rules []Rule) []Rule {
+	sorted := slices.Clone(rules)
+	for i := range sorted {
+		if sorted[i].Mode == ModeShuffle && sorted[i].shuffle == nil {
+			sorted[i].shuffle = &responseShuffle{orders: make(map[string]*shuffleOrder)}
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b Rule) int { return cmp.Compare(b.Priority, a.Priority) })
+	return sorted
+}
+
+// matchesModel reports whether the rule applies to the given model.
+func (r Rule) matchesModel(model string) bool {
+	return r.Model == nil || r.Model.MatchString(model)
+}
+
+// matchesUser reports whether the rule applies to the given user.
+func (r Rule) matchesUser(user string) bool {
+	return r.User == nil || r.User.MatchString(user)
 }
 
 // RuleResponder matches messages against an ordered list of rules.
-// The first matching rule wins. If no rule matches, the Markov fallback
-// responder is used.
+// The first matching rule wins. If no rule matches, the no-match responder
+// is used, or else the Markov fallback.
 type RuleResponder struct {
 	rules      []Rule
 	markov     *MarkovResponder
-	mu         sync.Mutex
+	noMatch    Responder
+	chained    bool        // return ErrNoMatch when nothing matches
+	mu         sync.Mutex  // guards callCounts
 	callCounts map[int]int // rule index → number of tool call invocations
 }
 
@@ -43,18 +235,52 @@ func NewRuleResponder(rules []Rule) *RuleResponder {
 	if len(rules) == 0 {
 		rules = DefaultRules()
 	}
-	return &RuleResponder{rules: rules, callCounts: make(map[int]int)}
+	return &RuleResponder{rules: sortRules(rules), callCounts: make(map[int]int)}
 }
 
 // Respond finds the first rule matching the last user message and expands
-// its response template with capture groups.
+// its response template with capture groups. Rules with a Model pattern are
+// matched against an empty model name.
 func (r *RuleResponder) Respond(messages []InternalMessage) (Response, error) {
-	input := extractInput(messages)
-	if input == "" {
+	return r.RespondWithContext(RespondContext{Messages: messages})
+}
+
+// RespondWithContext is like Respond, but also skips rules whose Model or
+// User pattern doesn't match the request, and varies its output with the
+// request temperature (see pickResponse).
+func (r *RuleResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	if extractInput(ctx.Messages) == "" {
 		return Response{}, errNoMessages
 	}
 
-	for i, rule := range r.rules {
+	r.mu.Lock()
+	resp, idx := findRuleResponse(r.rules, r.callCounts, ctx, r.markov)
+	r.mu.Unlock()
+	if idx >= 0 {
+		return resp, nil
+	}
+
+	if r.chained {
+		return Response{}, ErrNoMatch
+	}
+	if r.noMatch != nil {
+		return respondWith(r.noMatch, ctx)
+	}
+	if r.markov != nil {
+		return r.markov.RespondWithContext(ctx)
+	}
+	return Response{Text: "That's an interesting point. Could you tell me more?"}, nil
+}
+
+// findRuleResponse returns the response from the first rule that matches
+// the request, and that rule's index, or -1 if no rule matched. callCounts
+// tracks MaxCalls usage per rule index; the caller must guard it.
+func findRuleResponse(rules []Rule, callCounts map[int]int, ctx RespondContext, markov *MarkovResponder) (Response, int) {
+	input := extractInput(ctx.Messages)
+	for i, rule := range rules {
+		if !rule.matchesModel(ctx.Model) || !rule.matchesUser(ctx.User) {
+			continue
+		}
 		matches := rule.Pattern.FindStringSubmatch(input)
 		if matches == nil {
 			continue
@@ -62,40 +288,133 @@ func (r *RuleResponder) Respond(messages []InternalMessage) (Response, error) {
 		// If this rule specifies a tool call, return a tool call response.
 		if rule.ToolCall != nil {
 			if rule.MaxCalls != nil {
-				r.mu.Lock()
-				count := r.callCounts[i]
-				if count >= *rule.MaxCalls {
-					r.mu.Unlock()
+				if callCounts[i] >= *rule.MaxCalls {
 					// Exhausted: fall through to text responses if available.
-					if len(rule.Responses) > 0 {
-						template := rule.Responses[rand.IntN(len(rule.Responses))]
-						return Response{Text: expandTemplate(template, matches, input, r.markov)}, nil
+					if rule.hasText() {
+						return rule.textResponse(matches, input, ctx, markov), i
 					}
 					continue
 				}
-				r.callCounts[i]++
-				r.mu.Unlock()
+				callCounts[i]++
 			}
 			tc := resolveToolCall(*rule.ToolCall, matches, input)
-			return Response{ToolCalls: []ToolCall{tc}}, nil
+			if rule.ToolCallText && rule.hasText() {
+				resp := rule.textResponse(matches, input, ctx, markov)
+				resp.ToolCalls = []ToolCall{tc}
+				resp.FinishReason = ""
+				return resp, i
+			}
+			return Response{ToolCalls: []ToolCall{tc}}, i
 		}
-		template := rule.Responses[rand.IntN(len(rule.Responses))]
-		return Response{Text: expandTemplate(template, matches, input, r.markov)}, nil
+		return rule.textResponse(matches, input, ctx, markov), i
 	}
+	return Response{}, -1
+}
 
-	if r.markov != nil {
-		return r.markov.Respond(messages)
+// pickResponse chooses one of a rule's response templates. At temperature
+// 0 the first template is always used, so repeated requests are stable. As
+// temperature rises towards 1 a random template is chosen more often, and
+// from 1 upwards (or when temperature is unset) the choice is uniform.
+// Choices are drawn from rng, or from the global source if it is nil.
+func pickResponse(responses []string, temperature *float64, rng *rand.Rand) string {
+	roll, index := rand.Float64, rand.IntN
+	if rng != nil {
+		roll, index = rng.Float64, rng.IntN
+	}
+	if temperature != nil && *temperature < 1 && roll() >= *temperature {
+		return responses[0]
+	}
+	return responses[index(len(responses))]
+}
+
+// responseShuffle holds a shuffle-mode rule's response order for each
+// session.
+type responseShuffle struct {
+	mu     sync.Mutex
+	orders map[string]*shuffleOrder
+}
+
+// maxShuffleSessions bounds how many sessions' orders a rule keeps. Past
+// it, an arbitrary session's order is dropped and reshuffled on its next
+// use.
+const maxShuffleSessions = 1000
+
+// shuffleOrder is one session's order and its position in it.
+type shuffleOrder struct {
+	perm []int
+	next int
+}
+
+// next returns the index of the session's next response out of n. The
+// session's order is shuffled on first use, from seed if it is set.
+func (rs *responseShuffle) next(session string, n int, seed *int64) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	o := rs.orders[session]
+	if o == nil || len(o.perm) != n {
+		if o == nil && len(rs.orders) >= maxShuffleSessions {
+			for k := range rs.orders {
+				delete(rs.orders, k)
+				break
+			}
+		}
+		o = &shuffleOrder{perm: shufflePerm(session, n, seed)}
+		rs.orders[session] = o
+	}
+	i := o.perm[o.next]
+	o.next = (o.next + 1) % n
+	return i
+}
+
+// peek is like next, but leaves the session's position where it is and
+// doesn't record a new order. Without a seed, a session with no order yet
+// gets a preview that its first request won't necessarily repeat.
+func (rs *responseShuffle) peek(session string, n int, seed *int64) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if o := rs.orders[session]; o != nil && len(o.perm) == n {
+		return o.perm[o.next]
+	}
+	return shufflePerm(session, n, seed)[0]
+}
+
+// reset forgets every session's order.
+func (rs *responseShuffle) reset() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	clear(rs.orders)
+}
+
+// shufflePerm returns a session's shuffled order of n responses, seeded by
+// the session and seed, or randomly if seed is nil.
+func shufflePerm(session string, n int, seed *int64) []int {
+	h := fnv.New64a()
+	h.Write([]byte(session))
+	base := rand.Uint64()
+	if seed != nil {
+		base = uint64(*seed)
+	}
+	return rand.New(rand.NewPCG(base, h.Sum64())).Perm(n)
+}
+
+// resetShuffles forgets the session orders of rules' shuffle-mode rules.
+func resetShuffles(rules []Rule) {
+	for _, r := range rules {
+		if r.shuffle != nil {
+			r.shuffle.reset()
+		}
 	}
-	return Response{Text: "That's an interesting point. Could you tell me more?"}, nil
 }
 
 // expandTemplate replaces $1, $2, ... with capture group values,
-// ${input} with the full original message, and {{markov}} or {{markov:N}}
-// with Markov-generated text.
-func expandTemplate(template string, matches []string, input string, markov *MarkovResponder) string {
+// ${input} with the full original message, ${name:...} transforms (see
+// templateTransforms) with their results, and {{markov}} or {{markov:N}}
+// with Markov-generated text at the given temperature. history is the
+// conversation, for ${turn:N}.
+func expandTemplate(template string, matches []string, input string, history []InternalMessage, markov *MarkovResponder, temperature *float64) string {
 	// Handle {{markov}} and {{markov:N}} placeholders first.
 	if markov != nil && strings.Contains(template, "{{markov") {
-		template = expandMarkovPlaceholders(template, markov)
+		template = expandMarkovPlaceholders(template, markov, temperature)
 	}
 
 	result := make([]byte, 0, len(template)*2)
@@ -112,6 +431,12 @@ func expandTemplate(template string, matches []string, input string, markov *Mar
 			i += len("${input}")
 			continue
 		}
+		// Check for a ${name:...} transform. Malformed ones are left as-is.
+		if t, n, ok, err := parseTransform(template[i:]); ok && err == nil {
+			result = append(result, t.apply(matches, input, history)...)
+			i += n
+			continue
+		}
 		// Check for $N capture group reference (only substitute if within bounds)
 		if i+1 < len(template) && template[i+1] >= '1' && template[i+1] <= '9' {
 			idx := int(template[i+1] - '0')
@@ -128,12 +453,12 @@ func expandTemplate(template string, matches []string, input string, markov *Mar
 }
 
 // expandMarkovPlaceholders replaces {{markov}} and {{markov:N}} in the template.
-func expandMarkovPlaceholders(template string, markov *MarkovResponder) string {
+func expandMarkovPlaceholders(template string, markov *MarkovResponder, temperature *float64) string {
 	var result strings.Builder
 	i := 0
 	for i < len(template) {
 		if i+len("{{markov}}") <= len(template) && template[i:i+len("{{markov}}")] == "{{markov}}" {
-			result.WriteString(markov.GenerateMarkov(100))
+			result.WriteString(markov.generate(100, temperature))
 			i += len("{{markov}}")
 			continue
 		}
@@ -142,7 +467,7 @@ func expandMarkovPlaceholders(template string, markov *MarkovResponder) string {
 			if end != -1 {
 				numStr := template[i+len("{{markov:") : i+end]
 				if n, err := strconv.Atoi(numStr); err == nil && n > 0 {
-					result.WriteString(markov.GenerateMarkov(n))
+					result.WriteString(markov.generate(n, temperature))
 					i += end + 2
 					continue
 				}
@@ -161,6 +486,29 @@ func WithRules(rules ...Rule) Option {
 	}
 }
 
+// WithCaseInsensitive makes rule patterns ignore case without "(?i)" in
+// each one. It applies to the startup rules and to rules added later
+// through the admin API or control plane, except rules whose
+// CaseInsensitive is set.
+func WithCaseInsensitive(enabled bool) Option {
+	return func(s *Server) {
+		s.caseInsensitive = enabled
+	}
+}
+
+// ignoreCase returns a copy of rules in which each pattern that doesn't
+// already ignore case is recompiled to, skipping rules whose
+// CaseInsensitive is set.
+func ignoreCase(rules []Rule) []Rule {
+	out := slices.Clone(rules)
+	for i, r := range out {
+		if r.CaseInsensitive == nil && !strings.HasPrefix(r.Pattern.String(), "(?i)") {
+			out[i].Pattern = regexp.MustCompile("(?i)" + r.Pattern.String())
+		}
+	}
+	return out
+}
+
 // WithResponder configures the server to use the given Responder.
 func WithResponder(r Responder) Option {
 	return func(s *Server) {
@@ -168,17 +516,9 @@ func WithResponder(r Responder) Option {
 	}
 }
 
-// ruleConfig is the YAML representation of a rule (used by LoadRulesFile).
-type ruleConfig struct {
-	Pattern   string          `yaml:"pattern"`
-	Responses []string        `yaml:"responses"`
-	ToolCall  *ToolCallConfig `yaml:"tool_call,omitempty"`
-	MaxCalls  *int            `yaml:"max_calls,omitempty"`
-}
-
-// rulesFileConfig is the top-level YAML structure.
+// rulesFileConfig is the top-level YAML structure of a rules file.
 type rulesFileConfig struct {
-	Rules []ruleConfig `yaml:"rules"`
+	Rules []RuleConfig `yaml:"rules"`
 }
 
 // LoadRulesFile reads a YAML file and returns compiled Rules.
@@ -196,24 +536,13 @@ func ParseRulesYAML(data []byte) ([]Rule, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("parsing rules YAML: %w", err)
 	}
-	rules := make([]Rule, len(cfg.Rules))
-	for i, rc := range cfg.Rules {
-		re, err := regexp.Compile(rc.Pattern)
-		if err != nil {
-			return nil, fmt.Errorf("compiling rule %d pattern %q: %w", i, rc.Pattern, err)
-		}
-		if len(rc.Responses) == 0 && rc.ToolCall == nil {
-			return nil, fmt.Errorf("rule %d pattern %q has no responses or tool_call", i, rc.Pattern)
-		}
-		rules[i] = Rule{Pattern: re, Responses: rc.Responses, ToolCall: rc.ToolCall, MaxCalls: rc.MaxCalls}
-	}
-	return rules, nil
+	return CompileRules(cfg.Rules)
 }
 
 // DefaultRules returns a set of built-in rules that produce helpful
 // AI-assistant-like responses.
 func DefaultRules() []Rule {
-	return []Rule{
+	rules := []Rule{
 		{
 			Pattern: regexp.MustCompile(`(?i)^(?:hi|hello|hey|greetings|good (?:morning|afternoon|evening))[\s!.,]*$`),
 			Responses: []string{
@@ -287,4 +616,19 @@ func DefaultRules() []Rule {
 			},
 		},
 	}
+	for i := range rules {
+		rules[i].builtin = true
+	}
+	return rules
+}
+
+// onlyBuiltin reports whether rules is non-empty and made up of
+// DefaultRules alone.
+func onlyBuiltin(rules []Rule) bool {
+	for _, r := range rules {
+		if !r.builtin {
+			return false
+		}
+	}
+	return len(rules) > 0
 }
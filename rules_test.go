@@ -2,10 +2,12 @@ package llmock_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -69,6 +71,81 @@ func TestRules_MatchPriority(t *testing.T) {
 	}
 }
 
+func TestRules_TemplateTransforms(t *testing.T) {
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: `remind me on (.*) to (.*)`, Responses: []string{
+			`Reminder set for ${upper:$1}: ${replace:$2:/\s+/ /}. Order ${match:#(\d{3,})}.`,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+
+	got := chatRequest(t, ts, "remind me on tuesday to buy    milk   for #12345").Choices[0].Message.Content
+	want := "Reminder set for TUESDAY: buy milk for #12345. Order 12345."
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRules_TurnReferencesEarlierMessage(t *testing.T) {
+	ts := newTestServerWithRules(t, llmock.Rule{
+		Pattern:   regexp.MustCompile(`(?i)what did i say`),
+		Responses: []string{"Earlier you said: ${turn:-3}. First: ${turn:0}. Missing: [${turn:-9}]"},
+	})
+	defer ts.Close()
+
+	var resp llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[
+		{"role":"system","content":"be helpful"},
+		{"role":"user","content":"my name is Ada"},
+		{"role":"assistant","content":"Nice to meet you."},
+		{"role":"user","content":"I like tea"},
+		{"role":"assistant","content":"Noted."},
+		{"role":"user","content":"what did I say?"}]}`, &resp)
+	want := "Earlier you said: my name is Ada. First: my name is Ada. Missing: []"
+	if got := resp.Choices[0].Message.Content; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRules_MalformedTransformRejected(t *testing.T) {
+	for _, resp := range []string{
+		`${replace:$1:/[unclosed/x/}`,
+		`${replace:$1:/a/b}`,
+		`${match:(\d+}`,
+		`${upper:$0}`,
+		`${turn:last}`,
+	} {
+		if _, err := llmock.CompileRules([]llmock.RuleConfig{{Pattern: ".*", Responses: []string{resp}}}); err == nil {
+			t.Errorf("expected CompileRules error for %q", resp)
+		}
+	}
+}
+
+func TestRules_PriorityOrdering(t *testing.T) {
+	rules := []llmock.Rule{
+		{Pattern: regexp.MustCompile(`.*`), Responses: []string{"catchall"}, Priority: -1},
+		{Pattern: regexp.MustCompile(`hello`), Responses: []string{"first"}},
+		{Pattern: regexp.MustCompile(`hello`), Responses: []string{"second"}},
+		{Pattern: regexp.MustCompile(`hello world`), Responses: []string{"urgent"}, Priority: 1},
+	}
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+
+	if got := chatRequest(t, ts, "hello world").Choices[0].Message.Content; got != "urgent" {
+		t.Errorf("expected highest priority rule, got %q", got)
+	}
+	if got := chatRequest(t, ts, "hello").Choices[0].Message.Content; got != "first" {
+		t.Errorf("expected list order among equal priorities, got %q", got)
+	}
+	if got := chatRequest(t, ts, "bye").Choices[0].Message.Content; got != "catchall" {
+		t.Errorf("expected low-priority catchall, got %q", got)
+	}
+}
+
 func TestRules_CaptureGroupSubstitution(t *testing.T) {
 	rules := []llmock.Rule{
 		{
@@ -302,3 +379,448 @@ func TestExpandTemplate_DollarSignWithoutCapture(t *testing.T) {
 		t.Errorf("expected 'Cost: $5 for item', got %q", result.Choices[0].Message.Content)
 	}
 }
+
+func TestExpandTemplate_DoubleDollarKept(t *testing.T) {
+	// $$ is only an escape in config files; templates keep it.
+	ts := newTestServerWithRules(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`price`), Responses: []string{"US$$ and A$$ differ"}},
+	)
+	defer ts.Close()
+
+	if got := chatRequest(t, ts, "price").Choices[0].Message.Content; got != "US$$ and A$$ differ" {
+		t.Errorf("expected $$ to be kept, got %q", got)
+	}
+}
+
+func TestRules_ModelRouting(t *testing.T) {
+	ts := newTestServerWithRules(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Model: regexp.MustCompile(`^gpt-4$`), Responses: []string{"answer A"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Model: regexp.MustCompile(`^(gpt-3\.5|claude-.*|gemini-.*)`), Responses: []string{"answer B"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"any model"}},
+	)
+	defer ts.Close()
+
+	post := func(path, body string) string {
+		t.Helper()
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var raw map[string]any
+		json.NewDecoder(resp.Body).Decode(&raw)
+		b, _ := json.Marshal(raw)
+		return string(b)
+	}
+	openAI := func(model string) string {
+		return post("/v1/chat/completions", `{"model":"`+model+`","messages":[{"role":"user","content":"hi there"}]}`)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"openai gpt-4", openAI("gpt-4"), "answer A"},
+		{"openai gpt-3.5", openAI("gpt-3.5-turbo"), "answer B"},
+		{"openai other", openAI("o1"), "any model"},
+		{"anthropic", post("/v1/messages", `{"model":"claude-3-haiku","max_tokens":10,"messages":[{"role":"user","content":"hi there"}]}`), "answer B"},
+		{"gemini", post("/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"hi there"}]}]}`), "answer B"},
+	}
+	for _, tt := range tests {
+		if !strings.Contains(tt.got, tt.want) {
+			t.Errorf("%s: expected %q in response, got %s", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestRules_UserRouting(t *testing.T) {
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: "delete", User: "^blocked$", Responses: []string{"I can't help with that."}},
+		{Pattern: "delete", Responses: []string{"Deleted."}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+
+	ask := func(user string) string {
+		t.Helper()
+		var resp llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions",
+			`{"model":"gpt-4","user":"`+user+`","messages":[{"role":"user","content":"delete my files"}]}`, &resp)
+		return resp.Choices[0].Message.Content
+	}
+	if got := ask("blocked"); got != "I can't help with that." {
+		t.Errorf("blocked user: got %q", got)
+	}
+	if got := ask("alice"); got != "Deleted." {
+		t.Errorf("other user: got %q", got)
+	}
+}
+
+func TestRules_FinishReasonOverride(t *testing.T) {
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: "forbidden", FinishReason: "content_filter"},
+		{Pattern: "long", Responses: []string{"and so on"}, FinishReason: "length"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+
+	openAI := func(input string) (string, string) {
+		var resp llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"`+input+`"}]}`, &resp)
+		return resp.Choices[0].FinishReason, resp.Choices[0].Message.Content
+	}
+	anthropic := func(input string) (string, string) {
+		var resp llmock.AnthropicResponse
+		postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"`+input+`"}]}`, &resp)
+		return resp.StopReason, resp.Content[0].Text
+	}
+	gemini := func(input string) (string, string) {
+		var resp llmock.GeminiResponse
+		postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"`+input+`"}]}]}`, &resp)
+		return resp.Candidates[0].FinishReason, resp.Candidates[0].Content.Parts[0].Text
+	}
+	geminiStream := func(input string) (string, string) {
+		resp, err := http.Post(ts.URL+"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse", "application/json",
+			strings.NewReader(`{"contents":[{"role":"user","parts":[{"text":"`+input+`"}]}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var reason, text string
+		var usage bool
+		for _, data := range readSSEData(t, resp) {
+			var chunk llmock.GeminiResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range chunk.Candidates {
+				for _, p := range c.Content.Parts {
+					text += p.Text
+				}
+				if c.FinishReason != "" {
+					reason = c.FinishReason
+				}
+			}
+			usage = usage || chunk.UsageMetadata.PromptTokenCount > 0
+		}
+		if !usage {
+			t.Errorf("gemini stream %q: no usageMetadata", input)
+		}
+		return reason, text
+	}
+	responses := func(input string) (string, string) {
+		var resp llmock.ResponsesResponse
+		postJSON(t, ts, "/v1/responses", `{"model":"gpt-4o","input":"`+input+`"}`, &resp)
+		reason := resp.Status
+		if resp.IncompleteDetails != nil {
+			reason = resp.IncompleteDetails.Reason
+		}
+		return reason, resp.OutputText
+	}
+
+	tests := []struct {
+		name     string
+		call     func(string) (string, string)
+		input    string
+		want     string
+		wantText string
+	}{
+		{"openai content_filter", openAI, "forbidden topic", "content_filter", ""},
+		{"openai length", openAI, "long story", "length", "and so on"},
+		{"anthropic content_filter", anthropic, "forbidden topic", "refusal", ""},
+		{"anthropic length", anthropic, "long story", "max_tokens", "and so on"},
+		{"gemini content_filter", gemini, "forbidden topic", "SAFETY", ""},
+		{"gemini length", gemini, "long story", "MAX_TOKENS", "and so on"},
+		{"gemini stream content_filter", geminiStream, "forbidden topic", "SAFETY", ""},
+		{"gemini stream length", geminiStream, "long story", "MAX_TOKENS", "and so on"},
+		{"responses content_filter", responses, "forbidden topic", "content_filter", ""},
+		{"responses length", responses, "long story", "max_output_tokens", "and so on"},
+	}
+	for _, tt := range tests {
+		got, text := tt.call(tt.input)
+		if got != tt.want || text != tt.wantText {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.name, got, text, tt.want, tt.wantText)
+		}
+	}
+
+	if _, err := llmock.CompileRules([]llmock.RuleConfig{{Pattern: "x", FinishReason: "bogus"}}); err == nil {
+		t.Error("expected an error for an unknown finish_reason")
+	}
+}
+
+func TestRules_FinishReasonAfterSetRules(t *testing.T) {
+	s := llmock.New()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{{Pattern: "forbidden", FinishReason: "content_filter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	choice := chatRequest(t, ts, "forbidden topic").Choices[0]
+	if choice.FinishReason != "content_filter" || choice.Message.Content != "" {
+		t.Errorf("got (%q, %q), want content_filter with no text", choice.FinishReason, choice.Message.Content)
+	}
+}
+
+func TestCompileRules_ModelPattern(t *testing.T) {
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: "hi", Model: "^gpt-4", Responses: []string{"ok"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Model == nil || !rules[0].Model.MatchString("gpt-4o") {
+		t.Error("expected compiled model pattern")
+	}
+
+	_, err = llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: "hi", Model: "(", Responses: []string{"ok"}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid model regex")
+	}
+}
+
+func TestRules_TemperatureControlsVariation(t *testing.T) {
+	ts := newTestServerWithRules(t,
+		llmock.Rule{Pattern: regexp.MustCompile(`^pick$`), Responses: []string{"one", "two", "three", "four", "five"}},
+		llmock.Rule{Pattern: regexp.MustCompile(`^never$`), Responses: []string{"unused"}},
+	)
+	defer ts.Close()
+
+	collect := func(content string, temperature float64) map[string]bool {
+		t.Helper()
+		seen := make(map[string]bool)
+		for range 10 {
+			body := fmt.Sprintf(`{"model":"test","temperature":%v,"messages":[{"role":"user","content":%s}]}`,
+				temperature, jsonString(content))
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result llmock.ChatCompletionResponse
+			json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+			seen[result.Choices[0].Message.Content] = true
+		}
+		return seen
+	}
+
+	// Multi-response rule.
+	if seen := collect("pick", 0); len(seen) != 1 || !seen["one"] {
+		t.Errorf("temperature 0: expected only the first response, got %v", seen)
+	}
+	if seen := collect("pick", 1.0); len(seen) < 2 {
+		t.Errorf("temperature 1.0: expected varied responses, got %v", seen)
+	}
+
+	// Markov fallback (no rule matches).
+	if seen := collect("something unmatched", 0); len(seen) != 1 {
+		t.Errorf("temperature 0: expected identical Markov output, got %d variants", len(seen))
+	}
+	if seen := collect("something unmatched", 1.0); len(seen) < 2 {
+		t.Errorf("temperature 1.0: expected varied Markov output, got %v", seen)
+	}
+}
+
+func TestRules_TemperatureChoiceReproducibleUnderSeed(t *testing.T) {
+	picks := func() []string {
+		t.Helper()
+		s := llmock.New(
+			llmock.WithSeed(42),
+			llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^pick$`), Responses: []string{"one", "two", "three", "four", "five"}}),
+		)
+		ts := httptest.NewServer(s.Handler())
+		defer ts.Close()
+		var out []string
+		for range 20 {
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+				strings.NewReader(`{"model":"test","temperature":0.5,"messages":[{"role":"user","content":"pick"}]}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result llmock.ChatCompletionResponse
+			json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+			out = append(out, result.Choices[0].Message.Content)
+		}
+		return out
+	}
+
+	first, second := picks(), picks()
+	if !slices.Equal(first, second) {
+		t.Errorf("same seed picked differently:\n%v\n%v", first, second)
+	}
+	if slices.Equal(first, slices.Repeat([]string{"one"}, len(first))) {
+		t.Errorf("temperature 0.5 never varied: %v", first)
+	}
+}
+
+func TestRules_ShuffleModePerSession(t *testing.T) {
+	responses := []string{"one", "two", "three", "four", "five"}
+	s := llmock.New(
+		llmock.WithSeed(7),
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`^pick$`), Responses: responses, Mode: llmock.ModeShuffle}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	pick := func(session string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/chat/completions",
+			strings.NewReader(`{"model":"test","messages":[{"role":"user","content":"pick"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Session-Id", session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result llmock.ChatCompletionResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result.Choices[0].Message.Content
+	}
+	order := func(session string) []string {
+		t.Helper()
+		var got []string
+		for range responses {
+			got = append(got, pick(session))
+		}
+		return got
+	}
+
+	first := order("a")
+	if !slices.Equal(slices.Sorted(slices.Values(first)), slices.Sorted(slices.Values(responses))) {
+		t.Fatalf("session a: expected every response once before repeats, got %v", first)
+	}
+	if again := order("a"); !slices.Equal(again, first) {
+		t.Errorf("session a: expected the order to cycle, got %v then %v", first, again)
+	}
+	differs := false
+	for _, session := range []string{"b", "c", "d"} {
+		differs = differs || !slices.Equal(order(session), first)
+	}
+	if !differs {
+		t.Errorf("expected other sessions to get other orders than %v", first)
+	}
+
+	if _, err := llmock.CompileRules([]llmock.RuleConfig{{Pattern: "x", Responses: []string{"y"}, Mode: "random"}}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestRules_MarkovCorpusPerRule(t *testing.T) {
+	rules, err := llmock.CompileRules([]llmock.RuleConfig{
+		{Pattern: `legal`, Markov: &llmock.RuleMarkovConfig{Corpus: "lorem", Length: 30}},
+		{Pattern: `casual`, Markov: &llmock.RuleMarkovConfig{Corpus: "technical", Length: 30}},
+	})
+	if err != nil {
+		t.Fatalf("CompileRules: %v", err)
+	}
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+
+	vocab := func(input string) map[string]bool {
+		t.Helper()
+		seen := map[string]bool{}
+		for range 5 {
+			for _, w := range strings.Fields(chatRequest(t, ts, input).Choices[0].Message.Content) {
+				seen[strings.ToLower(strings.Trim(w, ".,;:!?"))] = true
+			}
+		}
+		return seen
+	}
+	legal, casual := vocab("legal question"), vocab("casual chat")
+	if len(legal) == 0 || len(casual) == 0 {
+		t.Fatal("expected Markov text from both rules")
+	}
+	for w := range legal {
+		if casual[w] {
+			t.Errorf("word %q generated by both rules", w)
+		}
+	}
+
+	if _, err := llmock.CompileRules([]llmock.RuleConfig{{Pattern: `x`, Markov: &llmock.RuleMarkovConfig{}}}); err == nil {
+		t.Error("expected an error for a markov block without a corpus")
+	}
+}
+
+func TestRuleWarnings_ShadowedByCatchAll(t *testing.T) {
+	rules := []llmock.Rule{
+		{Pattern: regexp.MustCompile(`(?i)^hello`), Responses: []string{"hi"}},
+		{Pattern: regexp.MustCompile(`.*`), Responses: []string{"fallback"}},
+		{Pattern: regexp.MustCompile(`weather`), Responses: []string{"sunny"}},
+		{Pattern: regexp.MustCompile(`refund`), Responses: []string{"5-7 days"}, Priority: 10},
+	}
+	warnings := llmock.RuleWarnings(rules)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"weather"`) {
+		t.Errorf("warnings = %q, want one for the weather rule", warnings)
+	}
+
+	// A catch-all limited to one model doesn't shadow anything.
+	rules[1].Model = regexp.MustCompile(`^gpt-4$`)
+	if warnings := llmock.RuleWarnings(rules); len(warnings) != 0 {
+		t.Errorf("warnings with model-limited catch-all = %q, want none", warnings)
+	}
+	rules[1].Model = nil
+
+	ts := newTestServerWithRules(t, rules...)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/_mock/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var cfg struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], `"weather"`) {
+		t.Errorf("/_mock/config warnings = %q, want one for the weather rule", cfg.Warnings)
+	}
+}
+
+func TestWithCaseInsensitive(t *testing.T) {
+	off := false
+	s := llmock.New(
+		llmock.WithCaseInsensitive(true),
+		llmock.WithRules(
+			llmock.Rule{Pattern: regexp.MustCompile(`^hello`), Responses: []string{"hi"}},
+			llmock.Rule{Pattern: regexp.MustCompile(`^exact`), Responses: []string{"sensitive"}, CaseInsensitive: &off},
+			llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"fallback"}},
+		),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	if got := chatRequest(t, ts, "HELLO there").Choices[0].Message.Content; got != "hi" {
+		t.Errorf("uppercase input got %q, want hi", got)
+	}
+	if got := chatRequest(t, ts, "EXACT").Choices[0].Message.Content; got != "fallback" {
+		t.Errorf("rule with case_insensitive false matched %q", got)
+	}
+
+	// Rules injected through the admin API ignore case too.
+	resp, err := http.Post(ts.URL+"/_mock/rules", "application/json",
+		strings.NewReader(`{"rules":[{"pattern":"refund","responses":["5-7 days"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := chatRequest(t, ts, "REFUND please").Choices[0].Message.Content; got != "5-7 days" {
+		t.Errorf("injected rule got %q, want 5-7 days", got)
+	}
+}
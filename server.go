@@ -1,6 +1,8 @@
 package llmock
 
 import (
+	"cmp"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -10,9 +12,12 @@ import (
 	mrand "math/rand/v2"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 var errNoMessages = errors.New("no messages provided")
@@ -32,12 +37,113 @@ type Responder interface {
 	Respond(messages []InternalMessage) (Response, error)
 }
 
-// EchoResponder echoes the last user message (or last message if no user message).
-type EchoResponder struct{}
+// RespondContext carries the conversation together with request
+// parameters, for responders that want to vary their output by model,
+// temperature, and so on. Optional parameters are nil when the request
+// didn't set them.
+type RespondContext struct {
+	Messages    []InternalMessage
+	Model       string
+	User        string // the end-user ID sent by the client, if any
+	Endpoint    string // the API family: EndpointOpenAI, EndpointAnthropic, or EndpointGemini
+	Temperature *float64
+	MaxTokens   *int
+	Tools       []RequestTool
+	Stream      bool
+
+	// FrequencyPenalty, PresencePenalty and LogitBias carry the OpenAI
+	// parameters of the same names. The Markov responder uses them to
+	// discourage repeated words and to forbid biased-out words.
+	FrequencyPenalty *float64
+	PresencePenalty  *float64
+	LogitBias        map[string]float64
+
+	// ToolResults holds the text of the tool results in the conversation.
+	// The Markov responder favours their words, so a reply after a tool
+	// call reads as if it used the tool's output.
+	ToolResults []string
+
+	// Session identifies the client's session: the X-Session-Id header,
+	// a thread ID, or a Realtime session ID. Shuffle-mode rules keep a
+	// response order per session.
+	Session string
+
+	seed   *int64      // the server's WithSeed, for shuffle-mode rules
+	rng    *mrand.Rand // the server's RNG under WithSeed, for picking among responses
+	dryRun bool        // for /_mock/match: peek at shuffle orders, don't advance them
+}
+
+// sessionHeader is the request header that names a client session.
+const sessionHeader = "X-Session-Id"
+
+// ContextResponder is an optional extension of Responder. When the server's
+// responder implements it, RespondWithContext is called instead of Respond.
+type ContextResponder interface {
+	Responder
+	RespondWithContext(ctx RespondContext) (Response, error)
+}
+
+// respondWith calls r with the request context if it is a ContextResponder,
+// or with just the messages otherwise.
+func respondWith(r Responder, ctx RespondContext) (Response, error) {
+	if cr, ok := r.(ContextResponder); ok {
+		return cr.RespondWithContext(ctx)
+	}
+	return r.Respond(ctx.Messages)
+}
+
+// Echo targets for EchoResponder.
+const (
+	EchoLastUser  = "last_user"  // the last user message, or the last message if none (the default)
+	EchoLast      = "last"       // the last message, whatever its role
+	EchoFirstUser = "first_user" // the first user message
+	EchoSystem    = "system"     // the first system message
+	EchoIndex     = "index"      // the message at Index
+)
 
-// Respond returns the last user message content, or the last message if there is no user message.
+// EchoResponder echoes one of the request's messages back, chosen by
+// Target.
+type EchoResponder struct {
+	// Target selects the message to echo. The zero value is EchoLastUser.
+	Target string
+	// Index is the message echoed when Target is EchoIndex. Negative
+	// values count back from the end, so -1 is the last message.
+	Index int
+}
+
+// Respond returns the content of the message selected by Target.
 func (e EchoResponder) Respond(messages []InternalMessage) (Response, error) {
-	input := extractInput(messages)
+	if len(messages) == 0 {
+		return Response{}, errNoMessages
+	}
+	var input string
+	switch e.Target {
+	case "", EchoLastUser:
+		input = extractInput(messages)
+	case EchoLast:
+		input = messages[len(messages)-1].Content
+	case EchoFirstUser, EchoSystem:
+		role := "user"
+		if e.Target == EchoSystem {
+			role = "system"
+		}
+		i := slices.IndexFunc(messages, func(m InternalMessage) bool { return m.Role == role })
+		if i < 0 {
+			return Response{}, fmt.Errorf("no %s message to echo", role)
+		}
+		input = messages[i].Content
+	case EchoIndex:
+		i := e.Index
+		if i < 0 {
+			i += len(messages)
+		}
+		if i < 0 || i >= len(messages) {
+			return Response{}, fmt.Errorf("echo index %d out of range for %d messages", e.Index, len(messages))
+		}
+		input = messages[i].Content
+	default:
+		return Response{}, fmt.Errorf("unknown echo target %q", e.Target)
+	}
 	if input == "" {
 		return Response{}, errNoMessages
 	}
@@ -46,26 +152,77 @@ func (e EchoResponder) Respond(messages []InternalMessage) (Response, error) {
 
 // Server is a mock LLM API server.
 type Server struct {
-	mux           *http.ServeMux
-	responder     Responder
-	tokenDelay    time.Duration
-	adminEnabled  *bool
-	admin         *adminState
-	faults        *faultState
-	initialFaults []Fault
-	seed          *int64
-	corpusText    string
-	corpusFile    string
-	markov        *MarkovResponder
-	autoToolCalls bool
-	rng           *mrand.Rand
-	mcpEnabled    bool
-	mcpConfig     MCPConfig
-	mcp           *mcpState
-	control       *controlPlane
-	verbose       bool
-	logger        *log.Logger
-	reqMeta       sync.Map // *http.Request → *verboseMeta
+	mux                    *http.ServeMux
+	responder              Responder
+	tokenDelay             atomic.Int64 // time.Duration; changed live by the control plane
+	latencyPerToken        time.Duration
+	latencyProfile         *latencyProfile
+	warmup                 *warmupState
+	sleep                  func(ctx context.Context, d time.Duration) bool // see withSleep
+	streamKeepAlive        time.Duration
+	streamByteRate         int
+	streamRunningUsage     bool
+	streamConsistencyCheck bool
+	responseCache          *responseCache
+	caseInsensitive        bool
+	adminEnabled           *bool
+	admin                  *adminState
+	faults                 *faultState
+	initialFaults          []Fault
+	faultSelection         string
+	seed                   *int64
+	corpusText             string
+	corpusFile             string
+	corpusName             string // built-in corpus that corpusText came from
+	markov                 *MarkovResponder
+	markovMinWords         int
+	noMatch                NoMatchConfig
+	strictMatching         bool
+	strictStatus           int
+	autoToolCalls          bool
+	citations              bool
+	imagePlaceholder       []byte
+	transcription          string
+	rerankEnabled          bool
+	realtimeEnabled        bool
+	batches                *batchState
+	batchDelay             time.Duration
+	assistantsEnabled      bool
+	assistants             *assistantsState
+	geminiStreamToolChunks bool
+	geminiSafetyRatings    []GeminiSafetyRating
+	rng                    *mrand.Rand
+	mcpEnabled             bool
+	mcpConfig              MCPConfig
+	mcp                    *mcpState
+	mcpEvents              *mcpEventHub
+	mcpPageSize            int
+	mcpAdvertiseAll        bool
+	mcpStrictVersion       bool
+	mcpToolsAsLLMTools     bool
+	control                *controlPlane
+	verbose                atomic.Bool // changed live by /_mock/verbose
+	logFormat              string
+	mutationRate           float64
+	mutator                *outputMutator
+	echoHeaders            []string
+	rateLimit              *rateLimiter
+	inFlight               chan struct{} // semaphore for WithMaxConcurrency
+	maxRequestBytes        int64
+	coldStart              time.Duration
+	endpointResponder      *endpointRuleResponder
+	endpointRules          map[string][]Rule // WithEndpointRules, by endpoint
+	fingerprint            string            // system_fingerprint for OpenAI chat
+	started                time.Time         // for WithColdStart
+	apiKeyQuota            int
+	usage                  *usageState
+	logger                 *log.Logger
+	clock                  func() time.Time
+	idGenerator            func() string
+	forceModel             string
+	modelSuffix            string
+	reqMeta                sync.Map // *http.Request → *verboseMeta
+	basePath               string   // prefix all routes are mounted under; see WithBasePath
 }
 
 // New creates a new Server with the given options.
@@ -76,26 +233,62 @@ func New(opts ...Option) *Server {
 	}
 	// Build the Markov responder.
 	s.markov = NewMarkovResponder(s.seed)
+	s.markov.minWords = s.markovMinWords
 	if s.corpusFile != "" {
 		data, err := os.ReadFile(s.corpusFile)
 		if err == nil {
-			mc := NewMarkovChain(2)
-			mc.Train(string(data))
-			s.markov.chain = mc
+			s.markov.setCorpus(string(data), "file:"+s.corpusFile)
 		}
 	} else if s.corpusText != "" {
-		mc := NewMarkovChain(2)
-		mc.Train(s.corpusText)
-		s.markov.chain = mc
+		source := "custom"
+		if s.corpusName != "" {
+			source = "builtin:" + s.corpusName
+		}
+		s.markov.setCorpus(s.corpusText, source)
 	}
 
 	if s.responder == nil {
 		s.responder = NewRuleResponder(nil)
 	}
 
-	// If the responder is a RuleResponder, set its markov fallback.
+	// Apply WithCaseInsensitive to the startup rules. Rules added later
+	// get it from the admin state.
+	if s.caseInsensitive {
+		rrs := []Responder{s.responder}
+		if cr, ok := s.responder.(*ChainResponder); ok {
+			rrs = cr.responders
+		}
+		for _, r := range rrs {
+			if rr, ok := r.(*RuleResponder); ok {
+				rr.rules = ignoreCase(rr.rules)
+			}
+		}
+		for endpoint, rules := range s.endpointRules {
+			s.endpointRules[endpoint] = ignoreCase(rules)
+		}
+	}
+
+	// Wire server state into the built-in responders, including chain
+	// stages: Markov and no-match fallbacks for rules, the clock for
+	// templates.
 	if rr, ok := s.responder.(*RuleResponder); ok {
 		rr.markov = s.markov
+		rr.noMatch = s.noMatchResponder()
+	}
+	if cr, ok := s.responder.(*ChainResponder); ok {
+		for _, r := range cr.responders {
+			if rr, ok := r.(*RuleResponder); ok {
+				rr.markov = s.markov
+				rr.chained = true
+			}
+			if tr, ok := r.(*TemplateResponder); ok {
+				tr.clock = s.now
+			}
+		}
+		cr.fallback = s.noMatchResponder()
+	}
+	if tr, ok := s.responder.(*TemplateResponder); ok {
+		tr.clock = s.now
 	}
 
 	// Initialize RNG and fault state.
@@ -107,6 +300,15 @@ func New(opts ...Option) *Server {
 	}
 	s.rng = rng
 	s.faults = newFaultState(s.initialFaults, rng)
+	s.faults.selection = s.faultSelection
+	s.mutator = newOutputMutator(s.mutationRate, s.seed)
+	s.started = s.now()
+	s.fingerprint = systemFingerprint(s.seed)
+	s.usage = newUsageState(s.apiKeyQuota)
+	s.batches = newBatchState()
+	if s.assistantsEnabled {
+		s.assistants = newAssistantsState()
+	}
 
 	// Admin API is enabled by default.
 	adminOn := s.adminEnabled == nil || *s.adminEnabled
@@ -117,38 +319,124 @@ func New(opts ...Option) *Server {
 			rules = rr.rules
 		}
 		s.admin = newAdminState(rules, s.markov)
+		s.admin.caseInsensitive = s.caseInsensitive
+		s.admin.seed = s.seed
+		s.admin.usage = s.usage
+		s.admin.assistants = s.assistants
 		// Wrap the responder: admin rules are tried first, then fallback
 		// to the original responder.
-		s.responder = &adminResponder{state: s.admin, fallback: s.responder}
+		s.responder = &adminResponder{state: s.admin, fallback: s.responder, initial: s.responder}
 	}
 
 	// Initialize MCP if enabled.
 	if s.mcpEnabled {
 		s.mcp = newMCPState(s.mcpConfig)
+		s.mcpEvents = newMCPEventHub()
+		s.mcp.addSubscriber(s.mcpEvents.sub)
 	}
 
 	s.mux = http.NewServeMux()
 	s.mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
 	s.mux.HandleFunc("POST /v1/messages", s.handleMessages)
+	s.mux.HandleFunc("POST /v1/responses", s.handleResponses)
+	s.mux.HandleFunc("POST /v1/images/generations", s.handleImageGenerations)
+	s.mux.HandleFunc("POST /v1/audio/transcriptions", s.handleAudioTranscriptions)
 	s.mux.HandleFunc("POST /v1beta/models/", s.handleGeminiRoute)
+	s.mux.HandleFunc("POST /v1/files", s.handleFileUpload)
+	s.mux.HandleFunc("GET /v1/files/{id}", s.handleFileGet)
+	s.mux.HandleFunc("GET /v1/files/{id}/content", s.handleFileContent)
+	s.mux.HandleFunc("POST /v1/batches", s.handleBatchCreate)
+	s.mux.HandleFunc("GET /v1/batches/{id}", s.handleBatchGet)
+
+	// Other methods on the POST-only endpoints get a 405 in the provider's
+	// error format rather than the mux's plain-text one.
+	for _, path := range postOnlyPaths {
+		s.mux.HandleFunc(path, handleMethodNotAllowed)
+	}
+
+	if s.rerankEnabled {
+		s.mux.HandleFunc("POST /v1/rerank", s.handleRerank)
+	}
+
+	if s.assistantsEnabled {
+		s.mux.HandleFunc("POST /v1/assistants", s.handleCreateAssistant)
+		s.mux.HandleFunc("GET /v1/assistants/{id}", s.handleGetAssistant)
+		s.mux.HandleFunc("POST /v1/threads", s.handleCreateThread)
+		s.mux.HandleFunc("GET /v1/threads/{id}", s.handleGetThread)
+		s.mux.HandleFunc("POST /v1/threads/{id}/messages", s.handleCreateThreadMessage)
+		s.mux.HandleFunc("GET /v1/threads/{id}/messages", s.handleListThreadMessages)
+		s.mux.HandleFunc("POST /v1/threads/{id}/runs", s.handleCreateRun)
+		s.mux.HandleFunc("GET /v1/threads/{id}/runs/{run_id}", s.handleGetRun)
+	}
+
+	if s.realtimeEnabled {
+		s.mux.HandleFunc("GET /v1/realtime", s.handleRealtime)
+	}
 
 	if s.mcpEnabled {
 		s.mux.HandleFunc("POST /mcp", s.handleMCP)
+		s.mux.HandleFunc("GET /mcp", s.handleMCPEvents)
 	}
 
 	if adminOn {
 		registerAdminRoutes(s.mux, s.admin)
 		registerFaultRoutes(s.mux, s.faults)
+		registerUsageRoutes(s.mux, s.usage)
+		s.mux.HandleFunc("GET /_mock/config", s.handleMockConfig)
+		s.mux.HandleFunc("GET /_mock/export", s.handleExport)
+		s.mux.HandleFunc("POST /_mock/import", s.handleImport)
+		s.mux.HandleFunc("GET /_mock/verbose", s.handleGetVerbose)
+		s.mux.HandleFunc("POST /_mock/verbose", s.handleSetVerbose)
 		if s.mcpEnabled {
 			registerMCPAdminRoutes(s.mux, s.mcp)
 		}
-		s.control = &controlPlane{admin: s.admin, faults: s.faults}
+		s.control = &controlPlane{admin: s.admin, faults: s.faults, srv: s}
 		s.mux.HandleFunc("POST /mcp/control", s.control.handleControl)
 	}
 
 	return s
 }
 
+// SetRules atomically replaces the server's rules, for example when
+// reloading a config file. The new rules also become the baseline that
+// DELETE /_mock/rules and /_mock/reset restore. If rules is empty, the
+// built-in default rules are used. Requires the admin API to be enabled.
+func (s *Server) SetRules(rules []Rule) error {
+	if s.admin == nil {
+		return errors.New("SetRules requires the admin API to be enabled")
+	}
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	s.admin.replaceRules(rules)
+	if ar, ok := s.responder.(*adminResponder); ok {
+		ar.dropRuleFallback(s.noMatchResponder())
+	}
+	return nil
+}
+
+// SetMCPConfig atomically replaces the MCP tools, resources, and prompts.
+// The new configuration also becomes the baseline for resets. Returns an
+// error if MCP was not enabled when the server was created.
+func (s *Server) SetMCPConfig(cfg MCPConfig) error {
+	if s.mcp == nil {
+		return errors.New("SetMCPConfig requires MCP to be enabled")
+	}
+	s.mcp.replace(cfg)
+	return nil
+}
+
+// SetFaults atomically replaces the active faults, for example when
+// reloading a config file. Count-limited faults start with their full
+// count. Returns an error, changing nothing, if a fault is invalid.
+func (s *Server) SetFaults(faults []Fault) error {
+	if err := validateFaults(faults); err != nil {
+		return err
+	}
+	s.faults.replace(faults)
+	return nil
+}
+
 // WithAdminAPI enables or disables the /_mock/ admin endpoints.
 // The admin API is enabled by default.
 func WithAdminAPI(enabled bool) Option {
@@ -166,12 +454,22 @@ func WithAutoToolCalls(enabled bool) Option {
 	}
 }
 
+// WithMCPToolsAsLLMTools offers the MCP server's tools (see WithMCP) to
+// auto-generated tool calls on the LLM endpoints when a request defines no
+// tools of its own, so an agent test can go from a mock model's tool call
+// straight to the mock MCP server. Auto tool calls must also be enabled.
+func WithMCPToolsAsLLMTools(enabled bool) Option {
+	return func(s *Server) {
+		s.mcpToolsAsLLMTools = enabled
+	}
+}
+
 // WithVerbose enables verbose request logging. When enabled, each request
 // is logged with method, path, extracted user message, matched rule pattern,
 // HTTP status, and response time.
 func WithVerbose(enabled bool) Option {
 	return func(s *Server) {
-		s.verbose = enabled
+		s.verbose.Store(enabled)
 	}
 }
 
@@ -183,46 +481,154 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
+// WithClock sets the function used for response timestamps, such as
+// "created". Freezing it makes response bodies reproducible. WithBatchDelay
+// follows it too, but other delays and rate limiting still use real time.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.clock = now
+	}
+}
+
+// WithIDGenerator sets the function that makes the unique part of response,
+// message, and tool call ids. Each id keeps its usual prefix, such as
+// "msg_" or "chatcmpl-mock-". By default the unique part is random hex.
+func WithIDGenerator(gen func() string) Option {
+	return func(s *Server) {
+		s.idGenerator = gen
+	}
+}
+
+// WithForceModel makes every response report model as its model,
+// whatever the request asked for, for testing how clients handle a model
+// mismatch.
+func WithForceModel(model string) Option {
+	return func(s *Server) {
+		s.forceModel = model
+	}
+}
+
+// WithModelSuffix appends suffix to the model reported in responses,
+// mimicking dated model ids: with "-0613", a request for "gpt-4" is
+// answered by "gpt-4-0613". It has no effect with WithForceModel.
+func WithModelSuffix(suffix string) Option {
+	return func(s *Server) {
+		s.modelSuffix = suffix
+	}
+}
+
+// responseModel returns the model a response reports for a request that
+// asked for requested, which defaults to "llmock-1".
+func (s *Server) responseModel(requested string) string {
+	if s.forceModel != "" {
+		return s.forceModel
+	}
+	return cmp.Or(requested, "llmock-1") + s.modelSuffix
+}
+
+// defaultEchoHeaders are the request headers echoed onto responses unless
+// WithEchoHeaders says otherwise.
+var defaultEchoHeaders = []string{"X-Request-Id"}
+
+// WithEchoHeaders sets the request headers (such as X-Request-Id and
+// traceparent) that are copied onto every response, replacing the default
+// of X-Request-Id alone. If X-Request-Id is in the set and the request has
+// none, one is generated. Call with no arguments to echo nothing.
+func WithEchoHeaders(headers ...string) Option {
+	return func(s *Server) {
+		s.echoHeaders = append([]string{}, headers...)
+	}
+}
+
+// echoHeadersHandler wraps h so the configured request headers are copied
+// onto the response before h writes anything, so they appear on streaming
+// responses too.
+func (s *Server) echoHeadersHandler(h http.Handler) http.Handler {
+	headers := s.echoHeaders
+	if headers == nil {
+		headers = defaultEchoHeaders
+	}
+	if len(headers) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range headers {
+			if v := r.Header.Get(name); v != "" {
+				w.Header().Set(name, v)
+			} else if http.CanonicalHeaderKey(name) == "X-Request-Id" {
+				w.Header().Set(name, s.newID("req_"))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// setResponseID sets the X-Request-Id response header to the id of the
+// generated response, unless the client supplied its own request id.
+func setResponseID(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("X-Request-Id") == "" {
+		w.Header().Set("X-Request-Id", id)
+	}
+}
+
 // verboseMeta holds per-request metadata for verbose logging.
 type verboseMeta struct {
 	userMessage string
 	matchedRule string
 }
 
+// WithBasePath mounts every route (the LLM APIs, admin, MCP, and Gemini
+// model paths) under prefix, such as "/mock-llm", for serving behind a
+// gateway on a subpath. Requests outside the prefix get a 404.
+func WithBasePath(prefix string) Option {
+	return func(s *Server) {
+		s.basePath = strings.TrimSuffix(prefix, "/")
+		if s.basePath != "" && !strings.HasPrefix(s.basePath, "/") {
+			s.basePath = "/" + s.basePath
+		}
+	}
+}
+
 // Handler returns the http.Handler for this server.
-// When verbose logging is enabled, the returned handler wraps the mux with
-// middleware that logs method, path, user message, matched rule, status, and timing.
+// The mux is wrapped with middleware that applies WithMaxRequestBytes and
+// WithRateLimit and echoes request headers (see WithEchoHeaders). While
+// verbose logging is enabled, the outer middleware logs method, path, user
+// message, matched rule, status, and timing. It is checked per request, so
+// POST /_mock/verbose takes effect immediately. With WithBasePath, the
+// prefix is stripped before any of this, so logged paths omit it.
 func (s *Server) Handler() http.Handler {
-	if !s.verbose {
-		return s.mux
-	}
+	h := s.echoHeadersHandler(s.maxBytesHandler(s.rateLimitHandler(s.latencyHandler(s.byteRateHandler(s.mux)))))
 	logger := s.logger
 	if logger == nil {
 		logger = log.Default()
 	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.verbose.Load() {
+			h.ServeHTTP(w, r)
+			s.reqMeta.Delete(r) // in case logging was turned off mid-request
+			return
+		}
 		start := time.Now()
 		rw := &verboseResponseWriter{ResponseWriter: w, status: http.StatusOK}
-		s.mux.ServeHTTP(rw, r)
-		elapsed := time.Since(start)
-		user := ""
-		rule := ""
+		h.ServeHTTP(rw, r)
+		entry := requestLog{
+			Time:     start,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   rw.status,
+			Duration: time.Since(start),
+		}
 		if meta, ok := s.reqMeta.LoadAndDelete(r); ok {
 			m := meta.(*verboseMeta)
-			user = m.userMessage
-			rule = m.matchedRule
+			entry.UserMessage = m.userMessage
+			entry.MatchedRule = m.matchedRule
 		}
-		var parts []string
-		parts = append(parts, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
-		if user != "" {
-			parts = append(parts, fmt.Sprintf("user=%q", user))
-		}
-		if rule != "" {
-			parts = append(parts, fmt.Sprintf("rule=%q", rule))
-		}
-		parts = append(parts, fmt.Sprintf("-> %d (%s)", rw.status, elapsed.Round(time.Millisecond)))
-		logger.Printf("llmock: %s", strings.Join(parts, " "))
+		logger.Print(entry.format(s.logFormat))
 	})
+	if s.basePath != "" {
+		handler = http.StripPrefix(s.basePath, handler)
+	}
+	return handler
 }
 
 // verboseResponseWriter wraps http.ResponseWriter to capture the status code
@@ -241,6 +647,12 @@ func (rw *verboseResponseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, for
+// example to hijack the connection for a WebSocket upgrade.
+func (rw *verboseResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *verboseResponseWriter) Flush() {
 	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
 		f.Flush()
@@ -249,18 +661,29 @@ func (rw *verboseResponseWriter) Flush() {
 
 // ChatCompletionRequest represents an OpenAI chat completion request.
 type ChatCompletionRequest struct {
-	Model       string           `json:"model"`
-	Messages    []Message        `json:"messages"`
-	Stream      bool             `json:"stream,omitempty"`
-	Temperature *float64         `json:"temperature,omitempty"`
-	MaxTokens   *int             `json:"max_tokens,omitempty"`
-	Tools       []OpenAIToolDef  `json:"tools,omitempty"`
+	Model       string          `json:"model"`
+	Messages    []Message       `json:"messages"`
+	Stream      bool            `json:"stream,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	Tools       []OpenAIToolDef `json:"tools,omitempty"`
+	User        string          `json:"user,omitempty"`
+
+	// MaxCompletionTokens supersedes MaxTokens in newer clients.
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
+
+	// Metadata is opaque and only recorded in the admin request log.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // OpenAIToolDef represents a tool definition in an OpenAI request.
 type OpenAIToolDef struct {
-	Type     string              `json:"type"`
-	Function OpenAIFunctionDef   `json:"function"`
+	Type     string            `json:"type"`
+	Function OpenAIFunctionDef `json:"function"`
 }
 
 // OpenAIFunctionDef describes a function tool in an OpenAI request.
@@ -275,7 +698,7 @@ type OpenAIFunctionDef struct {
 // and tool-role messages carry a ToolCallID linking them to a previous tool call.
 type Message struct {
 	Role       string           `json:"role"`
-	Content    json.RawMessage  `json:"content"`  // string or null
+	Content    json.RawMessage  `json:"content"` // string or null
 	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 	Name       string           `json:"name,omitempty"` // function name for tool messages
@@ -302,14 +725,20 @@ type ChatCompletionResponse struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   Usage    `json:"usage"`
+
+	// SystemFingerprint identifies the backend configuration. It is derived
+	// from the seed, so it is the same for every server with that seed.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
 }
 
 // ChoiceMessage represents the message in a response choice, which may
 // contain either text content or tool calls.
 type ChoiceMessage struct {
-	Role      string           `json:"role"`
-	Content   string           `json:"content,omitempty"`
-	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+	Role        string             `json:"role"`
+	Content     string             `json:"content,omitempty"`
+	ToolCalls   []OpenAIToolCall   `json:"tool_calls,omitempty"`
+	Annotations []OpenAIAnnotation `json:"annotations,omitempty"`
+	Images      []OpenAIImagePart  `json:"images,omitempty"`
 }
 
 // OpenAIToolCall represents a tool call in an OpenAI response.
@@ -327,9 +756,9 @@ type OpenAIFunctionCall struct {
 
 // Choice represents a response choice.
 type Choice struct {
-	Index        int          `json:"index"`
+	Index        int           `json:"index"`
 	Message      ChoiceMessage `json:"message"`
-	FinishReason string       `json:"finish_reason"`
+	FinishReason string        `json:"finish_reason"`
 }
 
 // Usage represents token usage statistics.
@@ -337,6 +766,14 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// PromptTokensDetails is only set for WithResponseCache hits.
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails breaks down an OpenAI request's prompt tokens.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
 }
 
 func toInternalMessages(messages []Message) []InternalMessage {
@@ -366,45 +803,51 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	internal := toInternalMessages(req.Messages)
+
 	// Evaluate faults before normal processing.
-	if f, ok := s.faults.evaluate(); ok {
-		if s.executeFault(w, r, f, "openai", req.Stream) {
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{model: req.Model, promptTokens: estimateTokens(req.Messages)}, "openai", req.Stream) {
 			return
 		}
+		w = faultWriter(w, f, "openai", req.Stream)
 	}
 
-	internal := toInternalMessages(req.Messages)
-	response, err := s.responder.Respond(internal)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
+	maxTokens := req.MaxTokens
+	if req.MaxCompletionTokens != nil {
+		maxTokens = req.MaxCompletionTokens
 	}
-
-	// If the conversation contains tool results, suppress tool call responses
-	// to avoid infinite tool-call loops.
-	hasToolResults := openAIHasToolResults(req.Messages)
-
-	// Auto-generate a tool call if enabled and no rule produced one.
-	if !hasToolResults && s.autoToolCalls && !response.IsToolCall() && len(req.Tools) > 0 {
-		reqTools := openAIToRequestTools(req.Tools)
-		if tc, ok := generateToolCallFromSchema(reqTools, s.rng); ok {
-			response = Response{ToolCalls: []ToolCall{tc}}
-		}
+	ctx := RespondContext{
+		Messages:    internal,
+		Model:       req.Model,
+		User:        req.User,
+		Endpoint:    EndpointOpenAI,
+		Temperature: req.Temperature,
+		MaxTokens:   maxTokens,
+		Tools:       openAIToRequestTools(req.Tools),
+		Stream:      req.Stream,
+
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		LogitBias:        req.LogitBias,
+		ToolResults:      toolRoleResults(internal),
+		Session:          r.Header.Get(sessionHeader),
 	}
-
-	// Force text response when tool results are present.
-	if hasToolResults && response.IsToolCall() {
-		response = s.forceTextResponse(response, internal)
+	response, cached, err := s.cachedRespond(r, req, func() (Response, error) {
+		return s.respondWithTools(ctx, openAIHasToolResults(req.Messages))
+	})
+	if err != nil {
+		writeError(w, s.responderErrorStatus(err), err.Error())
+		return
 	}
 
-	s.logAdminRequest(r, internal, response.Text)
+	s.logAdminRequestMetadata(r, internal, response.Text, req.Metadata)
+	response.ToolCalls = s.withToolCallIDs(response.ToolCalls)
 
-	model := req.Model
-	if model == "" {
-		model = "llmock-1"
-	}
+	model := s.responseModel(req.Model)
 
-	id := fmt.Sprintf("chatcmpl-mock-%d", time.Now().UnixNano())
+	id := s.chatCompletionID()
+	setResponseID(w, r, id)
 
 	if response.IsToolCall() {
 		// Tool call response: check that requested tools contain the called tool.
@@ -429,10 +872,13 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		}
 
 		promptTokens := estimateTokens(req.Messages)
-		completionTokens := 5 // rough estimate for tool call tokens
+		completionTokens := 5 + countTokens(response.Text) // rough estimate for tool call tokens
 
 		if req.Stream {
-			s.streamOpenAIToolCall(w, r, response.ToolCalls, model, id)
+			s.streamOpenAIToolCall(w, r, response.Text, response.ToolCalls, model, id)
+			return
+		}
+		if !s.waitForOutput(r, completionTokens) {
 			return
 		}
 
@@ -442,25 +888,23 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		}
 
 		resp := ChatCompletionResponse{
-			ID:      id,
-			Object:  "chat.completion",
-			Created: time.Now().Unix(),
-			Model:   model,
+			ID:                id,
+			Object:            "chat.completion",
+			Created:           s.now().Unix(),
+			Model:             model,
+			SystemFingerprint: s.fingerprint,
 			Choices: []Choice{
 				{
 					Index: 0,
 					Message: ChoiceMessage{
 						Role:      "assistant",
+						Content:   response.Text,
 						ToolCalls: toolCalls,
 					},
 					FinishReason: "tool_calls",
 				},
 			},
-			Usage: Usage{
-				PromptTokens:     promptTokens,
-				CompletionTokens: completionTokens,
-				TotalTokens:      promptTokens + completionTokens,
-			},
+			Usage: openAIUsage(promptTokens, completionTokens, cached),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
@@ -468,35 +912,46 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	}
 
 textResponse:
-	responseText := response.Text
+	responseText, truncated := truncateToTokens(response.Text, maxTokens)
+	finishReason := "stop"
+	if truncated {
+		finishReason = "length"
+	}
+	if response.FinishReason != "" {
+		finishReason = response.FinishReason
+	}
 	promptTokens := estimateTokens(req.Messages)
 	completionTokens := countTokens(responseText)
 
 	if req.Stream {
-		s.streamOpenAI(w, r, responseText, model, id)
+		s.checkedStream(w, "openai", responseText, func(w http.ResponseWriter) {
+			s.streamOpenAI(w, r, responseText, model, id, finishReason, promptTokens)
+		})
+		return
+	}
+	if !s.waitForOutput(r, completionTokens) {
 		return
 	}
 
 	resp := ChatCompletionResponse{
-		ID:      id,
-		Object:  "chat.completion",
-		Created: time.Now().Unix(),
-		Model:   model,
+		ID:                id,
+		Object:            "chat.completion",
+		Created:           s.now().Unix(),
+		Model:             model,
+		SystemFingerprint: s.fingerprint,
 		Choices: []Choice{
 			{
 				Index: 0,
 				Message: ChoiceMessage{
-					Role:    "assistant",
-					Content: responseText,
+					Role:        "assistant",
+					Content:     responseText,
+					Annotations: s.openAIAnnotations(responseText),
+					Images:      openAIImageParts(response.Media),
 				},
-				FinishReason: "stop",
+				FinishReason: finishReason,
 			},
 		},
-		Usage: Usage{
-			PromptTokens:     promptTokens,
-			CompletionTokens: completionTokens,
-			TotalTokens:      promptTokens + completionTokens,
-		},
+		Usage: openAIUsage(promptTokens, completionTokens, cached),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -505,11 +960,18 @@ textResponse:
 
 // AnthropicRequest represents an Anthropic Messages API request.
 type AnthropicRequest struct {
-	Model     string               `json:"model"`
-	Messages  []AnthropicMessage   `json:"messages"`
-	MaxTokens int                  `json:"max_tokens"`
-	Stream    bool                 `json:"stream,omitempty"`
-	Tools     []AnthropicToolDef   `json:"tools,omitempty"`
+	Model       string             `json:"model"`
+	Messages    []AnthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Tools       []AnthropicToolDef `json:"tools,omitempty"`
+
+	// StopSequences end the response at the first one that appears in it.
+	StopSequences []string `json:"stop_sequences,omitempty"`
+	// Metadata, such as {"user_id": ...}, is only recorded in the admin
+	// request log.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // AnthropicToolDef represents a tool definition in an Anthropic request.
@@ -529,14 +991,14 @@ type AnthropicMessage struct {
 // AnthropicInputBlock represents a content block in an Anthropic request message.
 // These appear when Content is an array rather than a string.
 type AnthropicInputBlock struct {
-	Type       string         `json:"type"`
-	Text       string         `json:"text,omitempty"`
-	ID         string         `json:"id,omitempty"`          // tool_use block
-	Name       string         `json:"name,omitempty"`        // tool_use block
-	Input      map[string]any `json:"input,omitempty"`       // tool_use block
-	ToolUseID  string         `json:"tool_use_id,omitempty"` // tool_result block
-	Content    json.RawMessage `json:"content,omitempty"`    // tool_result block (string or nested blocks)
-	IsError    bool           `json:"is_error,omitempty"`    // tool_result block
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`          // tool_use block
+	Name      string          `json:"name,omitempty"`        // tool_use block
+	Input     map[string]any  `json:"input,omitempty"`       // tool_use block
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_result block
+	Content   json.RawMessage `json:"content,omitempty"`     // tool_result block (string or nested blocks)
+	IsError   bool            `json:"is_error,omitempty"`    // tool_result block
 }
 
 // MessageContent extracts the text content from an AnthropicMessage.
@@ -564,54 +1026,147 @@ func (m AnthropicMessage) MessageContent() string {
 				parts = append(parts, b.Text)
 			}
 		case "tool_result":
-			// tool_result content can be a string or array of blocks.
-			if len(b.Content) > 0 {
-				var cs string
-				if err := json.Unmarshal(b.Content, &cs); err == nil {
-					parts = append(parts, cs)
-				} else {
-					var nested []AnthropicInputBlock
-					if err := json.Unmarshal(b.Content, &nested); err == nil {
-						for _, nb := range nested {
-							if nb.Type == "text" && nb.Text != "" {
-								parts = append(parts, nb.Text)
-							}
-						}
-					}
-				}
+			if text := b.toolResultText(); text != "" {
+				parts = append(parts, text)
 			}
 		}
 	}
 	return strings.Join(parts, "\n")
 }
 
+// toolResultText returns the text of a tool_result block, whose content
+// can be a string or an array of blocks.
+func (b AnthropicInputBlock) toolResultText() string {
+	if len(b.Content) == 0 {
+		return ""
+	}
+	var cs string
+	if err := json.Unmarshal(b.Content, &cs); err == nil {
+		return cs
+	}
+	var nested []AnthropicInputBlock
+	if err := json.Unmarshal(b.Content, &nested); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, nb := range nested {
+		if nb.Type == "text" && nb.Text != "" {
+			parts = append(parts, nb.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
 // AnthropicResponse represents an Anthropic Messages API response.
 type AnthropicResponse struct {
-	ID           string                 `json:"id"`
-	Type         string                 `json:"type"`
-	Role         string                 `json:"role"`
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
 	Content      []AnthropicContentBlock `json:"content"`
-	Model        string                 `json:"model"`
-	StopReason   string                 `json:"stop_reason"`
-	StopSequence *string                `json:"stop_sequence"`
-	Usage        AnthropicUsage         `json:"usage"`
+	Model        string                  `json:"model"`
+	StopReason   string                  `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        AnthropicUsage          `json:"usage"`
 }
 
 // AnthropicContentBlock represents a content block in an Anthropic response.
 // For text blocks: Type="text", Text is set.
 // For tool_use blocks: Type="tool_use", ID/Name/Input are set.
+// For image and document blocks: Type="image" or "document", Source is set.
 type AnthropicContentBlock struct {
-	Type  string         `json:"type"`
-	Text  string         `json:"text,omitempty"`
-	ID    string         `json:"id,omitempty"`
-	Name  string         `json:"name,omitempty"`
-	Input map[string]any `json:"input,omitempty"`
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     map[string]any        `json:"input,omitempty"`
+	Citations []AnthropicCitation   `json:"citations,omitempty"`
+	Source    *AnthropicMediaSource `json:"source,omitempty"`
 }
 
 // AnthropicUsage represents token usage in an Anthropic response.
 type AnthropicUsage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+
+	// CacheReadInputTokens counts input read from the cache on a
+	// WithResponseCache hit; InputTokens then excludes them.
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// now returns the current time from the configured clock.
+func (s *Server) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// systemFingerprint returns an OpenAI-style "fp_" fingerprint derived from
+// seed, or a random one if seed is nil.
+func systemFingerprint(seed *int64) string {
+	n := mrand.Uint64()
+	if seed != nil {
+		n = mrand.New(mrand.NewPCG(uint64(*seed), 2)).Uint64()
+	}
+	return fmt.Sprintf("fp_%010x", n&0xffffffffff)
+}
+
+// newID returns prefix followed by a unique suffix from the configured id
+// generator, or random hex by default.
+func (s *Server) newID(prefix string) string {
+	if s.idGenerator != nil {
+		return prefix + s.idGenerator()
+	}
+	return prefix + randomHex(12)
+}
+
+// chatCompletionID returns a new chat completion id: from the id generator
+// if one is configured, else from the clock.
+func (s *Server) chatCompletionID() string {
+	if s.idGenerator != nil {
+		return s.newID("chatcmpl-mock-")
+	}
+	return fmt.Sprintf("chatcmpl-mock-%d", s.now().UnixNano())
+}
+
+// serverRandSource is a rand.Source that draws from the server's RNG.
+type serverRandSource struct{ s *Server }
+
+func (src serverRandSource) Uint64() uint64 {
+	// s.rng is shared with the fault state, which guards it.
+	src.s.faults.mu.Lock()
+	defer src.s.faults.mu.Unlock()
+	return src.s.rng.Uint64()
+}
+
+// toolCallID returns a new tool call id: from the id generator if one is
+// configured, else from the seeded RNG under WithSeed so ids are
+// reproducible, else random.
+func (s *Server) toolCallID(prefix string) string {
+	if s.idGenerator == nil && s.seed != nil {
+		b := make([]byte, 12)
+		// s.rng is shared with the fault state, which guards it.
+		s.faults.mu.Lock()
+		for i := range b {
+			b[i] = byte(s.rng.UintN(256))
+		}
+		s.faults.mu.Unlock()
+		return prefix + hex.EncodeToString(b)
+	}
+	return s.newID(prefix)
+}
+
+// withToolCallIDs returns a copy of calls with fresh ids from toolCallID.
+// With neither an id generator nor a seed, the responder's ids are kept.
+func (s *Server) withToolCallIDs(calls []ToolCall) []ToolCall {
+	if (s.idGenerator == nil && s.seed == nil) || len(calls) == 0 {
+		return calls
+	}
+	out := slices.Clone(calls)
+	for i := range out {
+		out[i].ID = s.toolCallID("call_")
+	}
+	return out
 }
 
 func randomHex(n int) string {
@@ -654,45 +1209,44 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	internal := anthropicToInternal(req.Messages)
+
 	// Evaluate faults before normal processing.
-	if f, ok := s.faults.evaluate(); ok {
-		if s.executeFault(w, r, f, "anthropic", req.Stream) {
+	if f, ok := s.faults.evaluate(extractInput(internal)); ok {
+		if s.executeFault(w, r, f, faultRequest{model: req.Model, promptTokens: estimateAnthropicTokens(req.Messages)}, "anthropic", req.Stream) {
 			return
 		}
+		w = faultWriter(w, f, "anthropic", req.Stream)
 	}
 
-	internal := anthropicToInternal(req.Messages)
-	response, err := s.responder.Respond(internal)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
-		return
+	var maxTokens *int
+	if req.MaxTokens > 0 {
+		maxTokens = &req.MaxTokens
 	}
-
-	// If the conversation contains tool results, suppress tool call responses
-	// to avoid infinite tool-call loops.
-	hasToolResults := anthropicHasToolResults(req.Messages)
-
-	// Auto-generate a tool call if enabled and no rule produced one.
-	if !hasToolResults && s.autoToolCalls && !response.IsToolCall() && len(req.Tools) > 0 {
-		reqTools := anthropicToRequestTools(req.Tools)
-		if tc, ok := generateToolCallFromSchema(reqTools, s.rng); ok {
-			response = Response{ToolCalls: []ToolCall{tc}}
-		}
+	ctx := RespondContext{
+		Messages:    internal,
+		Model:       req.Model,
+		Endpoint:    EndpointAnthropic,
+		Temperature: req.Temperature,
+		MaxTokens:   maxTokens,
+		Tools:       anthropicToRequestTools(req.Tools),
+		Stream:      req.Stream,
+		ToolResults: anthropicToolResults(req.Messages),
+		Session:     r.Header.Get(sessionHeader),
 	}
-
-	// Force text response when tool results are present.
-	if hasToolResults && response.IsToolCall() {
-		response = s.forceTextResponse(response, internal)
+	response, cached, err := s.cachedRespond(r, req, func() (Response, error) {
+		return s.respondWithTools(ctx, anthropicHasToolResults(req.Messages))
+	})
+	if err != nil {
+		writeError(w, s.responderErrorStatus(err), err.Error())
+		return
 	}
 
-	s.logAdminRequest(r, internal, response.Text)
+	s.logAdminRequestMetadata(r, internal, response.Text, req.Metadata)
 
-	model := req.Model
-	if model == "" {
-		model = "llmock-1"
-	}
+	model := s.responseModel(req.Model)
 
-	id := fmt.Sprintf("msg_%s", randomHex(12))
+	id := s.newID("msg_")
 
 	if response.IsToolCall() {
 		// Validate tool calls against request tools.
@@ -716,23 +1270,30 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		}
 
 		inputTokens := estimateAnthropicTokens(req.Messages)
-		outputTokens := 5
+		outputTokens := 5 + countTokens(response.Text)
+		blocks := response.textBlocks()
 
 		if req.Stream {
-			s.streamAnthropicToolCall(w, r, response.ToolCalls, model, id, inputTokens)
+			s.streamAnthropicToolCall(w, r, blocks, response.ToolCalls, model, id, inputTokens)
+			return
+		}
+		if !s.waitForOutput(r, outputTokens) {
 			return
 		}
 
-		content := make([]AnthropicContentBlock, len(response.ToolCalls))
-		for i, tc := range response.ToolCalls {
+		var content []AnthropicContentBlock
+		for _, text := range blocks {
+			content = append(content, AnthropicContentBlock{Type: "text", Text: text})
+		}
+		for _, tc := range response.ToolCalls {
 			// Use Anthropic-style ID
-			tcID := generateToolCallID("toolu_")
-			content[i] = AnthropicContentBlock{
+			tcID := s.toolCallID("toolu_")
+			content = append(content, AnthropicContentBlock{
 				Type:  "tool_use",
 				ID:    tcID,
 				Name:  tc.Name,
 				Input: tc.Arguments,
-			}
+			})
 		}
 
 		resp := AnthropicResponse{
@@ -742,7 +1303,7 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 			Content:    content,
 			Model:      model,
 			StopReason: "tool_use",
-			Usage:      AnthropicUsage{InputTokens: inputTokens, OutputTokens: outputTokens},
+			Usage:      anthropicUsage(inputTokens, outputTokens, cached),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
@@ -750,29 +1311,72 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 anthropicTextResponse:
-	responseText := response.Text
+	responseText, stopSequence := cutAtStopSequence(response.Text, req.StopSequences)
+	responseText, truncated := truncateToTokens(responseText, maxTokens)
+	stopReason := "end_turn"
+	switch {
+	case truncated:
+		stopReason = "max_tokens"
+		stopSequence = nil
+	case stopSequence != nil:
+		stopReason = "stop_sequence"
+	}
+	if response.FinishReason != "" {
+		stopReason = anthropicStopReasons[response.FinishReason]
+		stopSequence = nil
+	}
 	inputTokens := estimateAnthropicTokens(req.Messages)
 	outputTokens := countTokens(responseText)
 
+	// Multi-block replies are kept only if nothing was cut from them.
+	blocks := []string{responseText}
+	if len(response.Blocks) > 0 && responseText == response.Text {
+		blocks = response.Blocks
+	}
+
 	if req.Stream {
-		s.streamAnthropic(w, r, responseText, model, id, inputTokens)
+		s.checkedStream(w, "anthropic", responseText, func(w http.ResponseWriter) {
+			s.streamAnthropic(w, r, blocks, model, id, inputTokens, stopReason, stopSequence)
+		})
+		return
+	}
+	if !s.waitForOutput(r, outputTokens) {
 		return
 	}
 
+	var content []AnthropicContentBlock
+	for _, b := range blocks {
+		if b == "" && response.Media != nil {
+			continue
+		}
+		content = append(content, AnthropicContentBlock{Type: "text", Text: b, Citations: s.anthropicCitations(b)})
+	}
+	if response.Media != nil {
+		content = append(content, anthropicMediaBlock(*response.Media))
+	}
 	resp := AnthropicResponse{
-		ID:         id,
-		Type:       "message",
-		Role:       "assistant",
-		Content:    []AnthropicContentBlock{{Type: "text", Text: responseText}},
-		Model:      model,
-		StopReason: "end_turn",
-		Usage:      AnthropicUsage{InputTokens: inputTokens, OutputTokens: outputTokens},
+		ID:           id,
+		Type:         "message",
+		Role:         "assistant",
+		Content:      content,
+		Model:        model,
+		StopReason:   stopReason,
+		StopSequence: stopSequence,
+		Usage:        anthropicUsage(inputTokens, outputTokens, cached),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// anthropicStopReasons maps OpenAI finish reasons to Anthropic stop reasons.
+var anthropicStopReasons = map[string]string{
+	"stop":           "end_turn",
+	"length":         "max_tokens",
+	"content_filter": "refusal",
+	"tool_calls":     "tool_use",
+}
+
 func estimateTokens(messages []Message) int {
 	total := 0
 	for _, m := range messages {
@@ -792,6 +1396,59 @@ func countTokens(s string) int {
 	return tokens
 }
 
+// truncateToTokens cuts text down to at most maxTokens tokens, as counted
+// by countTokens, and reports whether it had to. The text is cut after the
+// last word that fits, keeping its original spacing. A nil or non-positive
+// limit leaves the text alone.
+func truncateToTokens(text string, maxTokens *int) (string, bool) {
+	if maxTokens == nil || *maxTokens <= 0 || countTokens(text) <= *maxTokens {
+		return text, false
+	}
+	words, end := 0, 0
+	inWord := false
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if inWord {
+				end = i
+			}
+			inWord = false
+			continue
+		}
+		if !inWord {
+			// Counted as countTokens would count the first words+1 words.
+			if int(float64(words+1)*1.3) > *maxTokens {
+				break
+			}
+			words++
+			inWord = true
+		}
+	}
+	if inWord {
+		end = len(text)
+	}
+	return text[:end], true
+}
+
+// cutAtStopSequence cuts text just before the earliest of stops that occurs
+// in it, and returns the stop sequence that matched, or nil if none did.
+func cutAtStopSequence(text string, stops []string) (string, *string) {
+	cut := -1
+	var matched *string
+	for _, stop := range stops {
+		if stop == "" {
+			continue
+		}
+		if i := strings.Index(text, stop); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+			matched = &stop
+		}
+	}
+	if matched == nil {
+		return text, nil
+	}
+	return text[:cut], matched
+}
+
 type errorResponse struct {
 	Error struct {
 		Message string `json:"message"`
@@ -803,22 +1460,30 @@ type errorResponse struct {
 // When verbose logging is enabled, it also stores per-request metadata
 // for the verbose middleware to include in its log line.
 func (s *Server) logAdminRequest(r *http.Request, messages []InternalMessage, responseText string) {
+	s.logAdminRequestMetadata(r, messages, responseText, nil)
+}
+
+// logAdminRequestMetadata is logAdminRequest for requests that carry a
+// provider "metadata" object, which is recorded with the entry.
+func (s *Server) logAdminRequestMetadata(r *http.Request, messages []InternalMessage, responseText string, metadata map[string]any) {
 	matchedRule := ""
 	if ar, ok := s.responder.(*adminResponder); ok {
 		matchedRule = ar.getLastMatchedRule()
 	}
 	userMessage := extractInput(messages)
+	s.recordUsage(r, messages, responseText)
 	if s.admin != nil {
 		s.admin.logRequest(requestEntry{
-			Timestamp:   time.Now(),
+			Timestamp:   s.now(),
 			Method:      r.Method,
 			Path:        r.URL.Path,
 			UserMessage: userMessage,
 			MatchedRule: matchedRule,
 			Response:    responseText,
+			Metadata:    metadata,
 		})
 	}
-	if s.verbose {
+	if s.verbose.Load() {
 		s.reqMeta.Store(r, &verboseMeta{
 			userMessage: userMessage,
 			matchedRule: matchedRule,
@@ -886,6 +1551,38 @@ func openAIHasToolResults(messages []Message) bool {
 	return false
 }
 
+// toolRoleResults returns the content of the "tool" role messages, which
+// is how OpenAI-style requests carry tool results.
+func toolRoleResults(messages []InternalMessage) []string {
+	var out []string
+	for _, m := range messages {
+		if m.Role == "tool" && m.Content != "" {
+			out = append(out, m.Content)
+		}
+	}
+	return out
+}
+
+// anthropicToolResults returns the text of every tool_result block.
+func anthropicToolResults(messages []AnthropicMessage) []string {
+	var out []string
+	for _, m := range messages {
+		var blocks []AnthropicInputBlock
+		if err := json.Unmarshal(m.Content, &blocks); err != nil {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type != "tool_result" {
+				continue
+			}
+			if text := b.toolResultText(); text != "" {
+				out = append(out, text)
+			}
+		}
+	}
+	return out
+}
+
 // anthropicHasToolResults returns true if any message contains a tool_result content block.
 func anthropicHasToolResults(messages []AnthropicMessage) bool {
 	for _, m := range messages {
@@ -901,17 +1598,60 @@ func anthropicHasToolResults(messages []AnthropicMessage) bool {
 	return false
 }
 
+// respondWithTools gets the response to ctx. If the responder gave no tool
+// call and auto tool calls are on, it makes one for a tool from ctx.Tools
+// (or the MCP tools). If the conversation already has tool results, a tool
+// call is turned into text instead, to avoid infinite tool-call loops.
+func (s *Server) respondWithTools(ctx RespondContext, hasToolResults bool) (Response, error) {
+	response, err := s.respond(ctx)
+	if err != nil {
+		return response, err
+	}
+
+	// Auto-generate a tool call if enabled and no rule produced one.
+	reqTools := s.withMCPTools(ctx.Tools)
+	if !hasToolResults && s.autoToolCalls && !response.IsToolCall() && len(reqTools) > 0 {
+		if tc, ok := generateToolCallFromSchema(reqTools, s.rng); ok {
+			response = Response{ToolCalls: []ToolCall{tc}}
+		}
+	}
+
+	// Force text response when tool results are present.
+	if hasToolResults && response.IsToolCall() {
+		response = s.forceTextResponse(response, ctx)
+	}
+	return response, nil
+}
+
 // forceTextResponse converts a tool-call response to a text response.
 // Used when the request contains tool results to avoid infinite tool-call loops.
-func (s *Server) forceTextResponse(resp Response, messages []InternalMessage) Response {
+func (s *Server) forceTextResponse(resp Response, ctx RespondContext) Response {
 	if s.markov != nil {
-		if r, err := s.markov.Respond(messages); err == nil {
+		if r, err := s.markov.RespondWithContext(ctx); err == nil {
 			return r
 		}
 	}
 	return Response{Text: "I've processed the tool results. Is there anything else I can help with?"}
 }
 
+// postOnlyPaths are the LLM endpoints that only accept POST.
+var postOnlyPaths = []string{
+	"/v1/chat/completions",
+	"/v1/messages",
+	"/v1/responses",
+	"/v1/images/generations",
+	"/v1/audio/transcriptions",
+	"/v1beta/models/",
+}
+
+// handleMethodNotAllowed answers a request to a POST-only endpoint made
+// with another method.
+func handleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	format, _ := apiFormatForPath(r.URL.Path)
+	w.Header().Set("Allow", http.MethodPost)
+	writeFaultError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed, use POST", r.Method), "invalid_request_error", format)
+}
+
 func writeError(w http.ResponseWriter, code int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -1,14 +1,19 @@
 package llmock_test
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/shishberg/llmock"
 )
@@ -462,6 +467,47 @@ func TestVerbose_LogsUserMessageAndRule(t *testing.T) {
 	}
 }
 
+func TestVerbose_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	s := llmock.New(
+		llmock.WithVerbose(true),
+		llmock.WithLogFormat(llmock.LogFormatJSON),
+		llmock.WithLogger(log.New(&buf, "", 0)),
+		llmock.WithRules(llmock.Rule{
+			Pattern:   regexp.MustCompile(`(?i)hello`),
+			Responses: []string{"Hi there!"},
+		}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"model":"test","messages":[{"role":"user","content":"Hello!"}]}`
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not a JSON object: %v\n%s", err, buf.String())
+	}
+	for _, key := range []string{"ts", "method", "path", "status", "duration_ms", "user_message"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("JSON log missing %q: %s", key, buf.String())
+		}
+	}
+	if entry["method"] != "POST" || entry["path"] != "/v1/chat/completions" {
+		t.Errorf("unexpected method/path: %s", buf.String())
+	}
+	if entry["status"] != float64(200) || entry["user_message"] != "Hello!" {
+		t.Errorf("unexpected status/user_message: %s", buf.String())
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(entry["ts"])); err != nil {
+		t.Errorf("ts is not RFC 3339: %v", err)
+	}
+}
+
 func TestVerbose_AnthropicEndpoint(t *testing.T) {
 	var buf bytes.Buffer
 	logger := log.New(&buf, "", 0)
@@ -591,3 +637,515 @@ func TestVerbose_ErrorStatus(t *testing.T) {
 		t.Errorf("verbose log should show 400 status, got: %s", logLine)
 	}
 }
+
+// paramsResponder is an example ContextResponder that reports the request
+// parameters it was given.
+type paramsResponder struct{}
+
+func (paramsResponder) Respond(messages []llmock.InternalMessage) (llmock.Response, error) {
+	return llmock.Response{Text: "no context"}, nil
+}
+
+func (paramsResponder) RespondWithContext(ctx llmock.RespondContext) (llmock.Response, error) {
+	text := fmt.Sprintf("model=%s stream=%v tools=%d", ctx.Model, ctx.Stream, len(ctx.Tools))
+	if ctx.Temperature != nil {
+		text += fmt.Sprintf(" temperature=%.1f", *ctx.Temperature)
+	}
+	if ctx.MaxTokens != nil {
+		text += fmt.Sprintf(" max_tokens=%d", *ctx.MaxTokens)
+	}
+	return llmock.Response{Text: text}, nil
+}
+
+func TestContextResponder_ReceivesRequestParams(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(paramsResponder{}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{
+			name: "openai",
+			path: "/v1/chat/completions",
+			body: `{"model":"gpt-4","temperature":0.2,"max_tokens":50,"messages":[{"role":"user","content":"hi"}],
+				"tools":[{"type":"function","function":{"name":"f"}}]}`,
+			want: "model=gpt-4 stream=false tools=1 temperature=0.2 max_tokens=50",
+		},
+		{
+			name: "anthropic",
+			path: "/v1/messages",
+			body: `{"model":"claude-3","max_tokens":100,"temperature":1.0,"messages":[{"role":"user","content":"hi"}]}`,
+			want: "model=claude-3 stream=false tools=0 temperature=1.0 max_tokens=100",
+		},
+		{
+			name: "gemini",
+			path: "/v1beta/models/gemini-pro:generateContent",
+			body: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"generationConfig":{"temperature":0.7,"maxOutputTokens":20}}`,
+			want: "model=gemini-pro stream=false tools=0 temperature=0.7 max_tokens=20",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("expected %q in response, got %s", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestContextResponder_PlainResponderStillWorks(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","temperature":0.5,"messages":[{"role":"user","content":"plain"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result llmock.ChatCompletionResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Choices[0].Message.Content != "plain" {
+		t.Errorf("expected echo 'plain', got %q", result.Choices[0].Message.Content)
+	}
+}
+
+func TestEchoHeaders_Streaming(t *testing.T) {
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithEchoHeaders("X-Request-Id", "traceparent"),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	req, _ := http.NewRequest("POST", ts.URL+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("X-Request-Id", "client-123")
+	req.Header.Set("traceparent", traceparent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if got := resp.Header.Get("X-Request-Id"); got != "client-123" {
+		t.Errorf("expected echoed X-Request-Id, got %q", got)
+	}
+	if got := resp.Header.Get("traceparent"); got != traceparent {
+		t.Errorf("expected echoed traceparent, got %q", got)
+	}
+}
+
+func TestEchoHeaders_GeneratedRequestID(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result llmock.ChatCompletionResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-Id"); got != result.ID {
+		t.Errorf("expected X-Request-Id to be the completion id %q, got %q", result.ID, got)
+	}
+
+	resp, err = http.Get(ts.URL + "/_mock/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-Id"); !strings.HasPrefix(got, "req_") {
+		t.Errorf("expected a generated X-Request-Id, got %q", got)
+	}
+}
+
+const longPrompt = "one two three four five six seven eight nine ten"
+
+func TestMaxTokens_TruncatesOpenAIAndAnthropic(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+		`{"model":"gpt-4","max_tokens":3,"messages":[{"role":"user","content":"`+longPrompt+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chat llmock.ChatCompletionResponse
+	json.NewDecoder(resp.Body).Decode(&chat)
+	resp.Body.Close()
+	if chat.Choices[0].FinishReason != "length" || chat.Choices[0].Message.Content != "one two three" {
+		t.Errorf("expected truncated text with finish_reason length, got %q / %q", chat.Choices[0].Message.Content, chat.Choices[0].FinishReason)
+	}
+	if chat.Usage.CompletionTokens > 3 {
+		t.Errorf("expected completion tokens within the cap, got %d", chat.Usage.CompletionTokens)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(
+		`{"model":"claude-3","max_tokens":3,"messages":[{"role":"user","content":"`+longPrompt+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg llmock.AnthropicResponse
+	json.NewDecoder(resp.Body).Decode(&msg)
+	resp.Body.Close()
+	if msg.StopReason != "max_tokens" || msg.Content[0].Text != "one two three" || msg.Usage.OutputTokens > 3 {
+		t.Errorf("expected truncated text with stop_reason max_tokens, got %+v", msg)
+	}
+
+	// A generous cap leaves the text and the normal finish reason alone.
+	resp, err = http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+		`{"model":"gpt-4","max_completion_tokens":100,"messages":[{"role":"user","content":"`+longPrompt+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&chat)
+	resp.Body.Close()
+	if chat.Choices[0].FinishReason != "stop" || chat.Choices[0].Message.Content != longPrompt {
+		t.Errorf("expected untruncated text, got %q / %q", chat.Choices[0].Message.Content, chat.Choices[0].FinishReason)
+	}
+
+	// Truncation keeps the reply's own spacing.
+	resp, err = http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+		`{"model":"gpt-4","max_tokens":3,"messages":[{"role":"user","content":"one\ntwo  three\tfour five"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&chat)
+	resp.Body.Close()
+	if got := chat.Choices[0].Message.Content; got != "one\ntwo  three" {
+		t.Errorf("expected whitespace kept in the truncated text, got %q", got)
+	}
+}
+
+func TestMaxTokens_StreamingFinishReason(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(time.Millisecond))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+		`{"model":"gpt-4","max_completion_tokens":3,"stream":true,"messages":[{"role":"user","content":"`+longPrompt+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"finish_reason":"length"`) || strings.Contains(string(body), "four") {
+		t.Errorf("expected truncated stream ending with finish_reason length, got %s", body)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(
+		`{"model":"claude-3","max_tokens":3,"stream":true,"messages":[{"role":"user","content":"`+longPrompt+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ = io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"stop_reason":"max_tokens"`) || strings.Contains(string(body), "four") {
+		t.Errorf("expected truncated stream ending with stop_reason max_tokens, got %s", body)
+	}
+}
+
+func TestLatencyPerToken_ScalesWithOutput(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithLatencyPerToken(5*time.Millisecond))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	timed := func(content string) time.Duration {
+		t.Helper()
+		start := time.Now()
+		resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(
+			`{"model":"claude-3","max_tokens":1000,"messages":[{"role":"user","content":"`+content+`"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return time.Since(start)
+	}
+
+	short := timed("hi")                                          // 1 token: ~5ms
+	long := timed(strings.TrimSpace(strings.Repeat("word ", 30))) // 39 tokens: ~195ms
+	if long < 190*time.Millisecond {
+		t.Errorf("expected the long response to take at least 190ms, took %v", long)
+	}
+	if short*4 > long {
+		t.Errorf("expected latency proportional to length, got short %v vs long %v", short, long)
+	}
+}
+
+func TestClockAndIDGenerator(t *testing.T) {
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 0
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithClock(func() time.Time { return fixed }),
+		llmock.WithIDGenerator(func() string { n++; return fmt.Sprintf("%04d", n) }),
+		llmock.WithEchoHeaders(),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var chat struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	}
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&chat)
+	resp.Body.Close()
+	if chat.ID != "chatcmpl-mock-0001" || chat.Created != fixed.Unix() {
+		t.Errorf("expected id chatcmpl-mock-0001 created at %d, got %q at %d", fixed.Unix(), chat.ID, chat.Created)
+	}
+
+	var msg struct {
+		ID string `json:"id"`
+	}
+	resp, err = http.Post(ts.URL+"/v1/messages", "application/json",
+		strings.NewReader(`{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&msg)
+	resp.Body.Close()
+	if msg.ID != "msg_0002" {
+		t.Errorf("expected id msg_0002, got %q", msg.ID)
+	}
+}
+
+func TestEchoResponder_Targets(t *testing.T) {
+	messages := []llmock.InternalMessage{
+		{Role: "system", Content: "be terse"},
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "prefill"},
+	}
+	tests := []struct {
+		echo llmock.EchoResponder
+		want string
+	}{
+		{llmock.EchoResponder{}, "second question"},
+		{llmock.EchoResponder{Target: llmock.EchoLastUser}, "second question"},
+		{llmock.EchoResponder{Target: llmock.EchoLast}, "prefill"},
+		{llmock.EchoResponder{Target: llmock.EchoFirstUser}, "first question"},
+		{llmock.EchoResponder{Target: llmock.EchoSystem}, "be terse"},
+		{llmock.EchoResponder{Target: llmock.EchoIndex, Index: 2}, "first answer"},
+		{llmock.EchoResponder{Target: llmock.EchoIndex, Index: -2}, "second question"},
+	}
+	for _, tt := range tests {
+		resp, err := tt.echo.Respond(messages)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.echo, err)
+			continue
+		}
+		if resp.Text != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.echo, resp.Text, tt.want)
+		}
+	}
+
+	for _, echo := range []llmock.EchoResponder{
+		{Target: llmock.EchoSystem},
+		{Target: llmock.EchoIndex, Index: 5},
+		{Target: "bogus"},
+	} {
+		if _, err := echo.Respond(messages[1:]); err == nil {
+			t.Errorf("%+v: expected an error", echo)
+		}
+	}
+}
+
+func TestResponseModel_ForceAndSuffix(t *testing.T) {
+	models := func(opts ...llmock.Option) []string {
+		t.Helper()
+		ts := httptest.NewServer(llmock.New(append(opts, llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(0))...).Handler())
+		defer ts.Close()
+
+		var got []string
+		for _, tc := range []struct{ path, body string }{
+			{"/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`},
+			{"/v1/responses", `{"model":"gpt-4o","input":"hi"}`},
+			{"/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`},
+		} {
+			var resp struct {
+				Model        string `json:"model"`
+				ModelVersion string `json:"modelVersion"`
+			}
+			postJSON(t, ts, tc.path, tc.body, &resp)
+			got = append(got, resp.Model+resp.ModelVersion)
+		}
+
+		// Streamed chunks report the same model.
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+			strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: {"); ok {
+				var chunk struct {
+					Model string `json:"model"`
+				}
+				json.Unmarshal([]byte("{"+data), &chunk)
+				got = append(got, chunk.Model)
+				break
+			}
+		}
+		return got
+	}
+
+	want := []string{"gpt-4", "claude-3", "gpt-4o", "gemini-pro", "gpt-4"}
+	if got := models(); !slices.Equal(got, want) {
+		t.Errorf("default: got %v, want %v", got, want)
+	}
+	want = []string{"gpt-4-0613", "claude-3-0613", "gpt-4o-0613", "gemini-pro-0613", "gpt-4-0613"}
+	if got := models(llmock.WithModelSuffix("-0613")); !slices.Equal(got, want) {
+		t.Errorf("suffix: got %v, want %v", got, want)
+	}
+	for _, m := range models(llmock.WithForceModel("other-model"), llmock.WithModelSuffix("-0613")) {
+		if m != "other-model" {
+			t.Errorf("force: expected every response to report other-model, got %q", m)
+		}
+	}
+}
+
+func TestSystemFingerprint_StableUnderSeed(t *testing.T) {
+	fingerprint := func(seed int64, stream bool) string {
+		t.Helper()
+		ts := httptest.NewServer(llmock.New(llmock.WithSeed(seed)).Handler())
+		defer ts.Close()
+		if !stream {
+			var resp llmock.ChatCompletionResponse
+			postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, &resp)
+			return resp.SystemFingerprint
+		}
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+			strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var fp string
+		for _, line := range readSSEData(t, resp) {
+			if line == "[DONE]" {
+				continue
+			}
+			var chunk struct {
+				SystemFingerprint string `json:"system_fingerprint"`
+			}
+			json.Unmarshal([]byte(line), &chunk)
+			if fp != "" && chunk.SystemFingerprint != fp {
+				t.Errorf("fingerprint changed mid-stream: %q then %q", fp, chunk.SystemFingerprint)
+			}
+			fp = chunk.SystemFingerprint
+		}
+		return fp
+	}
+
+	first := fingerprint(42, false)
+	if !strings.HasPrefix(first, "fp_") {
+		t.Fatalf("expected an fp_ fingerprint, got %q", first)
+	}
+	if again := fingerprint(42, false); again != first {
+		t.Errorf("expected the same fingerprint for the same seed, got %q and %q", first, again)
+	}
+	if streamed := fingerprint(42, true); streamed != first {
+		t.Errorf("expected streamed chunks to carry %q, got %q", first, streamed)
+	}
+	if other := fingerprint(43, false); other == first {
+		t.Errorf("expected a different fingerprint for a different seed, got %q for both", other)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	s := llmock.New(
+		llmock.WithBasePath("/api"),
+		llmock.WithAdminAPI(true),
+		llmock.WithRules(llmock.Rule{Pattern: regexp.MustCompile(`.*`), Responses: []string{"mounted"}}),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	var chat llmock.ChatCompletionResponse
+	postJSON(t, ts, "/api/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, &chat)
+	if got := chat.Choices[0].Message.Content; got != "mounted" {
+		t.Errorf("expected rule response under the prefix, got %q", got)
+	}
+
+	var gemini llmock.GeminiResponse
+	postJSON(t, ts, "/api/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`, &gemini)
+	if gemini.ModelVersion != "gemini-pro" {
+		t.Errorf("expected Gemini model from the prefixed path, got %q", gemini.ModelVersion)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/_mock/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected admin API under the prefix, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 outside the prefix, got %d", resp.StatusCode)
+	}
+}
+
+func TestWrongMethod_Returns405(t *testing.T) {
+	ts := httptest.NewServer(llmock.New().Handler())
+	defer ts.Close()
+
+	for _, path := range []string{
+		"/v1/chat/completions",
+		"/v1/messages",
+		"/v1/responses",
+		"/v1beta/models/gemini-pro:generateContent",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("GET %s: expected a JSON error body: %v", path, err)
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: expected 405, got %d", path, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Allow"); got != "POST" {
+			t.Errorf("GET %s: expected Allow: POST, got %q", path, got)
+		}
+		if _, ok := body["error"]; !ok {
+			t.Errorf("GET %s: expected a provider error body, got %v", path, body)
+		}
+	}
+}
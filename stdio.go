@@ -11,9 +11,16 @@ import (
 // on a reader/writer pair (typically stdin/stdout). It reads one JSON-RPC
 // request per line, dispatches it through the control plane, and writes the
 // response as a single line followed by a newline.
+//
+// If the server has MCP enabled, resources/subscribe,
+// resources/unsubscribe and logging/setLevel are also accepted, and MCP
+// notifications (resource updates, log messages) are written as lines.
+// Up to 64 notifications are queued while the writer is blocked; further
+// ones are dropped until the queue drains.
 type StdioTransport struct {
-	cp *controlPlane
-	mu sync.Mutex // serializes writes
+	cp  *controlPlane
+	srv *Server
+	mu  sync.Mutex // serializes writes
 }
 
 // NewStdioTransport creates a StdioTransport backed by the given Server's
@@ -23,25 +30,70 @@ func NewStdioTransport(s *Server) *StdioTransport {
 	if s.control == nil {
 		return nil
 	}
-	return &StdioTransport{cp: s.control}
+	return &StdioTransport{cp: s.control, srv: s}
 }
 
 // Run reads JSON-RPC requests from r line by line and writes responses to w.
 // It blocks until r is exhausted (EOF) or a read error occurs. The returned
-// error is nil on normal EOF.
+// error is nil on normal EOF. Queued notifications are written before Run
+// returns, and nothing is written to w afterwards.
 func (st *StdioTransport) Run(r io.Reader, w io.Writer) error {
 	scanner := bufio.NewScanner(r)
 	// Allow up to 1 MB per line for large JSON-RPC messages.
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
+	var sub *mcpSubscriber
+	if st.srv.mcp != nil {
+		// Notifications are queued and written by a separate goroutine, so
+		// whatever triggered them (like an admin API request) never blocks
+		// on a slow reader.
+		notes := make(chan jsonRPCNotification, 64)
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case n := <-notes:
+					st.writeLine(w, n)
+				case <-done:
+					// Flush whatever is still queued, then stop.
+					for {
+						select {
+						case n := <-notes:
+							st.writeLine(w, n)
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+		sub = &mcpSubscriber{notify: func(n jsonRPCNotification) {
+			select {
+			case notes <- n:
+			default: // queue full; drop
+			}
+		}}
+		st.srv.mcp.addSubscriber(sub)
+		// Unsubscribe first so nothing new is queued, then wait for the
+		// writer so it never touches w after Run returns.
+		defer func() {
+			st.srv.mcp.removeSubscriber(sub)
+			close(done)
+			wg.Wait()
+		}()
+	}
+
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		if len(line) == 0 {
 			continue // skip blank lines
 		}
 
-		resp := st.handleLine(line)
-		st.writeResponse(w, resp)
+		resp := st.handleLine(line, sub)
+		st.writeLine(w, resp)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -50,7 +102,7 @@ func (st *StdioTransport) Run(r io.Reader, w io.Writer) error {
 	return nil
 }
 
-func (st *StdioTransport) handleLine(line []byte) jsonRPCResponse {
+func (st *StdioTransport) handleLine(line []byte, sub *mcpSubscriber) jsonRPCResponse {
 	var req jsonRPCRequest
 	if err := json.Unmarshal(line, &req); err != nil {
 		return jsonRPCResponse{
@@ -73,11 +125,23 @@ func (st *StdioTransport) handleLine(line []byte) jsonRPCResponse {
 		}
 	}
 
+	if sub != nil {
+		switch req.Method {
+		case "resources/subscribe":
+			return st.srv.mcpResourcesSubscribe(req, sub, true)
+		case "resources/unsubscribe":
+			return st.srv.mcpResourcesSubscribe(req, sub, false)
+		case "logging/setLevel":
+			return st.srv.mcpSetLogLevel(req)
+		}
+	}
+
 	return st.cp.dispatch(req)
 }
 
-func (st *StdioTransport) writeResponse(w io.Writer, resp jsonRPCResponse) {
-	data, _ := json.Marshal(resp)
+// writeLine writes a JSON-RPC message as a single line.
+func (st *StdioTransport) writeLine(w io.Writer, msg any) {
+	data, _ := json.Marshal(msg)
 	st.mu.Lock()
 	defer st.mu.Unlock()
 	w.Write(data)
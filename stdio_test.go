@@ -1,11 +1,20 @@
 package llmock_test
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/shishberg/llmock"
 )
@@ -81,8 +90,8 @@ func TestStdio_ToolsList(t *testing.T) {
 	if err := json.Unmarshal(resp.Result, &result); err != nil {
 		t.Fatalf("unmarshaling result: %v", err)
 	}
-	if len(result.Tools) != 9 {
-		t.Errorf("expected 9 tools, got %d", len(result.Tools))
+	if len(result.Tools) != 21 {
+		t.Errorf("expected 21 tools, got %d", len(result.Tools))
 	}
 }
 
@@ -337,6 +346,61 @@ func TestStdio_FullWorkflow(t *testing.T) {
 	}
 }
 
+func TestStdio_SetCorpus(t *testing.T) {
+	s := llmock.New(llmock.WithResponder(llmock.NewRuleResponder([]llmock.Rule{
+		{Pattern: regexp.MustCompile(".*"), Responses: []string{"{{markov}}"}},
+	})))
+	st := llmock.NewStdioTransport(s)
+
+	corpus := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(corpus, []byte("A walrus naps. A walrus swims. A walrus eats."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp := stdioCall(t, st, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "tools/call",
+		Params: map[string]any{
+			"name":      "llmock_set_corpus",
+			"arguments": map[string]any{"file": corpus},
+		},
+	})
+	getControlToolText(t, resp)
+
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	result := chatRequest(t, ts, "tell me something")
+	if !strings.Contains(result.Choices[0].Message.Content, "walrus") {
+		t.Errorf("expected response generated from the corpus file, got %q", result.Choices[0].Message.Content)
+	}
+}
+
+func TestStdio_AddMCPTool(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{}))
+	st := llmock.NewStdioTransport(s)
+
+	resp := stdioCall(t, st, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "tools/call",
+		Params: map[string]any{
+			"name":      "llmock_add_mcp_tool",
+			"arguments": map[string]any{"name": "search", "description": "Search the web"},
+		},
+	})
+	getControlToolText(t, resp)
+
+	resp = stdioCall(t, st, jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "tools/call",
+		Params:  map[string]any{"name": "llmock_list_mcp_tools"},
+	})
+	if text := getControlToolText(t, resp); !strings.Contains(text, "search") {
+		t.Errorf("expected added MCP tool in list, got: %s", text)
+	}
+}
+
 func TestStdio_AddFaultAndClear(t *testing.T) {
 	s := llmock.New()
 	st := llmock.NewStdioTransport(s)
@@ -442,3 +506,231 @@ func TestStdio_FullReset(t *testing.T) {
 		t.Error("original rule should still exist after reset")
 	}
 }
+
+// stdioSession runs a StdioTransport over pipes so a test can interleave
+// requests with other activity and read notifications as they arrive.
+type stdioSession struct {
+	t     *testing.T
+	in    *io.PipeWriter
+	lines *bufio.Scanner
+	done  chan error
+}
+
+func startStdioSession(t *testing.T, st *llmock.StdioTransport) *stdioSession {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	ss := &stdioSession{t: t, in: inW, lines: bufio.NewScanner(outR), done: make(chan error, 1)}
+	go func() {
+		ss.done <- st.Run(inR, outW)
+		outW.Close()
+	}()
+	return ss
+}
+
+func (ss *stdioSession) send(req jsonRPCRequest) {
+	line, _ := json.Marshal(req)
+	ss.in.Write(append(line, '\n'))
+}
+
+func (ss *stdioSession) readLine() map[string]any {
+	ss.t.Helper()
+	if !ss.lines.Scan() {
+		ss.t.Fatalf("expected a line from stdio: %v", ss.lines.Err())
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(ss.lines.Bytes(), &msg); err != nil {
+		ss.t.Fatalf("decoding line %q: %v", ss.lines.Text(), err)
+	}
+	return msg
+}
+
+func (ss *stdioSession) close() {
+	ss.t.Helper()
+	ss.in.Close()
+	if err := <-ss.done; err != nil {
+		ss.t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestStdio_ResourceSubscribeNotification(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{
+		Resources: []llmock.MCPResourceConfig{{URI: "file:///status.txt", Name: "Status", Content: "ok"}},
+	}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	ss := startStdioSession(t, llmock.NewStdioTransport(s))
+
+	ss.send(jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "resources/subscribe",
+		Params: map[string]any{"uri": "file:///status.txt"},
+	})
+	if msg := ss.readLine(); msg["error"] != nil || msg["id"] != float64(1) {
+		t.Fatalf("unexpected subscribe response: %v", msg)
+	}
+
+	// Replace the resource's content through the admin API.
+	body := `{"resources": [{"uri": "file:///status.txt", "name": "Status", "content": "degraded"}]}`
+	resp, err := http.Post(ts.URL+"/_mock/mcp/resources", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	msg := ss.readLine()
+	if msg["method"] != "notifications/resources/updated" {
+		t.Fatalf("expected resources/updated notification, got %v", msg)
+	}
+	if _, hasID := msg["id"]; hasID {
+		t.Error("notification must not carry an id")
+	}
+	if params, _ := msg["params"].(map[string]any); params["uri"] != "file:///status.txt" {
+		t.Errorf("unexpected notification params: %v", msg["params"])
+	}
+	ss.close()
+}
+
+// gatedWriter records what is written to it. Writes block between block
+// and release.
+type gatedWriter struct {
+	mu       sync.Mutex
+	gate     chan struct{} // nil while open
+	buf      bytes.Buffer
+	returned bool // set once Run has returned
+	late     bool // a write happened after Run returned
+}
+
+func (g *gatedWriter) block() {
+	g.mu.Lock()
+	g.gate = make(chan struct{})
+	g.mu.Unlock()
+}
+
+func (g *gatedWriter) release() {
+	g.mu.Lock()
+	close(g.gate)
+	g.gate = nil
+	g.mu.Unlock()
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	gate := g.gate
+	g.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.returned {
+		g.late = true
+	}
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) lines() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(g.buf.String(), "\n"), "\n")
+}
+
+func TestStdio_NotificationQueueDropsWhenFull(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{
+		Resources: []llmock.MCPResourceConfig{{URI: "file:///status.txt", Name: "Status", Content: "ok"}},
+	}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	inR, inW := io.Pipe()
+	out := &gatedWriter{}
+	done := make(chan error, 1)
+	go func() {
+		err := llmock.NewStdioTransport(s).Run(inR, out)
+		out.mu.Lock()
+		out.returned = true
+		out.mu.Unlock()
+		done <- err
+	}()
+
+	line, _ := json.Marshal(jsonRPCRequest{
+		JSONRPC: "2.0", ID: 1, Method: "resources/subscribe",
+		Params: map[string]any{"uri": "file:///status.txt"},
+	})
+	inW.Write(append(line, '\n'))
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		if strings.Contains(out.lines()[0], `"id":1`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no subscribe response")
+		}
+	}
+
+	// Block the writer, then send more updates than the queue holds.
+	out.block()
+	const updates = 100
+	for i := range updates {
+		body := fmt.Sprintf(`{"resources": [{"uri": "file:///status.txt", "name": "Status", "content": "v%d"}]}`, i)
+		resp, err := http.Post(ts.URL+"/_mock/mcp/resources", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	out.release()
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	out.mu.Lock()
+	late := out.late
+	out.mu.Unlock()
+	if late {
+		t.Error("notification written after Run returned")
+	}
+	updated := 0
+	for _, l := range out.lines()[1:] {
+		if strings.Contains(l, "notifications/resources/updated") {
+			updated++
+		}
+	}
+	// 64 queued, plus at most one the writer had already taken when it blocked.
+	if updated < 64 || updated > 65 {
+		t.Errorf("got %d updated notifications, want the queue's 64 (or 65) with the rest dropped", updated)
+	}
+}
+
+func TestStdio_LoggingNotifications(t *testing.T) {
+	s := llmock.New(llmock.WithMCP(llmock.MCPConfig{
+		Tools: []llmock.MCPToolConfig{{Name: "echo", Responses: []llmock.MCPToolResponse{{Pattern: ".*", Result: "ok"}}}},
+	}))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	ss := startStdioSession(t, llmock.NewStdioTransport(s))
+
+	ss.send(jsonRPCRequest{JSONRPC: "2.0", ID: 1, Method: "logging/setLevel", Params: map[string]any{"level": "info"}})
+	if msg := ss.readLine(); msg["error"] != nil {
+		t.Fatalf("logging/setLevel rejected: %v", msg["error"])
+	}
+
+	call := mcpCall(t, ts, jsonRPCRequest{
+		JSONRPC: "2.0", ID: 2, Method: "tools/call",
+		Params: map[string]any{"name": "echo", "arguments": map[string]any{"x": 1}},
+	})
+	if call.Error != nil {
+		t.Fatalf("tools/call failed: %v", call.Error)
+	}
+
+	msg := ss.readLine()
+	if msg["method"] != "notifications/message" {
+		t.Fatalf("expected notifications/message, got %v", msg)
+	}
+	params, _ := msg["params"].(map[string]any)
+	data, _ := params["data"].(map[string]any)
+	if params["level"] != "info" || data["tool"] != "echo" {
+		t.Errorf("unexpected log params: %v", params)
+	}
+	ss.close()
+}
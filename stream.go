@@ -7,13 +7,154 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // WithTokenDelay sets the delay between streamed tokens.
 // Default is 15ms.
 func WithTokenDelay(d time.Duration) Option {
 	return func(s *Server) {
-		s.tokenDelay = d
+		s.tokenDelay.Store(int64(d))
+	}
+}
+
+// WithLatencyPerToken makes response time proportional to output length.
+// Non-streaming responses are held back for d per output token; streaming
+// responses use d as the delay between tokens in place of WithTokenDelay.
+func WithLatencyPerToken(d time.Duration) Option {
+	return func(s *Server) {
+		s.latencyPerToken = d
+	}
+}
+
+// waitForOutput holds a non-streaming response for the per-token latency
+// of its output. It returns false if the request was cancelled meanwhile.
+func (s *Server) waitForOutput(r *http.Request, outputTokens int) bool {
+	if s.latencyPerToken <= 0 || outputTokens <= 0 {
+		return true
+	}
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-time.After(s.latencyPerToken * time.Duration(outputTokens)):
+		return true
+	}
+}
+
+// WithStreamKeepAlive makes streams write an SSE comment line (": keep-alive")
+// every interval while waiting between tokens, as real providers do, so
+// idle-timeout proxies keep the connection open. SSE parsers ignore
+// comments. Off by default.
+func WithStreamKeepAlive(interval time.Duration) Option {
+	return func(s *Server) {
+		s.streamKeepAlive = interval
+	}
+}
+
+// WithStreamRunningUsage makes every chunk of an OpenAI chat text stream
+// carry a usage object with the completion tokens sent so far, as some
+// metering gateways inject. The final chunk's usage is the total. This is
+// not standard OpenAI behavior, so it is off by default.
+func WithStreamRunningUsage(on bool) Option {
+	return func(s *Server) {
+		s.streamRunningUsage = on
+	}
+}
+
+// WithStreamByteRate caps the rate at which streamed responses reach the
+// client at bytesPerSec, modelling a bandwidth-constrained link. Each
+// flush is held back in proportion to the bytes written since the last
+// one. This adds to the token delay rather than replacing it. Zero or less
+// means no cap, the default.
+func WithStreamByteRate(bytesPerSec int) Option {
+	return func(s *Server) {
+		s.streamByteRate = bytesPerSec
+	}
+}
+
+// byteRateHandler wraps h so that flushed writes are paced to the
+// configured stream byte rate.
+func (s *Server) byteRateHandler(h http.Handler) http.Handler {
+	if s.streamByteRate <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&byteRateWriter{ResponseWriter: w, r: r, rate: s.streamByteRate}, r)
+	})
+}
+
+// byteRateWriter delays each Flush by the time the bytes written since the
+// previous one would take at rate bytes per second. Responses that are
+// never flushed, such as non-streaming JSON, are not slowed.
+type byteRateWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	rate    int
+	pending int
+}
+
+func (w *byteRateWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.pending += n
+	return n, err
+}
+
+func (w *byteRateWriter) Flush() {
+	d := time.Duration(w.pending) * time.Second / time.Duration(w.rate)
+	w.pending = 0
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-w.r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *byteRateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// waitForToken sleeps for the delay between streamed tokens, writing
+// keep-alive comments meanwhile if WithStreamKeepAlive is set. It returns
+// false if the request was cancelled.
+func (s *Server) waitForToken(w http.ResponseWriter, r *http.Request) bool {
+	return s.waitForTokenKeepAlive(w, r, ": keep-alive\n\n")
+}
+
+// waitForTokenKeepAlive is like waitForToken, but writes keepAlive instead
+// of an SSE comment, for streams that aren't SSE.
+func (s *Server) waitForTokenKeepAlive(w http.ResponseWriter, r *http.Request, keepAlive string) bool {
+	if sw, ok := w.(interface{ streamStopped() bool }); ok && sw.streamStopped() {
+		return false
+	}
+	timer := time.NewTimer(s.getTokenDelay())
+	defer timer.Stop()
+	var tick <-chan time.Time
+	if s.streamKeepAlive > 0 {
+		ticker := time.NewTicker(s.streamKeepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-tick:
+			fmt.Fprint(w, keepAlive)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
 	}
 }
 
@@ -41,8 +182,25 @@ func tokenize(text string) []string {
 	return chunks
 }
 
+// tokenizeBlock is tokenize, but keeps the text's leading and trailing
+// whitespace so that consecutive blocks still concatenate correctly.
+func tokenizeBlock(text string) []string {
+	chunks := tokenize(text)
+	if len(chunks) == 0 {
+		if text == "" {
+			return nil
+		}
+		return []string{text}
+	}
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	chunks[0] = text[:len(text)-len(trimmed)] + chunks[0]
+	chunks[len(chunks)-1] += trimmed[len(strings.TrimRightFunc(trimmed, unicode.IsSpace)):]
+	return chunks
+}
+
 // streamOpenAI writes the response as OpenAI-format SSE chunks.
-func (s *Server) streamOpenAI(w http.ResponseWriter, r *http.Request, responseText, model, id string) {
+// promptTokens is only reported with WithStreamRunningUsage.
+func (s *Server) streamOpenAI(w http.ResponseWriter, r *http.Request, responseText, model, id, finishReason string, promptTokens int) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, "streaming not supported")
@@ -54,9 +212,15 @@ func (s *Server) streamOpenAI(w http.ResponseWriter, r *http.Request, responseTe
 	w.Header().Set("Connection", "keep-alive")
 
 	chunks := tokenize(responseText)
-	created := time.Now().Unix()
+	created := s.now().Unix()
+	var sent strings.Builder
+	usage := func() Usage {
+		completion := countTokens(sent.String())
+		return Usage{PromptTokens: promptTokens, CompletionTokens: completion, TotalTokens: promptTokens + completion}
+	}
 
 	for i, chunk := range chunks {
+		sent.WriteString(chunk)
 		delta := map[string]any{}
 		if i == 0 {
 			delta["role"] = "assistant"
@@ -64,10 +228,11 @@ func (s *Server) streamOpenAI(w http.ResponseWriter, r *http.Request, responseTe
 		delta["content"] = chunk
 
 		event := map[string]any{
-			"id":      id,
-			"object":  "chat.completion.chunk",
-			"created": created,
-			"model":   model,
+			"id":                 id,
+			"object":             "chat.completion.chunk",
+			"created":            created,
+			"model":              model,
+			"system_fingerprint": s.fingerprint,
 			"choices": []map[string]any{
 				{
 					"index":         0,
@@ -76,41 +241,48 @@ func (s *Server) streamOpenAI(w http.ResponseWriter, r *http.Request, responseTe
 				},
 			},
 		}
+		if s.streamRunningUsage {
+			event["usage"] = usage()
+		}
 		data, _ := json.Marshal(event)
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
 
 		if i < len(chunks)-1 {
-			select {
-			case <-r.Context().Done():
+			if !s.waitForToken(w, r) {
 				return
-			case <-time.After(s.getTokenDelay()):
 			}
 		}
 	}
 
 	// Final chunk with finish_reason
 	finalEvent := map[string]any{
-		"id":      id,
-		"object":  "chat.completion.chunk",
-		"created": created,
-		"model":   model,
+		"id":                 id,
+		"object":             "chat.completion.chunk",
+		"created":            created,
+		"model":              model,
+		"system_fingerprint": s.fingerprint,
 		"choices": []map[string]any{
 			{
 				"index":         0,
 				"delta":         map[string]any{},
-				"finish_reason": "stop",
+				"finish_reason": finishReason,
 			},
 		},
 	}
+	if s.streamRunningUsage {
+		finalEvent["usage"] = usage()
+	}
 	data, _ := json.Marshal(finalEvent)
 	fmt.Fprintf(w, "data: %s\n\n", data)
 	fmt.Fprintf(w, "data: [DONE]\n\n")
 	flusher.Flush()
 }
 
-// streamAnthropic writes the response as Anthropic-format SSE events.
-func (s *Server) streamAnthropic(w http.ResponseWriter, r *http.Request, responseText, model, id string, inputTokens int) {
+// streamAnthropic writes the response as Anthropic-format SSE events, one
+// text content block per element of blocks.
+// stopSequence, if set, is reported in the message_delta event.
+func (s *Server) streamAnthropic(w http.ResponseWriter, r *http.Request, blocks []string, model, id string, inputTokens int, stopReason string, stopSequence *string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, "streaming not supported")
@@ -121,7 +293,7 @@ func (s *Server) streamAnthropic(w http.ResponseWriter, r *http.Request, respons
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	outputTokens := countTokens(responseText)
+	outputTokens := countTokens(strings.Join(blocks, ""))
 
 	// message_start
 	msgStart := map[string]any{
@@ -143,52 +315,16 @@ func (s *Server) streamAnthropic(w http.ResponseWriter, r *http.Request, respons
 	writeSSE(w, "message_start", msgStart)
 	flusher.Flush()
 
-	// content_block_start
-	blockStart := map[string]any{
-		"type":          "content_block_start",
-		"index":         0,
-		"content_block": map[string]any{"type": "text", "text": ""},
-	}
-	writeSSE(w, "content_block_start", blockStart)
-	flusher.Flush()
-
-	// content_block_delta events
-	chunks := tokenize(responseText)
-	for i, chunk := range chunks {
-		delta := map[string]any{
-			"type":  "content_block_delta",
-			"index": 0,
-			"delta": map[string]any{
-				"type": "text_delta",
-				"text": chunk,
-			},
-		}
-		writeSSE(w, "content_block_delta", delta)
-		flusher.Flush()
-
-		if i < len(chunks)-1 {
-			select {
-			case <-r.Context().Done():
-				return
-			case <-time.After(s.getTokenDelay()):
-			}
-		}
-	}
-
-	// content_block_stop
-	blockStop := map[string]any{
-		"type":  "content_block_stop",
-		"index": 0,
+	if !s.streamAnthropicTextBlocks(w, r, flusher, blocks) {
+		return
 	}
-	writeSSE(w, "content_block_stop", blockStop)
-	flusher.Flush()
 
 	// message_delta
 	msgDelta := map[string]any{
 		"type": "message_delta",
 		"delta": map[string]any{
-			"stop_reason":   "end_turn",
-			"stop_sequence": nil,
+			"stop_reason":   stopReason,
+			"stop_sequence": stopSequence,
 		},
 		"usage": map[string]any{
 			"output_tokens": outputTokens,
@@ -210,8 +346,53 @@ func writeSSE(w http.ResponseWriter, event string, data any) {
 	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
 }
 
-// streamOpenAIToolCall streams a tool call response in OpenAI format.
-func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, toolCalls []ToolCall, model, id string) {
+// streamAnthropicTextBlocks writes each of blocks as a text content block
+// at indexes 0..len(blocks)-1. Each block gets its own content_block_start
+// and stop pair; clients concatenate the blocks' text. It returns false if
+// the client went away.
+func (s *Server) streamAnthropicTextBlocks(w http.ResponseWriter, r *http.Request, flusher http.Flusher, blocks []string) bool {
+	for i, text := range blocks {
+		blockStart := map[string]any{
+			"type":          "content_block_start",
+			"index":         i,
+			"content_block": map[string]any{"type": "text", "text": ""},
+		}
+		writeSSE(w, "content_block_start", blockStart)
+		flusher.Flush()
+
+		chunks := tokenizeBlock(text)
+		for j, chunk := range chunks {
+			delta := map[string]any{
+				"type":  "content_block_delta",
+				"index": i,
+				"delta": map[string]any{
+					"type": "text_delta",
+					"text": chunk,
+				},
+			}
+			writeSSE(w, "content_block_delta", delta)
+			flusher.Flush()
+
+			if i < len(blocks)-1 || j < len(chunks)-1 {
+				if !s.waitForToken(w, r) {
+					return false
+				}
+			}
+		}
+
+		blockStop := map[string]any{
+			"type":  "content_block_stop",
+			"index": i,
+		}
+		writeSSE(w, "content_block_stop", blockStop)
+		flusher.Flush()
+	}
+	return true
+}
+
+// streamOpenAIToolCall streams a tool call response in OpenAI format. Any
+// text is streamed as content deltas before the tool calls.
+func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, text string, toolCalls []ToolCall, model, id string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, "streaming not supported")
@@ -222,7 +403,36 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	created := time.Now().Unix()
+	created := s.now().Unix()
+
+	textChunks := tokenize(text)
+	for i, chunk := range textChunks {
+		delta := map[string]any{"content": chunk}
+		if i == 0 {
+			delta["role"] = "assistant"
+		}
+		event := map[string]any{
+			"id":                 id,
+			"object":             "chat.completion.chunk",
+			"created":            created,
+			"model":              model,
+			"system_fingerprint": s.fingerprint,
+			"choices": []map[string]any{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": nil,
+				},
+			},
+		}
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+
+		if !s.waitForToken(w, r) {
+			return
+		}
+	}
 
 	for i, tc := range toolCalls {
 		argsJSON, _ := json.Marshal(tc.Arguments)
@@ -242,15 +452,16 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 				},
 			},
 		}
-		if i == 0 {
+		if i == 0 && len(textChunks) == 0 {
 			delta["role"] = "assistant"
 		}
 
 		event := map[string]any{
-			"id":      id,
-			"object":  "chat.completion.chunk",
-			"created": created,
-			"model":   model,
+			"id":                 id,
+			"object":             "chat.completion.chunk",
+			"created":            created,
+			"model":              model,
+			"system_fingerprint": s.fingerprint,
 			"choices": []map[string]any{
 				{
 					"index":         0,
@@ -263,9 +474,10 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
 
-		// Stream the arguments in chunks.
-		chunks := splitString(argsStr, 20)
-		for _, chunk := range chunks {
+		// Stream the arguments as small fragments, as real clients have to
+		// accumulate partial JSON.
+		chunks := splitString(argsStr, toolArgChunkSize)
+		for j, chunk := range chunks {
 			argDelta := map[string]any{
 				"tool_calls": []map[string]any{
 					{
@@ -277,10 +489,11 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 				},
 			}
 			argEvent := map[string]any{
-				"id":      id,
-				"object":  "chat.completion.chunk",
-				"created": created,
-				"model":   model,
+				"id":                 id,
+				"object":             "chat.completion.chunk",
+				"created":            created,
+				"model":              model,
+				"system_fingerprint": s.fingerprint,
 				"choices": []map[string]any{
 					{
 						"index":         0,
@@ -293,20 +506,22 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
 
-			select {
-			case <-r.Context().Done():
+			if j == len(chunks)-1 {
+				break
+			}
+			if !s.waitForToken(w, r) {
 				return
-			case <-time.After(s.getTokenDelay()):
 			}
 		}
 	}
 
 	// Final chunk with finish_reason.
 	finalEvent := map[string]any{
-		"id":      id,
-		"object":  "chat.completion.chunk",
-		"created": created,
-		"model":   model,
+		"id":                 id,
+		"object":             "chat.completion.chunk",
+		"created":            created,
+		"model":              model,
+		"system_fingerprint": s.fingerprint,
 		"choices": []map[string]any{
 			{
 				"index":         0,
@@ -322,7 +537,8 @@ func (s *Server) streamOpenAIToolCall(w http.ResponseWriter, r *http.Request, to
 }
 
 // streamAnthropicToolCall streams a tool call response in Anthropic format.
-func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request, toolCalls []ToolCall, model, id string, inputTokens int) {
+// Any text blocks come first, and the tool_use blocks follow them.
+func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request, blocks []string, toolCalls []ToolCall, model, id string, inputTokens int) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, "streaming not supported")
@@ -353,13 +569,20 @@ func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request,
 	writeSSE(w, "message_start", msgStart)
 	flusher.Flush()
 
+	if len(blocks) > 0 {
+		if !s.streamAnthropicTextBlocks(w, r, flusher, blocks) || !s.waitForToken(w, r) {
+			return
+		}
+	}
+
 	for i, tc := range toolCalls {
-		tcID := generateToolCallID("toolu_")
+		tcID := s.toolCallID("toolu_")
+		index := len(blocks) + i
 
 		// content_block_start for tool_use
 		blockStart := map[string]any{
 			"type":  "content_block_start",
-			"index": i,
+			"index": index,
 			"content_block": map[string]any{
 				"type":  "tool_use",
 				"id":    tcID,
@@ -370,13 +593,14 @@ func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request,
 		writeSSE(w, "content_block_start", blockStart)
 		flusher.Flush()
 
-		// Stream input JSON as deltas.
+		// Stream input JSON as input_json_delta fragments; clients
+		// concatenate partial_json and parse it at content_block_stop.
 		argsJSON, _ := json.Marshal(tc.Arguments)
-		chunks := splitString(string(argsJSON), 20)
-		for _, chunk := range chunks {
+		chunks := splitString(string(argsJSON), toolArgChunkSize)
+		for j, chunk := range chunks {
 			delta := map[string]any{
 				"type":  "content_block_delta",
-				"index": i,
+				"index": index,
 				"delta": map[string]any{
 					"type":         "input_json_delta",
 					"partial_json": chunk,
@@ -385,17 +609,18 @@ func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request,
 			writeSSE(w, "content_block_delta", delta)
 			flusher.Flush()
 
-			select {
-			case <-r.Context().Done():
+			if j == len(chunks)-1 {
+				break
+			}
+			if !s.waitForToken(w, r) {
 				return
-			case <-time.After(s.getTokenDelay()):
 			}
 		}
 
 		// content_block_stop
 		blockStop := map[string]any{
 			"type":  "content_block_stop",
-			"index": i,
+			"index": index,
 		}
 		writeSSE(w, "content_block_stop", blockStop)
 		flusher.Flush()
@@ -409,7 +634,7 @@ func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request,
 			"stop_sequence": nil,
 		},
 		"usage": map[string]any{
-			"output_tokens": 5,
+			"output_tokens": 5 + countTokens(strings.Join(blocks, "")),
 		},
 	}
 	writeSSE(w, "message_delta", msgDelta)
@@ -423,7 +648,12 @@ func (s *Server) streamAnthropicToolCall(w http.ResponseWriter, r *http.Request,
 	flusher.Flush()
 }
 
-// splitString splits s into chunks of at most n bytes.
+// toolArgChunkSize is the size in bytes of each streamed tool-call
+// argument fragment.
+const toolArgChunkSize = 8
+
+// splitString splits s into chunks of at most n bytes, never splitting a
+// UTF-8 sequence (a single rune longer than n gets a chunk of its own).
 func splitString(s string, n int) []string {
 	if len(s) == 0 {
 		return nil
@@ -434,15 +664,25 @@ func splitString(s string, n int) []string {
 			chunks = append(chunks, s)
 			break
 		}
-		chunks = append(chunks, s[:n])
-		s = s[n:]
+		end := n
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(s)
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
 	}
 	return chunks
 }
 
 func (s *Server) getTokenDelay() time.Duration {
-	if s.tokenDelay > 0 {
-		return s.tokenDelay
+	if s.latencyPerToken > 0 {
+		return s.latencyPerToken
+	}
+	if d := time.Duration(s.tokenDelay.Load()); d > 0 {
+		return d
 	}
 	return 15 * time.Millisecond
 }
@@ -3,8 +3,10 @@ package llmock_test
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -472,3 +474,281 @@ func TestStreamOpenAI_ConsistentID(t *testing.T) {
 		}
 	}
 }
+
+func TestStream_KeepAliveComments(t *testing.T) {
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithTokenDelay(50*time.Millisecond),
+		llmock.WithStreamKeepAlive(10*time.Millisecond),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"one two three four five six seven"}]}`
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	comments := 0
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			comments++
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if comments == 0 {
+		t.Error("expected keep-alive comments between delayed tokens")
+	}
+	if got := content.String(); got != "one two three four five six seven" {
+		t.Errorf("expected content intact despite comments, got %q", got)
+	}
+}
+
+func TestAnthropic_StopSequence(t *testing.T) {
+	ts := newTestServerWithRules(t, llmock.Rule{
+		Pattern:   regexp.MustCompile(`.*`),
+		Responses: []string{"Step one. END Step two. STOP"},
+	})
+	defer ts.Close()
+
+	body := `{"model":"claude-3","max_tokens":100,"stop_sequences":["STOP","END"],` +
+		`"messages":[{"role":"user","content":"steps"}]%s}`
+
+	var result llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", fmt.Sprintf(body, ""), &result)
+	if result.StopReason != "stop_sequence" {
+		t.Errorf("expected stop_reason stop_sequence, got %q", result.StopReason)
+	}
+	if result.StopSequence == nil || *result.StopSequence != "END" {
+		t.Errorf("expected stop_sequence END, got %v", result.StopSequence)
+	}
+	if got := result.Content[0].Text; got != "Step one. " {
+		t.Errorf("expected text cut before the stop sequence, got %q", got)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(fmt.Sprintf(body, `,"stream":true`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for _, ev := range readSSEEvents(t, resp) {
+		if ev.Event != "message_delta" {
+			continue
+		}
+		var delta struct {
+			Delta struct {
+				StopReason   string  `json:"stop_reason"`
+				StopSequence *string `json:"stop_sequence"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &delta); err != nil {
+			t.Fatal(err)
+		}
+		if delta.Delta.StopReason != "stop_sequence" || delta.Delta.StopSequence == nil || *delta.Delta.StopSequence != "END" {
+			t.Errorf("unexpected message_delta: %s", ev.Data)
+		}
+		return
+	}
+	t.Fatal("message_delta event not found")
+}
+
+func TestAnthropic_MultipleContentBlocks(t *testing.T) {
+	ts := newTestServerWithRules(t, llmock.Rule{
+		Pattern: regexp.MustCompile(`.*`),
+		Blocks:  []string{"First part. ", "Second part."},
+	})
+	defer ts.Close()
+
+	body := `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"parts"}]%s}`
+
+	var result llmock.AnthropicResponse
+	postJSON(t, ts, "/v1/messages", fmt.Sprintf(body, ""), &result)
+	if len(result.Content) != 2 || result.Content[0].Text != "First part. " || result.Content[1].Text != "Second part." {
+		t.Errorf("unexpected content blocks: %+v", result.Content)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(fmt.Sprintf(body, `,"stream":true`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var starts, stops []int
+	texts := map[int]string{}
+	var full strings.Builder
+	for _, ev := range readSSEEvents(t, resp) {
+		var data struct {
+			Index int `json:"index"`
+			Delta struct {
+				Text string `json:"text"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+			t.Fatal(err)
+		}
+		switch ev.Event {
+		case "content_block_start":
+			starts = append(starts, data.Index)
+		case "content_block_delta":
+			texts[data.Index] += data.Delta.Text
+			full.WriteString(data.Delta.Text)
+		case "content_block_stop":
+			stops = append(stops, data.Index)
+		}
+	}
+	if fmt.Sprint(starts) != "[0 1]" || fmt.Sprint(stops) != "[0 1]" {
+		t.Errorf("expected blocks 0 and 1 to start and stop, got starts %v stops %v", starts, stops)
+	}
+	if texts[0] != "First part. " || texts[1] != "Second part." {
+		t.Errorf("unexpected block texts: %q", texts)
+	}
+	if got := full.String(); got != "First part. Second part." {
+		t.Errorf("expected reconstructed text %q, got %q", "First part. Second part.", got)
+	}
+}
+
+func TestRules_PreambleStreamsBeforeAnswer(t *testing.T) {
+	ts := newTestServerWithRules(t, llmock.Rule{
+		Pattern:   regexp.MustCompile(`.*`),
+		Preamble:  "Let me think about this. --- ",
+		Responses: []string{"The answer is 42."},
+	})
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"question"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	for _, line := range readSSEData(t, resp) {
+		if line == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk.Choices) > 0 {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	got := content.String()
+	preamble, answer := strings.Index(got, "Let me think about this. ---"), strings.Index(got, "The answer is 42.")
+	if preamble < 0 || answer < 0 || preamble > answer {
+		t.Errorf("expected preamble then answer in streamed content, got %q", got)
+	}
+}
+
+func TestStreamRunningUsage(t *testing.T) {
+	s := llmock.New(
+		llmock.WithResponder(llmock.EchoResponder{}),
+		llmock.WithTokenDelay(0),
+		llmock.WithStreamRunningUsage(true),
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	text := "one two three four five six seven eight nine ten eleven twelve"
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"`+text+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var counts []int
+	for _, line := range readSSEData(t, resp) {
+		if line == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Usage *llmock.Usage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Usage == nil {
+			t.Fatalf("expected usage on every chunk, got %s", line)
+		}
+		if chunk.Usage.TotalTokens != chunk.Usage.PromptTokens+chunk.Usage.CompletionTokens {
+			t.Errorf("inconsistent usage %+v", *chunk.Usage)
+		}
+		counts = append(counts, chunk.Usage.CompletionTokens)
+	}
+	if len(counts) < 3 {
+		t.Fatalf("expected several chunks, got %d", len(counts))
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] < counts[i-1] {
+			t.Errorf("completion tokens decreased: %v", counts)
+		}
+	}
+	if counts[0] >= counts[len(counts)-1] {
+		t.Errorf("expected usage to grow across chunks, got %v", counts)
+	}
+	var full llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"`+text+`"}]}`, &full)
+	if want := full.Usage.CompletionTokens; counts[len(counts)-1] != want {
+		t.Errorf("expected final completion tokens %d, got %d", want, counts[len(counts)-1])
+	}
+}
+
+func TestStreamByteRate(t *testing.T) {
+	const rate = 20000
+	s := llmock.New(llmock.WithResponder(llmock.EchoResponder{}), llmock.WithTokenDelay(0), llmock.WithStreamByteRate(rate))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := fmt.Sprintf(`{"model":"test","stream":true,"messages":[{"role":"user","content":%q}]}`,
+		strings.Repeat("bandwidth ", 100))
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf strings.Builder
+	if _, err := bufio.NewReader(resp.Body).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	// Everything up to the final flush is paced, so the whole body takes at
+	// least its size at the configured rate.
+	want := time.Duration(buf.Len()) * time.Second / rate
+	if want < 500*time.Millisecond {
+		t.Fatalf("stream too small to measure: %d bytes", buf.Len())
+	}
+	if elapsed < want {
+		t.Errorf("streamed %d bytes in %v, want at least %v at %d bytes/s", buf.Len(), elapsed, want, rate)
+	}
+}
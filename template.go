@@ -0,0 +1,79 @@
+package llmock
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateResponder answers every request by executing a text/template.
+// The template sees a TemplateData value, so
+//
+//	You said {{.Input}} ({{len .Messages}} turns)
+//
+// echoes the input along with the conversation length. Besides the
+// text/template builtins, the functions upper, lower, and now (the server
+// clock) are available.
+type TemplateResponder struct {
+	tmpl  *template.Template
+	clock func() time.Time // set by New; nil means time.Now
+}
+
+// TemplateData is the value a TemplateResponder's template is executed with.
+type TemplateData struct {
+	Messages    []InternalMessage
+	Input       string // the last user message
+	Model       string
+	Temperature *float64
+	MaxTokens   *int
+	Stream      bool
+}
+
+// NewTemplateResponder parses text into a TemplateResponder.
+func NewTemplateResponder(text string) (*TemplateResponder, error) {
+	t := &TemplateResponder{}
+	tmpl, err := template.New("responder").Funcs(template.FuncMap{
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"now":   t.now,
+	}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response template: %w", err)
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+func (t *TemplateResponder) now() time.Time {
+	if t.clock != nil {
+		return t.clock()
+	}
+	return time.Now()
+}
+
+// Respond executes the template with the messages and no request model.
+func (t *TemplateResponder) Respond(messages []InternalMessage) (Response, error) {
+	return t.RespondWithContext(RespondContext{Messages: messages})
+}
+
+// RespondWithContext executes the template with the full request context.
+func (t *TemplateResponder) RespondWithContext(ctx RespondContext) (Response, error) {
+	input := extractInput(ctx.Messages)
+	if input == "" {
+		return Response{}, errNoMessages
+	}
+	var b strings.Builder
+	err := t.tmpl.Execute(&b, TemplateData{
+		Messages:    ctx.Messages,
+		Input:       input,
+		Model:       ctx.Model,
+		Temperature: ctx.Temperature,
+		MaxTokens:   ctx.MaxTokens,
+		Stream:      ctx.Stream,
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("executing response template: %w", err)
+	}
+	return Response{Text: b.String()}, nil
+}
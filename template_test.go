@@ -0,0 +1,48 @@
+package llmock_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+func TestTemplateResponder_TurnCount(t *testing.T) {
+	cfg, err := llmock.ParseConfig([]byte(`
+responder:
+  name: template
+  options:
+    template: "You said {{upper .Input}} ({{len .Messages}} turns, {{.Model}})"
+`), "test.yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	opts, err := cfg.ToOptions()
+	if err != nil {
+		t.Fatalf("ToOptions: %v", err)
+	}
+	ts := httptest.NewServer(llmock.New(opts...).Handler())
+	defer ts.Close()
+
+	var resp llmock.ChatCompletionResponse
+	postJSON(t, ts, "/v1/chat/completions",
+		`{"model":"gpt-4","messages":[{"role":"system","content":"be terse"},{"role":"user","content":"hi"}]}`, &resp)
+	if got, want := resp.Choices[0].Message.Content, "You said HI (2 turns, gpt-4)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTemplateResponder_Errors(t *testing.T) {
+	if _, err := llmock.NewTemplateResponder("{{.Input"); err == nil {
+		t.Error("expected a parse error")
+	}
+	tr, err := llmock.NewTemplateResponder("{{.Nope}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.Respond([]llmock.InternalMessage{{Role: "user", Content: "hi"}})
+	if err == nil || !strings.Contains(err.Error(), "executing response template") {
+		t.Errorf("expected an execution error, got %v", err)
+	}
+}
@@ -21,9 +21,19 @@ type ToolCall struct {
 
 // Response is the result from a Responder. It carries either text content
 // or one or more tool calls (but not both).
+//
+// FinishReason, if set, overrides the stop reason reported for a text
+// response. It uses OpenAI's values (see Rule.FinishReason); other APIs
+// report their equivalent.
+//
+// Blocks, if set, splits Text into parts that Anthropic responses return
+// as separate text content blocks. Text must equal the parts joined.
 type Response struct {
-	Text      string
-	ToolCalls []ToolCall
+	Text         string
+	ToolCalls    []ToolCall
+	FinishReason string
+	Blocks       []string
+	Media        *MediaConfig
 }
 
 // IsToolCall returns true if this response contains tool calls.
@@ -31,6 +41,18 @@ func (r Response) IsToolCall() bool {
 	return len(r.ToolCalls) > 0
 }
 
+// textBlocks returns the response's text as content parts: its Blocks if
+// set, otherwise its Text as one part, or nil if it has no text.
+func (r Response) textBlocks() []string {
+	if len(r.Blocks) > 0 {
+		return r.Blocks
+	}
+	if r.Text == "" {
+		return nil
+	}
+	return []string{r.Text}
+}
+
 // RequestTool describes a tool definition provided in the API request.
 type RequestTool struct {
 	Name       string
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -361,6 +362,77 @@ func TestToolCall_OpenAI_StreamingToolCall(t *testing.T) {
 	}
 }
 
+func TestToolCall_OpenAI_StreamingArgumentFragments(t *testing.T) {
+	rules := []llmock.Rule{
+		{
+			Pattern: regexp.MustCompile(`.*weather.*`),
+			ToolCall: &llmock.ToolCallConfig{
+				Name:      "get_weather",
+				Arguments: map[string]any{"location": "Zürich, Schweiz", "unit": "celsius"},
+			},
+		},
+	}
+	ts := newToolCallServer(t, rules...)
+	defer ts.Close()
+
+	body := `{
+		"model": "gpt-4",
+		"stream": true,
+		"messages": [{"role": "user", "content": "weather?"}],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {}}}]
+	}`
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var args strings.Builder
+	fragments := 0
+	var lastFinish any
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") || line == "data: [DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Function struct {
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason any `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			t.Fatalf("failed to parse chunk: %v", err)
+		}
+		for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+			if tc.Function.Arguments != "" {
+				args.WriteString(tc.Function.Arguments)
+				fragments++
+			}
+		}
+		lastFinish = chunk.Choices[0].FinishReason
+	}
+
+	if fragments < 3 {
+		t.Errorf("expected arguments split across several deltas, got %d", fragments)
+	}
+	if lastFinish != "tool_calls" {
+		t.Errorf("expected final finish_reason 'tool_calls', got %v", lastFinish)
+	}
+	want := `{"location":"Zürich, Schweiz","unit":"celsius"}`
+	if args.String() != want {
+		t.Errorf("reconstructed arguments = %q, want %q", args.String(), want)
+	}
+}
+
 func TestToolCall_Anthropic_StreamingToolCall(t *testing.T) {
 	rules := []llmock.Rule{
 		{
@@ -453,6 +525,73 @@ func TestToolCall_Anthropic_StreamingToolCall(t *testing.T) {
 	}
 }
 
+func TestToolCall_Anthropic_StreamingInputJSONDelta(t *testing.T) {
+	args := map[string]any{"location": "Berlin, Germany", "days": float64(3), "units": "metric"}
+	rules := []llmock.Rule{
+		{
+			Pattern:  regexp.MustCompile(`.*weather.*`),
+			ToolCall: &llmock.ToolCallConfig{Name: "get_forecast", Arguments: args},
+		},
+	}
+	ts := newToolCallServer(t, rules...)
+	defer ts.Close()
+
+	body := `{
+		"model": "claude-3-opus",
+		"max_tokens": 1024,
+		"stream": true,
+		"messages": [{"role": "user", "content": "weather?"}],
+		"tools": [{"name": "get_forecast", "input_schema": {"type": "object"}}]
+	}`
+
+	resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var partial strings.Builder
+	fragments := 0
+	inBlock, stopped := false, false
+	for _, ev := range readSSEEvents(t, resp) {
+		switch ev.Event {
+		case "content_block_start":
+			inBlock = true
+		case "content_block_stop":
+			inBlock, stopped = false, true
+		case "content_block_delta":
+			var d struct {
+				Delta struct {
+					Type        string `json:"type"`
+					PartialJSON string `json:"partial_json"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(ev.Data), &d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Delta.Type != "input_json_delta" {
+				t.Errorf("expected input_json_delta, got %q", d.Delta.Type)
+			}
+			if !inBlock || stopped {
+				t.Error("input_json_delta outside content_block_start/stop")
+			}
+			partial.WriteString(d.Delta.PartialJSON)
+			fragments++
+		}
+	}
+
+	if fragments < 3 {
+		t.Errorf("expected input split across several fragments, got %d", fragments)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(partial.String()), &got); err != nil {
+		t.Fatalf("concatenated partial_json %q does not parse: %v", partial.String(), err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("reconstructed input = %v, want %v", got, args)
+	}
+}
+
 func TestToolCall_NoToolsInRequest_StillReturnsToolCall(t *testing.T) {
 	// When no tools are in the request, a tool call rule still matches
 	// but the server should still produce the tool call (no filtering needed
@@ -883,3 +1022,119 @@ func TestToolCall_MaxCalls_ResetRestoresCounter(t *testing.T) {
 		t.Fatalf("after reset: expected 'tool_calls', got %q", r3.Choices[0].FinishReason)
 	}
 }
+
+func TestToolCall_SeededIDsAreReproducible(t *testing.T) {
+	rule := llmock.Rule{
+		Pattern:  regexp.MustCompile(`weather`),
+		ToolCall: &llmock.ToolCallConfig{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}},
+	}
+	openaiBody := `{"model":"gpt-4","messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`
+	anthropicBody := `{"model":"claude","max_tokens":100,"messages":[{"role":"user","content":"weather?"}],
+		"tools":[{"name":"get_weather","input_schema":{"type":"object"}}]}`
+
+	// toolCallIDs returns the OpenAI and Anthropic tool call ids from a fresh
+	// server with the given seed.
+	toolCallIDs := func(seed int64) [2]string {
+		ts := httptest.NewServer(llmock.New(llmock.WithRules(rule), llmock.WithSeed(seed)).Handler())
+		defer ts.Close()
+
+		var openai struct {
+			Choices []struct {
+				Message struct {
+					ToolCalls []struct {
+						ID string `json:"id"`
+					} `json:"tool_calls"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(openaiBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&openai)
+		resp.Body.Close()
+
+		var anthropic struct {
+			Content []struct {
+				ID string `json:"id"`
+			} `json:"content"`
+		}
+		resp, err = http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(anthropicBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&anthropic)
+		resp.Body.Close()
+		return [2]string{openai.Choices[0].Message.ToolCalls[0].ID, anthropic.Content[0].ID}
+	}
+
+	first, second := toolCallIDs(7), toolCallIDs(7)
+	if first != second {
+		t.Errorf("expected identical ids under the same seed, got %v and %v", first, second)
+	}
+	if !strings.HasPrefix(first[0], "call_") || !strings.HasPrefix(first[1], "toolu_") {
+		t.Errorf("expected call_ and toolu_ prefixes, got %v", first)
+	}
+	if other := toolCallIDs(8); other == first {
+		t.Errorf("expected a different seed to give different ids, got %v", other)
+	}
+}
+
+func TestToolCall_TextAndToolCallTogether(t *testing.T) {
+	ts := newToolCallServer(t, llmock.Rule{
+		Pattern:      regexp.MustCompile(`weather in (\w+)`),
+		Responses:    []string{"Let me check the weather in $1."},
+		ToolCall:     &llmock.ToolCallConfig{Name: "get_weather", Arguments: map[string]any{"location": "$1"}},
+		ToolCallText: true,
+	})
+	defer ts.Close()
+	const want = "Let me check the weather in Paris."
+
+	t.Run("openai", func(t *testing.T) {
+		var out llmock.ChatCompletionResponse
+		postJSON(t, ts, "/v1/chat/completions", `{"model":"gpt-4","messages":[{"role":"user","content":"weather in Paris"}]}`, &out)
+		msg := out.Choices[0].Message
+		if msg.Content != want {
+			t.Errorf("content = %q, want %q", msg.Content, want)
+		}
+		if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "get_weather" {
+			t.Errorf("tool_calls = %+v, want one get_weather call", msg.ToolCalls)
+		}
+		if out.Choices[0].FinishReason != "tool_calls" {
+			t.Errorf("finish_reason = %q, want tool_calls", out.Choices[0].FinishReason)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		var out llmock.AnthropicResponse
+		postJSON(t, ts, "/v1/messages", `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"weather in Paris"}]}`, &out)
+		if len(out.Content) != 2 {
+			t.Fatalf("got %d content blocks, want 2: %+v", len(out.Content), out.Content)
+		}
+		if out.Content[0].Type != "text" || out.Content[0].Text != want {
+			t.Errorf("first block = %+v, want text %q", out.Content[0], want)
+		}
+		if out.Content[1].Type != "tool_use" || out.Content[1].Name != "get_weather" {
+			t.Errorf("second block = %+v, want get_weather tool_use", out.Content[1])
+		}
+		if out.StopReason != "tool_use" {
+			t.Errorf("stop_reason = %q, want tool_use", out.StopReason)
+		}
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		var out llmock.GeminiResponse
+		postJSON(t, ts, "/v1beta/models/gemini-pro:generateContent", `{"contents":[{"role":"user","parts":[{"text":"weather in Paris"}]}]}`, &out)
+		parts := out.Candidates[0].Content.Parts
+		if len(parts) != 2 {
+			t.Fatalf("got %d parts, want 2: %+v", len(parts), parts)
+		}
+		if parts[0].Text != want {
+			t.Errorf("first part text = %q, want %q", parts[0].Text, want)
+		}
+		if parts[1].FunctionCall == nil || parts[1].FunctionCall.Name != "get_weather" {
+			t.Errorf("second part = %+v, want get_weather functionCall", parts[1])
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package llmock
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// templateTransforms are the ${name:...} transforms a response template
+// may use in addition to $N and ${input}:
+//
+//	${replace:SRC:/regex/replacement/}  regex replace within SRC
+//	${match:regex}                      first group (or whole match) of regex in the input
+//	${upper:SRC}, ${lower:SRC}          change case of SRC
+//	${trim:SRC}                         strip surrounding whitespace from SRC
+//	${turn:N}                           the Nth user message of the conversation
+//
+// SRC is a capture group reference ($1 to $9) or "input". A "/" inside a
+// replace pattern or replacement is written as "\/". Turn N counts user
+// messages from 0 for the first; negative N counts back from the latest,
+// so ${turn:-1} is the input and ${turn:-2} the user message before it.
+// Turns out of range expand to "".
+var templateTransforms = []string{"replace", "match", "upper", "lower", "trim", "turn"}
+
+// templateTransform is a parsed ${name:...} transform.
+type templateTransform struct {
+	name   string
+	source string         // "$N" or "input"; unused by match
+	re     *regexp.Regexp // replace and match
+	repl   string         // replace
+	turn   int            // turn
+}
+
+// parseTransform parses a transform at the start of s. ok is false if s
+// does not start with a known transform name; err is set if it does but
+// the transform is malformed. n is the length of s consumed.
+func parseTransform(s string) (t templateTransform, n int, ok bool, err error) {
+	if !strings.HasPrefix(s, "${") {
+		return t, 0, false, nil
+	}
+	colon := strings.IndexByte(s, ':')
+	if colon < 0 || !slices.Contains(templateTransforms, s[2:colon]) {
+		return t, 0, false, nil
+	}
+	t.name = s[2:colon]
+	body := colon + 1
+
+	switch t.name {
+	case "match":
+		end := closingBrace(s, body)
+		if end < 0 {
+			return t, 0, true, fmt.Errorf("unterminated ${match:...}")
+		}
+		t.re, err = regexp.Compile(s[body:end])
+		if err != nil {
+			return t, 0, true, fmt.Errorf("${match:...}: %w", err)
+		}
+		return t, end + 1, true, nil
+
+	case "replace":
+		sep := strings.IndexByte(s[body:], ':')
+		if sep < 0 {
+			return t, 0, true, fmt.Errorf("${replace:...} needs SRC:/regex/replacement/")
+		}
+		t.source = s[body : body+sep]
+		if err := checkTransformSource(t.source); err != nil {
+			return t, 0, true, err
+		}
+		p := body + sep + 1
+		if p >= len(s) || s[p] != '/' {
+			return t, 0, true, fmt.Errorf("${replace:...} needs SRC:/regex/replacement/")
+		}
+		pattern, p, found := readDelimited(s, p+1)
+		if !found {
+			return t, 0, true, fmt.Errorf("unterminated regex in ${replace:...}")
+		}
+		t.repl, p, found = readDelimited(s, p)
+		if !found {
+			return t, 0, true, fmt.Errorf("unterminated replacement in ${replace:...}")
+		}
+		if p >= len(s) || s[p] != '}' {
+			return t, 0, true, fmt.Errorf("expected } after ${replace:...} replacement")
+		}
+		t.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return t, 0, true, fmt.Errorf("${replace:...}: %w", err)
+		}
+		return t, p + 1, true, nil
+
+	case "turn":
+		end := strings.IndexByte(s[body:], '}')
+		if end < 0 {
+			return t, 0, true, fmt.Errorf("unterminated ${turn:...}")
+		}
+		t.turn, err = strconv.Atoi(s[body : body+end])
+		if err != nil {
+			return t, 0, true, fmt.Errorf("${turn:...} needs an integer, got %q", s[body:body+end])
+		}
+		return t, body + end + 1, true, nil
+
+	default: // upper, lower, trim
+		end := strings.IndexByte(s[body:], '}')
+		if end < 0 {
+			return t, 0, true, fmt.Errorf("unterminated ${%s:...}", t.name)
+		}
+		t.source = s[body : body+end]
+		if err := checkTransformSource(t.source); err != nil {
+			return t, 0, true, err
+		}
+		return t, body + end + 1, true, nil
+	}
+}
+
+// checkTransformSource validates a transform's SRC argument.
+func checkTransformSource(src string) error {
+	if src == "input" || (len(src) == 2 && src[0] == '$' && src[1] >= '1' && src[1] <= '9') {
+		return nil
+	}
+	return fmt.Errorf("transform source %q must be $1-$9 or input", src)
+}
+
+// closingBrace returns the index of the } that closes a ${ opened before
+// start, skipping balanced braces (such as regex repetition counts) and
+// backslash-escaped characters. It returns -1 if there is none.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// readDelimited reads from s[start:] up to the next unescaped '/', turning
+// "\/" into "/". It returns the text and the index just past the '/'.
+func readDelimited(s string, start int) (string, int, bool) {
+	var b strings.Builder
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '/':
+			b.WriteByte('/')
+			i++
+		case s[i] == '/':
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
+
+// apply evaluates the transform against a rule match and the
+// conversation it came from.
+func (t templateTransform) apply(matches []string, input string, history []InternalMessage) string {
+	if t.name == "turn" {
+		return userTurn(history, t.turn)
+	}
+	if t.name == "match" {
+		m := t.re.FindStringSubmatch(input)
+		switch {
+		case m == nil:
+			return ""
+		case len(m) > 1:
+			return m[1]
+		default:
+			return m[0]
+		}
+	}
+
+	src := input
+	if t.source != "input" {
+		src = ""
+		if idx := int(t.source[1] - '0'); idx < len(matches) {
+			src = matches[idx]
+		}
+	}
+	switch t.name {
+	case "replace":
+		return t.re.ReplaceAllString(src, t.repl)
+	case "upper":
+		return strings.ToUpper(src)
+	case "lower":
+		return strings.ToLower(src)
+	default: // trim
+		return strings.TrimSpace(src)
+	}
+}
+
+// userTurn returns the content of user message n of history, counting
+// from 0, or back from the latest if n is negative. It returns "" if there
+// is no such message.
+func userTurn(history []InternalMessage, n int) string {
+	var turns []string
+	for _, m := range history {
+		if m.Role == "user" {
+			turns = append(turns, m.Content)
+		}
+	}
+	if n < 0 {
+		n += len(turns)
+	}
+	if n < 0 || n >= len(turns) {
+		return ""
+	}
+	return turns[n]
+}
+
+// validateTemplate reports the first malformed transform in a response
+// template, so bad rules fail when they are loaded rather than per request.
+func validateTemplate(template string) error {
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			continue
+		}
+		_, n, ok, err := parseTransform(template[i:])
+		if err != nil {
+			return err
+		}
+		if ok {
+			i += n - 1
+		}
+	}
+	return nil
+}
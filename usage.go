@@ -0,0 +1,122 @@
+package llmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// anonymousKey is the usage key for requests that carry no API key.
+const anonymousKey = "anonymous"
+
+// keyUsage holds the running totals for one API key.
+type keyUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// usageState accounts requests and tokens per API key, and enforces the
+// optional per-key request quota.
+type usageState struct {
+	mu    sync.Mutex
+	keys  map[string]*keyUsage
+	quota int // max requests per key; 0 means unlimited
+}
+
+func newUsageState(quota int) *usageState {
+	return &usageState{keys: make(map[string]*keyUsage), quota: quota}
+}
+
+// WithAPIKeyQuota limits each API key to maxRequests LLM requests. Further
+// requests with that key get a 429 until the usage is reset via
+// /_mock/reset.
+func WithAPIKeyQuota(maxRequests int) Option {
+	return func(s *Server) {
+		s.apiKeyQuota = maxRequests
+	}
+}
+
+// apiKeyFromRequest returns the API key a request was made with, taken
+// from the Authorization bearer token, x-api-key (Anthropic), or
+// x-goog-api-key / ?key= (Gemini).
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	for _, h := range []string{"X-Api-Key", "X-Goog-Api-Key"} {
+		if v := r.Header.Get(h); v != "" {
+			return v
+		}
+	}
+	if v := r.URL.Query().Get("key"); v != "" {
+		return v
+	}
+	return anonymousKey
+}
+
+// addRequest counts a request against key. It returns false, without
+// counting, if the key has used up its quota.
+func (u *usageState) addRequest(key string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ku := u.keys[key]
+	if ku == nil {
+		ku = &keyUsage{}
+		u.keys[key] = ku
+	}
+	if u.quota > 0 && ku.Requests >= u.quota {
+		return false
+	}
+	ku.Requests++
+	return true
+}
+
+// addTokens adds token counts for a completed request to key's totals.
+func (u *usageState) addTokens(key string, prompt, completion int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ku := u.keys[key]
+	if ku == nil {
+		ku = &keyUsage{}
+		u.keys[key] = ku
+	}
+	ku.PromptTokens += prompt
+	ku.CompletionTokens += completion
+}
+
+// snapshot returns a copy of the per-key totals.
+func (u *usageState) snapshot() map[string]keyUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make(map[string]keyUsage, len(u.keys))
+	for k, v := range u.keys {
+		out[k] = *v
+	}
+	return out
+}
+
+func (u *usageState) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.keys = make(map[string]*keyUsage)
+}
+
+// recordUsage adds the tokens of a completed LLM request to the usage of
+// the request's API key.
+func (s *Server) recordUsage(r *http.Request, messages []InternalMessage, responseText string) {
+	prompt := 0
+	for _, m := range messages {
+		prompt += countTokens(m.Content)
+	}
+	s.usage.addTokens(apiKeyFromRequest(r), prompt, countTokens(responseText))
+}
+
+// registerUsageRoutes adds the /_mock/usage endpoint to the mux.
+func registerUsageRoutes(mux *http.ServeMux, u *usageState) {
+	mux.HandleFunc("GET /_mock/usage", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"usage": u.snapshot()})
+	})
+}
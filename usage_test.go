@@ -0,0 +1,104 @@
+package llmock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shishberg/llmock"
+)
+
+type keyUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func getUsage(t *testing.T, ts *httptest.Server) map[string]keyUsage {
+	t.Helper()
+	resp, err := http.Get(ts.URL + "/_mock/usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Usage map[string]keyUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Usage
+}
+
+func TestUsage_PerKeyAccounting(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	send := func(path, header, key, body string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL+path, strings.NewReader(body))
+		req.Header.Set(header, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+	openai := `{"model":"gpt-4","messages":[{"role":"user","content":"one two three"}]}`
+	anthropic := `{"model":"claude-3","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`
+	send("/v1/chat/completions", "Authorization", "Bearer sk-alice", openai)
+	send("/v1/chat/completions", "Authorization", "Bearer sk-alice", openai)
+	send("/v1/messages", "x-api-key", "sk-bob", anthropic)
+
+	usage := getUsage(t, ts)
+	alice, bob := usage["sk-alice"], usage["sk-bob"]
+	if alice.Requests != 2 || bob.Requests != 1 {
+		t.Errorf("expected 2 and 1 requests, got %d and %d", alice.Requests, bob.Requests)
+	}
+	if alice.PromptTokens <= bob.PromptTokens || alice.CompletionTokens == 0 {
+		t.Errorf("expected independent token totals, got alice=%+v bob=%+v", alice, bob)
+	}
+
+	resp, err := http.Post(ts.URL+"/_mock/reset", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if usage := getUsage(t, ts); len(usage) != 0 {
+		t.Errorf("expected usage cleared by reset, got %v", usage)
+	}
+}
+
+func TestUsage_Quota(t *testing.T) {
+	s := llmock.New(llmock.WithAPIKeyQuota(1))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	send := func(key string) int {
+		t.Helper()
+		body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+		req, _ := http.NewRequest("POST", ts.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := send("sk-a"); code != http.StatusOK {
+		t.Fatalf("expected first request to succeed, got %d", code)
+	}
+	if code := send("sk-a"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the quota is used, got %d", code)
+	}
+	if code := send("sk-b"); code != http.StatusOK {
+		t.Errorf("expected another key to have its own quota, got %d", code)
+	}
+}